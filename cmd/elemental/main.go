@@ -34,6 +34,7 @@ func main() {
 		cmd.Setup,
 		cmd.NewBuildCommand(appName, action.Build),
 		cmd.NewCustomizeCommand(appName, action.Customize),
+		cmd.NewCacheCommand(appName, action.CacheList, action.CachePrune),
 		cmd.NewVersionCommand(appName))
 
 	if err := application.Run(os.Args); err != nil {
@@ -34,6 +34,12 @@ func main() {
 		cmd.Setup,
 		cmd.NewInstallCommand(appName, action.Install),
 		cmd.NewUpgradeCommand(appName, action.Upgrade),
+		cmd.NewRollbackCommand(appName, action.Rollback),
+		cmd.NewStatusCommand(appName, action.Status),
+		cmd.NewDiffCommand(appName, action.Diff),
+		cmd.NewSnapshotCommand(appName, action.SnapshotPin, action.SnapshotUnpin),
+		cmd.NewResetCommand(appName, action.Reset),
+		cmd.NewHealthCheckCommand(appName, action.HealthCheck),
 		cmd.NewUnpackImageCommand(appName, action.Unpack),
 		cmd.NewBuildISOCommand(appName, action.BuildInstaller),
 		cmd.NewVersionCommand(appName))
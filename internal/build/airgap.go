@@ -0,0 +1,280 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	containerregistry "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"go.yaml.in/yaml/v3"
+
+	"github.com/suse/elemental/v3/internal/image"
+	"github.com/suse/elemental/v3/pkg/helm"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/manifest/resolver"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+	"github.com/suse/elemental/v3/pkg/unpack"
+)
+
+const (
+	// rke2ImagesPath is the directory rke2 imports the container image tarballs from on start
+	rke2ImagesPath     = "/var/lib/rancher/rke2/agent/images"
+	airgapImagesFile   = "elemental-airgap-images.tar"
+	helmChartMediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	ociScheme          = "oci://"
+)
+
+// helmRepositoryIndex is the subset of a Helm repository index.yaml required to locate chart archives
+type helmRepositoryIndex struct {
+	Entries map[string][]helmRepositoryEntry `yaml:"entries"`
+}
+
+type helmRepositoryEntry struct {
+	Version string   `yaml:"version"`
+	URLs    []string `yaml:"urls"`
+}
+
+// configureAirgap embeds the chart archives within the given Helm chart resources and stores the
+// container images of the enabled Helm charts and systemd extensions in a tarball imported by rke2
+func (b *Builder) configureAirgap(
+	ctx context.Context,
+	def *image.Definition,
+	manifest *resolver.ResolvedManifest,
+	buildDir image.BuildDir,
+	helmCharts []string,
+) error {
+	indexes := map[string]*helmRepositoryIndex{}
+	for _, chart := range helmCharts {
+		if err := b.embedHelmChart(ctx, filepath.Join(buildDir.OverlaysDir(), chart), buildDir, indexes); err != nil {
+			return fmt.Errorf("embedding helm chart '%s': %w", filepath.Base(chart), err)
+		}
+	}
+
+	images, err := airgapImages(def, manifest, b.System.Logger())
+	if err != nil {
+		return fmt.Errorf("collecting container images: %w", err)
+	}
+	if len(images) == 0 {
+		return nil
+	}
+
+	imagesDir := filepath.Join(buildDir.OverlaysDir(), rke2ImagesPath)
+	if err = vfs.MkdirAll(b.System.FS(), imagesDir, vfs.DirPerm); err != nil {
+		return fmt.Errorf("creating images directory: %w", err)
+	}
+
+	if err = b.writeImagesTarball(ctx, def, images, filepath.Join(imagesDir, airgapImagesFile)); err != nil {
+		return fmt.Errorf("writing container images tarball: %w", err)
+	}
+	return nil
+}
+
+// airgapImages returns the sorted container images of the enabled Helm charts and systemd extensions.
+// It warns if the Kubernetes extension lists no images, as the cluster can't start without network access.
+func airgapImages(def *image.Definition, manifest *resolver.ResolvedManifest, logger log.Logger) ([]string, error) {
+	var images []string
+
+	charts, _, err := enabledHelmCharts(manifest, def.Release.Components.HelmCharts, nil)
+	if err != nil {
+		return nil, fmt.Errorf("filtering enabled helm charts: %w", err)
+	}
+	for _, chart := range charts {
+		for _, img := range chart.Images {
+			images = append(images, img.Image)
+		}
+	}
+
+	extensions, err := enabledExtensions(manifest, def, logger)
+	if err != nil {
+		return nil, fmt.Errorf("filtering enabled extensions: %w", err)
+	}
+	for _, extension := range extensions {
+		if extension.Name == k8sExtension && len(extension.Images) == 0 {
+			logger.Warn("No container images listed for the '%s' extension, air-gapped nodes will pull them from their registries", k8sExtension)
+		}
+		for _, img := range extension.Images {
+			images = append(images, img.Image)
+		}
+	}
+
+	slices.Sort(images)
+	return slices.Compact(images), nil
+}
+
+// embedHelmChart fetches the chart archive of the Helm chart resource at the given path and embeds it
+func (b *Builder) embedHelmChart(ctx context.Context, path string, buildDir image.BuildDir, indexes map[string]*helmRepositoryIndex) error {
+	fs := b.System.FS()
+
+	data, err := fs.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading helm chart resource: %w", err)
+	}
+
+	crd := &helm.CRD{}
+	if err = yaml.Unmarshal(data, crd); err != nil {
+		return fmt.Errorf("parsing helm chart resource: %w", err)
+	}
+
+	var archive []byte
+	if strings.HasPrefix(crd.Spec.Repo, ociScheme) {
+		archive, err = b.pullOCIHelmChart(ctx, crd)
+	} else {
+		archive, err = b.downloadHelmChart(ctx, crd, buildDir, indexes)
+	}
+	if err != nil {
+		return err
+	}
+
+	b.System.Logger().Info("Embedding Helm chart %s %s", crd.Spec.Chart, crd.Spec.Version)
+	crd.EmbedChart(archive)
+
+	data, err = yaml.Marshal(crd)
+	if err != nil {
+		return fmt.Errorf("marshaling helm chart resource: %w", err)
+	}
+	return fs.WriteFile(path, data, 0o644)
+}
+
+// downloadHelmChart downloads the chart archive of the given resource from its Helm repository
+func (b *Builder) downloadHelmChart(ctx context.Context, crd *helm.CRD, buildDir image.BuildDir, indexes map[string]*helmRepositoryIndex) ([]byte, error) {
+	fs := b.System.FS()
+
+	tempDir, err := vfs.TempDir(fs, string(buildDir), "helm-")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp directory: %w", err)
+	}
+	defer func() {
+		_ = fs.RemoveAll(tempDir)
+	}()
+
+	repository := strings.TrimSuffix(crd.Spec.Repo, "/") + "/"
+	index, ok := indexes[repository]
+	if !ok {
+		indexFile := filepath.Join(tempDir, "index.yaml")
+		if err = b.DownloadFile(ctx, fs, repository+"index.yaml", indexFile); err != nil {
+			return nil, fmt.Errorf("downloading repository index: %w", err)
+		}
+
+		data, err := fs.ReadFile(indexFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading repository index: %w", err)
+		}
+
+		index = &helmRepositoryIndex{}
+		if err = yaml.Unmarshal(data, index); err != nil {
+			return nil, fmt.Errorf("parsing repository index: %w", err)
+		}
+		indexes[repository] = index
+	}
+
+	// Entries are sorted by version, the latest first
+	idx := slices.IndexFunc(index.Entries[crd.Spec.Chart], func(entry helmRepositoryEntry) bool {
+		return (crd.Spec.Version == "" || entry.Version == crd.Spec.Version) && len(entry.URLs) > 0
+	})
+	if idx < 0 {
+		return nil, fmt.Errorf("chart version '%s' not found in repository '%s'", crd.Spec.Version, crd.Spec.Repo)
+	}
+
+	base, err := url.Parse(repository)
+	if err != nil {
+		return nil, fmt.Errorf("parsing repository URL: %w", err)
+	}
+	chartURL, err := base.Parse(index.Entries[crd.Spec.Chart][idx].URLs[0])
+	if err != nil {
+		return nil, fmt.Errorf("parsing chart URL: %w", err)
+	}
+
+	archive := filepath.Join(tempDir, "chart.tgz")
+	if err = b.DownloadFile(ctx, fs, chartURL.String(), archive); err != nil {
+		return nil, fmt.Errorf("downloading chart archive: %w", err)
+	}
+
+	return fs.ReadFile(archive)
+}
+
+// pullOCIHelmChart pulls the chart archive of the given resource from its OCI registry
+func (b *Builder) pullOCIHelmChart(ctx context.Context, crd *helm.CRD) ([]byte, error) {
+	ref := fmt.Sprintf("%s/%s:%s", strings.TrimSuffix(strings.TrimPrefix(crd.Spec.Repo, ociScheme), "/"), crd.Spec.Chart, crd.Spec.Version)
+
+	img, err := unpack.NewOCIUnpacker(
+		b.System, ref, unpack.WithLocalOCI(b.Local), unpack.WithCacheDirOCI(b.CacheDir),
+	).Image(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pulling chart '%s': %w", ref, err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("reading chart layers: %w", err)
+	}
+
+	for _, layer := range layers {
+		mediaType, err := layer.MediaType()
+		if err != nil {
+			return nil, fmt.Errorf("reading chart layer media type: %w", err)
+		}
+		if mediaType != helmChartMediaType {
+			continue
+		}
+
+		reader, err := layer.Compressed()
+		if err != nil {
+			return nil, fmt.Errorf("reading chart layer: %w", err)
+		}
+		defer func() { _ = reader.Close() }()
+		return io.ReadAll(reader)
+	}
+
+	return nil, fmt.Errorf("no chart content found in '%s'", ref)
+}
+
+// writeImagesTarball pulls the given container images for the target platform and writes them into
+// a single tarball at the given path
+func (b *Builder) writeImagesTarball(ctx context.Context, def *image.Definition, images []string, path string) error {
+	refs := map[name.Reference]containerregistry.Image{}
+	for _, img := range images {
+		ref, err := name.ParseReference(img)
+		if err != nil {
+			return fmt.Errorf("parsing image reference '%s': %w", img, err)
+		}
+
+		b.System.Logger().Info("Pulling container image %s", img)
+		opts := []unpack.OCIOpt{unpack.WithLocalOCI(b.Local), unpack.WithCacheDirOCI(b.CacheDir)}
+		if def.Image.Platform != nil {
+			opts = append(opts, unpack.WithPlatformRefOCI(def.Image.Platform.String()))
+		}
+		refs[ref], err = unpack.NewOCIUnpacker(b.System, img, opts...).Image(ctx)
+		if err != nil {
+			return fmt.Errorf("pulling image '%s': %w", img, err)
+		}
+	}
+
+	path, err := b.System.FS().RawPath(path)
+	if err != nil {
+		return err
+	}
+	return tarball.MultiRefWriteToFile(path, refs)
+}
@@ -0,0 +1,200 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/suse/elemental/v3/internal/image"
+	"github.com/suse/elemental/v3/internal/image/kubernetes"
+	"github.com/suse/elemental/v3/internal/image/release"
+	"github.com/suse/elemental/v3/pkg/helm"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/manifest/api"
+	"github.com/suse/elemental/v3/pkg/manifest/api/core"
+	"github.com/suse/elemental/v3/pkg/manifest/resolver"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+const helmRepoIndex = `apiVersion: v1
+entries:
+  rancher:
+    - version: 2.11.2
+      urls:
+        - rancher-2.11.2.tgz
+    - version: 2.11.1
+      urls:
+        - charts/rancher-2.11.1.tgz
+`
+
+var _ = Describe("Air-gapped deployments", func() {
+	var manifest *resolver.ResolvedManifest
+	var def *image.Definition
+	BeforeEach(func() {
+		manifest = &resolver.ResolvedManifest{
+			CorePlatform: &core.ReleaseManifest{
+				Components: core.Components{
+					Systemd: api.Systemd{
+						Extensions: []api.SystemdExtension{
+							{
+								Name:  "rke2",
+								Image: "https://example.com/rke2.raw",
+								Images: []api.ExtensionImage{
+									{Name: "pause", Image: "registry.com/rancher/pause:3.6"},
+									{Name: "coredns", Image: "registry.com/rancher/coredns:1.12"},
+								},
+							},
+						},
+					},
+					Helm: &api.Helm{
+						Charts: []*api.HelmChart{
+							{
+								Chart:  "metallb",
+								Images: []api.HelmChartImage{{Name: "controller", Image: "registry.com/metallb/controller:0.14"}},
+							},
+							{
+								Chart:  "longhorn",
+								Images: []api.HelmChartImage{{Name: "manager", Image: "registry.com/longhorn/manager:1.9"}},
+							},
+						},
+					},
+				},
+			},
+		}
+		def = &image.Definition{
+			Kubernetes: kubernetes.Kubernetes{Airgap: true},
+			Release: release.Release{
+				Components: release.Components{
+					HelmCharts: []release.HelmChart{{Name: "metallb"}},
+				},
+			},
+		}
+	})
+
+	It("Collects the images of the enabled charts and extensions", func() {
+		images, err := airgapImages(def, manifest, log.New(log.WithDiscardAll()))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(images).To(Equal([]string{
+			"registry.com/metallb/controller:0.14",
+			"registry.com/rancher/coredns:1.12",
+			"registry.com/rancher/pause:3.6",
+		}))
+	})
+
+	It("Warns if the Kubernetes extension lists no images", func() {
+		buffer := &bytes.Buffer{}
+		manifest.CorePlatform.Components.Systemd.Extensions[0].Images = nil
+		images, err := airgapImages(def, manifest, log.New(log.WithBuffer(buffer)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(images).To(Equal([]string{"registry.com/metallb/controller:0.14"}))
+		Expect(buffer.String()).To(ContainSubstring("No container images listed for the 'rke2' extension"))
+	})
+
+	Describe("Helm charts", func() {
+		var fs vfs.FS
+		var cleanup func()
+		var system *sys.System
+		var downloads []string
+		var builder *Builder
+		buildDir := image.BuildDir("/_build/build")
+		chartPath := filepath.Join("/", image.HelmPath(), "rancher.yaml")
+
+		writeCRD := func(version string) {
+			crd := helm.NewCRD("cattle-system", "rancher", version, "", "https://releases.rancher.com/server-charts/stable")
+			data, err := yaml.Marshal(crd)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vfs.MkdirAll(fs, filepath.Dir(filepath.Join(buildDir.OverlaysDir(), chartPath)), vfs.DirPerm)).To(Succeed())
+			Expect(fs.WriteFile(filepath.Join(buildDir.OverlaysDir(), chartPath), data, vfs.FilePerm)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			var err error
+			fs, cleanup, err = sysmock.TestFS(map[string]any{"/_build/build": map[string]any{}})
+			Expect(err).NotTo(HaveOccurred())
+			system, err = sys.NewSystem(sys.WithLogger(log.New(log.WithDiscardAll())), sys.WithFS(fs))
+			Expect(err).NotTo(HaveOccurred())
+
+			downloads = []string{}
+			builder = &Builder{
+				System: system,
+				DownloadFile: func(_ context.Context, fs vfs.FS, url, path string) error {
+					downloads = append(downloads, url)
+					if filepath.Base(url) == "index.yaml" {
+						return fs.WriteFile(path, []byte(helmRepoIndex), vfs.FilePerm)
+					}
+					return fs.WriteFile(path, []byte("archive"), vfs.FilePerm)
+				},
+			}
+			// No release charts nor Kubernetes extension enabled, hence no images to pull
+			def.Release.Components.HelmCharts = nil
+		})
+
+		AfterEach(func() {
+			cleanup()
+		})
+
+		It("Embeds the chart archives within the Helm chart resources", func() {
+			writeCRD("2.11.1")
+			Expect(builder.configureAirgap(context.Background(), def, manifest, buildDir, []string{chartPath})).To(Succeed())
+			Expect(downloads).To(Equal([]string{
+				"https://releases.rancher.com/server-charts/stable/index.yaml",
+				"https://releases.rancher.com/server-charts/stable/charts/rancher-2.11.1.tgz",
+			}))
+
+			data, err := fs.ReadFile(filepath.Join(buildDir.OverlaysDir(), chartPath))
+			Expect(err).NotTo(HaveOccurred())
+			crd := &helm.CRD{}
+			Expect(yaml.Unmarshal(data, crd)).To(Succeed())
+			Expect(crd.Spec.Repo).To(BeEmpty())
+			Expect(crd.Spec.ChartContent).To(Equal("YXJjaGl2ZQ=="))
+
+			// There are no images, hence no images tarball is written
+			Expect(vfs.Exists(fs, filepath.Join(buildDir.OverlaysDir(), rke2ImagesPath))).To(BeFalse())
+		})
+
+		It("Fails to embed a missing chart version", func() {
+			writeCRD("1.0.0")
+			err := builder.configureAirgap(context.Background(), def, manifest, buildDir, []string{chartPath})
+			Expect(err).To(MatchError(
+				"embedding helm chart 'rancher.yaml': chart version '1.0.0' not found in repository " +
+					"'https://releases.rancher.com/server-charts/stable'",
+			))
+		})
+
+		It("Fails to download the repository index", func() {
+			writeCRD("2.11.1")
+			builder.DownloadFile = func(context.Context, vfs.FS, string, string) error {
+				return fmt.Errorf("download failed")
+			}
+			err := builder.configureAirgap(context.Background(), def, manifest, buildDir, []string{chartPath})
+			Expect(err).To(MatchError(
+				"embedding helm chart 'rancher.yaml': downloading repository index: download failed",
+			))
+		})
+	})
+})
@@ -48,15 +48,21 @@ type Builder struct {
 	Helm         helmConfigurator
 	DownloadFile downloadFunc
 	Local        bool
+	// Rootless populates the disk image offline, without loop devices, mounts nor chroots
+	Rootless bool
+	// CacheDir is the directory of a persistent cache for the remote OCI images
+	CacheDir string
 }
 
+const defaultDiskSize imginstall.DiskSize = "10G"
+
 func (b *Builder) Run(ctx context.Context, d *image.Definition, buildDir image.BuildDir) error {
 	logger := b.System.Logger()
 	runner := b.System.Runner()
 	fs := b.System.FS()
 
 	logger.Info("Resolving release manifest: %s", d.Release.ManifestURI)
-	m, err := resolveManifest(fs, d.Release.ManifestURI, buildDir, b.Local)
+	m, err := resolveManifest(fs, d.Release.ManifestURI, buildDir, b.Local, b.CacheDir)
 	if err != nil {
 		logger.Error("Resolving release manifest failed")
 		return err
@@ -83,11 +89,44 @@ func (b *Builder) Run(ctx context.Context, d *image.Definition, buildDir image.B
 		}
 	}
 
-	if err = b.downloadSystemExtensions(ctx, d, m, buildDir); err != nil {
+	extensions, err := b.downloadSystemExtensions(ctx, d, m, buildDir)
+	if err != nil {
 		logger.Error("Downloading system extensions failed")
 		return err
 	}
 
+	err = vfs.MkdirAll(b.System.FS(), buildDir.OverlaysDir(), vfs.DirPerm)
+	if err != nil {
+		logger.Error("Failed creating overlay dir")
+		return err
+	}
+
+	logger.Info("Preparing installation setup")
+	dep, err := newDeployment(b.System, d, m.CorePlatform.Components.OperatingSystem.Image, buildDir, preparePart)
+	if err != nil {
+		logger.Error("Preparing installation setup failed")
+		return err
+	}
+	dep.Release = &deployment.ReleaseInfo{
+		ManifestURI: d.Release.ManifestURI,
+		Version:     releaseVersion(m),
+		Extensions:  extensions,
+	}
+
+	if d.Image.ImageType == image.TypeISO {
+		return b.buildInstaller(ctx, d, dep, buildDir)
+	}
+
+	if b.Rootless {
+		logger.Info("Installing OS into RAW disk image")
+		if err = b.installImage(ctx, d, dep); err != nil {
+			logger.Error("Installation failed")
+			return err
+		}
+		logger.Info("Installation complete")
+		return nil
+	}
+
 	logger.Info("Creating RAW disk image")
 	if err = createDisk(runner, d.Image, d.Installation.DiskSize); err != nil {
 		logger.Error("Creating RAW disk image failed")
@@ -105,29 +144,9 @@ func (b *Builder) Run(ctx context.Context, d *image.Definition, buildDir image.B
 			logger.Error("Detaching loop device failed: %v", dErr)
 		}
 	}()
+	dep.Disks[0].Device = device
 
-	err = vfs.MkdirAll(b.System.FS(), buildDir.OverlaysDir(), vfs.DirPerm)
-	if err != nil {
-		logger.Error("Failed creating overlay dir")
-		return err
-	}
-
-	logger.Info("Preparing installation setup")
-	dep, err := newDeployment(
-		b.System,
-		device,
-		d.Installation.Bootloader,
-		d.Installation.KernelCmdLine,
-		m.CorePlatform.Components.OperatingSystem.Image,
-		buildDir,
-		preparePart,
-	)
-	if err != nil {
-		logger.Error("Preparing installation setup failed")
-		return err
-	}
-
-	boot, err := bootloader.New(dep.BootConfig.Bootloader, b.System)
+	boot, err := newBootloader(b.System, dep)
 	if err != nil {
 		logger.Error("Parsing boot config failed")
 		return err
@@ -139,7 +158,7 @@ func (b *Builder) Run(ctx context.Context, d *image.Definition, buildDir image.B
 	)
 	installer := install.New(
 		ctx, b.System, install.WithUpgrader(upgrader),
-		install.WithUnpackOpts(unpack.WithLocal(b.Local)),
+		install.WithUnpackOpts(b.unpackOpts()...),
 	)
 
 	logger.Info("Installing OS")
@@ -153,26 +172,95 @@ func (b *Builder) Run(ctx context.Context, d *image.Definition, buildDir image.B
 	return nil
 }
 
-func newDeployment(system *sys.System, installationDevice, bootloader, kernelCmdLine, osImage string, buildDir image.BuildDir, customPartitions ...*deployment.Partition) (*deployment.Deployment, error) {
-	var d *deployment.Deployment
+// installImage installs the given deployment into the RAW disk image of the given definition
+// without root privileges. Partitions are populated offline and the disk image is assembled
+// by systemd-repart.
+func (b *Builder) installImage(ctx context.Context, d *image.Definition, dep *deployment.Deployment) error {
+	diskSize := d.Installation.DiskSize
+	if diskSize == "" {
+		diskSize = defaultDiskSize
+	} else if !diskSize.IsValid() {
+		return fmt.Errorf("invalid disk size definition '%s'", diskSize)
+	}
+
+	boot, err := newBootloader(b.System, dep)
+	if err != nil {
+		return fmt.Errorf("parsing boot config: %w", err)
+	}
+
+	installer := install.New(
+		ctx, b.System, install.WithBootloader(boot),
+		install.WithUnpackOpts(b.unpackOpts()...),
+	)
+	return installer.InstallImage(dep, d.Image.RAWImageName(), diskSize.MiB())
+}
+
+// unpackOpts returns the options to unpack the OS image
+func (b *Builder) unpackOpts() []unpack.Opt {
+	return []unpack.Opt{unpack.WithLocal(b.Local), unpack.WithCacheDir(b.CacheDir)}
+}
+
+func newBootloader(s *sys.System, dep *deployment.Deployment) (bootloader.Bootloader, error) {
+	return bootloader.New(
+		dep.BootConfig.Bootloader, s, bootloader.WithBootAttempts(dep.BootConfig.BootAttempts),
+		bootloader.WithSecureBoot(dep.SecureBoot), bootloader.WithLegacyBIOS(dep.IsBIOSEnabled()),
+	)
+}
+
+// newDeployment creates the deployment of the given image definition. The target device of the
+// disk image is not known at this stage, hence it is left unset. Installer images select the
+// target disk at installation time and include a recovery partition.
+func newDeployment(system *sys.System, def *image.Definition, osImage string, buildDir image.BuildDir, preparePart *deployment.Partition) (*deployment.Deployment, error) {
+	var customPartitions []*deployment.Partition
+	if def.Installation.BIOS {
+		customPartitions = append(customPartitions, &deployment.Partition{
+			Label: deployment.BiosLabel, Role: deployment.BIOS, Size: deployment.BiosSize,
+		})
+	}
+	if swap := def.Installation.Swap; swap != nil && swap.PartitionSize > 0 {
+		customPartitions = append(customPartitions, &deployment.Partition{
+			Label: deployment.SwapLabel, Role: deployment.Swap, Size: swap.PartitionSize,
+		})
+	}
+	if preparePart != nil {
+		customPartitions = append(customPartitions, preparePart)
+	}
+
+	opts := []deployment.Opt{deployment.WithPartitions(1, customPartitions...)}
 	if ok, _ := vfs.Exists(system.FS(), buildDir.FirstbootConfigDir()); ok {
 		configSize, err := vfs.DirSizeMB(system.FS(), buildDir.FirstbootConfigDir())
 		if err != nil {
 			return nil, fmt.Errorf("failed to compute configuration partition size: %w", err)
 		}
-		d = deployment.New(
-			deployment.WithPartitions(1, customPartitions...),
-			deployment.WithConfigPartition(deployment.MiB(configSize)),
-		)
-	} else {
-		d = deployment.New(
-			deployment.WithPartitions(1, customPartitions...),
-		)
+		opts = append(opts, deployment.WithConfigPartition(deployment.MiB(configSize)))
 	}
+	if def.Image.ImageType == image.TypeISO {
+		// Recovery partition size is determined by the installer media build
+		opts = append(opts, deployment.WithRecoveryPartition(0))
+	}
+	d := deployment.New(opts...)
 
-	d.Disks[0].Device = installationDevice
-	d.BootConfig.Bootloader = bootloader
-	d.BootConfig.KernelCmdline = kernelCmdLine
+	if def.Image.ImageType == image.TypeISO {
+		// The self installing ISO installs the system unattended, the keys are not included in the media
+		if def.Installation.SecureBoot != nil {
+			return nil, fmt.Errorf("secure boot signing is not supported by installer ISOs, the keys are not included in the media")
+		}
+		d.Disks[0].Selector = def.Installation.DiskSelector
+		if d.Disks[0].Selector == nil {
+			d.Disks[0].Selector = &deployment.DiskSelector{}
+		}
+	} else {
+		// The RAW image is likely written to a larger disk, grow the system partition on boot
+		d.Disks[0].Partitions[len(d.Disks[0].Partitions)-1].Grow = true
+	}
+	d.BootConfig.Bootloader = def.Installation.Bootloader
+	d.BootConfig.KernelCmdline = def.Installation.KernelCmdLine
+	d.BootConfig.BootAttempts = def.Installation.BootAttempts
+	d.HealthChecks = def.Installation.HealthChecks
+	d.SecureBoot = def.Installation.SecureBoot
+	if swap := def.Installation.Swap; swap != nil {
+		d.Swap = &deployment.SwapConfig{File: swap.File, Zram: swap.Zram}
+	}
 
 	osURI := fmt.Sprintf("%s://%s", deployment.OCI, osImage)
 	osSource, err := deployment.NewSrcFromURI(osURI)
@@ -188,20 +276,20 @@ func newDeployment(system *sys.System, installationDevice, bootloader, kernelCmd
 	}
 	d.OverlayTree = overlaySource
 
-	if err = d.Sanitize(system); err != nil {
+	if err = d.Sanitize(system, deployment.CheckDiskDevice); err != nil {
 		return nil, fmt.Errorf("sanitizing deployment: %w", err)
 	}
 
 	return d, nil
 }
 
-func resolveManifest(fs vfs.FS, manifestURI string, buildDir image.BuildDir, local bool) (*resolver.ResolvedManifest, error) {
+func resolveManifest(fs vfs.FS, manifestURI string, buildDir image.BuildDir, local bool, cacheDir string) (*resolver.ResolvedManifest, error) {
 	manifestsDir := buildDir.ReleaseManifestsDir()
 	if err := vfs.MkdirAll(fs, manifestsDir, 0700); err != nil {
 		return nil, fmt.Errorf("creating release manifest store '%s': %w", manifestsDir, err)
 	}
 
-	extr, err := extractor.New(extractor.WithStore(manifestsDir))
+	extr, err := extractor.New(extractor.WithStore(manifestsDir), extractor.WithCacheDir(cacheDir))
 	if err != nil {
 		return nil, fmt.Errorf("initialising OCI release manifest extractor: %w", err)
 	}
@@ -215,21 +303,32 @@ func resolveManifest(fs vfs.FS, manifestURI string, buildDir image.BuildDir, loc
 	return m, nil
 }
 
-func createDisk(runner sys.Runner, img image.Image, diskSize imginstall.DiskSize) error {
-	const defaultSize = "10G"
+// releaseVersion returns the version of the resolved release, that is the product version
+// if the release extends the core platform or the core platform version otherwise
+func releaseVersion(m *resolver.ResolvedManifest) string {
+	switch {
+	case m.ProductExtension != nil && m.ProductExtension.Metadata != nil:
+		return m.ProductExtension.Metadata.Version
+	case m.CorePlatform != nil && m.CorePlatform.Metadata != nil:
+		return m.CorePlatform.Metadata.Version
+	default:
+		return ""
+	}
+}
 
+func createDisk(runner sys.Runner, img image.Image, diskSize imginstall.DiskSize) error {
 	if diskSize == "" {
-		diskSize = defaultSize
+		diskSize = defaultDiskSize
 	} else if !diskSize.IsValid() {
 		return fmt.Errorf("invalid disk size definition '%s'", diskSize)
 	}
 
-	_, err := runner.Run("truncate", "-s", string(diskSize), img.OutputImageName)
+	_, err := runner.Run("truncate", "-s", string(diskSize), img.RAWImageName())
 	return err
 }
 
 func attachDevice(runner sys.Runner, img image.Image) (string, error) {
-	out, err := runner.Run("losetup", "-f", "--show", img.OutputImageName)
+	out, err := runner.Run("losetup", "-f", "--show", img.RAWImageName())
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+
+	"github.com/suse/elemental/v3/internal/image"
+)
+
+// qemuImgOpts returns the qemu-img convert output options of the given image type
+func qemuImgOpts(imageType string) ([]string, error) {
+	var opts []string
+
+	switch image.FileExtension(imageType) {
+	case image.TypeQCOW2:
+		opts = []string{"-O", "qcow2"}
+		if image.IsCompressed(imageType) {
+			opts = append(opts, "-c")
+		}
+	case image.TypeVMDK:
+		subformat := "monolithicSparse"
+		if image.IsCompressed(imageType) {
+			subformat = "streamOptimized"
+		}
+		opts = []string{"-O", "vmdk", "-o", fmt.Sprintf("subformat=%s", subformat)}
+	case image.TypeVHDX:
+		opts = []string{"-O", "vhdx", "-o", "subformat=dynamic"}
+	default:
+		return nil, fmt.Errorf("image type %q can't be converted from a RAW disk image", imageType)
+	}
+	return opts, nil
+}
+
+// Convert converts the RAW disk image written by Run to the requested image type. The virtual
+// size of the output image matches the RAW disk image size and zeroed regions are not allocated.
+// The RAW disk image is removed unless it is requested to be kept. RAW and ISO images are left as is.
+func (b *Builder) Convert(d *image.Definition) error {
+	logger := b.System.Logger()
+
+	if d.Image.ImageType == image.TypeRAW || d.Image.ImageType == image.TypeISO {
+		return nil
+	}
+
+	opts, err := qemuImgOpts(d.Image.ImageType)
+	if err != nil {
+		return err
+	}
+
+	raw := d.Image.RAWImageName()
+	logger.Info("Converting RAW disk image to %s", d.Image.ImageType)
+
+	args := append([]string{"convert", "-f", "raw", "-S", "4k"}, opts...)
+	args = append(args, raw, d.Image.OutputImageName)
+	out, err := b.System.Runner().Run("qemu-img", args...)
+	if err != nil {
+		return fmt.Errorf("converting disk image to %s: %s: %w", d.Image.ImageType, string(out), err)
+	}
+
+	if d.Image.KeepRAW {
+		logger.Info("Keeping RAW disk image at %s", raw)
+		return nil
+	}
+
+	if err = b.System.FS().Remove(raw); err != nil {
+		return fmt.Errorf("removing RAW disk image: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/internal/image"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+var _ = Describe("Convert", Label("convert"), func() {
+	var b *Builder
+	var runner *sysmock.Runner
+	var fs vfs.FS
+	var cleanup func()
+	var def *image.Definition
+
+	BeforeEach(func() {
+		var err error
+		runner = sysmock.NewRunner()
+		fs, cleanup, err = sysmock.TestFS(map[string]any{"/build/disk.raw": []byte{}})
+		Expect(err).NotTo(HaveOccurred())
+		system, err := sys.NewSystem(
+			sys.WithFS(fs), sys.WithRunner(runner),
+			sys.WithLogger(log.New(log.WithDiscardAll())),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		b = &Builder{System: system}
+		def = &image.Definition{
+			Image: image.Image{ImageType: image.TypeQCOW2Compressed, OutputImageName: "/build/disk.qcow2"},
+		}
+	})
+	AfterEach(func() {
+		cleanup()
+	})
+	It("names the intermediate RAW disk image after the output image", func() {
+		Expect(def.Image.RAWImageName()).To(Equal("/build/disk.raw"))
+		def.Image.OutputImageName = "/build/disk.raw"
+		Expect(def.Image.RAWImageName()).To(Equal("/build/disk.raw.raw"))
+		def.Image.ImageType = image.TypeRAW
+		Expect(def.Image.RAWImageName()).To(Equal("/build/disk.raw"))
+	})
+	It("converts the RAW disk image and removes it", func() {
+		Expect(b.Convert(def)).To(Succeed())
+		Expect(runner.CmdsMatch([][]string{{
+			"qemu-img", "convert", "-f", "raw", "-S", "4k", "-O", "qcow2", "-c",
+			"/build/disk.raw", "/build/disk.qcow2",
+		}})).To(Succeed())
+		Expect(vfs.Exists(fs, "/build/disk.raw")).To(BeFalse())
+	})
+	It("keeps the RAW disk image if requested", func() {
+		def.Image = image.Image{ImageType: image.TypeVMDKCompressed, OutputImageName: "/build/disk.vmdk", KeepRAW: true}
+		Expect(b.Convert(def)).To(Succeed())
+		Expect(runner.CmdsMatch([][]string{{
+			"qemu-img", "convert", "-f", "raw", "-S", "4k", "-O", "vmdk", "-o", "subformat=streamOptimized",
+			"/build/disk.raw", "/build/disk.vmdk",
+		}})).To(Succeed())
+		Expect(vfs.Exists(fs, "/build/disk.raw")).To(BeTrue())
+	})
+	It("does nothing for RAW images", func() {
+		def.Image.ImageType = image.TypeRAW
+		Expect(b.Convert(def)).To(Succeed())
+		Expect(runner.GetCmds()).To(BeEmpty())
+	})
+	It("fails if qemu-img fails", func() {
+		def.Image.ImageType = image.TypeVHDX
+		runner.ReturnError = fmt.Errorf("qemu-img failed")
+		Expect(b.Convert(def)).To(MatchError(ContainSubstring("converting disk image to vhdx")))
+		Expect(vfs.Exists(fs, "/build/disk.raw")).To(BeTrue())
+	})
+})
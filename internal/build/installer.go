@@ -0,0 +1,99 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/suse/elemental/v3/internal/image"
+	"github.com/suse/elemental/v3/internal/template"
+	"github.com/suse/elemental/v3/pkg/bootloader"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/installer"
+)
+
+const liveInstallScriptName = "live-install.sh"
+
+//go:embed templates/live-install.sh.tpl
+var liveInstallScriptTpl string
+
+// buildInstaller builds a self installing ISO of the given deployment. The overlay tree of the
+// deployment, including the system extensions and the firstboot configuration, is embedded in the
+// ISO together with the install description and applied at installation time.
+func (b *Builder) buildInstaller(ctx context.Context, def *image.Definition, d *deployment.Deployment, buildDir image.BuildDir) error {
+	logger := b.System.Logger()
+
+	script, err := writeLiveInstallScript(b, buildDir)
+	if err != nil {
+		logger.Error("Writing live installer script failed")
+		return err
+	}
+	d.Installer.CfgScript = script
+
+	boot, err := bootloader.New(
+		d.BootConfig.Bootloader, b.System, bootloader.WithSecureBoot(d.SecureBoot),
+		bootloader.WithLegacyBIOS(d.IsBIOSEnabled()),
+	)
+	if err != nil {
+		logger.Error("Parsing boot config failed")
+		return err
+	}
+
+	media := installer.NewISO(
+		ctx, b.System, installer.WithBootloader(boot),
+		installer.WithUnpackOpts(b.unpackOpts()...),
+	)
+	media.OutputDir = filepath.Dir(def.Image.OutputImageName)
+	media.Name = strings.TrimSuffix(filepath.Base(def.Image.OutputImageName), "."+image.TypeISO)
+
+	logger.Info("Building installer ISO")
+	if err = media.Build(d); err != nil {
+		logger.Error("Building installer ISO failed")
+		return fmt.Errorf("building installer media: %w", err)
+	}
+
+	logger.Info("Installer ISO build complete")
+	return nil
+}
+
+// writeLiveInstallScript writes the configuration script of the live installer which loads the
+// system extensions of the ISO and runs the installation at boot
+func writeLiveInstallScript(b *Builder, buildDir image.BuildDir) (string, error) {
+	values := struct {
+		ExtensionsDir string
+		InstallDesc   string
+	}{
+		ExtensionsDir: filepath.Join(installer.OverlayPath, image.ExtensionsPath()),
+		InstallDesc:   installer.InstallDesc,
+	}
+
+	data, err := template.Parse(liveInstallScriptName, liveInstallScriptTpl, &values)
+	if err != nil {
+		return "", fmt.Errorf("parsing live installer script template: %w", err)
+	}
+
+	path := filepath.Join(string(buildDir), liveInstallScriptName)
+	if err = b.System.FS().WriteFile(path, []byte(data), 0o744); err != nil {
+		return "", fmt.Errorf("writing live installer script: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/internal/image"
+	"github.com/suse/elemental/v3/internal/image/install"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+var _ = Describe("Installer", Label("installer"), func() {
+	var system *sys.System
+	var fs vfs.FS
+	var cleanup func()
+	var def *image.Definition
+
+	BeforeEach(func() {
+		var err error
+		fs, cleanup, err = sysmock.TestFS(map[string]any{"/build/.keep": []byte{}})
+		Expect(err).NotTo(HaveOccurred())
+		system, err = sys.NewSystem(
+			sys.WithFS(fs), sys.WithRunner(sysmock.NewRunner()),
+			sys.WithLogger(log.New(log.WithDiscardAll())),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		def = &image.Definition{
+			Image:        image.Image{ImageType: image.TypeISO, OutputImageName: "/build/installer.iso"},
+			Installation: install.Installation{Bootloader: "grub"},
+		}
+	})
+	AfterEach(func() {
+		cleanup()
+	})
+	It("defines an installer deployment with a recovery partition and a disk selector", func() {
+		d, err := newDeployment(system, def, "registry.org/my/os:latest", "/build", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.GetRecoveryPartition()).NotTo(BeNil())
+		Expect(d.Disks[0].Selector).To(Equal(&deployment.DiskSelector{}))
+		for _, part := range d.Disks[0].Partitions {
+			Expect(part.Grow).To(BeFalse())
+		}
+	})
+	It("uses the disk selector of the installation", func() {
+		def.Installation.DiskSelector = &deployment.DiskSelector{Transport: "nvme"}
+		d, err := newDeployment(system, def, "registry.org/my/os:latest", "/build", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.Disks[0].Selector.Transport).To(Equal("nvme"))
+	})
+	It("refuses to sign installer ISOs with Secure Boot keys", func() {
+		def.Installation.SecureBoot = &deployment.SecureBoot{Key: "/keys/db.key", Cert: "/keys/db.crt"}
+		_, err := newDeployment(system, def, "registry.org/my/os:latest", "/build", nil)
+		Expect(err).To(MatchError(ContainSubstring("secure boot signing is not supported by installer ISOs")))
+	})
+	It("grows the system partition of disk images", func() {
+		def.Image.ImageType = image.TypeRAW
+		d, err := newDeployment(system, def, "registry.org/my/os:latest", "/build", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(d.GetRecoveryPartition()).To(BeNil())
+		Expect(d.Disks[0].Selector).To(BeNil())
+		Expect(d.GetSystemPartition().Grow).To(BeTrue())
+	})
+	It("writes the live installer script", func() {
+		path, err := writeLiveInstallScript(&Builder{System: system}, "/build")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(path).To(Equal("/build/live-install.sh"))
+
+		data, err := fs.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("ln -s /run/initramfs/live/Install/Overlay/var/lib/extensions /run/extensions"))
+		Expect(string(data)).To(ContainSubstring("ConditionPathExists=/run/initramfs/live/Install/install.yaml"))
+	})
+})
@@ -76,6 +76,14 @@ func (b *Builder) configureKubernetes(
 		}
 	}
 
+	if def.Kubernetes.Airgap {
+		b.System.Logger().Info("Embedding Helm charts and container images for air-gapped deployments")
+
+		if err = b.configureAirgap(ctx, def, manifest, buildDir, runtimeHelmCharts); err != nil {
+			return "", "", fmt.Errorf("configuring air-gapped deployment: %w", err)
+		}
+	}
+
 	var runtimeManifestsDir string
 	if needsManifestsSetup(def) {
 		b.System.Logger().Info("Configuring Kubernetes manifests")
@@ -0,0 +1,328 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/suse/elemental/v3/internal/image"
+	"github.com/suse/elemental/v3/internal/image/release"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/helm"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/manifest/api"
+	"github.com/suse/elemental/v3/pkg/manifest/resolver"
+	"github.com/suse/elemental/v3/pkg/snapper"
+	"github.com/suse/elemental/v3/pkg/sys"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+// ReleaseUpgrade describes the content of a release manifest a deployed system is upgraded to
+type ReleaseUpgrade struct {
+	// OSImage is the operating system image of the release
+	OSImage string
+	// Overlay is the directory holding the refreshed systemd extensions and Helm chart resources
+	Overlay string
+	// Release is the release information to record in the upgraded deployment
+	Release *deployment.ReleaseInfo
+}
+
+// PrepareReleaseUpgrade resolves the given release manifest and stages the systemd extensions and Helm
+// chart resources of the release within the overlays directory of the build directory. Only the required
+// extensions, the extensions of the current release and the Helm charts already deployed at rootDir are
+// refreshed. Helm charts not included in the release manifest are left untouched.
+func (b *Builder) PrepareReleaseUpgrade(ctx context.Context, manifestURI string, current *deployment.ReleaseInfo, rootDir string, buildDir image.BuildDir) (*ReleaseUpgrade, error) {
+	m, crds, extensions, err := b.resolveReleaseUpgrade(manifestURI, current, rootDir, buildDir)
+	if err != nil {
+		return nil, err
+	}
+
+	overlay := buildDir.OverlaysDir()
+	if len(crds) > 0 {
+		h := &Helm{FS: b.System.FS(), RelativePath: image.HelmPath(), DestinationDir: overlay, Logger: b.System.Logger()}
+		if _, err = h.writeHelmCharts(crds); err != nil {
+			return nil, fmt.Errorf("writing helm chart resources: %w", err)
+		}
+	}
+
+	var installed []deployment.ExtensionInfo
+	if len(extensions) > 0 {
+		installed, err = b.pullExtensions(ctx, extensions, filepath.Join(overlay, image.ExtensionsPath()))
+		if err != nil {
+			return nil, fmt.Errorf("pulling systemd extensions: %w", err)
+		}
+	}
+
+	return &ReleaseUpgrade{
+		OSImage: m.CorePlatform.Components.OperatingSystem.Image,
+		Overlay: overlay,
+		Release: &deployment.ReleaseInfo{
+			ManifestURI: manifestURI,
+			Version:     releaseVersion(m),
+			Extensions:  installed,
+		},
+	}, nil
+}
+
+// PlanReleaseUpgrade resolves the given release manifest as PrepareReleaseUpgrade does, but it neither pulls
+// the systemd extensions nor writes the Helm chart resources. The returned release only lists the names of
+// the extensions to install and there is no overlay.
+func (b *Builder) PlanReleaseUpgrade(manifestURI string, current *deployment.ReleaseInfo, rootDir string, buildDir image.BuildDir) (*ReleaseUpgrade, error) {
+	m, _, extensions, err := b.resolveReleaseUpgrade(manifestURI, current, rootDir, buildDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var planned []deployment.ExtensionInfo
+	for _, ext := range extensions {
+		planned = append(planned, deployment.ExtensionInfo{Name: ext.Name})
+	}
+
+	return &ReleaseUpgrade{
+		OSImage: m.CorePlatform.Components.OperatingSystem.Image,
+		Release: &deployment.ReleaseInfo{
+			ManifestURI: manifestURI,
+			Version:     releaseVersion(m),
+			Extensions:  planned,
+		},
+	}, nil
+}
+
+// resolveReleaseUpgrade resolves the given release manifest and returns it together with the refreshed
+// Helm chart resources and the systemd extensions to install
+func (b *Builder) resolveReleaseUpgrade(manifestURI string, current *deployment.ReleaseInfo, rootDir string, buildDir image.BuildDir) (*resolver.ResolvedManifest, []*helm.CRD, []api.SystemdExtension, error) {
+	fs := b.System.FS()
+	logger := b.System.Logger()
+
+	logger.Info("Resolving release manifest: %s", manifestURI)
+	m, err := resolveManifest(fs, manifestURI, buildDir, b.Local, b.CacheDir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	deployed, err := deployedHelmCharts(fs, filepath.Join(rootDir, image.HelmPath()))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("reading deployed helm charts: %w", err)
+	}
+
+	crds, charts, err := upgradeHelmCharts(m, deployed)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("refreshing helm charts: %w", err)
+	}
+
+	return m, crds, upgradeExtensions(m, current, charts, logger), nil
+}
+
+// SnapshotReleases returns the releases recorded in the deployment files of all the snapshots found
+// at rootDir. Snapshots without a deployment file or without a release are skipped.
+func SnapshotReleases(s *sys.System, rootDir string) ([]*deployment.ReleaseInfo, error) {
+	dir := filepath.Join(rootDir, snapper.SnapshotsPath)
+	if ok, _ := vfs.Exists(s.FS(), dir); !ok {
+		return nil, nil
+	}
+
+	entries, err := s.FS().ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshots directory '%s': %w", dir, err)
+	}
+
+	var releases []*deployment.ReleaseInfo
+	for _, entry := range entries {
+		d, err := deployment.Parse(s, filepath.Join(dir, entry.Name(), "snapshot"))
+		if err != nil {
+			return nil, fmt.Errorf("parsing deployment of snapshot %s: %w", entry.Name(), err)
+		}
+		if d != nil && d.Release != nil {
+			releases = append(releases, d.Release)
+		}
+	}
+
+	return releases, nil
+}
+
+// StaleExtensions returns the extension files of the known releases which are not part of any of the
+// deployed ones. Extension files are shared by all snapshots, hence those of a previous release are only
+// stale once no snapshot deploys that release anymore.
+func StaleExtensions(known, deployed []*deployment.ReleaseInfo) []string {
+	var stale []string
+
+	inUse := map[string]bool{}
+	for _, rel := range deployed {
+		if rel == nil {
+			continue
+		}
+		for _, ext := range rel.Extensions {
+			inUse[ext.File] = true
+		}
+	}
+
+	for _, rel := range known {
+		if rel == nil {
+			continue
+		}
+		for _, ext := range rel.Extensions {
+			path := filepath.Join("/", image.ExtensionsPath(), ext.File)
+			if inUse[ext.File] || slices.Contains(stale, path) {
+				continue
+			}
+			stale = append(stale, path)
+		}
+	}
+
+	return stale
+}
+
+// deployedHelmCharts parses the Helm chart resources found in the given directory
+func deployedHelmCharts(fs vfs.FS, dir string) ([]*helm.CRD, error) {
+	if ok, _ := vfs.Exists(fs, dir); !ok {
+		return nil, nil
+	}
+
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading directory '%s': %w", dir, err)
+	}
+
+	var crds []*helm.CRD
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
+			continue
+		}
+
+		data, err := fs.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading helm chart '%s': %w", entry.Name(), err)
+		}
+
+		crd := &helm.CRD{}
+		if err = yaml.Unmarshal(data, crd); err != nil {
+			return nil, fmt.Errorf("parsing helm chart '%s': %w", entry.Name(), err)
+		}
+		crds = append(crds, crd)
+	}
+
+	return crds, nil
+}
+
+// upgradeHelmCharts sets the chart version and repository of the release manifest to the deployed Helm
+// chart resources which are part of the release. Deployed values are kept. Dependencies introduced by the
+// release are included as new resources. Returns the updated resources and the matching release charts.
+func upgradeHelmCharts(rm *resolver.ResolvedManifest, deployed []*helm.CRD) ([]*helm.CRD, []*api.HelmChart, error) {
+	var enabled []release.HelmChart
+
+	for _, crd := range deployed {
+		if !isReleaseHelmChart(rm, crd.Spec.Chart) {
+			continue
+		}
+		enabled = append(enabled, release.HelmChart{Name: crd.Spec.Chart})
+	}
+
+	if len(enabled) == 0 {
+		return nil, nil, nil
+	}
+
+	charts, repositories, err := enabledHelmCharts(rm, enabled, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("filtering enabled helm charts: %w", err)
+	}
+
+	var crds []*helm.CRD
+	for _, chart := range charts {
+		repository, ok := repositories[chart.GetRepositoryName()]
+		if !ok {
+			return nil, nil, fmt.Errorf("repository not found for chart: %s", chart.GetName())
+		}
+
+		idx := slices.IndexFunc(deployed, func(c *helm.CRD) bool { return c.Spec.Chart == chart.GetName() })
+		if idx >= 0 {
+			crd := deployed[idx]
+			crd.Spec.Version = chart.Version
+			crd.Spec.Repo = repository
+			crds = append(crds, crd)
+			continue
+		}
+
+		var values []byte
+		if len(chart.GetInlineValues()) > 0 {
+			values, err = yaml.Marshal(chart.GetInlineValues())
+			if err != nil {
+				return nil, nil, fmt.Errorf("marshaling values for chart %s: %w", chart.GetName(), err)
+			}
+		}
+		crds = append(crds, chart.ToCRD(values, repository))
+	}
+
+	return crds, charts, nil
+}
+
+func isReleaseHelmChart(rm *resolver.ResolvedManifest, name string) bool {
+	hasChart := func(h *api.Helm) bool {
+		return h != nil && slices.ContainsFunc(h.Charts, func(c *api.HelmChart) bool { return c.Chart == name })
+	}
+
+	if hasChart(rm.CorePlatform.Components.Helm) {
+		return true
+	}
+
+	return rm.ProductExtension != nil && hasChart(rm.ProductExtension.Components.Helm)
+}
+
+// upgradeExtensions returns the systemd extensions of the release manifest to install on upgrade. Those
+// are the required extensions, the extensions of the current release and the dependencies of the given charts.
+func upgradeExtensions(rm *resolver.ResolvedManifest, current *deployment.ReleaseInfo, charts []*api.HelmChart, logger log.Logger) []api.SystemdExtension {
+	var all, enabled []api.SystemdExtension
+
+	all = append(all, rm.CorePlatform.Components.Systemd.Extensions...)
+	if rm.ProductExtension != nil {
+		all = append(all, rm.ProductExtension.Components.Systemd.Extensions...)
+	}
+
+	var installed []string
+	if current != nil {
+		for _, ext := range current.Extensions {
+			installed = append(installed, ext.Name)
+		}
+	}
+
+	isDependency := func(extension string) bool {
+		return slices.ContainsFunc(charts, func(c *api.HelmChart) bool {
+			return slices.Contains(c.ExtensionDependencies(), extension)
+		})
+	}
+
+	for _, ext := range all {
+		if ext.Required || slices.Contains(installed, ext.Name) || isDependency(ext.Name) {
+			enabled = append(enabled, ext)
+		} else {
+			logger.Debug("Extension '%s' not enabled", ext.Name)
+		}
+		installed = slices.DeleteFunc(installed, func(name string) bool { return name == ext.Name })
+	}
+
+	if len(installed) > 0 {
+		logger.Warn("Extension(s) not included in the release manifest: %s", strings.Join(installed, ", "))
+	}
+
+	return enabled
+}
@@ -0,0 +1,242 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/internal/image"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/manifest/api"
+	"github.com/suse/elemental/v3/pkg/manifest/api/core"
+	"github.com/suse/elemental/v3/pkg/manifest/api/product"
+	"github.com/suse/elemental/v3/pkg/manifest/resolver"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+const deployedMetalLB = `apiVersion: helm.cattle.io/v1
+kind: HelmChart
+metadata:
+  name: metallb
+  namespace: kube-system
+spec:
+  chart: metallb
+  version: 302.0.0+up0.14.9
+  repo: https://old.example.com
+  valuesContent: |
+    speaker:
+      enabled: false
+  targetNamespace: metallb-system
+  createNamespace: true
+  backOffLimit: 20
+`
+
+var _ = Describe("Release upgrade", Label("release", "upgrade"), func() {
+	logger := log.New(log.WithDiscardAll())
+
+	var rm *resolver.ResolvedManifest
+
+	BeforeEach(func() {
+		rm = &resolver.ResolvedManifest{
+			CorePlatform: &core.ReleaseManifest{
+				Components: core.Components{
+					Systemd: api.Systemd{
+						Extensions: []api.SystemdExtension{
+							{Name: "elemental3ctl", Image: "https://example.com/elemental3ctl.raw", Required: true},
+							{Name: "rke2", Image: "https://example.com/rke2.raw"},
+						},
+					},
+					Helm: &api.Helm{
+						Charts: []*api.HelmChart{
+							{
+								Chart:      "metallb",
+								Version:    "303.0.0+up0.15.0",
+								Namespace:  "metallb-system",
+								Repository: "suse-core",
+								DependsOn: []api.HelmChartDependency{
+									{Name: "metallb-crd", Type: api.DependencyTypeHelm},
+									{Name: "frr", Type: "sysext"},
+								},
+							},
+							{
+								Chart:      "metallb-crd",
+								Version:    "303.0.0",
+								Repository: "suse-core",
+								Values:     map[string]any{"enabled": true},
+							},
+						},
+						Repositories: []*api.HelmRepository{
+							{Name: "suse-core", URL: "https://charts.example.com"},
+						},
+					},
+				},
+			},
+			ProductExtension: &product.ReleaseManifest{
+				Components: product.Components{
+					Systemd: api.Systemd{
+						Extensions: []api.SystemdExtension{
+							{Name: "frr", Image: "https://example.com/frr.raw"},
+							{Name: "debugging-toolkit", Image: "https://example.com/debugging-toolkit.raw"},
+						},
+					},
+				},
+			},
+		}
+	})
+
+	It("Refreshes deployed Helm charts keeping their values", func() {
+		fs, cleanup, err := sysmock.TestFS(map[string]any{
+			"/helm/metallb.yaml": deployedMetalLB,
+			"/helm/custom.yaml":  "spec:\n  chart: custom\n",
+			"/helm/README":       "not a chart",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer cleanup()
+
+		deployed, err := deployedHelmCharts(fs, "/helm")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deployed).To(HaveLen(2))
+
+		crds, charts, err := upgradeHelmCharts(rm, deployed)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(charts).To(HaveLen(2))
+		Expect(crds).To(HaveLen(2))
+
+		Expect(crds[0].Spec.Chart).To(Equal("metallb-crd"))
+		Expect(crds[0].Spec.Version).To(Equal("303.0.0"))
+		Expect(crds[0].Spec.ValuesContent).To(Equal("enabled: true\n"))
+
+		Expect(crds[1].Spec.Chart).To(Equal("metallb"))
+		Expect(crds[1].Spec.Version).To(Equal("303.0.0+up0.15.0"))
+		Expect(crds[1].Spec.Repo).To(Equal("https://charts.example.com"))
+		Expect(crds[1].Spec.ValuesContent).To(Equal("speaker:\n  enabled: false\n"))
+	})
+
+	It("Ignores a missing Helm charts directory", func() {
+		fs, cleanup, err := sysmock.TestFS(nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer cleanup()
+
+		deployed, err := deployedHelmCharts(fs, "/helm")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deployed).To(BeEmpty())
+	})
+
+	It("Selects required, installed and dependency extensions", func() {
+		current := &deployment.ReleaseInfo{
+			Extensions: []deployment.ExtensionInfo{
+				{Name: "rke2", File: "rke2-1.31.raw"},
+				{Name: "removed", File: "removed.raw"},
+			},
+		}
+		charts := []*api.HelmChart{rm.CorePlatform.Components.Helm.Charts[0]}
+
+		extensions := upgradeExtensions(rm, current, charts, logger)
+		var names []string
+		for _, ext := range extensions {
+			names = append(names, ext.Name)
+		}
+		Expect(names).To(Equal([]string{"elemental3ctl", "rke2", "frr"}))
+	})
+
+	It("Lists extension files not deployed by any snapshot", func() {
+		previous := &deployment.ReleaseInfo{
+			Extensions: []deployment.ExtensionInfo{
+				{Name: "rke2", File: "rke2-1.30.raw"},
+				{Name: "elemental3ctl", File: "elemental3ctl.raw"},
+			},
+		}
+		current := &deployment.ReleaseInfo{
+			Extensions: []deployment.ExtensionInfo{
+				{Name: "rke2", File: "rke2-1.31.raw"},
+				{Name: "elemental3ctl", File: "elemental3ctl.raw"},
+			},
+		}
+		next := &deployment.ReleaseInfo{
+			Extensions: []deployment.ExtensionInfo{
+				{Name: "rke2", File: "rke2-1.32.raw"},
+				{Name: "elemental3ctl", File: "elemental3ctl.raw"},
+			},
+		}
+		known := []*deployment.ReleaseInfo{previous, current}
+
+		// the current snapshot is kept for rollbacks, only the previous one got removed
+		Expect(StaleExtensions(known, []*deployment.ReleaseInfo{current, next})).To(Equal([]string{"/var/lib/extensions/rke2-1.30.raw"}))
+		Expect(StaleExtensions(known, []*deployment.ReleaseInfo{previous, current, next})).To(BeEmpty())
+		Expect(StaleExtensions(nil, []*deployment.ReleaseInfo{next})).To(BeEmpty())
+	})
+
+	It("Reads the releases of all snapshots", func() {
+		fs, cleanup, err := sysmock.TestFS(map[string]any{
+			"/.snapshots/1/snapshot/etc/elemental/deployment.yaml": "release:\n  version: \"1.0\"\n",
+			"/.snapshots/2/snapshot/etc/elemental/deployment.yaml": "sourceOS:\n  uri: oci://registry.example.com/os:1\n",
+			"/.snapshots/3/snapshot/etc/os-release":                "ID=sl-micro\n",
+			"/.snapshots/4/snapshot/etc/elemental/deployment.yaml": "release:\n  version: \"1.1\"\n",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer cleanup()
+
+		s, err := sys.NewSystem(sys.WithFS(fs), sys.WithLogger(logger))
+		Expect(err).NotTo(HaveOccurred())
+
+		releases, err := SnapshotReleases(s, "/")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(releases).To(HaveLen(2))
+		Expect(releases[0].Version).To(Equal("1.0"))
+		Expect(releases[1].Version).To(Equal("1.1"))
+
+		releases, err = SnapshotReleases(s, "/missing")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(releases).To(BeEmpty())
+	})
+
+	It("Plans a release upgrade without pulling any artifact", func() {
+		// the manifest extractor store lives in the host filesystem
+		s, err := sys.NewSystem(sys.WithLogger(logger))
+		Expect(err).NotTo(HaveOccurred())
+		buildDir := image.BuildDir(GinkgoT().TempDir())
+
+		manifest, err := filepath.Abs("../../pkg/manifest/testdata/full_core_release_manifest.yaml")
+		Expect(err).NotTo(HaveOccurred())
+
+		b := &Builder{
+			System: s,
+			DownloadFile: func(_ context.Context, _ vfs.FS, url, _ string) error {
+				return fmt.Errorf("unexpected download of %s", url)
+			},
+		}
+		current := &deployment.ReleaseInfo{
+			Extensions: []deployment.ExtensionInfo{{Name: "rke2", File: "rke2-1.31.raw"}},
+		}
+
+		rel, err := b.PlanReleaseUpgrade("file://"+manifest, current, string(buildDir), buildDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rel.Overlay).To(BeEmpty())
+		Expect(rel.OSImage).NotTo(BeEmpty())
+		Expect(rel.Release.Extensions).To(Equal([]deployment.ExtensionInfo{{Name: "elemental3ctl"}, {Name: "rke2"}}))
+		Expect(vfs.Exists(s.FS(), buildDir.OverlaysDir())).To(BeFalse())
+	})
+})
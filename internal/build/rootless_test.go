@@ -0,0 +1,82 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package build
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/internal/image"
+	"github.com/suse/elemental/v3/internal/image/install"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+var _ = Describe("Rootless build", Label("rootless"), func() {
+	var system *sys.System
+	var runner *sysmock.Runner
+	var fs vfs.FS
+	var cleanup func()
+	var def *image.Definition
+	var b *Builder
+
+	BeforeEach(func() {
+		var err error
+		runner = sysmock.NewRunner()
+		fs, cleanup, err = sysmock.TestFS(map[string]any{"/build/.keep": []byte{}})
+		Expect(err).NotTo(HaveOccurred())
+		system, err = sys.NewSystem(
+			sys.WithFS(fs), sys.WithRunner(runner),
+			sys.WithLogger(log.New(log.WithDiscardAll())),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		def = &image.Definition{
+			Image:        image.Image{ImageType: image.TypeRAW, OutputImageName: "/build/image.raw"},
+			Installation: install.Installation{Bootloader: "grub"},
+		}
+		b = &Builder{System: system, Rootless: true}
+	})
+	AfterEach(func() {
+		cleanup()
+	})
+	It("converts the disk size to MiB", func() {
+		Expect(install.DiskSize("10G").MiB()).To(BeEquivalentTo(10240))
+		Expect(install.DiskSize("1T").MiB()).To(BeEquivalentTo(1024 * 1024))
+		Expect(install.DiskSize("1500K").MiB()).To(BeEquivalentTo(2))
+		Expect(install.DiskSize("10").MiB()).To(BeZero())
+	})
+	It("fails on an invalid disk size", func() {
+		def.Installation.DiskSize = "10X"
+		d, err := newDeployment(system, def, "registry.org/my/os:latest", "/build", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b.installImage(context.Background(), def, d)).To(MatchError("invalid disk size definition '10X'"))
+	})
+	It("does not support legacy BIOS boot", func() {
+		def.Installation.BIOS = true
+		d, err := newDeployment(system, def, "registry.org/my/os:latest", "/build", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b.installImage(context.Background(), def, d)).To(
+			MatchError("offline installation does not support legacy BIOS boot"),
+		)
+		Expect(runner.GetCmds()).To(BeEmpty())
+	})
+})
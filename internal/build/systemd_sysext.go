@@ -27,6 +27,7 @@ import (
 
 	"github.com/suse/elemental/v3/internal/image"
 	"github.com/suse/elemental/v3/internal/image/release"
+	"github.com/suse/elemental/v3/pkg/deployment"
 	"github.com/suse/elemental/v3/pkg/log"
 	"github.com/suse/elemental/v3/pkg/manifest/api"
 	"github.com/suse/elemental/v3/pkg/manifest/resolver"
@@ -35,42 +36,54 @@ import (
 	"github.com/suse/elemental/v3/pkg/unpack"
 )
 
-func (b *Builder) downloadSystemExtensions(ctx context.Context, def *image.Definition, rm *resolver.ResolvedManifest, buildDir image.BuildDir) error {
+func (b *Builder) downloadSystemExtensions(ctx context.Context, def *image.Definition, rm *resolver.ResolvedManifest, buildDir image.BuildDir) ([]deployment.ExtensionInfo, error) {
 	logger := b.System.Logger()
 
 	extensions, err := enabledExtensions(rm, def, logger)
 	if err != nil {
-		return fmt.Errorf("filtering enabled systemd extensions: %w", err)
+		return nil, fmt.Errorf("filtering enabled systemd extensions: %w", err)
 	} else if len(extensions) == 0 {
-		return nil
+		return nil, nil
 	}
 
-	fs := b.System.FS()
 	extensionsDir := filepath.Join(buildDir.OverlaysDir(), image.ExtensionsPath())
 
-	if err = vfs.MkdirAll(fs, extensionsDir, 0o700); err != nil {
-		return fmt.Errorf("creating extensions directory: %w", err)
+	return b.pullExtensions(ctx, extensions, extensionsDir)
+}
+
+// pullExtensions fetches the given systemd extensions into the extensions directory and
+// returns the file name each of them got within that directory
+func (b *Builder) pullExtensions(ctx context.Context, extensions []api.SystemdExtension, extensionsDir string) ([]deployment.ExtensionInfo, error) {
+	logger := b.System.Logger()
+	fs := b.System.FS()
+
+	if err := vfs.MkdirAll(fs, extensionsDir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating extensions directory: %w", err)
 	}
 
+	var installed []deployment.ExtensionInfo
 	for _, extension := range extensions {
 		logger.Info("Pulling extension %s from %s...",
 			extension.Name, extension.Image)
 
 		if isRemoteURL(extension.Image) {
 			extensionPath := filepath.Join(extensionsDir, filepath.Base(extension.Image))
-			if err = b.DownloadFile(ctx, fs, extension.Image, extensionPath); err != nil {
-				return fmt.Errorf("downloading systemd extension %s: %w", extension.Name, err)
+			if err := b.DownloadFile(ctx, fs, extension.Image, extensionPath); err != nil {
+				return nil, fmt.Errorf("downloading systemd extension %s: %w", extension.Name, err)
 			}
 
+			installed = append(installed, deployment.ExtensionInfo{Name: extension.Name, File: filepath.Base(extensionPath)})
 			continue
 		}
 
-		if err = b.unpackExtension(ctx, extension, extensionsDir); err != nil {
-			return fmt.Errorf("unpacking systemd extension %s: %w", extension.Name, err)
+		file, err := b.unpackExtension(ctx, extension, extensionsDir)
+		if err != nil {
+			return nil, fmt.Errorf("unpacking systemd extension %s: %w", extension.Name, err)
 		}
+		installed = append(installed, deployment.ExtensionInfo{Name: extension.Name, File: file})
 	}
 
-	return nil
+	return installed, nil
 }
 
 func isRemoteURL(s string) bool {
@@ -82,25 +95,29 @@ func isRemoteURL(s string) bool {
 	return u.Scheme == "http" || u.Scheme == "https"
 }
 
-func (b *Builder) unpackExtension(ctx context.Context, extension api.SystemdExtension, extensionsDir string) error {
+// unpackExtension unpacks the given OCI extension into the extensions directory and returns the name of
+// the resulting extension image or directory
+func (b *Builder) unpackExtension(ctx context.Context, extension api.SystemdExtension, extensionsDir string) (string, error) {
 	fs := b.System.FS()
 
 	tempDir, err := vfs.TempDir(fs, "", fmt.Sprintf("%s-", extension.Name))
 	if err != nil {
-		return fmt.Errorf("creating temp directory: %w", err)
+		return "", fmt.Errorf("creating temp directory: %w", err)
 	}
 	defer func() {
 		_ = fs.RemoveAll(tempDir)
 	}()
 
-	unpacker := unpack.NewOCIUnpacker(b.System, extension.Image, unpack.WithLocalOCI(b.Local))
+	unpacker := unpack.NewOCIUnpacker(
+		b.System, extension.Image, unpack.WithLocalOCI(b.Local), unpack.WithCacheDirOCI(b.CacheDir),
+	)
 	if _, err = unpacker.Unpack(ctx, tempDir); err != nil {
-		return fmt.Errorf("unpacking extension: %w", err)
+		return "", fmt.Errorf("unpacking extension: %w", err)
 	}
 
 	entries, err := fs.ReadDir(tempDir)
 	if err != nil {
-		return fmt.Errorf("reading unpacked directory: %w", err)
+		return "", fmt.Errorf("reading unpacked directory: %w", err)
 	}
 
 	if len(entries) == 1 {
@@ -108,17 +125,17 @@ func (b *Builder) unpackExtension(ctx context.Context, extension api.SystemdExte
 		if !entry.IsDir() {
 			file := filepath.Join(tempDir, entry.Name())
 			if err = vfs.CopyFile(fs, file, extensionsDir); err != nil {
-				return fmt.Errorf("copying extension file %s: %w", file, err)
+				return "", fmt.Errorf("copying extension file %s: %w", file, err)
 			}
 
-			return nil
+			return entry.Name(), nil
 		}
 	}
 
 	if !slices.ContainsFunc(entries, func(entry iofs.DirEntry) bool {
 		return entry.Name() == "usr" && entry.IsDir()
 	}) {
-		return fmt.Errorf("invalid extension: either a single image file or a /usr directory is required")
+		return "", fmt.Errorf("invalid extension: either a single image file or a /usr directory is required")
 	}
 
 	sync := rsync.NewRsync(b.System, rsync.WithContext(ctx))
@@ -141,10 +158,14 @@ func (b *Builder) unpackExtension(ctx context.Context, extension api.SystemdExte
 	}
 
 	if err = syncDirectory("usr"); err != nil {
-		return err
+		return "", err
+	}
+
+	if err = syncDirectory("opt"); err != nil {
+		return "", err
 	}
 
-	return syncDirectory("opt")
+	return extension.Name, nil
 }
 
 func isExtensionExplicitlyEnabled(name string, def *image.Definition) bool {
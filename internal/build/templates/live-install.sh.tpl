@@ -0,0 +1,26 @@
+#!/bin/bash
+# Generated by Elemental3, installs the system from the live installer at boot
+
+set -e
+
+# Load the system extensions included in the installation overlay tree
+rm -rf /run/extensions
+ln -s {{ .ExtensionsDir }} /run/extensions
+
+cat > /etc/systemd/system/elemental-autoinstall.service << EOF
+[Unit]
+Description=Elemental Autoinstall
+Wants=network-online.target
+After=network-online.target systemd-sysext.service
+ConditionPathExists={{ .InstallDesc }}
+
+[Service]
+Type=oneshot
+ExecStart=/usr/local/bin/elemental3ctl --debug install
+ExecStartPost=/usr/bin/systemctl reboot
+
+[Install]
+WantedBy=multi-user.target
+EOF
+
+systemctl enable elemental-autoinstall.service
@@ -18,6 +18,7 @@ limitations under the License.
 package action
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -36,6 +37,7 @@ import (
 	"github.com/suse/elemental/v3/internal/image"
 	"github.com/suse/elemental/v3/internal/image/kubernetes"
 	"github.com/suse/elemental/v3/internal/image/release"
+	"github.com/suse/elemental/v3/pkg/cache"
 	"github.com/suse/elemental/v3/pkg/helm"
 	"github.com/suse/elemental/v3/pkg/http"
 	"github.com/suse/elemental/v3/pkg/sys"
@@ -83,11 +85,22 @@ func Build(ctx *cli.Context) error {
 		FS:        system.FS(),
 	}
 
+	var download func(ctx context.Context, fs vfs.FS, url, path string) error = http.DownloadFile
+	if args.CacheDir != "" {
+		if err = vfs.MkdirAll(system.FS(), args.CacheDir, vfs.DirPerm); err != nil {
+			logger.Error("Creating cache directory failed")
+			return err
+		}
+		download = cache.New(system, args.CacheDir).Downloader(http.DownloadFile, http.ETag)
+	}
+
 	builder := &build.Builder{
 		System:       system,
 		Helm:         build.NewHelm(system.FS(), valuesResolver, logger, buildDir.OverlaysDir()),
-		DownloadFile: http.DownloadFile,
+		DownloadFile: download,
 		Local:        args.Local,
+		Rootless:     args.Rootless,
+		CacheDir:     args.CacheDir,
 	}
 
 	logger.Info("Starting build process for %s %s image", definition.Image.Platform.String(), definition.Image.ImageType)
@@ -96,6 +109,11 @@ func Build(ctx *cli.Context) error {
 		return err
 	}
 
+	if err = builder.Convert(definition); err != nil {
+		logger.Error("Converting disk image failed")
+		return err
+	}
+
 	logger.Info("Build process complete")
 	return nil
 }
@@ -106,11 +124,14 @@ func validateArgs(fs vfs.FS, args *cmd.BuildFlags) error {
 		return fmt.Errorf("reading config directory: %w", err)
 	}
 
-	validImageTypes := []string{image.TypeRAW}
-	if !slices.Contains(validImageTypes, args.ImageType) {
+	if args.ImageType != image.TypeISO && !slices.Contains(image.DiskImageTypes, args.ImageType) {
 		return fmt.Errorf("image type %q not supported", args.ImageType)
 	}
 
+	if args.Rootless && args.ImageType == image.TypeISO {
+		return fmt.Errorf("rootless builds are not supported for %q images", args.ImageType)
+	}
+
 	if _, err := platform.Parse(args.Platform); err != nil {
 		return fmt.Errorf("malformed platform %q", args.Platform)
 	}
@@ -121,7 +142,7 @@ func validateArgs(fs vfs.FS, args *cmd.BuildFlags) error {
 func parseImageDefinition(f vfs.FS, args *cmd.BuildFlags) (*image.Definition, error) {
 	outputPath := args.OutputPath
 	if outputPath == "" {
-		imageName := fmt.Sprintf("image-%s.%s", time.Now().UTC().Format("2006-01-02T15-04-05"), args.ImageType)
+		imageName := fmt.Sprintf("image-%s.%s", time.Now().UTC().Format("2006-01-02T15-04-05"), image.FileExtension(args.ImageType))
 		outputPath = filepath.Join(args.BuildDir, imageName)
 	}
 
@@ -135,6 +156,7 @@ func parseImageDefinition(f vfs.FS, args *cmd.BuildFlags) (*image.Definition, er
 			ImageType:       args.ImageType,
 			Platform:        p,
 			OutputImageName: outputPath,
+			KeepRAW:         args.KeepRAW,
 		},
 	}
 
@@ -50,16 +50,28 @@ func BuildInstaller(ctx *cli.Context) error { //nolint:dupl
 		stop()
 	}()
 
-	media := installer.NewISO(ctxCancel, s, installer.WithUnpackOpts(unpack.WithLocal(args.Local), unpack.WithVerify(args.Verify)))
-
-	digestInstallerSetup(args, media)
-
 	d, err := digestInstallerDeploymentSetup(s, args)
 	if err != nil {
 		s.Logger().Error("Failed to collect build setup")
 		return err
 	}
 
+	bootloader, err := bootloader.New(
+		d.BootConfig.Bootloader, s, bootloader.WithSecureBoot(d.SecureBoot),
+		bootloader.WithLegacyBIOS(d.IsBIOSEnabled()),
+	)
+	if err != nil {
+		s.Logger().Error("Parsing boot config failed")
+		return err
+	}
+
+	media := installer.NewISO(
+		ctxCancel, s, installer.WithBootloader(bootloader),
+		installer.WithUnpackOpts(unpack.WithLocal(args.Local), unpack.WithVerify(args.Verify)),
+	)
+
+	digestInstallerSetup(args, media)
+
 	s.Logger().Info("Running build process")
 
 	err = media.Build(d)
@@ -101,6 +113,16 @@ func digestInstallerDeploymentSetup(s *sys.System, flags *cmd.InstallerFlags) (*
 		return nil, fmt.Errorf("failed applying install flags to deployment description: %w", err)
 	}
 
+	if flags.ImageFormat != "" {
+		d.Installer.Image.Format, err = deployment.ParseImageFormat(flags.ImageFormat)
+		if err != nil {
+			return nil, fmt.Errorf("invalid installer image format: %w", err)
+		}
+	}
+	if flags.ImageCompression != "" {
+		d.Installer.Image.Compression = flags.ImageCompression
+	}
+
 	err = d.Sanitize(s, deployment.CheckDiskDevice)
 	if err != nil {
 		return nil, fmt.Errorf("inconsistent deployment setup found: %w", err)
@@ -0,0 +1,70 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/suse/elemental/v3/internal/cli/cmd"
+	"github.com/suse/elemental/v3/pkg/cache"
+	"github.com/suse/elemental/v3/pkg/sys"
+)
+
+func CacheList(ctx *cli.Context) error {
+	if ctx.App.Metadata == nil || ctx.App.Metadata["system"] == nil {
+		return fmt.Errorf("error setting up initial configuration")
+	}
+	s := ctx.App.Metadata["system"].(*sys.System)
+
+	entries, err := cache.New(s, cmd.CacheArgs.CacheDir).List()
+	if err != nil {
+		return fmt.Errorf("listing cache entries: %w", err)
+	}
+
+	w := tabwriter.NewWriter(ctx.App.Writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tSOURCE\tDIGEST\tPLATFORM\tSIZE (MiB)\tLAST USED")
+	for _, entry := range entries {
+		fmt.Fprintf(
+			w, "%s\t%s\t%s\t%s\t%.1f\t%s\n", entry.Kind, entry.Source, entry.Digest, entry.Platform,
+			float64(entry.Size)/(1024*1024), entry.LastUsed.Format(time.DateTime),
+		)
+	}
+	return w.Flush()
+}
+
+func CachePrune(ctx *cli.Context) error {
+	if ctx.App.Metadata == nil || ctx.App.Metadata["system"] == nil {
+		return fmt.Errorf("error setting up initial configuration")
+	}
+	s := ctx.App.Metadata["system"].(*sys.System)
+
+	pruned, err := cache.New(s, cmd.CacheArgs.CacheDir).Prune(cmd.CacheArgs.OlderThan)
+	if err != nil {
+		return fmt.Errorf("pruning cache: %w", err)
+	}
+
+	for _, entry := range pruned {
+		s.Logger().Debug("Removed %s %s (%s)", entry.Kind, entry.Source, entry.Digest)
+	}
+	s.Logger().Info("Removed %d cache entries", len(pruned))
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action_test
+
+import (
+	"bytes"
+	"context"
+	"flag"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/suse/elemental/v3/internal/cli/action"
+	"github.com/suse/elemental/v3/internal/cli/cmd"
+	"github.com/suse/elemental/v3/pkg/cache"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+var _ = Describe("Cache actions", Label("cache"), func() {
+	var s *sys.System
+	var tfs vfs.FS
+	var cleanup func()
+	var err error
+	var out *bytes.Buffer
+
+	newContext := func() *cli.Context {
+		set := flag.NewFlagSet("cache", flag.ContinueOnError)
+		ctx := cli.NewContext(cli.NewApp(), set, nil)
+		ctx.App.Metadata = map[string]any{"system": s}
+		ctx.App.Writer = out
+		return ctx
+	}
+
+	BeforeEach(func() {
+		tfs, cleanup, err = sysmock.TestFS(map[string]any{"/tmp": map[string]any{}})
+		Expect(err).NotTo(HaveOccurred())
+		s, err = sys.NewSystem(sys.WithFS(tfs), sys.WithLogger(log.New(log.WithDiscardAll())))
+		Expect(err).NotTo(HaveOccurred())
+		out = &bytes.Buffer{}
+		cmd.CacheArgs = cmd.CacheFlags{CacheDir: "/cache"}
+
+		download := cache.New(s, "/cache").Downloader(
+			func(_ context.Context, fs vfs.FS, _, path string) error {
+				return fs.WriteFile(path, []byte("data"), vfs.FilePerm)
+			},
+			func(context.Context, string) (string, error) { return `"etag"`, nil },
+		)
+		Expect(download(context.Background(), tfs, "https://example.com/ext.raw", "/tmp/ext.raw")).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+	It("lists the cache entries", func() {
+		Expect(action.CacheList(newContext())).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("KIND"))
+		Expect(out.String()).To(ContainSubstring(`download  https://example.com/ext.raw  "etag"`))
+	})
+	It("prunes the cache entries", func() {
+		cmd.CacheArgs.OlderThan = 0
+		Expect(action.CachePrune(newContext())).To(Succeed())
+		Expect(action.CacheList(newContext())).To(Succeed())
+		Expect(out.String()).NotTo(ContainSubstring("https://example.com/ext.raw"))
+	})
+	It("fails without a system", func() {
+		ctx := newContext()
+		ctx.App.Metadata = nil
+		Expect(action.CacheList(ctx)).To(MatchError("error setting up initial configuration"))
+	})
+})
@@ -0,0 +1,173 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/suse/elemental/v3/internal/cli/cmd"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/snapper"
+	"github.com/suse/elemental/v3/pkg/sys"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+// binaryProbeSize is the number of leading bytes checked for NUL characters to detect binary files
+const binaryProbeSize = 8000
+
+func Diff(ctx *cli.Context) error {
+	var s *sys.System
+	args := &cmd.DiffArgs
+	if ctx.App.Metadata == nil || ctx.App.Metadata["system"] == nil {
+		return fmt.Errorf("error setting up initial configuration")
+	}
+	s = ctx.App.Metadata["system"].(*sys.System)
+
+	if args.From < 0 {
+		return fmt.Errorf("invalid snapshot ID: %d", args.From)
+	}
+	if args.To < 0 {
+		return fmt.Errorf("invalid snapshot ID: %d", args.To)
+	}
+
+	d, err := deployment.Parse(s, "/")
+	if err != nil {
+		return fmt.Errorf("parsing deployment: %w", err)
+	} else if d == nil {
+		return fmt.Errorf("deployment not found")
+	}
+
+	if d.Snapshotter != nil && d.Snapshotter.Name != "snapper" {
+		return fmt.Errorf("diffs are only supported by the 'snapper' snapshotter")
+	}
+
+	volume := filepath.Clean(args.Volume)
+	if !isSnapshottedVolume(d, volume) {
+		return fmt.Errorf("'%s' is not a snapshotted RW volume", volume)
+	}
+
+	sn := snapper.New(s)
+	config := snapper.ConfigName(volume)
+
+	from := args.From
+	if from == 0 {
+		from, err = stockSnapshot(sn, config)
+		if err != nil {
+			return err
+		}
+	}
+
+	changes, err := sn.Changes("/", config, from, args.To)
+	if err != nil {
+		return fmt.Errorf("listing changes of '%s': %w", volume, err)
+	}
+
+	return writeDiff(ctx.App.Writer, s, sn, volume, from, args.To, changes)
+}
+
+// isSnapshottedVolume returns true if the given path is a snapshotted RW volume of the deployment
+func isSnapshottedVolume(d *deployment.Deployment, path string) bool {
+	for _, disk := range d.Disks {
+		for _, rwVol := range disk.Partitions.GetSnapshottedVolumes() {
+			if rwVol.Path == path {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stockSnapshot returns the ID of the snapshot holding the OS image content of the volume of the given config
+func stockSnapshot(sn *snapper.Snapper, config string) (int, error) {
+	snaps, err := sn.ListSnapshots("/", config)
+	if err != nil {
+		return 0, fmt.Errorf("listing snapshots: %w", err)
+	}
+	stock := snaps.GetWithUserdata("stock", "true")
+	if len(stock) != 1 {
+		return 0, fmt.Errorf("inconsistent number of stock snapshots for config '%s': %d", config, len(stock))
+	}
+	return stock[0], nil
+}
+
+// writeDiff writes the given changes followed by the unified diff of text files
+func writeDiff(out io.Writer, s *sys.System, sn *snapper.Snapper, volume string, from, to int, changes []snapper.Change) error {
+	target := "current content"
+	if to > 0 {
+		target = fmt.Sprintf("snapshot %d", to)
+	}
+	fmt.Fprintf(out, "Changes of %s from snapshot %d to %s:\n", volume, from, target)
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "  none")
+		return nil
+	}
+
+	for _, change := range changes {
+		fmt.Fprintf(out, "\n%s %s\n", change.Flags, change.Path)
+		if !change.ContentChanged() {
+			continue
+		}
+		if !isTextChange(s.FS(), volume, change, from, to) {
+			fmt.Fprintln(out, "Binary or special file, content not shown")
+			continue
+		}
+		diff, err := sn.Diff("/", snapper.ConfigName(volume), from, to, change.Path)
+		if err != nil {
+			return fmt.Errorf("diffing '%s': %w", change.Path, err)
+		}
+		fmt.Fprint(out, diff)
+	}
+	return nil
+}
+
+// isTextChange returns true if all the existing versions of the changed file in the given
+// snapshots are regular text files
+func isTextChange(fs vfs.FS, volume string, change snapper.Change, ids ...int) bool {
+	for _, id := range ids {
+		path := change.Path
+		if id > 0 {
+			rel := strings.TrimPrefix(change.Path, volume)
+			path = filepath.Join(volume, snapper.SnapshotsPath, strconv.Itoa(id), "snapshot", rel)
+		}
+
+		info, err := fs.Lstat(path)
+		if err != nil {
+			// not present in this snapshot, created or deleted file
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			return false
+		}
+
+		data, err := fs.ReadFile(path)
+		if err != nil {
+			return false
+		}
+		if bytes.IndexByte(data[:min(len(data), binaryProbeSize)], 0) >= 0 {
+			return false
+		}
+	}
+	return true
+}
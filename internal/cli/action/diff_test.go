@@ -0,0 +1,143 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action_test
+
+import (
+	"bytes"
+	"slices"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/suse/elemental/v3/internal/cli/action"
+	"github.com/suse/elemental/v3/internal/cli/cmd"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+const etcSnapList = `{
+  "etc": [
+    {"number": 0, "default": false, "active": false, "userdata": null},
+    {"number": 3, "default": false, "active": false, "userdata": {"stock": "true"}},
+    {"number": 4, "default": false, "active": false, "userdata": {"pre-transaction": "true"}}
+  ]
+}`
+
+const etcStatus = `c..... /etc/hosts
++..... /etc/motd
+c..... /etc/ld.so.cache
+.p.... /etc/shadow
+`
+
+var _ = Describe("Diff action", Label("diff"), func() {
+	var s *sys.System
+	var tfs vfs.FS
+	var cleanup func()
+	var err error
+	var ctx *cli.Context
+	var out *bytes.Buffer
+	var runner *sysmock.Runner
+
+	BeforeEach(func() {
+		cmd.DiffArgs = cmd.DiffFlags{Volume: "/etc"}
+		out = &bytes.Buffer{}
+		tfs, cleanup, err = sysmock.TestFS(map[string]string{
+			"/etc/hosts":                             "127.0.0.1 localhost\n10.0.0.1 server\n",
+			"/etc/.snapshots/3/snapshot/hosts":       "127.0.0.1 localhost\n",
+			"/etc/motd":                              "welcome\n",
+			"/etc/ld.so.cache":                       "cache\x00new",
+			"/etc/.snapshots/3/snapshot/ld.so.cache": "cache\x00old",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		runner = sysmock.NewRunner()
+		runner.SideEffect = func(command string, args ...string) ([]byte, error) {
+			if command != "snapper" {
+				return nil, nil
+			}
+			switch {
+			case slices.Contains(args, "list"):
+				return []byte(etcSnapList), nil
+			case slices.Contains(args, "status"):
+				output := args[slices.Index(args, "--output")+1]
+				return nil, tfs.WriteFile(output, []byte(etcStatus), vfs.FilePerm)
+			case slices.Contains(args, "diff"):
+				return []byte("--- " + args[len(args)-1] + "\n+++ " + args[len(args)-1] + "\n"), nil
+			}
+			return nil, nil
+		}
+		s, err = sys.NewSystem(
+			sys.WithFS(tfs), sys.WithRunner(runner),
+			sys.WithLogger(log.New(log.WithDiscardAll())),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		d := deployment.DefaultDeployment()
+		Expect(d.WriteDeploymentFile(s, "/")).To(Succeed())
+
+		ctx = cli.NewContext(cli.NewApp(), nil, &cli.Context{})
+		ctx.App.Writer = out
+		if ctx.App.Metadata == nil {
+			ctx.App.Metadata = map[string]any{}
+		}
+		ctx.App.Metadata["system"] = s
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+	It("fails if no sys.System instance is in metadata", func() {
+		ctx.App.Metadata["system"] = nil
+		Expect(action.Diff(ctx)).NotTo(Succeed())
+	})
+	It("fails for a negative snapshot ID", func() {
+		cmd.DiffArgs.To = -1
+		Expect(action.Diff(ctx)).To(MatchError("invalid snapshot ID: -1"))
+	})
+	It("fails for a volume which is not snapshotted", func() {
+		cmd.DiffArgs.Volume = "/var/"
+		Expect(action.Diff(ctx)).To(MatchError("'/var' is not a snapshotted RW volume"))
+	})
+	It("compares the stock content with the current content", func() {
+		Expect(action.Diff(ctx)).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("Changes of /etc from snapshot 3 to current content:"))
+		Expect(out.String()).To(ContainSubstring("c..... /etc/hosts\n--- /etc/hosts\n"))
+		Expect(out.String()).To(ContainSubstring("+..... /etc/motd\n--- /etc/motd\n"))
+		Expect(out.String()).To(ContainSubstring("c..... /etc/ld.so.cache\nBinary or special file, content not shown\n"))
+		Expect(out.String()).To(ContainSubstring(".p.... /etc/shadow\n"))
+		Expect(runner.CmdsMatch([][]string{
+			{"snapper", "--no-dbus", "-c", "etc", "--jsonout", "list"},
+			{"snapper", "--no-dbus", "-c", "etc", "status", "--output"},
+			{"snapper", "--no-dbus", "-c", "etc", "diff", "3..0", "/etc/hosts"},
+			{"snapper", "--no-dbus", "-c", "etc", "diff", "3..0", "/etc/motd"},
+		})).To(Succeed())
+	})
+	It("compares the given snapshots", func() {
+		cmd.DiffArgs.From = 4
+		cmd.DiffArgs.To = 5
+		Expect(action.Diff(ctx)).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("Changes of /etc from snapshot 4 to snapshot 5:"))
+		Expect(runner.IncludesCmds([][]string{
+			{"snapper", "--no-dbus", "-c", "etc", "diff", "4..5", "/etc/hosts"},
+		})).To(Succeed())
+	})
+})
@@ -0,0 +1,86 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/suse/elemental/v3/internal/cli/cmd"
+	"github.com/suse/elemental/v3/pkg/health"
+	"github.com/suse/elemental/v3/pkg/sys"
+)
+
+func HealthCheck(ctx *cli.Context) error {
+	var s *sys.System
+	args := &cmd.HealthCheckArgs
+	if ctx.App.Metadata == nil || ctx.App.Metadata["system"] == nil {
+		return fmt.Errorf("error setting up initial configuration")
+	}
+	s = ctx.App.Metadata["system"].(*sys.System)
+
+	s.Logger().Info("Starting health-check action with args: %+v", args)
+
+	ctxCancel, stop := signal.NotifyContext(ctx.Context, syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	d, rollbacker, err := rollbackSetup(ctxCancel, s)
+	if err != nil {
+		return err
+	}
+
+	checkErr := health.Run(ctxCancel, s, d.HealthChecks)
+	if checkErr == nil {
+		s.Logger().Info("All health checks passed")
+		// checks only run on the first boot of a snapshot
+		return health.DisableUnit(s, "/")
+	}
+
+	s.Logger().Error("Health check failed: %v", checkErr)
+	if args.NoRollback {
+		return checkErr
+	}
+
+	s.Logger().Info("Rolling back to the previous snapshot")
+	err = rollbacker.Rollback(d, 0)
+	if err != nil {
+		s.Logger().Error("Rollback failed")
+		return fmt.Errorf("%w: rolling back: %w", checkErr, err)
+	}
+
+	if args.NoReboot {
+		s.Logger().Info("Rollback completed, reboot to boot into the previous snapshot")
+		return checkErr
+	}
+
+	s.Logger().Info("Rollback completed, rebooting")
+	_, err = s.Runner().Run("systemctl", "reboot")
+	if err != nil {
+		return fmt.Errorf("%w: rebooting: %w", checkErr, err)
+	}
+
+	return checkErr
+}
@@ -0,0 +1,176 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/suse/elemental/v3/internal/cli/action"
+	"github.com/suse/elemental/v3/internal/cli/cmd"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/health"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+const healthLsblk = `{
+  "blockdevices": [
+    {"label": "EFI", "partlabel": "efi", "partuuid": "c60d1845-7b04-4fc4-8639-8c49eb7277d5",
+     "size": 272629760, "fstype": "vfat", "mountpoints": ["/boot"], "path": "/dev/sda1", "pkname": "/dev/sda", "type": "part"},
+    {"label": "SYSTEM", "partlabel": "system", "partuuid": "34a8abb8-ddb3-48a2-8ecc-2443e92c7510",
+     "size": 2726297600, "fstype": "btrfs", "mountpoints": ["/"], "path": "/dev/sda2", "pkname": "/dev/sda", "type": "part"}
+  ]
+}`
+
+const healthSnapList = `{
+  "root": [
+    {"number": 1, "default": false, "active": false, "userdata": null},
+    {"number": 2, "default": true, "active": true, "userdata": null}
+  ]
+}`
+
+const healthUnitWants = "/etc/systemd/system/multi-user.target.wants/" + health.UnitName
+
+var _ = Describe("Health check action", Label("health"), func() {
+	var s *sys.System
+	var tfs vfs.FS
+	var cleanup func()
+	var err error
+	var ctx *cli.Context
+	var buffer *bytes.Buffer
+
+	BeforeEach(func() {
+		cmd.HealthCheckArgs = cmd.HealthCheckFlags{}
+		buffer = &bytes.Buffer{}
+		tfs, cleanup, err = sysmock.TestFS(map[string]string{
+			"/etc/elemental/deployment.yaml": badConfig,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		s, err = sys.NewSystem(
+			sys.WithFS(tfs),
+			sys.WithLogger(log.New(log.WithBuffer(buffer))),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		ctx = cli.NewContext(cli.NewApp(), nil, &cli.Context{Context: context.Background()})
+		if ctx.App.Metadata == nil {
+			ctx.App.Metadata = map[string]any{}
+		}
+		ctx.App.Metadata["system"] = s
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+	It("fails if no sys.System instance is in metadata", func() {
+		ctx.App.Metadata["system"] = nil
+		Expect(action.HealthCheck(ctx)).NotTo(Succeed())
+	})
+	It("fails if the deployment file does not exist", func() {
+		Expect(tfs.RemoveAll("/etc/elemental")).To(Succeed())
+		Expect(action.HealthCheck(ctx)).To(MatchError("deployment not found"))
+	})
+	It("fails if the setup is inconsistent", func() {
+		err = action.HealthCheck(ctx)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("inconsistent deployment"))
+	})
+	Describe("running the health checks", func() {
+		var runner *sysmock.Runner
+		var checkErr error
+
+		BeforeEach(func() {
+			checkErr = nil
+			runner = sysmock.NewRunner()
+			runner.SideEffect = func(command string, args ...string) ([]byte, error) {
+				switch {
+				case command == "lsblk":
+					return []byte(healthLsblk), nil
+				case command == "snapper" && slices.Contains(args, "list"):
+					return []byte(healthSnapList), nil
+				case command == "/bin/sh":
+					return []byte("service down"), checkErr
+				}
+				return nil, nil
+			}
+			mounter := sysmock.NewMounter()
+			Expect(mounter.Mount("/dev/sda2", "/", "btrfs", []string{"ro", "subvol=@/.snapshots/2/snapshot"})).To(Succeed())
+			s, err = sys.NewSystem(
+				sys.WithFS(tfs), sys.WithRunner(runner), sys.WithMounter(mounter),
+				sys.WithLogger(log.New(log.WithBuffer(buffer))),
+			)
+			Expect(err).NotTo(HaveOccurred())
+			ctx.App.Metadata["system"] = s
+
+			d := deployment.DefaultDeployment()
+			d.Disks[0].Device = "/dev/sda"
+			d.Disks[0].Partitions[0].UUID = "c60d1845-7b04-4fc4-8639-8c49eb7277d5"
+			d.Disks[0].Partitions[1].UUID = "34a8abb8-ddb3-48a2-8ecc-2443e92c7510"
+			d.SourceOS = deployment.NewOCISrc("registry.org/my/os:v2")
+			d.HealthChecks = []deployment.HealthCheck{{Name: "service", Command: "systemctl is-active my.service"}}
+			Expect(d.WriteDeploymentFile(s, "/")).To(Succeed())
+			Expect(vfs.MkdirAll(tfs, "/dev", vfs.DirPerm)).To(Succeed())
+			Expect(tfs.WriteFile("/dev/sda", []byte{}, vfs.FilePerm)).To(Succeed())
+			Expect(vfs.MkdirAll(tfs, "/etc/systemd/system/multi-user.target.wants", vfs.DirPerm)).To(Succeed())
+			Expect(tfs.WriteFile(healthUnitWants, []byte{}, vfs.FilePerm)).To(Succeed())
+		})
+		It("disables the health check unit if all checks pass", func() {
+			Expect(action.HealthCheck(ctx)).To(Succeed())
+			Expect(runner.IncludesCmds([][]string{{"/bin/sh", "-c", "systemctl is-active my.service"}})).To(Succeed())
+			Expect(runner.IncludesCmds([][]string{{"systemctl", "reboot"}})).NotTo(Succeed())
+			Expect(vfs.Exists(tfs, healthUnitWants)).To(BeFalse())
+		})
+		It("rolls back to the previous snapshot and reboots if a check fails", func() {
+			checkErr = fmt.Errorf("exit status 3")
+			err = action.HealthCheck(ctx)
+			Expect(err).To(MatchError(ContainSubstring("health check 'service' failed")))
+			Expect(runner.MatchMilestones([][]string{
+				{"/bin/sh", "-c", "systemctl is-active my.service"},
+				{"snapper", "--no-dbus", "modify", "--default", "1"},
+				{"systemctl", "reboot"},
+			})).To(Succeed())
+			Expect(vfs.Exists(tfs, healthUnitWants)).To(BeTrue())
+		})
+		It("rolls back without rebooting if requested", func() {
+			cmd.HealthCheckArgs.NoReboot = true
+			checkErr = fmt.Errorf("exit status 3")
+			Expect(action.HealthCheck(ctx)).NotTo(Succeed())
+			Expect(runner.IncludesCmds([][]string{
+				{"snapper", "--no-dbus", "modify", "--default", "1"},
+			})).To(Succeed())
+			Expect(runner.IncludesCmds([][]string{{"systemctl", "reboot"}})).NotTo(Succeed())
+		})
+		It("neither rolls back nor reboots if requested", func() {
+			cmd.HealthCheckArgs.NoRollback = true
+			checkErr = fmt.Errorf("exit status 3")
+			Expect(action.HealthCheck(ctx)).NotTo(Succeed())
+			Expect(runner.IncludesCmds([][]string{{"snapper", "--no-dbus", "modify", "--default", "1"}})).NotTo(Succeed())
+			Expect(runner.IncludesCmds([][]string{{"systemctl", "reboot"}})).NotTo(Succeed())
+			Expect(vfs.Exists(tfs, healthUnitWants)).To(BeTrue())
+		})
+	})
+})
@@ -26,6 +26,7 @@ import (
 	"go.yaml.in/yaml/v3"
 
 	"github.com/suse/elemental/v3/internal/cli/cmd"
+	"github.com/suse/elemental/v3/pkg/block/lsblk"
 	"github.com/suse/elemental/v3/pkg/bootloader"
 	"github.com/suse/elemental/v3/pkg/deployment"
 	"github.com/suse/elemental/v3/pkg/firmware"
@@ -64,7 +65,10 @@ func Install(ctx *cli.Context) error { //nolint:dupl
 		stop()
 	}()
 
-	bootloader, err := bootloader.New(d.BootConfig.Bootloader, s)
+	bootloader, err := bootloader.New(
+		d.BootConfig.Bootloader, s, bootloader.WithBootAttempts(d.BootConfig.BootAttempts),
+		bootloader.WithSecureBoot(d.SecureBoot), bootloader.WithLegacyBIOS(d.IsBIOSEnabled()),
+	)
 	if err != nil {
 		s.Logger().Error("Parsing boot config failed")
 		return err
@@ -114,13 +118,6 @@ func loadDescriptionFile(s *sys.System, file string, d *deployment.Deployment) e
 
 // setBootloader configures the bootloader for the given deployment with the given flags
 func setBootloader(s *sys.System, d *deployment.Deployment, flags *cmd.InstallFlags) {
-	disk := d.GetSystemDisk()
-	if flags.CreateBootEntry && disk != nil {
-		d.Firmware.BootEntries = []*firmware.EfiBootEntry{
-			firmware.DefaultBootEntry(s.Platform(), disk.Device),
-		}
-	}
-
 	if d.BootConfig == nil {
 		d.BootConfig = &deployment.BootConfig{}
 	}
@@ -128,10 +125,27 @@ func setBootloader(s *sys.System, d *deployment.Deployment, flags *cmd.InstallFl
 		d.BootConfig.Bootloader = flags.Bootloader
 	}
 
+	efi := firmware.IsEFI(s)
+	if !efi && d.BootConfig.Bootloader == bootloader.BootGrub {
+		s.Logger().Info("No EFI firmware found, enabling legacy BIOS boot")
+		deployment.WithBIOSPartition()(d)
+	}
+
+	disk := d.GetSystemDisk()
+	if flags.CreateBootEntry && disk != nil && efi {
+		d.Firmware.BootEntries = []*firmware.EfiBootEntry{
+			firmware.DefaultBootEntry(s.Platform(), disk.Device),
+		}
+	}
+
 	if flags.KernelCmdline != "" {
 		d.BootConfig.KernelCmdline = flags.KernelCmdline
 	}
 
+	if flags.BootAttempts != 0 {
+		d.BootConfig.BootAttempts = flags.BootAttempts
+	}
+
 	if flags.EnableFips {
 		d.Fips = &deployment.FipsConfig{
 			Enabled: true,
@@ -142,6 +156,25 @@ func setBootloader(s *sys.System, d *deployment.Deployment, flags *cmd.InstallFl
 	}
 }
 
+// setSecureBootKeys sets the given Secure Boot keys to the deployment, if any. The keys of installed
+// systems are not stored in their deployment, so they are only taken from flags. Installing the boot
+// artifacts of a Secure Boot deployment without keys fails unless unsigned artifacts are allowed.
+func setSecureBootKeys(d *deployment.Deployment, key, cert string, allowUnsigned bool) error {
+	if key != "" || cert != "" {
+		if d.SecureBoot == nil {
+			d.SecureBoot = &deployment.SecureBoot{}
+		}
+		d.SecureBoot.Key = key
+		d.SecureBoot.Cert = cert
+		return nil
+	}
+	if d.SecureBoot == nil || d.SecureBoot.Key != "" || d.SecureBoot.Cert != "" || allowUnsigned {
+		return nil
+	}
+	return fmt.Errorf("secure boot keys are required to sign the boot artifacts, " +
+		"set them with --secure-boot-key and --secure-boot-cert or use --allow-unsigned")
+}
+
 // disgestInstallSetup produces the Deployment object required to describe the installation parameters
 func digestInstallSetup(s *sys.System, flags *cmd.InstallFlags) (*deployment.Deployment, error) {
 	d := deployment.DefaultDeployment()
@@ -166,6 +199,11 @@ func digestInstallSetup(s *sys.System, flags *cmd.InstallFlags) (*deployment.Dep
 		disk.Device = flags.Target
 	}
 
+	err := d.ResolveDiskSelectors(s, lsblk.NewLsDevice(s))
+	if err != nil {
+		return nil, fmt.Errorf("resolving disk selectors: %w", err)
+	}
+
 	if flags.OperatingSystemImage != "" {
 		srcOS, err := deployment.NewSrcFromURI(flags.OperatingSystemImage)
 		if err != nil {
@@ -187,6 +225,10 @@ func digestInstallSetup(s *sys.System, flags *cmd.InstallFlags) (*deployment.Dep
 	}
 
 	setBootloader(s, d, flags)
+	err = setSecureBootKeys(d, flags.SecureBootKey, flags.SecureBootCert, flags.AllowUnsigned)
+	if err != nil {
+		return nil, err
+	}
 
 	if flags.Snapshotter != "" {
 		d.Snapshotter.Name = flags.Snapshotter
@@ -202,7 +244,7 @@ func digestInstallSetup(s *sys.System, flags *cmd.InstallFlags) (*deployment.Dep
 		}
 	}
 
-	err := d.Sanitize(s)
+	err = d.Sanitize(s)
 	if err != nil {
 		return nil, fmt.Errorf("inconsistent deployment setup found: %w", err)
 	}
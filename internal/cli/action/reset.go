@@ -0,0 +1,138 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/suse/elemental/v3/internal/cli/cmd"
+	"github.com/suse/elemental/v3/pkg/bootloader"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/firmware"
+	"github.com/suse/elemental/v3/pkg/install"
+	"github.com/suse/elemental/v3/pkg/installer"
+	"github.com/suse/elemental/v3/pkg/sys"
+	"github.com/suse/elemental/v3/pkg/transaction"
+	"github.com/suse/elemental/v3/pkg/upgrade"
+)
+
+func Reset(ctx *cli.Context) error { //nolint:dupl
+	var s *sys.System
+	args := &cmd.ResetArgs
+	if ctx.App.Metadata == nil || ctx.App.Metadata["system"] == nil {
+		return fmt.Errorf("error setting up initial configuration")
+	}
+	s = ctx.App.Metadata["system"].(*sys.System)
+
+	s.Logger().Info("Starting reset action with args: %+v", args)
+
+	d, err := digestResetSetup(s, args)
+	if err != nil {
+		s.Logger().Error("Failed to collect reset setup")
+		return err
+	}
+
+	s.Logger().Info("Checked configuration, running reset process")
+
+	ctxCancel, stop := signal.NotifyContext(ctx.Context, syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	bootloader, err := bootloader.New(
+		d.BootConfig.Bootloader, s, bootloader.WithBootAttempts(d.BootConfig.BootAttempts),
+		bootloader.WithSecureBoot(d.SecureBoot), bootloader.WithLegacyBIOS(d.IsBIOSEnabled()),
+	)
+	if err != nil {
+		s.Logger().Error("Parsing boot config failed")
+		return err
+	}
+
+	snapshotter, err := transaction.New(ctxCancel, s, d, d.Snapshotter.Name)
+	if err != nil {
+		s.Logger().Error("Parsing snapshotter config failed")
+		return err
+	}
+
+	manager := firmware.NewEfiBootManager(s)
+	upgrader := upgrade.New(
+		ctxCancel, s, upgrade.WithBootManager(manager), upgrade.WithBootloader(bootloader),
+		upgrade.WithSnapshotter(snapshotter),
+	)
+	installer := install.New(
+		ctxCancel, s, install.WithUpgrader(upgrader), install.WithBootloader(bootloader),
+	)
+
+	err = installer.Reset(d, args.KeepVolumes.Value()...)
+	if err != nil {
+		s.Logger().Error("Reset failed")
+		return err
+	}
+
+	s.Logger().Info("Reset complete")
+
+	return nil
+}
+
+// digestResetSetup produces the Deployment object required to reset the system from the recovery
+// partition. It reuses the deployment stored in the recovery partition at installation time.
+func digestResetSetup(s *sys.System, flags *cmd.ResetFlags) (*deployment.Deployment, error) {
+	if !install.IsLiveMedia(s) {
+		return nil, fmt.Errorf("reset can only be executed from the recovery system")
+	}
+
+	description := flags.Description
+	if description == "" {
+		description = installer.InstallDesc
+	}
+
+	d := deployment.DefaultDeployment()
+	err := loadDescriptionFile(s, description, d)
+	if err != nil {
+		return nil, err
+	}
+
+	// Always reinstall the OS image of the recovery system
+	d.SourceOS = deployment.NewRawSrc(installer.LiveImagePath(installer.LiveMountPoint, d.Installer.Image))
+	err = setSecureBootKeys(d, flags.SecureBootKey, flags.SecureBootCert, flags.AllowUnsigned)
+	if err != nil {
+		return nil, err
+	}
+
+	// Device names are not guaranteed to be consistent across reboots, partitions
+	// are found by their UUID.
+	err = d.Sanitize(s, deployment.CheckDiskDevice)
+	if err != nil {
+		return nil, fmt.Errorf("inconsistent deployment setup found: %w", err)
+	}
+	if d.BootConfig == nil {
+		d.BootConfig = &deployment.BootConfig{Bootloader: bootloader.BootNone}
+	}
+	if d.Snapshotter == nil {
+		d.Snapshotter = &deployment.SnapshotterConfig{Name: "snapper"}
+	}
+
+	return d, nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action_test
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/suse/elemental/v3/internal/cli/action"
+	"github.com/suse/elemental/v3/internal/cli/cmd"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+var _ = Describe("Reset action", Label("reset"), func() {
+	var s *sys.System
+	var tfs vfs.FS
+	var mounter *sysmock.Mounter
+	var cleanup func()
+	var err error
+	var ctx *cli.Context
+	var buffer *bytes.Buffer
+
+	BeforeEach(func() {
+		cmd.ResetArgs = cmd.ResetFlags{}
+		buffer = &bytes.Buffer{}
+		mounter = sysmock.NewMounter()
+		tfs, cleanup, err = sysmock.TestFS(map[string]string{
+			"/run/initramfs/live/LiveOS/squashfs.img":  "",
+			"/run/initramfs/live/Install/install.yaml": badConfig,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		s, err = sys.NewSystem(
+			sys.WithFS(tfs), sys.WithMounter(mounter),
+			sys.WithLogger(log.New(log.WithBuffer(buffer))),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		ctx = cli.NewContext(cli.NewApp(), nil, &cli.Context{})
+		if ctx.App.Metadata == nil {
+			ctx.App.Metadata = map[string]any{}
+		}
+		ctx.App.Metadata["system"] = s
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+	It("fails if no sys.System instance is in metadata", func() {
+		ctx.App.Metadata["system"] = nil
+		Expect(action.Reset(ctx)).NotTo(Succeed())
+	})
+	It("fails if not booted from the recovery system", func() {
+		Expect(action.Reset(ctx)).To(MatchError("reset can only be executed from the recovery system"))
+	})
+	Describe("booted from the recovery system", func() {
+		BeforeEach(func() {
+			Expect(mounter.Mount("/dev/device2", "/run/initramfs/live", "", []string{"ro"})).To(Succeed())
+		})
+		It("fails if the description file does not exist", func() {
+			cmd.ResetArgs.Description = "/some/missing/file.yaml"
+			err = action.Reset(ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("could not read description file"))
+		})
+		It("fails if the stored deployment requires Secure Boot keys", func() {
+			Expect(tfs.WriteFile("/run/initramfs/live/Install/install.yaml", []byte("secureBoot: {}\n"), vfs.FilePerm)).To(Succeed())
+			err = action.Reset(ctx)
+			Expect(err).To(MatchError(ContainSubstring("secure boot keys are required to sign the boot artifacts")))
+
+			cmd.ResetArgs.AllowUnsigned = true
+			err = action.Reset(ctx)
+			Expect(err).To(MatchError(ContainSubstring("inconsistent deployment")))
+		})
+		It("fails if the stored deployment is inconsistent", func() {
+			err = action.Reset(ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("inconsistent deployment"))
+		})
+	})
+})
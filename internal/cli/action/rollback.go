@@ -0,0 +1,111 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/suse/elemental/v3/internal/cli/cmd"
+	"github.com/suse/elemental/v3/pkg/bootloader"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/rollback"
+	"github.com/suse/elemental/v3/pkg/sys"
+	"github.com/suse/elemental/v3/pkg/transaction"
+)
+
+func Rollback(ctx *cli.Context) error {
+	var s *sys.System
+	args := &cmd.RollbackArgs
+	if ctx.App.Metadata == nil || ctx.App.Metadata["system"] == nil {
+		return fmt.Errorf("error setting up initial configuration")
+	}
+	s = ctx.App.Metadata["system"].(*sys.System)
+
+	s.Logger().Info("Starting rollback action with args: %+v", args)
+
+	if args.To < 0 {
+		return fmt.Errorf("invalid snapshot ID: %d", args.To)
+	}
+
+	ctxCancel, stop := signal.NotifyContext(ctx.Context, syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	d, rollbacker, err := rollbackSetup(ctxCancel, s)
+	if err != nil {
+		return err
+	}
+
+	err = rollbacker.Rollback(d, args.To)
+	if err != nil {
+		s.Logger().Error("Rollback failed")
+		return err
+	}
+
+	s.Logger().Info("Rollback completed, reboot to boot into the default snapshot")
+
+	return nil
+}
+
+// rollbackSetup parses the deployment of the running system and returns it together with
+// a rollbacker configured for it
+func rollbackSetup(ctx context.Context, s *sys.System) (*deployment.Deployment, *rollback.Rollbacker, error) {
+	d, err := deployment.Parse(s, "/")
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing deployment: %w", err)
+	} else if d == nil {
+		return nil, nil, fmt.Errorf("deployment not found")
+	}
+
+	err = d.Sanitize(s, deployment.CheckDiskDevice)
+	if err != nil {
+		return nil, nil, fmt.Errorf("inconsistent deployment setup found: %w", err)
+	}
+	if d.BootConfig == nil {
+		d.BootConfig = &deployment.BootConfig{Bootloader: bootloader.BootNone}
+	}
+	if d.Snapshotter == nil {
+		d.Snapshotter = &deployment.SnapshotterConfig{Name: "snapper"}
+	}
+
+	bootloader, err := bootloader.New(d.BootConfig.Bootloader, s)
+	if err != nil {
+		s.Logger().Error("Parsing boot config failed")
+		return nil, nil, err
+	}
+
+	snapshotter, err := transaction.New(ctx, s, d, d.Snapshotter.Name)
+	if err != nil {
+		s.Logger().Error("Parsing snapshotter config failed")
+		return nil, nil, err
+	}
+
+	rollbacker := rollback.New(
+		ctx, s, rollback.WithBootloader(bootloader), rollback.WithTransaction(snapshotter),
+	)
+	return d, rollbacker, nil
+}
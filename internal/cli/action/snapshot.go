@@ -0,0 +1,88 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/snapper"
+	"github.com/suse/elemental/v3/pkg/sys"
+)
+
+func SnapshotPin(ctx *cli.Context) error {
+	return pinSnapshot(ctx, true)
+}
+
+func SnapshotUnpin(ctx *cli.Context) error {
+	return pinSnapshot(ctx, false)
+}
+
+// pinSnapshot pins or unpins the root snapshot given as the only command argument
+func pinSnapshot(ctx *cli.Context, pin bool) error {
+	var s *sys.System
+	if ctx.App.Metadata == nil || ctx.App.Metadata["system"] == nil {
+		return fmt.Errorf("error setting up initial configuration")
+	}
+	s = ctx.App.Metadata["system"].(*sys.System)
+
+	if ctx.Args().Len() != 1 {
+		return fmt.Errorf("a single snapshot ID is required")
+	}
+	id, err := strconv.Atoi(ctx.Args().First())
+	if err != nil || id <= 0 {
+		return fmt.Errorf("invalid snapshot ID: '%s'", ctx.Args().First())
+	}
+
+	d, err := deployment.Parse(s, "/")
+	if err != nil {
+		return fmt.Errorf("parsing deployment: %w", err)
+	} else if d == nil {
+		return fmt.Errorf("deployment not found")
+	}
+
+	if d.Snapshotter != nil && d.Snapshotter.Name != "snapper" {
+		return fmt.Errorf("pinning snapshots is only supported by the 'snapper' snapshotter")
+	}
+
+	sn := snapper.New(s)
+	snaps, err := sn.ListSnapshots("/", "root")
+	if err != nil {
+		return fmt.Errorf("listing snapshots: %w", err)
+	}
+	if snaps.Get(id) == nil {
+		return fmt.Errorf("snapshot %d not found", id)
+	}
+
+	if !pin {
+		if err = sn.Unpin("/", id); err != nil {
+			return fmt.Errorf("unpinning snapshot %d: %w", id, err)
+		}
+		s.Logger().Info("Snapshot %d unpinned", id)
+		return nil
+	}
+
+	if err = sn.Pin("/", id); err != nil {
+		return fmt.Errorf("pinning snapshot %d: %w", id, err)
+	}
+	s.Logger().Info("Snapshot %d pinned", id)
+	return nil
+}
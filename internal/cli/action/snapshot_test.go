@@ -0,0 +1,104 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action_test
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/suse/elemental/v3/internal/cli/action"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+var _ = Describe("Snapshot actions", Label("snapshot"), func() {
+	var s *sys.System
+	var tfs vfs.FS
+	var cleanup func()
+	var err error
+	var runner *sysmock.Runner
+
+	newContext := func(args ...string) *cli.Context {
+		set := flag.NewFlagSet("pin", flag.ContinueOnError)
+		Expect(set.Parse(args)).To(Succeed())
+		ctx := cli.NewContext(cli.NewApp(), set, nil)
+		ctx.App.Metadata = map[string]any{"system": s}
+		return ctx
+	}
+
+	BeforeEach(func() {
+		tfs, cleanup, err = sysmock.TestFS(nil)
+		Expect(err).NotTo(HaveOccurred())
+		runner = sysmock.NewRunner()
+		runner.SideEffect = func(command string, args ...string) ([]byte, error) {
+			if command == "snapper" && args[len(args)-1] == "number,date,default,active,userdata" {
+				return []byte(statusSnapList), nil
+			}
+			return nil, nil
+		}
+		s, err = sys.NewSystem(
+			sys.WithFS(tfs), sys.WithRunner(runner),
+			sys.WithLogger(log.New(log.WithDiscardAll())),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		d := deployment.DefaultDeployment()
+		d.SourceOS = deployment.NewOCISrc("registry.org/my/os:v2")
+		Expect(d.WriteDeploymentFile(s, "/")).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+	It("pins and unpins a snapshot", func() {
+		Expect(action.SnapshotPin(newContext("1"))).To(Succeed())
+		Expect(action.SnapshotUnpin(newContext("1"))).To(Succeed())
+		Expect(runner.MatchMilestones([][]string{
+			{"snapper", "--no-dbus", "modify", "--userdata", "pinned=yes", "--cleanup-algorithm", "", "1"},
+			{"snapper", "--no-dbus", "modify", "--userdata", "pinned=", "--cleanup-algorithm", "number", "1"},
+		})).To(Succeed())
+	})
+	It("fails for invalid arguments", func() {
+		Expect(action.SnapshotPin(newContext())).To(MatchError("a single snapshot ID is required"))
+		Expect(action.SnapshotPin(newContext("one"))).To(MatchError("invalid snapshot ID: 'one'"))
+		Expect(action.SnapshotUnpin(newContext("0"))).To(MatchError("invalid snapshot ID: '0'"))
+	})
+	It("fails for a non existing snapshot", func() {
+		Expect(action.SnapshotPin(newContext("7"))).To(MatchError("snapshot 7 not found"))
+		Expect(runner.IncludesCmds([][]string{{"snapper", "--no-dbus", "modify"}})).NotTo(Succeed())
+	})
+	It("fails to pin a snapshot", func() {
+		runner.SideEffect = func(command string, args ...string) ([]byte, error) {
+			if slices.Contains(args, "modify") {
+				return []byte("invalid"), fmt.Errorf("modify failed")
+			}
+			return []byte(statusSnapList), nil
+		}
+		err := action.SnapshotPin(newContext("2"))
+		Expect(err).To(MatchError("pinning snapshot 2: modifying snapshot 2: invalid: modify failed"))
+	})
+})
@@ -0,0 +1,259 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/suse/elemental/v3/internal/cli/cmd"
+	"github.com/suse/elemental/v3/pkg/bootloader"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/snapper"
+	"github.com/suse/elemental/v3/pkg/sys"
+	"github.com/suse/elemental/v3/pkg/transaction"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+type imageStatus struct {
+	URI    string `json:"uri"`
+	Digest string `json:"digest,omitempty"`
+}
+
+type partitionStatus struct {
+	Label      string   `json:"label"`
+	Role       string   `json:"role"`
+	FileSystem string   `json:"fileSystem"`
+	Size       uint     `json:"size"`
+	MountPoint string   `json:"mountPoint,omitempty"`
+	RWVolumes  []string `json:"rwVolumes,omitempty"`
+}
+
+type rollbackStatus struct {
+	Date string       `json:"date"`
+	From *imageStatus `json:"from,omitempty"`
+}
+
+type systemStatus struct {
+	SourceOS      *imageStatus             `json:"sourceOS,omitempty"`
+	Partitions    []partitionStatus        `json:"partitions"`
+	Bootloader    string                   `json:"bootloader"`
+	KernelCmdline string                   `json:"kernelCmdline,omitempty"`
+	Snapshotter   string                   `json:"snapshotter"`
+	Rollback      *rollbackStatus          `json:"rollback,omitempty"`
+	Snapshots     snapper.Snapshots        `json:"snapshots,omitempty"`
+	BootEntries   []bootloader.BootEntry   `json:"bootEntries,omitempty"`
+	MergeReport   *transaction.MergeReport `json:"mergeReport,omitempty"`
+}
+
+func Status(ctx *cli.Context) error {
+	var s *sys.System
+	args := &cmd.StatusArgs
+	if ctx.App.Metadata == nil || ctx.App.Metadata["system"] == nil {
+		return fmt.Errorf("error setting up initial configuration")
+	}
+	s = ctx.App.Metadata["system"].(*sys.System)
+
+	if args.Output != outputText && args.Output != outputJSON {
+		return fmt.Errorf("unsupported output format '%s'", args.Output)
+	}
+
+	d, err := deployment.Parse(s, "/")
+	if err != nil {
+		return fmt.Errorf("parsing deployment: %w", err)
+	} else if d == nil {
+		return fmt.Errorf("deployment not found")
+	}
+
+	status, err := collectStatus(s, d)
+	if err != nil {
+		return err
+	}
+
+	if args.Output == outputJSON {
+		enc := json.NewEncoder(ctx.App.Writer)
+		enc.SetIndent("", "  ")
+		return enc.Encode(status)
+	}
+	return writeTextStatus(ctx.App.Writer, status)
+}
+
+// collectStatus gathers the status of the running system from the given deployment, the snapshotter
+// and the bootloader.
+func collectStatus(s *sys.System, d *deployment.Deployment) (*systemStatus, error) {
+	status := &systemStatus{
+		SourceOS:    newImageStatus(d.SourceOS),
+		Partitions:  []partitionStatus{},
+		Bootloader:  bootloader.BootNone,
+		Snapshotter: deployment.Unknown,
+	}
+
+	for _, disk := range d.Disks {
+		for _, part := range disk.Partitions {
+			pStatus := partitionStatus{
+				Label:      part.Label,
+				Role:       part.Role.String(),
+				FileSystem: part.FileSystem.String(),
+				Size:       uint(part.Size),
+				MountPoint: part.MountPoint,
+			}
+			for _, rwVol := range part.RWVolumes {
+				pStatus.RWVolumes = append(pStatus.RWVolumes, rwVol.Path)
+			}
+			status.Partitions = append(status.Partitions, pStatus)
+		}
+	}
+
+	if d.Rollback != nil {
+		status.Rollback = &rollbackStatus{
+			Date: d.Rollback.Date,
+			From: newImageStatus(d.Rollback.From),
+		}
+	}
+
+	if d.BootConfig != nil {
+		status.Bootloader = d.BootConfig.Bootloader
+		status.KernelCmdline = d.BootConfig.KernelCmdline
+	}
+
+	if d.Snapshotter != nil {
+		status.Snapshotter = d.Snapshotter.Name
+	}
+
+	if status.Snapshotter == "snapper" {
+		snaps, err := snapper.New(s).ListSnapshots("/", "root")
+		if err != nil {
+			return nil, fmt.Errorf("listing snapshots: %w", err)
+		}
+		status.Snapshots = snaps
+
+		status.MergeReport, err = transaction.ReadMergeReport(s, "/")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	esp := d.GetEfiPartition()
+	if esp != nil {
+		b, err := bootloader.New(status.Bootloader, s)
+		if err != nil {
+			return nil, fmt.Errorf("initializing bootloader: %w", err)
+		}
+		status.BootEntries, err = b.GetEntries(filepath.Join("/", esp.MountPoint))
+		if err != nil {
+			return nil, fmt.Errorf("listing boot entries: %w", err)
+		}
+	}
+
+	return status, nil
+}
+
+func newImageStatus(src *deployment.ImageSource) *imageStatus {
+	if src == nil || src.IsEmpty() {
+		return nil
+	}
+	return &imageStatus{URI: src.String(), Digest: src.GetDigest()}
+}
+
+// writeTextStatus writes the given status in a human readable format
+func writeTextStatus(out io.Writer, status *systemStatus) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "Deployment:")
+	if status.SourceOS != nil {
+		fmt.Fprintf(w, "  OS image:\t%s\n", status.SourceOS.URI)
+		fmt.Fprintf(w, "  OS image digest:\t%s\n", status.SourceOS.Digest)
+	}
+	fmt.Fprintf(w, "  Bootloader:\t%s\n", status.Bootloader)
+	fmt.Fprintf(w, "  Kernel cmdline:\t%s\n", status.KernelCmdline)
+	fmt.Fprintf(w, "  Snapshotter:\t%s\n", status.Snapshotter)
+	if status.Rollback != nil {
+		from := ""
+		if status.Rollback.From != nil {
+			from = " from " + status.Rollback.From.URI
+		}
+		fmt.Fprintf(w, "  Rolled back:\t%s%s\n", status.Rollback.Date, from)
+	}
+
+	fmt.Fprintln(w, "\nPartitions:")
+	fmt.Fprintln(w, "  LABEL\tROLE\tFILESYSTEM\tSIZE (MiB)\tMOUNTPOINT\tRW VOLUMES")
+	for _, part := range status.Partitions {
+		size := "all available"
+		if part.Size > 0 {
+			size = fmt.Sprintf("%d", part.Size)
+		}
+		fmt.Fprintf(
+			w, "  %s\t%s\t%s\t%s\t%s\t%s\n", part.Label, part.Role, part.FileSystem,
+			size, part.MountPoint, strings.Join(part.RWVolumes, ","),
+		)
+	}
+
+	if len(status.Snapshots) > 0 {
+		fmt.Fprintln(w, "\nSnapshots:")
+		fmt.Fprintln(w, "  ID\tDEFAULT\tACTIVE\tUSERDATA")
+		for _, snap := range status.Snapshots {
+			fmt.Fprintf(w, "  %d\t%s\t%s\t%s\n", snap.Number, yesNo(snap.Default), yesNo(snap.Active), sortedMetadata(snap.UserData))
+		}
+	}
+
+	if len(status.BootEntries) > 0 {
+		fmt.Fprintln(w, "\nBoot entries:")
+		fmt.Fprintln(w, "  ID\tNAME\tKERNEL\tCMDLINE")
+		for _, entry := range status.BootEntries {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", entry.ID, entry.DisplayName, entry.Linux, entry.CmdLine)
+		}
+	}
+
+	if status.MergeReport != nil && len(status.MergeReport.Conflicts) > 0 {
+		fmt.Fprintf(w, "\nMerge conflicts of snapshot %d:\n", status.MergeReport.Snapshot)
+		fmt.Fprintln(w, "  PATH\tPOLICY\tKEPT")
+		for _, conflict := range status.MergeReport.Conflicts {
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", conflict.Path, conflict.Policy, conflict.Kept)
+		}
+	}
+
+	return w.Flush()
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+// sortedMetadata returns the given metadata as a comma separated list of key=value pairs sorted by key
+func sortedMetadata(m snapper.Metadata) string {
+	pairs := []string{}
+	for k, v := range m {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,149 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action_test
+
+import (
+	"bytes"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/suse/elemental/v3/internal/cli/action"
+	"github.com/suse/elemental/v3/internal/cli/cmd"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+const statusSnapList = `{
+  "root": [
+    {"number": 0, "default": false, "active": false, "userdata": null},
+    {"number": 1, "default": false, "active": true, "userdata": null},
+    {"number": 2, "default": true, "active": false, "userdata": {"update-in-progress": ""}}
+  ]
+}`
+
+var _ = Describe("Status action", Label("status"), func() {
+	var s *sys.System
+	var tfs vfs.FS
+	var cleanup func()
+	var err error
+	var ctx *cli.Context
+	var out *bytes.Buffer
+	var runner *sysmock.Runner
+
+	BeforeEach(func() {
+		cmd.StatusArgs = cmd.StatusFlags{Output: "text"}
+		out = &bytes.Buffer{}
+		tfs, cleanup, err = sysmock.TestFS(map[string]string{
+			"/boot/grubenv":               "entries=active 2 1",
+			"/boot/loader/entries/active": "display_name=OS\nlinux=/os/6.14/vmlinuz\ncmdline=snapshot2",
+			"/boot/loader/entries/2":      "display_name=OS (2)\nlinux=/os/6.14/vmlinuz\ncmdline=snapshot2",
+			"/boot/loader/entries/1":      "display_name=OS (1)\nlinux=/os/6.12/vmlinuz\ncmdline=snapshot1",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		runner = sysmock.NewRunner()
+		runner.SideEffect = func(command string, args ...string) ([]byte, error) {
+			switch command {
+			case "snapper":
+				return []byte(statusSnapList), nil
+			case "grub2-editenv":
+				return tfs.ReadFile(args[0])
+			}
+			return nil, nil
+		}
+		s, err = sys.NewSystem(
+			sys.WithFS(tfs), sys.WithRunner(runner),
+			sys.WithLogger(log.New(log.WithDiscardAll())),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		d := deployment.DefaultDeployment()
+		d.SourceOS = deployment.NewOCISrc("registry.org/my/os:v2")
+		d.SourceOS.SetDigest("sha256:abcd")
+		d.BootConfig.Bootloader = "grub"
+		Expect(d.WriteDeploymentFile(s, "/")).To(Succeed())
+
+		ctx = cli.NewContext(cli.NewApp(), nil, &cli.Context{})
+		ctx.App.Writer = out
+		if ctx.App.Metadata == nil {
+			ctx.App.Metadata = map[string]any{}
+		}
+		ctx.App.Metadata["system"] = s
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+	It("fails if no sys.System instance is in metadata", func() {
+		ctx.App.Metadata["system"] = nil
+		Expect(action.Status(ctx)).NotTo(Succeed())
+	})
+	It("fails for an unknown output format", func() {
+		cmd.StatusArgs.Output = "xml"
+		Expect(action.Status(ctx)).To(MatchError("unsupported output format 'xml'"))
+	})
+	It("fails if the deployment file does not exist", func() {
+		Expect(tfs.RemoveAll("/etc/elemental")).To(Succeed())
+		Expect(action.Status(ctx)).To(MatchError("deployment not found"))
+	})
+	It("prints the status as text", func() {
+		Expect(action.Status(ctx)).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("oci://registry.org/my/os:v2"))
+		Expect(out.String()).To(ContainSubstring("sha256:abcd"))
+		Expect(out.String()).To(MatchRegexp(`2\s+yes\s+no\s+update-in-progress=`))
+		Expect(out.String()).To(MatchRegexp(`1\s+OS \(1\)\s+/os/6.12/vmlinuz\s+snapshot1`))
+	})
+	It("prints the status as json", func() {
+		cmd.StatusArgs.Output = "json"
+		Expect(action.Status(ctx)).To(Succeed())
+
+		status := map[string]any{}
+		Expect(json.Unmarshal(out.Bytes(), &status)).To(Succeed())
+		Expect(status["sourceOS"]).To(HaveKeyWithValue("digest", "sha256:abcd"))
+		Expect(status["snapshotter"]).To(Equal("snapper"))
+		Expect(status["snapshots"]).To(HaveLen(2))
+		Expect(status["bootEntries"]).To(HaveLen(3))
+		Expect(status["partitions"]).To(HaveLen(2))
+		Expect(runner.IncludesCmds([][]string{
+			{"snapper", "--no-dbus", "-c", "root", "--jsonout", "list"},
+		})).To(Succeed())
+		Expect(status).NotTo(HaveKey("mergeReport"))
+	})
+	It("prints the merge conflicts of the last upgrade", func() {
+		report := "snapshot: 2\nconflicts:\n  - volume: /etc\n    path: /etc/hosts\n    policy: prefer-image\n    kept: image\n"
+		Expect(vfs.MkdirAll(tfs, "/var/lib/elemental", vfs.DirPerm)).To(Succeed())
+		Expect(tfs.WriteFile("/var/lib/elemental/merge-report.yaml", []byte(report), vfs.FilePerm)).To(Succeed())
+
+		Expect(action.Status(ctx)).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("Merge conflicts of snapshot 2:"))
+		Expect(out.String()).To(MatchRegexp(`/etc/hosts\s+prefer-image\s+image`))
+
+		out.Reset()
+		cmd.StatusArgs.Output = "json"
+		Expect(action.Status(ctx)).To(Succeed())
+		status := map[string]any{}
+		Expect(json.Unmarshal(out.Bytes(), &status)).To(Succeed())
+		Expect(status["mergeReport"]).To(HaveKeyWithValue("conflicts", HaveLen(1)))
+	})
+})
@@ -18,17 +18,27 @@ limitations under the License.
 package action
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 
 	"github.com/urfave/cli/v2"
 
+	"github.com/suse/elemental/v3/internal/build"
 	"github.com/suse/elemental/v3/internal/cli/cmd"
+	"github.com/suse/elemental/v3/internal/image"
 	"github.com/suse/elemental/v3/pkg/bootloader"
 	"github.com/suse/elemental/v3/pkg/deployment"
 	"github.com/suse/elemental/v3/pkg/firmware"
+	"github.com/suse/elemental/v3/pkg/http"
 	"github.com/suse/elemental/v3/pkg/sys"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+	"github.com/suse/elemental/v3/pkg/transaction"
 	"github.com/suse/elemental/v3/pkg/unpack"
 	"github.com/suse/elemental/v3/pkg/upgrade"
 )
@@ -43,14 +53,12 @@ func Upgrade(ctx *cli.Context) error { //nolint:dupl
 
 	s.Logger().Info("Starting upgrade action with args: %+v", args)
 
-	d, err := digestUpgradeSetup(s, args)
+	err := validateUpgradeArgs(args)
 	if err != nil {
-		s.Logger().Error("Failed to collect upgrade setup")
+		s.Logger().Error("Invalid upgrade arguments")
 		return err
 	}
 
-	s.Logger().Info("Checked configuration, running upgrade process")
-
 	ctxCancel, stop := signal.NotifyContext(ctx.Context, syscall.SIGTERM, syscall.SIGINT)
 	defer stop()
 
@@ -59,7 +67,36 @@ func Upgrade(ctx *cli.Context) error { //nolint:dupl
 		stop()
 	}()
 
-	bootloader, err := bootloader.New(d.BootConfig.Bootloader, s)
+	if args.ApplyStaged || args.DiscardStaged {
+		return stagedUpgrade(ctxCancel, s, args)
+	}
+
+	var workDir string
+	if args.ReleaseManifest != "" {
+		workDir, err = vfs.TempDir(s.FS(), "", "elemental-upgrade")
+		if err != nil {
+			s.Logger().Error("Failed creating release upgrade working directory")
+			return err
+		}
+		defer func() {
+			if rErr := s.FS().RemoveAll(workDir); rErr != nil {
+				s.Logger().Error("Failed removing release upgrade working directory: %v", rErr)
+			}
+		}()
+	}
+
+	d, current, err := digestUpgradeSetup(ctxCancel, s, args, image.BuildDir(workDir))
+	if err != nil {
+		s.Logger().Error("Failed to collect upgrade setup")
+		return err
+	}
+
+	s.Logger().Info("Checked configuration, running upgrade process")
+
+	bootloader, err := bootloader.New(
+		d.BootConfig.Bootloader, s, bootloader.WithBootAttempts(d.BootConfig.BootAttempts),
+		bootloader.WithSecureBoot(d.SecureBoot), bootloader.WithLegacyBIOS(d.IsBIOSEnabled()),
+	)
 	if err != nil {
 		s.Logger().Error("Parsing boot config failed")
 		return err
@@ -71,35 +108,213 @@ func Upgrade(ctx *cli.Context) error { //nolint:dupl
 		upgrade.WithUnpackOpts(unpack.WithVerify(args.Verify), unpack.WithLocal(args.Local)),
 	)
 
+	err = upgrader.ResolveDigest(d)
+	if err != nil {
+		s.Logger().Error("Resolving OS image digest failed")
+		return err
+	}
+
+	// extensions and Helm charts of a new release need to be applied even if the OS image is unchanged.
+	// Overlay trees and configuration scripts have no digest to compare with, they are always applied.
+	upToDate := upgrade.IsUpToDate(current.SourceOS, d.SourceOS) &&
+		upgrade.IsReleaseUpToDate(current.Release, d.Release) &&
+		args.Overlay == "" && args.ConfigScript == ""
+
+	if args.Plan {
+		plan, err := upgrader.Plan(d, current.SourceOS)
+		if err != nil {
+			s.Logger().Error("Computing upgrade plan failed")
+			return err
+		}
+		plan.UpToDate = upToDate
+		return writeUpgradePlan(ctx.App.Writer, plan)
+	}
+
+	if upToDate && !args.Force {
+		s.Logger().Info("System is already up to date with '%s' (%s), use --force to upgrade anyway", d.SourceOS.String(), d.SourceOS.GetDigest())
+		return nil
+	}
+
+	if args.Stage {
+		err = upgrader.Stage(d)
+		if err != nil {
+			s.Logger().Error("Staging upgrade failed")
+			return err
+		}
+		s.Logger().Info("Upgrade staged, run 'upgrade --apply-staged' to boot into it on next reboot")
+		return nil
+	}
+
+	// releases deployed in snapshots the upgrade might remove, their extensions are stale afterwards
+	known, err := build.SnapshotReleases(s, "/")
+	if err != nil {
+		s.Logger().Error("Reading releases of the current snapshots failed")
+		return err
+	}
+
 	err = upgrader.Upgrade(d)
 	if err != nil {
 		s.Logger().Error("Upgrade failed")
 		return err
 	}
 
+	removeStaleExtensions(s, known, d.Release)
+
 	s.Logger().Info("Upgrade completed")
 
 	return nil
 }
 
-func digestUpgradeSetup(s *sys.System, flags *cmd.UpgradeFlags) (*deployment.Deployment, error) {
+// removeStaleExtensions removes the extension files of the given known releases which are neither part of
+// the next release nor deployed by any of the remaining snapshots. Extensions are shared by all snapshots,
+// hence they are kept as long as any snapshot a rollback could boot into requires them.
+func removeStaleExtensions(s *sys.System, known []*deployment.ReleaseInfo, next *deployment.ReleaseInfo) {
+	deployed, err := build.SnapshotReleases(s, "/")
+	if err != nil {
+		s.Logger().Warn("Failed reading releases of the remaining snapshots, keeping extensions: %v", err)
+		return
+	}
+
+	for _, ext := range build.StaleExtensions(known, append(deployed, next)) {
+		s.Logger().Info("Removing extension '%s' not required by any snapshot", ext)
+		if err = s.FS().RemoveAll(ext); err != nil {
+			s.Logger().Warn("Failed removing stale extension '%s': %v", ext, err)
+		}
+	}
+}
+
+// validateUpgradeArgs checks the OS image is given either as an image or as part of a release manifest,
+// unless a staged upgrade is applied or discarded
+func validateUpgradeArgs(flags *cmd.UpgradeFlags) error {
+	if flags.ApplyStaged || flags.DiscardStaged {
+		switch {
+		case flags.ApplyStaged && flags.DiscardStaged:
+			return fmt.Errorf("a staged upgrade can't be applied and discarded at the same time")
+		case flags.OperatingSystemImage != "" || flags.ReleaseManifest != "" || flags.Stage:
+			return fmt.Errorf("a staged upgrade can't be applied or discarded while starting a new upgrade")
+		}
+		return nil
+	}
+
+	switch {
+	case flags.OperatingSystemImage == "" && flags.ReleaseManifest == "":
+		return fmt.Errorf("either an OS image or a release manifest is required")
+	case flags.OperatingSystemImage != "" && flags.ReleaseManifest != "":
+		return fmt.Errorf("an OS image and a release manifest can't be set at the same time")
+	case flags.Overlay != "" && flags.ReleaseManifest != "":
+		return fmt.Errorf("an overlay can't be set together with a release manifest")
+	case flags.Stage && flags.ReleaseManifest != "":
+		// extensions and Helm charts are written to shared volumes, they can't wait for the staged snapshot
+		return fmt.Errorf("a release manifest upgrade can't be staged")
+	}
+	return nil
+}
+
+// stagedUpgrade applies or discards the staged upgrade of the running system
+func stagedUpgrade(ctx context.Context, s *sys.System, flags *cmd.UpgradeFlags) error {
+	d, upgrader, err := stagedUpgradeSetup(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	if flags.DiscardStaged {
+		err = upgrader.DiscardStaged(d)
+		if err != nil {
+			s.Logger().Error("Discarding staged upgrade failed")
+			return err
+		}
+		s.Logger().Info("Staged upgrade discarded")
+		return nil
+	}
+
+	known, err := build.SnapshotReleases(s, "/")
+	if err != nil {
+		s.Logger().Error("Reading releases of the current snapshots failed")
+		return err
+	}
+
+	err = upgrader.ApplyStaged(d)
+	if err != nil {
+		s.Logger().Error("Applying staged upgrade failed")
+		return err
+	}
+	removeStaleExtensions(s, known, d.Release)
+	s.Logger().Info("Staged upgrade applied, reboot to boot into the default snapshot")
+
+	return nil
+}
+
+// stagedUpgradeSetup parses the deployment of the running system and returns it together with
+// an upgrader configured for it
+func stagedUpgradeSetup(ctx context.Context, s *sys.System) (*deployment.Deployment, *upgrade.Upgrader, error) {
 	d, err := deployment.Parse(s, "/")
 	if err != nil {
-		return nil, fmt.Errorf("parsing deployment: %w", err)
+		return nil, nil, fmt.Errorf("parsing deployment: %w", err)
 	} else if d == nil {
-		return nil, fmt.Errorf("deployment not found")
+		return nil, nil, fmt.Errorf("deployment not found")
 	}
 
-	srcOS, err := deployment.NewSrcFromURI(flags.OperatingSystemImage)
+	err = d.Sanitize(s, deployment.CheckDiskDevice)
 	if err != nil {
-		return nil, fmt.Errorf("failed parsing OS source URI ('%s'): %w", flags.OperatingSystemImage, err)
+		return nil, nil, fmt.Errorf("inconsistent deployment setup found: %w", err)
+	}
+	if d.BootConfig == nil {
+		d.BootConfig = &deployment.BootConfig{Bootloader: bootloader.BootNone}
+	}
+	if d.Snapshotter == nil {
+		d.Snapshotter = &deployment.SnapshotterConfig{Name: "snapper"}
+	}
+
+	bootloader, err := bootloader.New(
+		d.BootConfig.Bootloader, s, bootloader.WithBootAttempts(d.BootConfig.BootAttempts),
+		bootloader.WithSecureBoot(d.SecureBoot), bootloader.WithLegacyBIOS(d.IsBIOSEnabled()),
+	)
+	if err != nil {
+		s.Logger().Error("Parsing boot config failed")
+		return nil, nil, err
+	}
+
+	snapshotter, err := transaction.New(ctx, s, d, d.Snapshotter.Name)
+	if err != nil {
+		s.Logger().Error("Parsing snapshotter config failed")
+		return nil, nil, err
+	}
+
+	upgrader := upgrade.New(ctx, s, upgrade.WithBootloader(bootloader), upgrade.WithTransaction(snapshotter))
+	return d, upgrader, nil
+}
+
+// digestUpgradeSetup produces the Deployment object required to describe the upgrade parameters.
+// It also returns the current deployment as found in the system. If a release manifest is given
+// its extensions and Helm charts are staged in the given working directory.
+func digestUpgradeSetup(ctx context.Context, s *sys.System, flags *cmd.UpgradeFlags, workDir image.BuildDir) (*deployment.Deployment, *deployment.Deployment, error) {
+	d, err := deployment.Parse(s, "/")
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing deployment: %w", err)
+	} else if d == nil {
+		return nil, nil, fmt.Errorf("deployment not found")
+	}
+	current := *d
+	// the rollback record belongs to the current snapshot, not to the upgraded one
+	d.Rollback = nil
+
+	if flags.ReleaseManifest != "" {
+		err = releaseUpgradeSetup(ctx, s, d, flags, workDir)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		srcOS, err := deployment.NewSrcFromURI(flags.OperatingSystemImage)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed parsing OS source URI ('%s'): %w", flags.OperatingSystemImage, err)
+		}
+		d.SourceOS = srcOS
 	}
-	d.SourceOS = srcOS
 
 	if flags.Overlay != "" {
 		overlay, err := deployment.NewSrcFromURI(flags.Overlay)
 		if err != nil {
-			return nil, fmt.Errorf("failed parsing overlay source URI ('%s'): %w", flags.Overlay, err)
+			return nil, nil, fmt.Errorf("failed parsing overlay source URI ('%s'): %w", flags.Overlay, err)
 		}
 		d.OverlayTree = overlay
 	}
@@ -108,7 +323,15 @@ func digestUpgradeSetup(s *sys.System, flags *cmd.UpgradeFlags) (*deployment.Dep
 		d.CfgScript = flags.ConfigScript
 	}
 
-	if flags.CreateBootEntry {
+	// a plan does not install any boot artifact
+	err = setSecureBootKeys(d, flags.SecureBootKey, flags.SecureBootCert, flags.AllowUnsigned || flags.Plan)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if flags.CreateBootEntry && !firmware.IsEFI(s) {
+		s.Logger().Warn("No EFI firmware found, skipping EFI boot entry creation")
+	} else if flags.CreateBootEntry {
 		if d.Firmware == nil {
 			d.Firmware = &deployment.FirmwareConfig{}
 		}
@@ -119,7 +342,87 @@ func digestUpgradeSetup(s *sys.System, flags *cmd.UpgradeFlags) (*deployment.Dep
 
 	err = d.Sanitize(s, deployment.CheckDiskDevice)
 	if err != nil {
-		return nil, fmt.Errorf("inconsistent deployment setup found: %w", err)
+		return nil, nil, fmt.Errorf("inconsistent deployment setup found: %w", err)
+	}
+	return d, &current, nil
+}
+
+// releaseUpgradeSetup sets the OS image of the given release manifest to the deployment and stages
+// the release systemd extensions and Helm charts as the deployment overlay tree
+func releaseUpgradeSetup(ctx context.Context, s *sys.System, d *deployment.Deployment, flags *cmd.UpgradeFlags, workDir image.BuildDir) error {
+	builder := &build.Builder{
+		System:       s,
+		DownloadFile: http.DownloadFile,
+		Local:        flags.Local,
+	}
+
+	var rel *build.ReleaseUpgrade
+	var err error
+	if flags.Plan {
+		// the plan only lists the release content, nothing is pulled
+		rel, err = builder.PlanReleaseUpgrade(flags.ReleaseManifest, d.Release, "/", workDir)
+	} else {
+		rel, err = builder.PrepareReleaseUpgrade(ctx, flags.ReleaseManifest, d.Release, "/", workDir)
+	}
+	if err != nil {
+		return fmt.Errorf("preparing release upgrade: %w", err)
+	}
+
+	d.SourceOS = deployment.NewOCISrc(rel.OSImage)
+	if rel.Overlay != "" {
+		d.OverlayTree = deployment.NewDirSrc(rel.Overlay)
+	}
+	d.Release = rel.Release
+	return nil
+}
+
+// writeUpgradePlan prints the given upgrade plan in a human readable format
+func writeUpgradePlan(out io.Writer, plan *upgrade.Plan) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "OS image:")
+	fmt.Fprintf(w, "  Target:\t%s\n", plan.Source.String())
+	fmt.Fprintf(w, "  Target digest:\t%s\n", plan.Source.GetDigest())
+	if plan.Current != nil {
+		fmt.Fprintf(w, "  Current:\t%s\n", plan.Current.String())
+		fmt.Fprintf(w, "  Current digest:\t%s\n", plan.Current.GetDigest())
+	}
+	fmt.Fprintf(w, "  Up to date:\t%s\n", yesNo(plan.UpToDate))
+
+	if plan.Release != nil {
+		fmt.Fprintln(w, "\nRelease:")
+		fmt.Fprintf(w, "  Manifest:\t%s\n", plan.Release.ManifestURI)
+		fmt.Fprintf(w, "  Version:\t%s\n", plan.Release.Version)
+		var extensions []string
+		for _, ext := range plan.Release.Extensions {
+			extensions = append(extensions, ext.Name)
+		}
+		if len(extensions) > 0 {
+			fmt.Fprintf(w, "  Extensions:\t%s\n", strings.Join(extensions, ", "))
+		}
 	}
-	return d, nil
+
+	fmt.Fprintln(w, "\nSnapshots:")
+	base := "none"
+	if plan.BaseSnapshot > 0 {
+		base = strconv.Itoa(plan.BaseSnapshot)
+	}
+	fmt.Fprintf(w, "  Base snapshot:\t%s\n", base)
+	merged := "none"
+	if len(plan.MergedVolumes) > 0 {
+		merged = strings.Join(plan.MergedVolumes, ", ")
+	}
+	fmt.Fprintf(w, "  Merged RW volumes:\t%s\n", merged)
+
+	fmt.Fprintln(w, "\nBootloader:")
+	fmt.Fprintf(w, "  Bootloader:\t%s\n", plan.Bootloader)
+	fmt.Fprintf(w, "  New default entry cmdline:\t%s\n", plan.KernelCmdline)
+	if plan.RecoveryKernelCmdline != "" {
+		fmt.Fprintf(w, "  Recovery entry cmdline:\t%s\n", plan.RecoveryKernelCmdline)
+	}
+	if len(plan.EFIBootEntries) > 0 {
+		fmt.Fprintf(w, "  EFI boot entries:\t%s\n", strings.Join(plan.EFIBootEntries, ", "))
+	}
+
+	return w.Flush()
 }
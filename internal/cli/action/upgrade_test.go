@@ -19,6 +19,7 @@ package action_test
 
 import (
 	"bytes"
+	"context"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -53,7 +54,7 @@ var _ = Describe("Upgrade action", Label("upgrade"), func() {
 			sys.WithLogger(log.New(log.WithBuffer(buffer))),
 		)
 		Expect(err).NotTo(HaveOccurred())
-		ctx = cli.NewContext(cli.NewApp(), nil, &cli.Context{})
+		ctx = cli.NewContext(cli.NewApp(), nil, &cli.Context{Context: context.Background()})
 		if ctx.App.Metadata == nil {
 			ctx.App.Metadata = map[string]any{}
 		}
@@ -67,6 +68,46 @@ var _ = Describe("Upgrade action", Label("upgrade"), func() {
 		ctx.App.Metadata["system"] = nil
 		Expect(action.Upgrade(ctx)).NotTo(Succeed())
 	})
+	It("fails if neither an OS image nor a release manifest is given", func() {
+		err = action.Upgrade(ctx)
+		Expect(err).To(MatchError("either an OS image or a release manifest is required"))
+	})
+	It("fails if both an OS image and a release manifest are given", func() {
+		cmd.UpgradeArgs.OperatingSystemImage = "my.registry.org/my/image:test"
+		cmd.UpgradeArgs.ReleaseManifest = "oci://my.registry.org/my/release:test"
+		err = action.Upgrade(ctx)
+		Expect(err).To(MatchError("an OS image and a release manifest can't be set at the same time"))
+	})
+	It("fails if an overlay is given together with a release manifest", func() {
+		cmd.UpgradeArgs.ReleaseManifest = "oci://my.registry.org/my/release:test"
+		cmd.UpgradeArgs.Overlay = "dir:///some/overlay"
+		err = action.Upgrade(ctx)
+		Expect(err).To(MatchError("an overlay can't be set together with a release manifest"))
+	})
+	It("fails if a release manifest upgrade is staged", func() {
+		cmd.UpgradeArgs.ReleaseManifest = "oci://my.registry.org/my/release:test"
+		cmd.UpgradeArgs.Stage = true
+		err = action.Upgrade(ctx)
+		Expect(err).To(MatchError("a release manifest upgrade can't be staged"))
+	})
+	It("fails if a staged upgrade is applied and discarded at once", func() {
+		cmd.UpgradeArgs.ApplyStaged = true
+		cmd.UpgradeArgs.DiscardStaged = true
+		err = action.Upgrade(ctx)
+		Expect(err).To(MatchError("a staged upgrade can't be applied and discarded at the same time"))
+	})
+	It("fails if a staged upgrade is applied together with a new upgrade", func() {
+		cmd.UpgradeArgs.ApplyStaged = true
+		cmd.UpgradeArgs.OperatingSystemImage = "my.registry.org/my/image:test"
+		err = action.Upgrade(ctx)
+		Expect(err).To(MatchError("a staged upgrade can't be applied or discarded while starting a new upgrade"))
+	})
+	It("fails to apply a staged upgrade if the setup is inconsistent", func() {
+		cmd.UpgradeArgs.ApplyStaged = true
+		err = action.Upgrade(ctx)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("inconsistent deployment"))
+	})
 	It("fails to start the upgrade if the deployment file does not exist", func() {
 		Expect(tfs.RemoveAll("/etc/elemental")).To(Succeed())
 		cmd.UpgradeArgs.OperatingSystemImage = "my.registry.org/my/image:test"
@@ -31,6 +31,9 @@ type BuildFlags struct {
 	BuildDir   string
 	OutputPath string
 	Local      bool
+	KeepRAW    bool
+	Rootless   bool
+	CacheDir   string
 }
 
 var BuildArgs BuildFlags
@@ -44,7 +47,7 @@ func NewBuildCommand(appName string, action func(*cli.Context) error) *cli.Comma
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:        "image-type",
-				Usage:       "Type of image artifact to build (RAW or ISO)",
+				Usage:       "Type of image artifact to build (raw, qcow2, qcow2-compressed, vmdk, vmdk-compressed, vhdx or iso)",
 				Destination: &BuildArgs.ImageType,
 				Required:    true,
 			},
@@ -73,11 +76,26 @@ func NewBuildCommand(appName string, action func(*cli.Context) error) *cli.Comma
 				Destination: &BuildArgs.OutputPath,
 				DefaultText: "image-<timestamp>.<image-type>",
 			},
+			&cli.BoolFlag{
+				Name:        "keep-raw",
+				Usage:       "Keep the intermediate RAW disk image of non RAW image types",
+				Destination: &BuildArgs.KeepRAW,
+			},
 			&cli.BoolFlag{
 				Name:        "local",
 				Usage:       "Load OCI images from the local container storage instead of a remote registry",
 				Destination: &BuildArgs.Local,
 			},
+			&cli.BoolFlag{
+				Name:        "rootless",
+				Usage:       "Populate the disk image offline, without loop devices, mounts nor chroots",
+				Destination: &BuildArgs.Rootless,
+			},
+			&cli.StringFlag{
+				Name:        "cache-dir",
+				Usage:       "Full path to a persistent cache directory for OCI images and downloads shared across builds",
+				Destination: &BuildArgs.CacheDir,
+			},
 		},
 	}
 }
@@ -34,6 +34,8 @@ type InstallerFlags struct {
 	Overlay              string
 	Label                string
 	KernelCmdLine        string
+	ImageFormat          string
+	ImageCompression     string
 }
 
 var InstallerArgs InstallerFlags
@@ -119,6 +121,16 @@ func NewBuildISOCommand(appName string, action func(*cli.Context) error) *cli.Co
 				Usage:       "Kernel command line to boot the installer media",
 				Destination: &InstallerArgs.KernelCmdLine,
 			},
+			&cli.StringFlag{
+				Name:        "image-format",
+				Usage:       "Format of the OS image of the installer media and recovery partition [squashfs, erofs]",
+				Destination: &InstallerArgs.ImageFormat,
+			},
+			&cli.StringFlag{
+				Name:        "image-compression",
+				Usage:       "Compression algorithm of the OS image of the installer media, 'none' disables compression",
+				Destination: &InstallerArgs.ImageCompression,
+			},
 		},
 	}
 }
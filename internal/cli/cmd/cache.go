@@ -0,0 +1,70 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+type CacheFlags struct {
+	CacheDir  string
+	OlderThan time.Duration
+}
+
+var CacheArgs CacheFlags
+
+func NewCacheCommand(appName string, listAction, pruneAction func(*cli.Context) error) *cli.Command {
+	cacheDir := &cli.StringFlag{
+		Name:        "cache-dir",
+		Usage:       "Full path to the build cache directory",
+		Destination: &CacheArgs.CacheDir,
+		Required:    true,
+	}
+
+	return &cli.Command{
+		Name:      "cache",
+		Usage:     "Manage the persistent build cache",
+		UsageText: fmt.Sprintf("%s cache COMMAND", appName),
+		Subcommands: []*cli.Command{
+			{
+				Name:      "list",
+				Usage:     "List the OCI images and downloads stored in the cache",
+				UsageText: fmt.Sprintf("%s cache list [OPTIONS]", appName),
+				Action:    listAction,
+				Flags:     []cli.Flag{cacheDir},
+			},
+			{
+				Name:      "prune",
+				Usage:     "Remove the cache entries not used recently",
+				UsageText: fmt.Sprintf("%s cache prune [OPTIONS]", appName),
+				Action:    pruneAction,
+				Flags: []cli.Flag{
+					cacheDir,
+					&cli.DurationFlag{
+						Name:        "older-than",
+						Usage:       "Only remove the entries not used within the given duration (e.g. 168h), all entries by default",
+						Destination: &CacheArgs.OlderThan,
+					},
+				},
+			},
+		},
+	}
+}
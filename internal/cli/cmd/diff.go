@@ -0,0 +1,59 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+type DiffFlags struct {
+	From   int
+	To     int
+	Volume string
+}
+
+var DiffArgs DiffFlags
+
+func NewDiffCommand(appName string, action func(*cli.Context) error) *cli.Command {
+	return &cli.Command{
+		Name:      "diff",
+		Usage:     "Show the local changes of a snapshotted RW volume compared to the OS image content",
+		UsageText: fmt.Sprintf("%s diff [OPTIONS]", appName),
+		Action:    action,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:        "from",
+				Usage:       "ID of the volume snapshot to compare from, defaults to the stock content of the OS image",
+				Destination: &DiffArgs.From,
+			},
+			&cli.IntFlag{
+				Name:        "to",
+				Usage:       "ID of the volume snapshot to compare to, defaults to the current content",
+				Destination: &DiffArgs.To,
+			},
+			&cli.StringFlag{
+				Name:        "volume",
+				Usage:       "Path of the snapshotted RW volume to compare",
+				Value:       "/etc",
+				Destination: &DiffArgs.Volume,
+			},
+		},
+	}
+}
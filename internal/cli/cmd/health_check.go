@@ -0,0 +1,52 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+type HealthCheckFlags struct {
+	NoRollback bool
+	NoReboot   bool
+}
+
+var HealthCheckArgs HealthCheckFlags
+
+func NewHealthCheckCommand(appName string, action func(*cli.Context) error) *cli.Command {
+	return &cli.Command{
+		Name:      "health-check",
+		Usage:     "Run the deployment health checks and roll back to the previous snapshot on failure",
+		UsageText: fmt.Sprintf("%s health-check [OPTIONS]", appName),
+		Action:    action,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:        "no-rollback",
+				Usage:       "Only report failing health checks without rolling back",
+				Destination: &HealthCheckArgs.NoRollback,
+			},
+			&cli.BoolFlag{
+				Name:        "no-reboot",
+				Usage:       "Do not reboot after rolling back",
+				Destination: &HealthCheckArgs.NoReboot,
+			},
+		},
+	}
+}
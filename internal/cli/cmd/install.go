@@ -32,10 +32,14 @@ type InstallFlags struct {
 	CreateBootEntry      bool
 	Bootloader           string
 	KernelCmdline        string
+	BootAttempts         int
 	Verify               bool
 	Local                bool
 	EnableFips           bool
 	Snapshotter          string
+	SecureBootKey        string
+	SecureBootCert       string
+	AllowUnsigned        bool
 }
 
 var InstallArgs InstallFlags
@@ -83,7 +87,7 @@ func NewInstallCommand(appName string, action func(*cli.Context) error) *cli.Com
 				Name:        "bootloader",
 				Aliases:     []string{"b"},
 				Value:       "grub",
-				Usage:       "Bundled bootloader to install to ESP",
+				Usage:       "Bundled bootloader to install to ESP [grub, systemd-boot, none]",
 				Destination: &InstallArgs.Bootloader,
 			},
 			&cli.StringFlag{
@@ -92,6 +96,11 @@ func NewInstallCommand(appName string, action func(*cli.Context) error) *cli.Com
 				Usage:       "Kernel cmdline for installed system",
 				Destination: &InstallArgs.KernelCmdline,
 			},
+			&cli.IntFlag{
+				Name:        "boot-attempts",
+				Usage:       "Number of failed boots of a new snapshot before falling back to the previous one, 0 disables boot counting",
+				Destination: &InstallArgs.BootAttempts,
+			},
 			&cli.BoolFlag{
 				Name:        "verify",
 				Value:       true,
@@ -114,6 +123,21 @@ func NewInstallCommand(appName string, action func(*cli.Context) error) *cli.Com
 				Value:       "snapper",
 				Destination: &InstallArgs.Snapshotter,
 			},
+			&cli.StringFlag{
+				Name:        "secure-boot-key",
+				Usage:       "Path of the Secure Boot private key to sign the boot artifacts with",
+				Destination: &InstallArgs.SecureBootKey,
+			},
+			&cli.StringFlag{
+				Name:        "secure-boot-cert",
+				Usage:       "Path of the Secure Boot certificate matching the key",
+				Destination: &InstallArgs.SecureBootCert,
+			},
+			&cli.BoolFlag{
+				Name:        "allow-unsigned",
+				Usage:       "Install unsigned boot artifacts if no Secure Boot keys are given for a Secure Boot deployment",
+				Destination: &InstallArgs.AllowUnsigned,
+			},
 		},
 	}
 }
@@ -0,0 +1,71 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+type ResetFlags struct {
+	Description    string
+	KeepVolumes    cli.StringSlice
+	SecureBootKey  string
+	SecureBootCert string
+	AllowUnsigned  bool
+}
+
+var ResetArgs ResetFlags
+
+func NewResetCommand(appName string, action func(*cli.Context) error) *cli.Command {
+	return &cli.Command{
+		Name:      "reset",
+		Usage:     "Reinstall the system from the recovery partition",
+		UsageText: fmt.Sprintf("%s reset [OPTIONS]", appName),
+		Action:    action,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "description",
+				Aliases:     []string{"d"},
+				Usage:       "Description file to read reset details, defaults to the one stored in the recovery partition",
+				Destination: &ResetArgs.Description,
+			},
+			&cli.StringSliceFlag{
+				Name:        "keep-volume",
+				Usage:       "Path of a non snapshotted RW volume to keep, all other volumes are wiped. Can be set multiple times",
+				Destination: &ResetArgs.KeepVolumes,
+			},
+			&cli.StringFlag{
+				Name:        "secure-boot-key",
+				Usage:       "Path of the Secure Boot private key to sign the boot artifacts with",
+				Destination: &ResetArgs.SecureBootKey,
+			},
+			&cli.StringFlag{
+				Name:        "secure-boot-cert",
+				Usage:       "Path of the Secure Boot certificate matching the key",
+				Destination: &ResetArgs.SecureBootCert,
+			},
+			&cli.BoolFlag{
+				Name:        "allow-unsigned",
+				Usage:       "Install unsigned boot artifacts if no Secure Boot keys are given for a Secure Boot deployment",
+				Destination: &ResetArgs.AllowUnsigned,
+			},
+		},
+	}
+}
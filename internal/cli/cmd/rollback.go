@@ -0,0 +1,46 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+type RollbackFlags struct {
+	To int
+}
+
+var RollbackArgs RollbackFlags
+
+func NewRollbackCommand(appName string, action func(*cli.Context) error) *cli.Command {
+	return &cli.Command{
+		Name:      "rollback",
+		Usage:     "Set a previous snapshot as the default one to boot from",
+		UsageText: fmt.Sprintf("%s rollback [OPTIONS]", appName),
+		Action:    action,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:        "to",
+				Usage:       "ID of the snapshot to roll back to, defaults to the one previous to the current default",
+				Destination: &RollbackArgs.To,
+			},
+		},
+	}
+}
@@ -0,0 +1,46 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+func NewSnapshotCommand(appName string, pinAction, unpinAction func(*cli.Context) error) *cli.Command {
+	return &cli.Command{
+		Name:      "snapshot",
+		Usage:     "Manage the snapshots of the system",
+		UsageText: fmt.Sprintf("%s snapshot COMMAND", appName),
+		Subcommands: []*cli.Command{
+			{
+				Name:      "pin",
+				Usage:     "Pin a snapshot so it is never cleaned up",
+				UsageText: fmt.Sprintf("%s snapshot pin ID", appName),
+				Action:    pinAction,
+			},
+			{
+				Name:      "unpin",
+				Usage:     "Unpin a snapshot so it is cleaned up according to the snapshots retention",
+				UsageText: fmt.Sprintf("%s snapshot unpin ID", appName),
+				Action:    unpinAction,
+			},
+		},
+	}
+}
@@ -25,11 +25,20 @@ import (
 
 type UpgradeFlags struct {
 	OperatingSystemImage string
+	ReleaseManifest      string
 	ConfigScript         string
 	Overlay              string
 	Verify               bool
 	CreateBootEntry      bool
 	Local                bool
+	Force                bool
+	Plan                 bool
+	Stage                bool
+	ApplyStaged          bool
+	DiscardStaged        bool
+	SecureBootKey        string
+	SecureBootCert       string
+	AllowUnsigned        bool
 }
 
 var UpgradeArgs UpgradeFlags
@@ -37,7 +46,7 @@ var UpgradeArgs UpgradeFlags
 func NewUpgradeCommand(appName string, action func(*cli.Context) error) *cli.Command {
 	return &cli.Command{
 		Name:      "upgrade",
-		Usage:     "Upgrade system from an OS image",
+		Usage:     "Upgrade system from an OS image or a release manifest",
 		UsageText: fmt.Sprintf("%s upgrade [OPTIONS]", appName),
 		Action:    action,
 		Flags: []cli.Flag{
@@ -45,7 +54,11 @@ func NewUpgradeCommand(appName string, action func(*cli.Context) error) *cli.Com
 				Name:        "os-image",
 				Usage:       "URI to the image containing the operating system",
 				Destination: &UpgradeArgs.OperatingSystemImage,
-				Required:    true,
+			},
+			&cli.StringFlag{
+				Name:        "release-manifest",
+				Usage:       "URI to the release manifest to upgrade to, including its systemd extensions and Helm charts",
+				Destination: &UpgradeArgs.ReleaseManifest,
 			},
 			&cli.StringFlag{
 				Name:        "config",
@@ -73,6 +86,46 @@ func NewUpgradeCommand(appName string, action func(*cli.Context) error) *cli.Com
 				Usage:       "Load OCI images from the local container storage instead of a remote registry",
 				Destination: &UpgradeArgs.Local,
 			},
+			&cli.BoolFlag{
+				Name:        "force",
+				Usage:       "Upgrade even if the OS image digest matches the one of the current deployment",
+				Destination: &UpgradeArgs.Force,
+			},
+			&cli.BoolFlag{
+				Name:        "plan",
+				Usage:       "Print the changes the upgrade would apply without modifying the system",
+				Destination: &UpgradeArgs.Plan,
+			},
+			&cli.BoolFlag{
+				Name:        "stage",
+				Usage:       "Prepare the upgraded snapshot without setting it as the default one to boot from",
+				Destination: &UpgradeArgs.Stage,
+			},
+			&cli.BoolFlag{
+				Name:        "apply-staged",
+				Usage:       "Set the staged snapshot as the default one to boot from",
+				Destination: &UpgradeArgs.ApplyStaged,
+			},
+			&cli.BoolFlag{
+				Name:        "discard-staged",
+				Usage:       "Delete the staged snapshot",
+				Destination: &UpgradeArgs.DiscardStaged,
+			},
+			&cli.StringFlag{
+				Name:        "secure-boot-key",
+				Usage:       "Path of the Secure Boot private key to sign the boot artifacts with",
+				Destination: &UpgradeArgs.SecureBootKey,
+			},
+			&cli.StringFlag{
+				Name:        "secure-boot-cert",
+				Usage:       "Path of the Secure Boot certificate matching the key",
+				Destination: &UpgradeArgs.SecureBootCert,
+			},
+			&cli.BoolFlag{
+				Name:        "allow-unsigned",
+				Usage:       "Install unsigned boot artifacts if no Secure Boot keys are given for a Secure Boot deployment",
+				Destination: &UpgradeArgs.AllowUnsigned,
+			},
 		},
 	}
 }
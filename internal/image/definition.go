@@ -18,6 +18,9 @@ limitations under the License.
 package image
 
 import (
+	"path/filepath"
+	"strings"
+
 	"github.com/suse/elemental/v3/internal/image/install"
 	"github.com/suse/elemental/v3/internal/image/kubernetes"
 	"github.com/suse/elemental/v3/internal/image/release"
@@ -26,9 +29,30 @@ import (
 )
 
 const (
-	TypeRAW = "raw"
+	TypeRAW             = "raw"
+	TypeQCOW2           = "qcow2"
+	TypeQCOW2Compressed = "qcow2-compressed"
+	TypeVMDK            = "vmdk"
+	TypeVMDKCompressed  = "vmdk-compressed"
+	TypeVHDX            = "vhdx"
+	TypeISO             = "iso"
+
+	compressedSuffix = "-compressed"
 )
 
+// DiskImageTypes lists the disk image types, all but RAW are converted from a RAW disk image
+var DiskImageTypes = []string{TypeRAW, TypeQCOW2, TypeQCOW2Compressed, TypeVMDK, TypeVMDKCompressed, TypeVHDX}
+
+// FileExtension returns the file extension of the given image type
+func FileExtension(imageType string) string {
+	return strings.TrimSuffix(imageType, compressedSuffix)
+}
+
+// IsCompressed returns true if the given image type is a compressed variant
+func IsCompressed(imageType string) bool {
+	return strings.HasSuffix(imageType, compressedSuffix)
+}
+
 type Definition struct {
 	Image        Image
 	Installation install.Installation
@@ -42,6 +66,21 @@ type Image struct {
 	ImageType       string
 	Platform        *platform.Platform
 	OutputImageName string
+	// KeepRAW keeps the intermediate RAW disk image of converted image types
+	KeepRAW bool
+}
+
+// RAWImageName returns the path of the RAW disk image the output image is converted from, which
+// is the output image itself for RAW images
+func (i Image) RAWImageName() string {
+	if i.ImageType == TypeRAW {
+		return i.OutputImageName
+	}
+	raw := strings.TrimSuffix(i.OutputImageName, filepath.Ext(i.OutputImageName)) + "." + TypeRAW
+	if raw == i.OutputImageName {
+		raw += "." + TypeRAW
+	}
+	return raw
 }
 
 type Network struct {
@@ -17,7 +17,12 @@ limitations under the License.
 
 package install
 
-import "regexp"
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/suse/elemental/v3/pkg/deployment"
+)
 
 type DiskSize string
 
@@ -25,8 +30,48 @@ func (d DiskSize) IsValid() bool {
 	return regexp.MustCompile(`^[1-9]\d*[KMGT]$`).MatchString(string(d))
 }
 
+// MiB returns the disk size in MiB, sizes not aligned to MiB are rounded up. Returns zero
+// for invalid sizes.
+func (d DiskSize) MiB() deployment.MiB {
+	if !d.IsValid() {
+		return 0
+	}
+
+	size, _ := strconv.ParseUint(string(d[:len(d)-1]), 10, 64)
+	switch d[len(d)-1] {
+	case 'K':
+		size = (size + 1023) / 1024
+	case 'G':
+		size *= 1024
+	case 'T':
+		size *= 1024 * 1024
+	}
+	return deployment.MiB(size)
+}
+
 type Installation struct {
 	Bootloader    string   `yaml:"bootloader"`
 	KernelCmdLine string   `yaml:"kernelCmdLine"`
 	DiskSize      DiskSize `yaml:"diskSize"`
+	BootAttempts  int      `yaml:"bootAttempts,omitempty"`
+	// HealthChecks are executed on the first boot after each upgrade
+	HealthChecks []deployment.HealthCheck `yaml:"healthChecks,omitempty"`
+	// SecureBoot signs the boot artifacts installed into the ESP with the given keys
+	SecureBoot *deployment.SecureBoot `yaml:"secureBoot,omitempty"`
+	// BIOS adds a BIOS boot partition and installs GRUB for legacy BIOS boot in addition to EFI
+	BIOS bool `yaml:"bios,omitempty"`
+	// DiskSelector selects the target disk when installing from an installer ISO, the first disk
+	// not holding the installer media is selected if unset
+	DiskSelector *deployment.DiskSelector `yaml:"diskSelector,omitempty"`
+	// Swap configures the swap partition, swap file and zram device of the installation
+	Swap *Swap `yaml:"swap,omitempty"`
+}
+
+type Swap struct {
+	// PartitionSize adds a swap partition of the given size in MiB
+	PartitionSize deployment.MiB `yaml:"partitionSize,omitempty"`
+	// File is created within a non snapshotted RW volume with copy on write disabled, such as /var
+	File *deployment.SwapFile `yaml:"file,omitempty"`
+	// Zram configures a compressed swap device in RAM
+	Zram *deployment.ZramConfig `yaml:"zram,omitempty"`
 }
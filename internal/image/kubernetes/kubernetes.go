@@ -37,7 +37,10 @@ type Kubernetes struct {
 	LocalManifests []string
 	Nodes          Nodes   `yaml:"nodes,omitempty"`
 	Network        Network `yaml:"network,omitempty"`
-	Config         Config  `yaml:"-"`
+	// Airgap embeds the Helm charts and the container images of the cluster within the image,
+	// so nodes come up without access to any chart repository nor container registry
+	Airgap bool   `yaml:"airgap,omitempty"`
+	Config Config `yaml:"-"`
 }
 
 type Config struct {
@@ -38,11 +38,12 @@ type OCIUnpacker interface {
 }
 
 type ociUnpacker struct {
-	system *sys.System
+	system   *sys.System
+	cacheDir string
 }
 
 func (o *ociUnpacker) Unpack(ctx context.Context, uri, dest string, local bool) (digest string, err error) {
-	unpacker := unpack.NewOCIUnpacker(o.system, uri, unpack.WithLocalOCI(local))
+	unpacker := unpack.NewOCIUnpacker(o.system, uri, unpack.WithLocalOCI(local), unpack.WithCacheDirOCI(o.cacheDir))
 	return unpacker.Unpack(ctx, dest)
 }
 
@@ -59,7 +60,10 @@ type OCIReleaseManifestExtractor struct {
 	// this root store path.
 	//
 	// Defaults to the OS temporary directory.
-	store    string
+	store string
+	// Location of a persistent cache for the pulled OCI images.
+	// Only used by the default unpacker.
+	cacheDir string
 	unpacker OCIUnpacker
 	fs       vfs.FS
 	ctx      context.Context
@@ -79,6 +83,12 @@ func WithStore(store string) Opts {
 	}
 }
 
+func WithCacheDir(dir string) Opts {
+	return func(r *OCIReleaseManifestExtractor) {
+		r.cacheDir = dir
+	}
+}
+
 func WithSearchPaths(globs []string) Opts {
 	return func(r *OCIReleaseManifestExtractor) {
 		r.searchPaths = globs
@@ -131,7 +141,8 @@ func New(opts ...Opts) (*OCIReleaseManifestExtractor, error) {
 		}
 
 		extr.unpacker = &ociUnpacker{
-			system: s,
+			system:   s,
+			cacheDir: extr.cacheDir,
 		}
 	}
 
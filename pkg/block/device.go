@@ -25,6 +25,7 @@ import (
 )
 
 type Device interface {
+	GetAllDisks() (DiskList, error)
 	GetAllPartitions() (PartitionList, error)
 	GetDevicePartitions(device string) (PartitionList, error)
 	GetDeviceSectorSize(device string) (uint, error)
@@ -46,6 +47,19 @@ type Partition struct {
 
 type PartitionList []*Partition
 
+// Disk struct represents a whole disk device, size in MiB
+type Disk struct {
+	Path        string
+	Size        uint
+	Rotational  bool
+	Transport   string
+	Serial      string
+	WWN         string
+	MountPoints []string
+}
+
+type DiskList []*Disk
+
 // GetByName gets a partitions by its name from the PartitionList
 func (pl PartitionList) GetByName(name string) *Partition {
 	var part *Partition
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/suse/elemental/v3/pkg/block"
 	"github.com/suse/elemental/v3/pkg/sys"
@@ -50,6 +51,62 @@ type jPart struct {
 
 type jParts []*block.Partition
 
+type jDisk struct {
+	Path        string   `json:"path,omitempty"`
+	Size        uint64   `json:"size,omitempty"`
+	Rotational  jBool    `json:"rota,omitempty"`
+	Transport   string   `json:"tran,omitempty"`
+	Serial      string   `json:"serial,omitempty"`
+	WWN         string   `json:"wwn,omitempty"`
+	MountPoints []string `json:"mountpoints,omitempty"`
+	Type        string   `json:"type,omitempty"`
+}
+
+type jDisks []*block.Disk
+
+// jBool is a boolean reported either as a JSON boolean or as a "0" or "1" string by older lsblk versions
+type jBool bool
+
+func (b *jBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", `"1"`, "1":
+		*b = true
+	case "false", `"0"`, "0", "null":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean value: %s", string(data))
+	}
+	return nil
+}
+
+func (d *jDisks) UnmarshalJSON(data []byte) error {
+	var devices []jDisk
+
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return err
+	}
+
+	var disks jDisks
+	for _, dev := range devices {
+		// filter only disk devices
+		if dev.Type != "disk" {
+			continue
+		}
+		// Converts B to MB
+		disks = append(disks, &block.Disk{
+			Path:        dev.Path,
+			Size:        uint(dev.Size / (1024 * 1024)),
+			Rotational:  bool(dev.Rotational),
+			Transport:   dev.Transport,
+			Serial:      dev.Serial,
+			WWN:         dev.WWN,
+			MountPoints: slices.DeleteFunc(dev.MountPoints, func(m string) bool { return m == "" }),
+		})
+	}
+	*d = disks
+	return nil
+}
+
 func (p jPart) Partition() *block.Partition {
 	// Converts B to MB
 	return &block.Partition{
@@ -103,6 +160,26 @@ func unmarshalLsblk(lsblkOut []byte) ([]*block.Partition, error) {
 	return parts, nil
 }
 
+func unmarshalLsblkDisks(lsblkOut []byte) ([]*block.Disk, error) {
+	var objmap map[string]*json.RawMessage
+	err := json.Unmarshal(lsblkOut, &objmap)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := objmap["blockdevices"]; !ok {
+		return nil, errors.New("invalid json object, no 'blockdevices' key found")
+	}
+
+	var disks jDisks
+	err = json.Unmarshal(*objmap["blockdevices"], &disks)
+	if err != nil {
+		return nil, err
+	}
+
+	return disks, nil
+}
+
 func unmarshalSectorSize(lsblkOut []byte) (uint, error) {
 	var objmap map[string]*json.RawMessage
 	err := json.Unmarshal(lsblkOut, &objmap)
@@ -128,6 +205,16 @@ func unmarshalSectorSize(lsblkOut []byte) (uint, error) {
 	return devices[0].SectorSize, nil
 }
 
+// GetAllDisks gets a slice of all disk devices found in the host, partitions are not included
+func (l lsDevice) GetAllDisks() (block.DiskList, error) {
+	out, err := l.runner.Run("lsblk", "-p", "-b", "-d", "-n", "-J", "--output", "PATH,SIZE,ROTA,TRAN,SERIAL,WWN,MOUNTPOINTS,TYPE")
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalLsblkDisks(out)
+}
+
 // GetAllPartitions gets a slice of all partition devices found in the host
 // mapped into a v1.PartitionList object.
 func (l lsDevice) GetAllPartitions() (block.PartitionList, error) {
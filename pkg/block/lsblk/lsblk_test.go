@@ -106,6 +106,38 @@ const partsPortionLslbkOut = `,{
          "type": "part"
       }`
 
+const disksLsblk = `{
+   "blockdevices": [
+      {
+         "path": "/dev/sda",
+         "size": 512110190592,
+         "rota": true,
+         "tran": "sata",
+         "serial": "WD-123",
+         "wwn": "0x50014ee2b5a1c3d4",
+         "mountpoints": [null],
+         "type": "disk"
+      },{
+         "path": "/dev/nvme0n1",
+         "size": 256060514304,
+         "rota": "0",
+         "tran": "nvme",
+         "serial": "S4EWNX0",
+         "wwn": null,
+         "mountpoints": [null],
+         "type": "disk"
+      },{
+         "path": "/dev/sr0",
+         "size": 1073741824,
+         "rota": false,
+         "tran": "sata",
+         "mountpoints": ["/run/initramfs/live"],
+         "type": "rom"
+      }
+   ]
+}
+`
+
 func TestLsBlockSuite(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "LsBlock test suite")
@@ -206,6 +238,33 @@ var _ = Describe("BlockDevice", Label("lsblk"), func() {
 			Expect(err).To(HaveOccurred())
 		})
 	})
+	Describe("GetAllDisks", func() {
+		It("lists all disks found by lsblk", func() {
+			json = disksLsblk
+			disks, err := b.GetAllDisks()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(disks).To(Equal(block.DiskList{
+				{
+					Path: "/dev/sda", Size: 488386, Rotational: true, Transport: "sata",
+					Serial: "WD-123", WWN: "0x50014ee2b5a1c3d4", MountPoints: []string{},
+				},
+				{Path: "/dev/nvme0n1", Size: 244198, Transport: "nvme", Serial: "S4EWNX0", MountPoints: []string{}},
+			}))
+			Expect(runner.CmdsMatch([][]string{{
+				"lsblk", "-p", "-b", "-d", "-n", "-J", "--output", "PATH,SIZE,ROTA,TRAN,SERIAL,WWN,MOUNTPOINTS,TYPE",
+			}})).To(Succeed())
+		})
+		It("fails on invalid lsblk output", func() {
+			json = `{"blockdevices": [{"path": "/dev/sda", "rota": "maybe", "type": "disk"}]}`
+			_, err := b.GetAllDisks()
+			Expect(err).To(MatchError("invalid boolean value: \"maybe\""))
+		})
+		It("lsblk call fails", func() {
+			lsblkErr = fmt.Errorf("new lsblk error")
+			_, err := b.GetAllDisks()
+			Expect(err).To(HaveOccurred())
+		})
+	})
 	Describe("GetPartitionByLabel", func() {
 		var cmds [][]string
 		BeforeEach(func() {
@@ -21,18 +21,123 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/secureboot"
 	"github.com/suse/elemental/v3/pkg/sys"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
 )
 
 type Bootloader interface {
 	Install(rootPath, espDir, espLabel, entryID, kernelCmdline, recKernelCmdline string) error
 	InstallLive(rootPath, espDir, kernelCmdline string) error
 	Prune(rootPath, espDir string, keepEntryIDs []int) error
+	SetDefaultEntry(espDir, entryID string) error
+	GetEntries(espDir string) ([]BootEntry, error)
+}
+
+// BootCounter is implemented by bootloaders able to fall back to the previous default entry
+// when a new default entry fails to boot
+type BootCounter interface {
+	// SetDefaultEntryWithFallback sets the given existing entry as the default one and arms the boot
+	// counter to fall back to the current default entry if boot counting is enabled
+	SetDefaultEntryWithFallback(espDir, entryID string) error
+}
+
+// BootEntry describes a boot entry installed by the bootloader
+type BootEntry struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+	Linux       string `json:"linux"`
+	Initrd      string `json:"initrd"`
+	CmdLine     string `json:"cmdline"`
+}
+
+// options holds the setup shared by the bootloader implementations
+type options struct {
+	bootAttempts int
+	secureBoot   *deployment.SecureBoot
+	legacyBIOS   bool
+}
+
+type Option func(*options)
+
+// WithBootAttempts enables boot counting. After the given number of failed boots of a new
+// default entry GRUB falls back to the previous default entry. Zero disables boot counting.
+func WithBootAttempts(attempts int) Option {
+	return func(o *options) {
+		o.bootAttempts = attempts
+	}
+}
+
+// WithSecureBoot signs the EFI binaries and kernels installed into the ESP with the given
+// Secure Boot keys. Nil disables signing. Without keys the signed EFI binaries already installed
+// are kept and new kernels are installed unsigned.
+func WithSecureBoot(sb *deployment.SecureBoot) Option {
+	return func(o *options) {
+		o.secureBoot = sb
+	}
+}
+
+// WithLegacyBIOS additionally installs the i386-pc GRUB image so the system can also boot
+// on legacy BIOS firmware. Only supported by GRUB.
+func WithLegacyBIOS(enabled bool) Option {
+	return func(o *options) {
+		o.legacyBIOS = enabled
+	}
+}
+
+// sign signs the given EFI binaries if Secure Boot signing is enabled
+func (o options) sign(s *sys.System, files ...string) error {
+	if o.secureBoot == nil {
+		return nil
+	}
+	if !o.secureBoot.HasKeys() {
+		s.Logger().Warn("No Secure Boot keys given, %v are not signed", files)
+		return nil
+	}
+	return secureboot.Sign(s, o.secureBoot, files...)
+}
+
+// signKernel signs the given kernel if Secure Boot signing is enabled
+func (o options) signKernel(s *sys.System, kernel string) error {
+	if o.secureBoot == nil {
+		return nil
+	}
+	if !o.secureBoot.HasKeys() {
+		s.Logger().Warn("No Secure Boot keys given, kernel '%s' is not signed", kernel)
+		return nil
+	}
+	return secureboot.SignKernel(s, o.secureBoot, kernel)
+}
+
+// keepSigned returns true if the given EFI binaries are already installed and they can't be signed
+// again, in that case they are not replaced to keep them bootable with Secure Boot
+func (o options) keepSigned(s *sys.System, files ...string) bool {
+	if o.secureBoot == nil || o.secureBoot.HasKeys() {
+		return false
+	}
+	for _, file := range files {
+		if ok, _ := vfs.Exists(s.FS(), file); !ok {
+			return false
+		}
+	}
+	s.Logger().Warn("No Secure Boot keys given, keeping the installed signed %v", files)
+	return true
+}
+
+// installEnrollFiles copies the Secure Boot auto enrollment files into the given ESP, if any
+func (o options) installEnrollFiles(s *sys.System, espDir string) error {
+	if o.secureBoot == nil {
+		return nil
+	}
+	return secureboot.InstallEnrollFiles(s, o.secureBoot, espDir)
 }
 
 const (
 	BootNone = "none"
 	BootGrub = "grub"
+
+	BootSystemdBoot = "systemd-boot"
 )
 
 type None struct {
@@ -58,12 +163,23 @@ func (n *None) Prune(_, _ string, _ []int) error {
 	return nil
 }
 
-func New(name string, s *sys.System) (Bootloader, error) {
+func (n *None) SetDefaultEntry(_, _ string) error {
+	n.s.Logger().Info("Skipping bootloader default entry update")
+	return nil
+}
+
+func (n *None) GetEntries(_ string) ([]BootEntry, error) {
+	return nil, nil
+}
+
+func New(name string, s *sys.System, opts ...Option) (Bootloader, error) {
 	switch name {
 	case BootNone:
 		return NewNone(s), nil
 	case BootGrub:
-		return NewGrub(s), nil
+		return NewGrub(s, opts...), nil
+	case BootSystemdBoot:
+		return NewSystemdBoot(s, opts...), nil
 	}
 
 	return nil, fmt.Errorf("new bootloader '%s': %w", name, errors.ErrUnsupported)
@@ -45,7 +45,7 @@ var _ = Describe("Bootloader tests", Label("bootloader", "grub", "none"), func()
 		Expect(err).NotTo(HaveOccurred())
 	})
 	It("Successsfully creates a new bootloader", func() {
-		for _, name := range []string{"none", "grub"} {
+		for _, name := range []string{"none", "grub", "systemd-boot"} {
 			b, err := bootloader.New(name, s)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(b).NotTo(BeNil())
@@ -38,6 +38,7 @@ import (
 
 type Grub struct {
 	s *sys.System
+	options
 }
 
 type grubBootEntry struct {
@@ -48,13 +49,17 @@ type grubBootEntry struct {
 	ID          string
 }
 
-type Option func(*Grub)
+// bootCount describes a step of the boot counter decrement in grub.cfg
+type bootCount struct {
+	Current int
+	Next    int
+}
 
 func NewGrub(s *sys.System, opts ...Option) *Grub {
-	g := &Grub{s}
+	g := &Grub{s: s}
 
 	for _, opt := range opts {
-		opt(g)
+		opt(&g.options)
 	}
 
 	return g
@@ -68,8 +73,24 @@ const (
 
 	liveBootPath = "/boot"
 	grubEnvFile  = "grubenv"
+
+	bootSuccessUnitName = "elemental-boot-success.service"
+	systemdUnitsPath    = "/etc/systemd/system"
+
+	// BIOSEltoritoImg is the El Torito boot image for legacy BIOS within the live media
+	BIOSEltoritoImg = "/boot/grub2/i386-pc/eltorito.img"
+	// BIOSHybridMBR is the MBR boot code for legacy BIOS within the live media
+	BIOSHybridMBR = "/boot/grub2/i386-pc/boot_hybrid.img"
+
+	grubBIOSTarget = "i386-pc"
 )
 
+// grubBIOSLiveModules are the modules embedded in the El Torito image of the live media
+var grubBIOSLiveModules = []string{
+	"biosdisk", "iso9660", "part_gpt", "part_msdos", "normal", "configfile", "linux",
+	"search", "search_label", "search_fs_file", "loadenv", "test", "echo",
+}
+
 //go:embed grubtemplates/grub.cfg
 var grubCfg []byte
 
@@ -79,6 +100,9 @@ var grubLiveEFICfg []byte
 //go:embed grubtemplates/grub_live.cfg
 var grubLiveCfg []byte
 
+//go:embed grubtemplates/elemental-boot-success.service
+var bootSuccessUnit []byte
+
 // InstallLive installs the live bootloader to the specified target.
 func (g *Grub) InstallLive(rootPath, target, kernelCmdLine string) error {
 	g.s.Logger().Info("Preparing GRUB bootloader for live media")
@@ -118,6 +142,13 @@ func (g *Grub) InstallLive(rootPath, target, kernelCmdLine string) error {
 		return fmt.Errorf("installing elemental EFI apps: %w", err)
 	}
 
+	if g.legacyBIOS {
+		err = g.installLiveBIOS(rootPath, target)
+		if err != nil {
+			return fmt.Errorf("installing legacy BIOS boot image: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -133,6 +164,13 @@ func (g *Grub) Install(rootPath, espDir, espLabel, entryID, kernelCmdline, recKe
 		return fmt.Errorf("installing grub config: %w", err)
 	}
 
+	if g.legacyBIOS {
+		err = g.installBIOS(rootPath, espDir, espLabel)
+		if err != nil {
+			return fmt.Errorf("installing legacy BIOS bootloader: %w", err)
+		}
+	}
+
 	entry, err := g.installKernelInitrd(rootPath, espDir, "")
 	if err != nil {
 		return fmt.Errorf("installing kernel+initrd: %w", err)
@@ -173,6 +211,13 @@ func (g *Grub) Install(rootPath, espDir, espLabel, entryID, kernelCmdline, recKe
 		return fmt.Errorf("updating boot entries: %w", err)
 	}
 
+	if entryID != RecoveryBootID {
+		err = g.setBootCounter(rootPath, espDir, entryID)
+		if err != nil {
+			return fmt.Errorf("setting boot counter: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -243,6 +288,106 @@ func (g Grub) Prune(rootPath, espDir string, keepSnapshotIDs []int) (err error)
 	return g.pruneOldKernels(rootPath, espDir, activeEntries)
 }
 
+// SetDefaultEntry points the default boot entry to the kernel, initrd and command line of the
+// given existing entry ID.
+func (g *Grub) SetDefaultEntry(espDir, entryID string) error {
+	entryPath := filepath.Join(espDir, "loader", "entries", entryID)
+	if ok, _ := vfs.Exists(g.s.FS(), entryPath); !ok {
+		return fmt.Errorf("boot entry '%s' not found", entryID)
+	}
+
+	vars, err := g.readGrubEnv(entryPath)
+	if err != nil {
+		return fmt.Errorf("reading boot entry '%s': %w", entryID, err)
+	}
+
+	g.s.Logger().Info("Setting boot entry '%s' as the default one", entryID)
+	defaultEntry := &grubBootEntry{
+		Linux:       vars["linux"],
+		Initrd:      vars["initrd"],
+		CmdLine:     vars["cmdline"],
+		DisplayName: strings.TrimSuffix(vars["display_name"], fmt.Sprintf(" (%s)", entryID)),
+		ID:          DefaultBootID,
+	}
+	err = g.writeBootEntry(espDir, defaultEntry)
+	if err != nil {
+		return fmt.Errorf("writing default boot entry: %w", err)
+	}
+
+	// the entry is explicitly selected, there is nothing to fall back to
+	grubEnvPath := filepath.Join(espDir, grubEnvFile)
+	grubEnv, err := g.readGrubEnv(grubEnvPath)
+	if err != nil {
+		return fmt.Errorf("reading grubenv: %w", err)
+	}
+	if _, ok := grubEnv["active_entry"]; ok {
+		err = g.editGrubEnv(grubEnvPath, "set", fmt.Sprintf("active_entry=%s", entryID))
+		if err != nil {
+			return fmt.Errorf("updating active entry: %w", err)
+		}
+	}
+	err = g.editGrubEnv(grubEnvPath, "unset", "boot_counter", "fallback_entry")
+	if err != nil {
+		return fmt.Errorf("resetting boot counter: %w", err)
+	}
+	return nil
+}
+
+// SetDefaultEntryWithFallback sets the given existing entry as the default one, as SetDefaultEntry does,
+// and arms the boot counter to fall back to the current default entry if boot counting is enabled.
+func (g *Grub) SetDefaultEntryWithFallback(espDir, entryID string) error {
+	grubEnvPath := filepath.Join(espDir, grubEnvFile)
+	grubEnv, err := g.readGrubEnv(grubEnvPath)
+	if err != nil {
+		return fmt.Errorf("reading grubenv: %w", err)
+	}
+	previous := grubEnv["active_entry"]
+
+	err = g.SetDefaultEntry(espDir, entryID)
+	if err != nil {
+		return err
+	}
+
+	if g.bootAttempts <= 0 || previous == "" || previous == entryID {
+		return nil
+	}
+
+	g.s.Logger().Info("Falling back to boot entry '%s' after %d failed boot attempts", previous, g.bootAttempts)
+	err = g.editGrubEnv(
+		grubEnvPath, "set", fmt.Sprintf("active_entry=%s", entryID),
+		fmt.Sprintf("boot_counter=%d", g.bootAttempts), fmt.Sprintf("fallback_entry=%s", previous),
+	)
+	if err != nil {
+		return fmt.Errorf("setting boot counter: %w", err)
+	}
+	return nil
+}
+
+// GetEntries returns the boot entries listed in the ESP grubenv file in boot menu order.
+func (g *Grub) GetEntries(espDir string) ([]BootEntry, error) {
+	grubEnvPath := filepath.Join(espDir, grubEnvFile)
+	grubEnv, err := g.readGrubEnv(grubEnvPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading grubenv: %w", err)
+	}
+
+	entries := []BootEntry{}
+	for _, id := range strings.Fields(grubEnv["entries"]) {
+		vars, err := g.readGrubEnv(filepath.Join(espDir, "loader", "entries", id))
+		if err != nil {
+			return nil, fmt.Errorf("reading boot entry '%s': %w", id, err)
+		}
+		entries = append(entries, BootEntry{
+			ID:          id,
+			DisplayName: vars["display_name"],
+			Linux:       vars["linux"],
+			Initrd:      vars["initrd"],
+			CmdLine:     vars["cmdline"],
+		})
+	}
+	return entries, nil
+}
+
 func (g Grub) pruneOldKernels(rootPath, espDir string, activeEntries []string) error {
 	activeKernels := map[string]bool{}
 
@@ -345,12 +490,17 @@ func (g *Grub) installElementalEFI(rootPath, espDir, espLabel string) error {
 
 	for _, efiEntry := range []string{"BOOT", "ELEMENTAL"} {
 		targetDir := filepath.Join(espDir, "EFI", efiEntry)
-		err := g.installEFIEntry(rootPath, targetDir, grubCfg, map[string]string{"Label": espLabel})
+		data := map[string]any{"Label": espLabel, "BootCounts": g.bootCounts()}
+		err := g.installEFIEntry(rootPath, targetDir, grubCfg, data)
 		if err != nil {
 			return fmt.Errorf("failed setting '%s' EFI entry: %w", efiEntry, err)
 		}
 	}
 
+	if g.secureBoot != nil && g.secureBoot.EnrollDir != "" {
+		g.s.Logger().Warn("Secure Boot enrollment files are not installed with GRUB, enroll them from the firmware setup")
+	}
+
 	return nil
 }
 
@@ -364,20 +514,28 @@ func (g *Grub) installEFIEntry(rootPath, targetDir string, grubTmpl []byte, data
 	}
 
 	srcDir := filepath.Join(rootPath, "usr", "share", "efi", grubArch(g.s.Platform().Arch))
-	for _, name := range []string{"grub.efi", "MokManager.efi"} {
-		src := filepath.Join(srcDir, name)
-		target := filepath.Join(targetDir, name)
-		err = vfs.CopyFile(g.s.FS(), src, target)
+	shim := filepath.Join(targetDir, defaultEfiBootFileName(g.s.Platform()))
+	efiApps := []string{filepath.Join(targetDir, "grub.efi"), filepath.Join(targetDir, "MokManager.efi"), shim}
+	if !g.keepSigned(g.s, efiApps...) {
+		for _, name := range []string{"grub.efi", "MokManager.efi"} {
+			src := filepath.Join(srcDir, name)
+			target := filepath.Join(targetDir, name)
+			err = vfs.CopyFile(g.s.FS(), src, target)
+			if err != nil {
+				return fmt.Errorf("copying file '%s': %w", src, err)
+			}
+		}
+
+		src := filepath.Join(srcDir, "shim.efi")
+		err = vfs.CopyFile(g.s.FS(), src, shim)
 		if err != nil {
 			return fmt.Errorf("copying file '%s': %w", src, err)
 		}
-	}
 
-	src := filepath.Join(srcDir, "shim.efi")
-	target := filepath.Join(targetDir, defaultEfiBootFileName(g.s.Platform()))
-	err = vfs.CopyFile(g.s.FS(), src, target)
-	if err != nil {
-		return fmt.Errorf("copying file '%s': %w", src, err)
+		err = g.sign(g.s, efiApps...)
+		if err != nil {
+			return fmt.Errorf("signing EFI applications: %w", err)
+		}
 	}
 
 	err = g.writeGrubConfig(targetDir, grubTmpl, data)
@@ -436,11 +594,64 @@ func (g *Grub) installGrub(rootPath, espDir string) error {
 	return nil
 }
 
+// installBIOS installs the i386-pc GRUB core image into the BIOS boot partition of the disk holding
+// the ESP. The core image loads the same configuration and boot entries from the ESP as EFI does.
+func (g *Grub) installBIOS(rootPath, espDir, espLabel string) error {
+	g.s.Logger().Info("Installing legacy BIOS bootloader")
+
+	data := map[string]any{"Label": espLabel, "BootCounts": g.bootCounts()}
+	err := g.writeGrubConfig(filepath.Join(espDir, "grub2"), grubCfg, data)
+	if err != nil {
+		return fmt.Errorf("failed writing BIOS grub config file: %w", err)
+	}
+
+	out, err := g.s.Runner().Run("grub2-probe", "--target=disk", espDir)
+	if err != nil {
+		return fmt.Errorf("probing disk of '%s': %w", espDir, err)
+	}
+	disk := strings.TrimSpace(string(out))
+
+	_, err = g.s.Runner().Run(
+		"grub2-install", fmt.Sprintf("--target=%s", grubBIOSTarget), fmt.Sprintf("--boot-directory=%s", espDir),
+		fmt.Sprintf("--directory=%s", filepath.Join(rootPath, "/usr/share/grub2", grubBIOSTarget)), disk,
+	)
+	if err != nil {
+		return fmt.Errorf("installing grub to '%s': %w", disk, err)
+	}
+
+	return nil
+}
+
+// installLiveBIOS creates the El Torito image to boot the live media on legacy BIOS firmware
+func (g *Grub) installLiveBIOS(rootPath, target string) error {
+	g.s.Logger().Info("Creating legacy BIOS boot image")
+
+	hybridMBR := filepath.Join(target, BIOSHybridMBR)
+	if ok, _ := vfs.Exists(g.s.FS(), hybridMBR); !ok {
+		return fmt.Errorf("legacy BIOS boot image '%s' not found, is the %s GRUB package installed?", BIOSHybridMBR, grubBIOSTarget)
+	}
+
+	args := []string{
+		"-O", fmt.Sprintf("%s-eltorito", grubBIOSTarget),
+		"-d", filepath.Join(rootPath, "/usr/share/grub2", grubBIOSTarget),
+		"-p", filepath.Join(liveBootPath, "grub2"),
+		"-o", filepath.Join(target, BIOSEltoritoImg),
+	}
+	args = append(args, grubBIOSLiveModules...)
+
+	_, err := g.s.Runner().Run("grub2-mkimage", args...)
+	if err != nil {
+		return fmt.Errorf("creating El Torito image: %w", err)
+	}
+
+	return nil
+}
+
 // readIDAndName parses OS ID and OS name from os-relese file. Returns error of no OS ID is found.
-func (g *Grub) readIDAndName(rootPath string) (osID string, displayName string, err error) {
-	g.s.Logger().Info("Reading OS Relese")
+func readIDAndName(s *sys.System, rootPath string) (osID string, displayName string, err error) {
+	s.Logger().Info("Reading OS Relese")
 
-	osVars, err := vfs.LoadEnvFile(g.s.FS(), filepath.Join(rootPath, OsReleasePath))
+	osVars, err := vfs.LoadEnvFile(s.FS(), filepath.Join(rootPath, OsReleasePath))
 	if err != nil {
 		return "", "", fmt.Errorf("loading %s vars: %w", OsReleasePath, err)
 	}
@@ -473,7 +684,7 @@ func (g *Grub) installKernelInitrd(rootPath, espDir, subfolder string) (grubBoot
 	g.s.Logger().Info("Installing kernel/initrd")
 	entry := grubBootEntry{}
 
-	osID, displayName, err := g.readIDAndName(rootPath)
+	osID, displayName, err := readIDAndName(g.s, rootPath)
 	if err != nil {
 		return entry, fmt.Errorf("failed parsing OS release: %w", err)
 	}
@@ -505,6 +716,11 @@ func (g *Grub) installKernelInitrd(rootPath, espDir, subfolder string) (grubBoot
 		return entry, fmt.Errorf("copying kernel hmac '%s': %w", kernelHmac, err)
 	}
 
+	err = g.signKernel(g.s, filepath.Join(targetDir, filepath.Base(kernel)))
+	if err != nil {
+		return entry, fmt.Errorf("signing kernel: %w", err)
+	}
+
 	initrdPath := filepath.Join(filepath.Dir(kernel), Initrd)
 	if exists, _ := vfs.Exists(g.s.FS(), initrdPath); !exists {
 		return entry, fmt.Errorf("initrd not found")
@@ -601,6 +817,95 @@ func (g *Grub) updateBootEntries(espDir string, newEntries ...*grubBootEntry) er
 	return err
 }
 
+// setBootCounter arms the boot counter to fall back to the previous active entry if boot counting
+// is enabled. The active entry is only tracked while boot counting is enabled, thus the counter is
+// not armed on the first installation of an entry after enabling it. The unit marking the boot as
+// successful is installed or removed in the given root accordingly.
+func (g *Grub) setBootCounter(rootPath, espDir, entryID string) error {
+	grubEnvPath := filepath.Join(espDir, grubEnvFile)
+	unitPath := filepath.Join(rootPath, systemdUnitsPath, bootSuccessUnitName)
+	wantsPath := filepath.Join(rootPath, systemdUnitsPath, "multi-user.target.wants", bootSuccessUnitName)
+
+	if g.bootAttempts <= 0 {
+		_ = g.s.FS().Remove(wantsPath)
+		_ = g.s.FS().Remove(unitPath)
+		return g.editGrubEnv(grubEnvPath, "unset", "active_entry", "boot_counter", "fallback_entry")
+	}
+
+	grubEnv, err := g.readGrubEnv(grubEnvPath)
+	if err != nil {
+		return fmt.Errorf("reading grubenv: %w", err)
+	}
+	previous := grubEnv["active_entry"]
+
+	err = g.writeBootSuccessUnit(unitPath, wantsPath, strings.TrimPrefix(grubEnvPath, rootPath))
+	if err != nil {
+		return fmt.Errorf("installing boot success unit: %w", err)
+	}
+
+	vars := []string{fmt.Sprintf("active_entry=%s", entryID)}
+	if previous == "" || previous == entryID {
+		g.s.Logger().Debug("No previous entry to fall back to, boot counter not armed")
+		err = g.editGrubEnv(grubEnvPath, "unset", "boot_counter", "fallback_entry")
+		if err != nil {
+			return err
+		}
+	} else {
+		g.s.Logger().Info("Falling back to boot entry '%s' after %d failed boot attempts", previous, g.bootAttempts)
+		vars = append(vars, fmt.Sprintf("boot_counter=%d", g.bootAttempts), fmt.Sprintf("fallback_entry=%s", previous))
+	}
+
+	return g.editGrubEnv(grubEnvPath, append([]string{"set"}, vars...)...)
+}
+
+// writeBootSuccessUnit writes and enables the systemd unit which resets the boot counter
+// stored in the given grubenv once the boot is complete
+func (g *Grub) writeBootSuccessUnit(unitPath, wantsPath, grubEnvPath string) error {
+	err := vfs.MkdirAll(g.s.FS(), filepath.Dir(wantsPath), vfs.DirPerm)
+	if err != nil {
+		return fmt.Errorf("creating directory '%s': %w", filepath.Dir(wantsPath), err)
+	}
+
+	f, err := g.s.FS().Create(unitPath)
+	if err != nil {
+		return fmt.Errorf("creating unit file '%s': %w", unitPath, err)
+	}
+
+	unit := template.Must(template.New("unit").Parse(string(bootSuccessUnit)))
+	err = unit.Execute(f, map[string]string{"GrubEnv": grubEnvPath})
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("rendering unit file '%s': %w", unitPath, err)
+	}
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("closing unit file '%s': %w", unitPath, err)
+	}
+
+	if ok, _ := vfs.Exists(g.s.FS(), wantsPath); ok {
+		return nil
+	}
+	return g.s.FS().Symlink(filepath.Join("..", bootSuccessUnitName), wantsPath)
+}
+
+// bootCounts returns the boot counter decrement steps to render in grub.cfg
+func (g Grub) bootCounts() []bootCount {
+	counts := []bootCount{}
+	for i := g.bootAttempts; i > 0; i-- {
+		counts = append(counts, bootCount{Current: i, Next: i - 1})
+	}
+	return counts
+}
+
+func (g *Grub) editGrubEnv(path string, args ...string) error {
+	stdOut, err := g.s.Runner().Run("grub2-editenv", append([]string{path}, args...)...)
+	g.s.Logger().Debug("grub2-editenv stdout: %s", string(stdOut))
+	if err != nil {
+		return fmt.Errorf("editing grubenv '%s': %w", path, err)
+	}
+	return nil
+}
+
 func (g Grub) writeBootEntry(espDir string, entry *grubBootEntry) error {
 	displayName := fmt.Sprintf("display_name=%s", entry.DisplayName)
 	linux := fmt.Sprintf("linux=%s", entry.Linux)
@@ -21,12 +21,14 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	"github.com/suse/elemental/v3/pkg/bootloader"
+	"github.com/suse/elemental/v3/pkg/deployment"
 	"github.com/suse/elemental/v3/pkg/log"
 	"github.com/suse/elemental/v3/pkg/sys"
 	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
@@ -68,10 +70,20 @@ var _ = Describe("Grub tests", Label("bootloader", "grub"), func() {
 			case "grub2-editenv":
 				path := args[0]
 				switch args[1] {
-				case "set":
-					// Write args to the file
-					content := strings.Join(args[2:], "\n")
-					err := tfs.WriteFile(path, []byte(content), vfs.FilePerm)
+				case "set", "unset":
+					// Merge args into the variables of the file
+					var vars []string
+					if data, err := tfs.ReadFile(path); err == nil && len(data) > 0 {
+						vars = strings.Split(string(data), "\n")
+					}
+					for _, arg := range args[2:] {
+						key, _, _ := strings.Cut(arg, "=")
+						vars = slices.DeleteFunc(vars, func(v string) bool { return strings.HasPrefix(v, key+"=") })
+						if args[1] == "set" {
+							vars = append(vars, arg)
+						}
+					}
+					err := tfs.WriteFile(path, []byte(strings.Join(vars, "\n")), vfs.FilePerm)
 					Expect(err).NotTo(HaveOccurred())
 				case "list":
 					return tfs.ReadFile(path)
@@ -191,6 +203,50 @@ var _ = Describe("Grub tests", Label("bootloader", "grub"), func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(string(entries)).To(Equal("entries=active 2 1 recovery"))
 	})
+	It("Sets the 'active' entry to a previous snapshot", func() {
+		err := grub.Install("/target/dir", "/target/dir/boot", "EFI", "1", "snapshot1", "")
+		Expect(err).ToNot(HaveOccurred())
+
+		err = grub.Install("/target/dir", "/target/dir/boot", "EFI", "2", "snapshot2", "")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(grub.SetDefaultEntry("/target/dir/boot", "1")).To(Succeed())
+
+		activeEntry, err := tfs.ReadFile("/target/dir/boot/loader/entries/active")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.SplitSeq(string(activeEntry), "\n")).To(ContainElement("cmdline=snapshot1"))
+		Expect(strings.SplitSeq(string(activeEntry), "\n")).To(ContainElement("display_name=openSUSE Tumbleweed"))
+
+		// Entries list remains untouched
+		entries, err := tfs.ReadFile("/target/dir/boot/grubenv")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(entries)).To(Equal("entries=active 2 1"))
+	})
+	It("Lists the installed boot entries", func() {
+		err := grub.Install("/target/dir", "/target/dir/boot", "EFI", "1", "snapshot1", "recovery cmdline")
+		Expect(err).ToNot(HaveOccurred())
+
+		err = grub.Install("/target/dir", "/target/dir/boot", "EFI", "2", "snapshot2", "recovery cmdline")
+		Expect(err).ToNot(HaveOccurred())
+
+		entries, err := grub.GetEntries("/target/dir/boot")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(HaveLen(4))
+		Expect(entries[0].ID).To(Equal(bootloader.DefaultBootID))
+		Expect(entries[0].CmdLine).To(Equal("snapshot2"))
+		Expect(entries[1].ID).To(Equal("2"))
+		Expect(entries[2].ID).To(Equal("1"))
+		Expect(entries[2].DisplayName).To(Equal("openSUSE Tumbleweed (1)"))
+		Expect(entries[2].Linux).To(Equal("/opensuse-tumbleweed/6.14.4-1-default/vmlinuz"))
+		Expect(entries[3].ID).To(Equal(bootloader.RecoveryBootID))
+		Expect(entries[3].CmdLine).To(Equal("recovery cmdline"))
+	})
+	It("Fails to set the 'active' entry to a non existing entry", func() {
+		err := grub.Install("/target/dir", "/target/dir/boot", "EFI", "1", "snapshot1", "")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(grub.SetDefaultEntry("/target/dir/boot", "3")).To(MatchError("boot entry '3' not found"))
+	})
 	It("Prunes old snapshots", func() {
 		// "Install" older (6.6.99) kernel
 		Expect(vfs.MkdirAll(tfs, "/target/dir/boot/opensuse-tumbleweed/6.6.99-1-default", vfs.DirPerm)).To(Succeed())
@@ -254,6 +310,206 @@ var _ = Describe("Grub tests", Label("bootloader", "grub"), func() {
 		Expect(vfs.Exists(tfs, "/target/dir/boot/opensuse-tumbleweed/6.14.4-1-default/.vmlinuz.hmac")).To(BeTrue())
 		Expect(vfs.Exists(tfs, "/target/dir/boot/opensuse-tumbleweed/6.14.4-1-default/initrd")).To(BeTrue())
 	})
+	It("Arms the boot counter to fall back to the previous entry", func() {
+		grub = bootloader.NewGrub(s, bootloader.WithBootAttempts(3))
+
+		err := grub.Install("/target/dir", "/target/dir/boot", "EFI", "1", "snapshot1", "")
+		Expect(err).ToNot(HaveOccurred())
+
+		// Nothing to fall back to on the first installation
+		grubEnv, err := tfs.ReadFile("/target/dir/boot/grubenv")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.Split(string(grubEnv), "\n")).To(ConsistOf("entries=active 1", "active_entry=1"))
+
+		err = grub.Install("/target/dir", "/target/dir/boot", "EFI", "2", "snapshot2", "")
+		Expect(err).ToNot(HaveOccurred())
+
+		grubEnv, err = tfs.ReadFile("/target/dir/boot/grubenv")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.Split(string(grubEnv), "\n")).To(ConsistOf(
+			"entries=active 2 1", "active_entry=2", "boot_counter=3", "fallback_entry=1",
+		))
+
+		// grub.cfg decrements the counter down from the configured attempts
+		grubCfg, err := tfs.ReadFile("/target/dir/boot/EFI/ELEMENTAL/grub.cfg")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(grubCfg)).To(ContainSubstring(`elif test "${boot_counter}" == "3"; then`))
+		Expect(string(grubCfg)).To(ContainSubstring(`set boot_counter="0"`))
+		Expect(string(grubCfg)).NotTo(ContainSubstring(`"${boot_counter}" == "4"`))
+		// The decremented counter is saved into the grubenv it was loaded from
+		Expect(string(grubCfg)).To(ContainSubstring("save_env --file (${root})/grubenv boot_counter\n"))
+
+		// The unit resetting the counter is enabled
+		unit, err := tfs.ReadFile("/target/dir/etc/systemd/system/elemental-boot-success.service")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(unit)).To(ContainSubstring("grub2-editenv /boot/grubenv unset boot_counter fallback_entry"))
+		link, err := tfs.Readlink("/target/dir/etc/systemd/system/multi-user.target.wants/elemental-boot-success.service")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(link).To(Equal("../elemental-boot-success.service"))
+
+		// Explicitly selecting an entry disarms the counter
+		Expect(grub.SetDefaultEntry("/target/dir/boot", "1")).To(Succeed())
+		grubEnv, err = tfs.ReadFile("/target/dir/boot/grubenv")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.Split(string(grubEnv), "\n")).To(ConsistOf("entries=active 2 1", "active_entry=1"))
+	})
+	It("Arms the boot counter when setting a default entry with fallback", func() {
+		grub = bootloader.NewGrub(s, bootloader.WithBootAttempts(3))
+		Expect(grub.Install("/target/dir", "/target/dir/boot", "EFI", "1", "snapshot1", "")).To(Succeed())
+		Expect(grub.Install("/target/dir", "/target/dir/boot", "EFI", "2", "snapshot2", "")).To(Succeed())
+
+		// a staged entry is installed without becoming the default one
+		Expect(grub.SetDefaultEntry("/target/dir/boot", "1")).To(Succeed())
+		Expect(grub.SetDefaultEntryWithFallback("/target/dir/boot", "2")).To(Succeed())
+
+		grubEnv, err := tfs.ReadFile("/target/dir/boot/grubenv")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.Split(string(grubEnv), "\n")).To(ConsistOf(
+			"entries=active 2 1", "active_entry=2", "boot_counter=3", "fallback_entry=1",
+		))
+		activeEntry, err := tfs.ReadFile("/target/dir/boot/loader/entries/active")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.SplitSeq(string(activeEntry), "\n")).To(ContainElement("cmdline=snapshot2"))
+
+		// without boot counting it behaves as SetDefaultEntry
+		grub = bootloader.NewGrub(s)
+		Expect(grub.SetDefaultEntry("/target/dir/boot", "1")).To(Succeed())
+		Expect(grub.SetDefaultEntryWithFallback("/target/dir/boot", "2")).To(Succeed())
+		grubEnv, err = tfs.ReadFile("/target/dir/boot/grubenv")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.Split(string(grubEnv), "\n")).To(ConsistOf("entries=active 2 1", "active_entry=2"))
+	})
+	It("Disables boot counting", func() {
+		grub = bootloader.NewGrub(s, bootloader.WithBootAttempts(3))
+		Expect(grub.Install("/target/dir", "/target/dir/boot", "EFI", "1", "snapshot1", "")).To(Succeed())
+		Expect(grub.Install("/target/dir", "/target/dir/boot", "EFI", "2", "snapshot2", "")).To(Succeed())
+
+		grub = bootloader.NewGrub(s)
+		Expect(grub.Install("/target/dir", "/target/dir/boot", "EFI", "3", "snapshot3", "")).To(Succeed())
+
+		grubEnv, err := tfs.ReadFile("/target/dir/boot/grubenv")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.Split(string(grubEnv), "\n")).To(HaveLen(1))
+		Expect(string(grubEnv)).To(HavePrefix("entries=active 3"))
+		Expect(vfs.Exists(tfs, "/target/dir/etc/systemd/system/elemental-boot-success.service")).To(BeFalse())
+		Expect(vfs.Exists(tfs, "/target/dir/etc/systemd/system/multi-user.target.wants/elemental-boot-success.service")).To(BeFalse())
+	})
+	It("Signs EFI applications and kernels with the secure boot key", func() {
+		Expect(vfs.MkdirAll(tfs, "/etc/secureboot", vfs.DirPerm)).To(Succeed())
+		Expect(tfs.WriteFile("/etc/secureboot/db.auth", []byte("db"), vfs.FilePerm)).To(Succeed())
+
+		sideEffect := runner.SideEffect
+		runner.SideEffect = func(command string, args ...string) ([]byte, error) {
+			switch command {
+			case "sbsign":
+				return nil, tfs.WriteFile(args[5], []byte("signed"), vfs.FilePerm)
+			case "sbverify":
+				return nil, nil
+			case "sha512hmac":
+				return []byte("hmac " + args[0]), nil
+			}
+			return sideEffect(command, args...)
+		}
+
+		grub = bootloader.NewGrub(s, bootloader.WithSecureBoot(&deployment.SecureBoot{
+			Key: "/etc/secureboot/db.key", Cert: "/etc/secureboot/db.crt", EnrollDir: "/etc/secureboot",
+		}))
+		Expect(grub.Install("/target/dir", "/target/dir/boot", "EFI", "1", "snapshot1", "")).To(Succeed())
+
+		for _, file := range []string{
+			"/target/dir/boot/EFI/ELEMENTAL/grub.efi", "/target/dir/boot/EFI/ELEMENTAL/bootx64.efi",
+			"/target/dir/boot/EFI/BOOT/MokManager.efi", "/target/dir/boot/opensuse-tumbleweed/6.14.4-1-default/vmlinuz",
+		} {
+			data, err := tfs.ReadFile(file)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("signed"), file)
+		}
+		hmac, err := tfs.ReadFile("/target/dir/boot/opensuse-tumbleweed/6.14.4-1-default/.vmlinuz.hmac")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(hmac)).To(Equal("hmac  vmlinuz\n"))
+		// enrollment files are only read by systemd-boot
+		Expect(vfs.Exists(tfs, "/target/dir/boot/loader/keys/elemental/db.auth")).To(BeFalse())
+	})
+	It("Keeps the signed EFI applications when upgrading a deployment without secure boot keys", func() {
+		signed := false
+		sideEffect := runner.SideEffect
+		runner.SideEffect = func(command string, args ...string) ([]byte, error) {
+			switch command {
+			case "sbsign":
+				signed = true
+				return nil, tfs.WriteFile(args[5], []byte("signed"), vfs.FilePerm)
+			case "sbverify":
+				return nil, nil
+			case "sha512hmac":
+				return []byte("hmac " + args[0]), nil
+			}
+			return sideEffect(command, args...)
+		}
+
+		d := deployment.DefaultDeployment()
+		d.SecureBoot = &deployment.SecureBoot{Key: "/etc/secureboot/db.key", Cert: "/etc/secureboot/db.crt"}
+		grub = bootloader.NewGrub(s, bootloader.WithSecureBoot(d.SecureBoot))
+		Expect(grub.Install("/target/dir", "/target/dir/boot", "EFI", "1", "snapshot1", "")).To(Succeed())
+		Expect(d.WriteDeploymentFile(s, "/target/dir")).To(Succeed())
+
+		// upgrade with the deployment stored in the installed system
+		signed = false
+		stored, err := deployment.Parse(s, "/target/dir")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.SecureBoot).NotTo(BeNil())
+		Expect(stored.SecureBoot.Key).To(BeEmpty())
+
+		grub = bootloader.NewGrub(s, bootloader.WithSecureBoot(stored.SecureBoot))
+		Expect(grub.Install("/target/dir", "/target/dir/boot", "EFI", "2", "snapshot2", "")).To(Succeed())
+		Expect(signed).To(BeFalse())
+
+		for _, file := range []string{
+			"/target/dir/boot/EFI/ELEMENTAL/grub.efi", "/target/dir/boot/EFI/ELEMENTAL/bootx64.efi",
+			"/target/dir/boot/EFI/BOOT/MokManager.efi",
+		} {
+			data, err := tfs.ReadFile(file)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("signed"), file)
+		}
+	})
+	It("Installs grub for legacy BIOS boot", func() {
+		sideEffect := runner.SideEffect
+		runner.SideEffect = func(command string, args ...string) ([]byte, error) {
+			switch command {
+			case "grub2-probe":
+				return []byte("/dev/sda\n"), nil
+			case "grub2-install", "grub2-mkimage":
+				return nil, nil
+			}
+			return sideEffect(command, args...)
+		}
+
+		grub = bootloader.NewGrub(s, bootloader.WithLegacyBIOS(true))
+		Expect(grub.Install("/target/dir", "/target/dir/boot", "EFI", "1", "snapshot1", "")).To(Succeed())
+		grubCfg, err := tfs.ReadFile("/target/dir/boot/grub2/grub.cfg")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(grubCfg)).To(ContainSubstring("save_env --file (${root})/grubenv boot_counter\n"))
+		Expect(runner.MatchMilestones([][]string{
+			{"grub2-probe", "--target=disk", "/target/dir/boot"},
+			{
+				"grub2-install", "--target=i386-pc", "--boot-directory=/target/dir/boot",
+				"--directory=/target/dir/usr/share/grub2/i386-pc", "/dev/sda",
+			},
+		})).To(Succeed())
+
+		err = grub.InstallLive("/target/dir", "/iso/dir", "kernel cmdline")
+		Expect(err).To(MatchError(ContainSubstring("legacy BIOS boot image")))
+
+		Expect(vfs.MkdirAll(tfs, "/iso/dir/boot/grub2/i386-pc", vfs.DirPerm)).To(Succeed())
+		Expect(tfs.WriteFile("/iso/dir/boot/grub2/i386-pc/boot_hybrid.img", []byte("mbr"), vfs.FilePerm)).To(Succeed())
+		Expect(grub.InstallLive("/target/dir", "/iso/dir", "kernel cmdline")).To(Succeed())
+		Expect(runner.MatchMilestones([][]string{
+			{
+				"grub2-mkimage", "-O", "i386-pc-eltorito", "-d", "/target/dir/usr/share/grub2/i386-pc",
+				"-p", "/boot/grub2", "-o", "/iso/dir/boot/grub2/i386-pc/eltorito.img",
+			},
+		})).To(Succeed())
+	})
 	It("Installs bootloader for recovery", func() {
 		err := grub.Install("/target/dir", "/target/dir/boot", "EFI", bootloader.RecoveryBootID, "snapshot1", "")
 		Expect(err).ToNot(HaveOccurred())
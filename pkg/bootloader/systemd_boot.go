@@ -0,0 +1,383 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+
+	"github.com/suse/elemental/v3/pkg/sys"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+const (
+	ukiDir         = "EFI/Linux"
+	ukiPrefix      = "elemental-"
+	loaderConfFile = "loader/loader.conf"
+	liveBootID     = "live"
+	systemdBootDir = "/usr/lib/systemd/boot/efi"
+	systemdTimeout = 10
+)
+
+// SystemdBoot installs systemd-boot to the ESP. Each boot entry is a Unified Kernel Image (UKI)
+// under EFI/Linux, which systemd-boot discovers as Boot Loader Specification type #2 entries.
+type SystemdBoot struct {
+	s *sys.System
+	options
+}
+
+// ukiSection describes a PE section as reported by 'ukify inspect'
+type ukiSection struct {
+	Text string `json:"text"`
+}
+
+func NewSystemdBoot(s *sys.System, opts ...Option) *SystemdBoot {
+	sb := &SystemdBoot{s: s}
+
+	for _, opt := range opts {
+		opt(&sb.options)
+	}
+
+	return sb
+}
+
+// InstallLive installs systemd-boot and a single UKI booting the live media to the specified target.
+func (sb *SystemdBoot) InstallLive(rootPath, target, kernelCmdline string) error {
+	sb.s.Logger().Info("Preparing systemd-boot bootloader for live media")
+
+	err := sb.installEFI(rootPath, filepath.Join(target, "EFI", "BOOT"))
+	if err != nil {
+		return fmt.Errorf("installing systemd-boot EFI apps: %w", err)
+	}
+
+	err = sb.installEnrollFiles(sb.s, target)
+	if err != nil {
+		return fmt.Errorf("installing secure boot enrollment files: %w", err)
+	}
+
+	err = sb.buildUKI(rootPath, target, liveBootID, kernelCmdline)
+	if err != nil {
+		return fmt.Errorf("building unified kernel image: %w", err)
+	}
+
+	return nil
+}
+
+// Install installs systemd-boot and the UKI of the given entry ID to the specified ESP and sets
+// it as the default entry. The recovery UKI is only created if it does not exist yet.
+func (sb *SystemdBoot) Install(rootPath, espDir, _, entryID, kernelCmdline, recKernelCmdline string) error {
+	err := sb.installEFI(rootPath, filepath.Join(espDir, "EFI", "BOOT"), filepath.Join(espDir, "EFI", "ELEMENTAL"))
+	if err != nil {
+		return fmt.Errorf("installing systemd-boot EFI apps: %w", err)
+	}
+
+	err = sb.installEnrollFiles(sb.s, espDir)
+	if err != nil {
+		return fmt.Errorf("installing secure boot enrollment files: %w", err)
+	}
+
+	err = sb.buildUKI(rootPath, espDir, entryID, kernelCmdline)
+	if err != nil {
+		return fmt.Errorf("building unified kernel image: %w", err)
+	}
+
+	if entryID == RecoveryBootID {
+		return nil
+	}
+
+	recoveryUKI := filepath.Join(espDir, ukiDir, ukiName(RecoveryBootID))
+	if ok, _ := vfs.Exists(sb.s.FS(), recoveryUKI); recKernelCmdline != "" && !ok {
+		err = sb.buildUKI(rootPath, espDir, RecoveryBootID, recKernelCmdline)
+		if err != nil {
+			return fmt.Errorf("building recovery unified kernel image: %w", err)
+		}
+	}
+
+	return sb.SetDefaultEntry(espDir, entryID)
+}
+
+// Prune removes the UKIs of the snapshots not in the passed in keepSnapshotIDs.
+func (sb *SystemdBoot) Prune(_, espDir string, keepSnapshotIDs []int) error {
+	sb.s.Logger().Info("Pruning old boot artifacts in %s", espDir)
+
+	ids, err := sb.listEntryIDs(espDir)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		snapshotID, err := strconv.Atoi(id)
+		if err != nil || slices.Contains(keepSnapshotIDs, snapshotID) {
+			continue
+		}
+
+		uki := filepath.Join(espDir, ukiDir, ukiName(id))
+		err = sb.s.FS().Remove(uki)
+		if err != nil {
+			return fmt.Errorf("failed removing '%s': %w", uki, err)
+		}
+	}
+
+	return nil
+}
+
+// SetDefaultEntry sets the UKI of the given existing entry ID as the default one in loader.conf.
+func (sb *SystemdBoot) SetDefaultEntry(espDir, entryID string) error {
+	uki := filepath.Join(espDir, ukiDir, ukiName(entryID))
+	if ok, _ := vfs.Exists(sb.s.FS(), uki); !ok {
+		return fmt.Errorf("boot entry '%s' not found", entryID)
+	}
+
+	sb.s.Logger().Info("Setting boot entry '%s' as the default one", entryID)
+
+	loaderConf := filepath.Join(espDir, loaderConfFile)
+	err := vfs.MkdirAll(sb.s.FS(), filepath.Dir(loaderConf), vfs.DirPerm)
+	if err != nil {
+		return fmt.Errorf("creating loader dir: %w", err)
+	}
+
+	conf := fmt.Sprintf("default %s\ntimeout %d\neditor no\n", ukiName(entryID), systemdTimeout)
+	if sb.secureBoot != nil && sb.secureBoot.EnrollDir != "" {
+		conf += "secure-boot-enroll if-safe\n"
+	}
+	err = sb.s.FS().WriteFile(loaderConf, []byte(conf), vfs.FilePerm)
+	if err != nil {
+		return fmt.Errorf("writing '%s': %w", loaderConf, err)
+	}
+	return nil
+}
+
+// GetEntries returns the installed UKIs in boot menu order. The first entry is the default one.
+func (sb *SystemdBoot) GetEntries(espDir string) ([]BootEntry, error) {
+	ids, err := sb.listEntryIDs(espDir)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultID := ""
+	loaderConf := filepath.Join(espDir, loaderConfFile)
+	if data, err := sb.s.FS().ReadFile(loaderConf); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if value, ok := strings.CutPrefix(line, "default "); ok {
+				defaultID = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(value), ukiPrefix), ".efi")
+			}
+		}
+	}
+
+	entries := []BootEntry{}
+	for _, id := range ids {
+		entry, err := sb.inspectUKI(espDir, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if id == defaultID {
+			defaultEntry := entry
+			defaultEntry.ID = DefaultBootID
+			defaultEntry.DisplayName = strings.TrimSuffix(entry.DisplayName, fmt.Sprintf(" (%s)", id))
+			entries = append([]BootEntry{defaultEntry}, entries...)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// installEFI copies the systemd-boot EFI application from the given root to the given target directories
+func (sb *SystemdBoot) installEFI(rootPath string, targetDirs ...string) error {
+	bootFile := defaultEfiBootFileName(sb.s.Platform())
+	src := filepath.Join(rootPath, systemdBootDir, fmt.Sprintf("systemd-%s", bootFile))
+
+	for _, targetDir := range targetDirs {
+		sb.s.Logger().Info("Copying EFI artifacts at %s", targetDir)
+
+		err := vfs.MkdirAll(sb.s.FS(), targetDir, vfs.DirPerm)
+		if err != nil {
+			return fmt.Errorf("creating dir '%s': %w", targetDir, err)
+		}
+
+		target := filepath.Join(targetDir, bootFile)
+		if sb.keepSigned(sb.s, target) {
+			continue
+		}
+
+		err = vfs.CopyFile(sb.s.FS(), src, target)
+		if err != nil {
+			return fmt.Errorf("copying file '%s': %w", src, err)
+		}
+
+		err = sb.sign(sb.s, target)
+		if err != nil {
+			return fmt.Errorf("signing systemd-boot: %w", err)
+		}
+	}
+	return nil
+}
+
+// buildUKI bundles the kernel, initrd, kernel command line and os-release of the given root into the
+// UKI of the given entry ID. The entry ID is appended to the OS name to identify it in the boot menu.
+func (sb *SystemdBoot) buildUKI(rootPath, espDir, entryID, kernelCmdline string) (err error) {
+	sb.s.Logger().Info("Building unified kernel image for entry '%s'", entryID)
+
+	kernel, kernelVersion, err := vfs.FindKernel(sb.s.FS(), rootPath)
+	if err != nil {
+		return fmt.Errorf("finding kernel: %w", err)
+	}
+
+	initrd := filepath.Join(filepath.Dir(kernel), Initrd)
+	if exists, _ := vfs.Exists(sb.s.FS(), initrd); !exists {
+		return fmt.Errorf("initrd not found")
+	}
+
+	_, displayName, err := readIDAndName(sb.s, rootPath)
+	if err != nil {
+		return fmt.Errorf("failed parsing OS release: %w", err)
+	}
+
+	osVars, err := vfs.LoadEnvFile(sb.s.FS(), filepath.Join(rootPath, OsReleasePath))
+	if err != nil {
+		return fmt.Errorf("loading %s vars: %w", OsReleasePath, err)
+	}
+	if entryID != liveBootID {
+		osVars["PRETTY_NAME"] = fmt.Sprintf("%s (%s)", displayName, entryID)
+	}
+
+	osRelease, err := godotenv.Marshal(osVars)
+	if err != nil {
+		return fmt.Errorf("marshalling os-release: %w", err)
+	}
+
+	tempDir, err := vfs.TempDir(sb.s.FS(), "", "elemental-uki")
+	if err != nil {
+		return fmt.Errorf("creating temporary directory: %w", err)
+	}
+	defer func() {
+		rmErr := sb.s.FS().RemoveAll(tempDir)
+		if err == nil && rmErr != nil {
+			err = fmt.Errorf("removing temporary directory: %w", rmErr)
+		}
+	}()
+
+	osReleaseFile := filepath.Join(tempDir, "os-release")
+	err = sb.s.FS().WriteFile(osReleaseFile, []byte(osRelease+"\n"), vfs.FilePerm)
+	if err != nil {
+		return fmt.Errorf("writing os-release: %w", err)
+	}
+
+	targetDir := filepath.Join(espDir, ukiDir)
+	err = vfs.MkdirAll(sb.s.FS(), targetDir, vfs.DirPerm)
+	if err != nil {
+		return fmt.Errorf("creating UKI dir '%s': %w", targetDir, err)
+	}
+
+	uki := filepath.Join(targetDir, ukiName(entryID))
+	stdOut, err := sb.s.Runner().Run(
+		"ukify", "build", fmt.Sprintf("--linux=%s", kernel), fmt.Sprintf("--initrd=%s", initrd),
+		fmt.Sprintf("--cmdline=%s", kernelCmdline), fmt.Sprintf("--os-release=@%s", osReleaseFile),
+		fmt.Sprintf("--uname=%s", kernelVersion), fmt.Sprintf("--output=%s", uki),
+	)
+	sb.s.Logger().Debug("ukify stdout: %s", string(stdOut))
+	if err != nil {
+		return fmt.Errorf("running ukify: %w", err)
+	}
+
+	err = sb.sign(sb.s, uki)
+	if err != nil {
+		return fmt.Errorf("signing unified kernel image: %w", err)
+	}
+	return nil
+}
+
+// inspectUKI reads the boot entry of the given entry ID from the sections of its UKI
+func (sb *SystemdBoot) inspectUKI(espDir, entryID string) (BootEntry, error) {
+	uki := filepath.Join(espDir, ukiDir, ukiName(entryID))
+	entry := BootEntry{ID: entryID, Linux: filepath.Join("/", ukiDir, ukiName(entryID))}
+
+	stdOut, err := sb.s.Runner().Run("ukify", "inspect", "--json=short", uki)
+	if err != nil {
+		return entry, fmt.Errorf("inspecting UKI '%s': %w", uki, err)
+	}
+
+	sections := map[string]ukiSection{}
+	err = json.Unmarshal(stdOut, &sections)
+	if err != nil {
+		return entry, fmt.Errorf("unmarshalling UKI '%s' sections: %w", uki, err)
+	}
+
+	osVars, err := godotenv.Unmarshal(sections[".osrel"].Text)
+	if err != nil {
+		return entry, fmt.Errorf("parsing UKI '%s' os-release: %w", uki, err)
+	}
+
+	entry.DisplayName = osVars["PRETTY_NAME"]
+	entry.CmdLine = strings.TrimSpace(sections[".cmdline"].Text)
+	return entry, nil
+}
+
+// listEntryIDs returns the entry IDs of the installed UKIs, snapshots in descending order followed by the recovery one
+func (sb *SystemdBoot) listEntryIDs(espDir string) ([]string, error) {
+	dir := filepath.Join(espDir, ukiDir)
+	if ok, _ := vfs.Exists(sb.s.FS(), dir); !ok {
+		return nil, nil
+	}
+
+	files, err := sb.s.FS().ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading directory '%s': %w", dir, err)
+	}
+
+	snapshots := []int{}
+	hasRecovery := false
+	for _, file := range files {
+		id, ok := strings.CutPrefix(strings.TrimSuffix(file.Name(), ".efi"), ukiPrefix)
+		if !ok || file.IsDir() {
+			continue
+		}
+		if id == RecoveryBootID {
+			hasRecovery = true
+			continue
+		}
+		snapshotID, err := strconv.Atoi(id)
+		if err != nil {
+			sb.s.Logger().Warn("Failed parsing snapshot ID '%s': %s", id, err.Error())
+			continue
+		}
+		snapshots = append(snapshots, snapshotID)
+	}
+
+	slices.Sort(snapshots)
+	slices.Reverse(snapshots)
+
+	ids := []string{}
+	for _, id := range snapshots {
+		ids = append(ids, strconv.Itoa(id))
+	}
+	if hasRecovery {
+		ids = append(ids, RecoveryBootID)
+	}
+	return ids, nil
+}
+
+func ukiName(entryID string) string {
+	return fmt.Sprintf("%s%s.efi", ukiPrefix, entryID)
+}
@@ -0,0 +1,183 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootloader_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/pkg/bootloader"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+var _ = Describe("SystemdBoot tests", Label("bootloader", "systemd-boot"), func() {
+	var tfs vfs.FS
+	var s *sys.System
+	var cleanup func()
+	var sdboot *bootloader.SystemdBoot
+	var runner *sysmock.Runner
+	BeforeEach(func() {
+		var err error
+		tfs, cleanup, err = sysmock.TestFS(map[string]any{
+			"/target/dir/etc/os-release":                                   "ID=opensuse-tumbleweed\nNAME=openSUSE Tumbleweed",
+			"/target/dir/usr/lib/systemd/boot/efi/systemd-bootx64.efi":     "x86_64 systemd-boot",
+			"/target/dir/usr/lib/modules/6.14.4-1-default/vmlinuz":         "6.14.4-1-default vmlinux",
+			"/target/dir/usr/lib/modules/6.14.4-1-default/initrd":          "6.14.4-1-default initrd",
+			"/target/dir/usr/lib/modules/6.14.4-1-default/.vmlinuz.hmac":   "6.14.4-1-default .vmlinux.hmac",
+			"/target/dir/usr/lib/systemd/boot/efi/systemd-bootaa64.efi":    "aarch64 systemd-boot",
+			"/target/dir/usr/lib/systemd/boot/efi/systemd-bootriscv64.efi": "riscv64 systemd-boot",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		runner = sysmock.NewRunner()
+		s, err = sys.NewSystem(
+			sys.WithRunner(runner),
+			sys.WithFS(tfs),
+			sys.WithLogger(log.New(log.WithDiscardAll())),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// ukify stub: a built UKI stores its os-release and cmdline sections as JSON
+		runner.SideEffect = func(command string, args ...string) ([]byte, error) {
+			if command != "ukify" {
+				return nil, fmt.Errorf("command '%s', %w", command, errors.ErrUnsupported)
+			}
+			switch args[0] {
+			case "build":
+				sections := map[string]map[string]string{}
+				var output string
+				for _, arg := range args[1:] {
+					key, value, _ := strings.Cut(arg, "=")
+					switch key {
+					case "--cmdline":
+						sections[".cmdline"] = map[string]string{"text": value}
+					case "--os-release":
+						osRelease, err := tfs.ReadFile(strings.TrimPrefix(value, "@"))
+						Expect(err).NotTo(HaveOccurred())
+						sections[".osrel"] = map[string]string{"text": string(osRelease)}
+					case "--output":
+						output = value
+					}
+				}
+				data, err := json.Marshal(sections)
+				Expect(err).NotTo(HaveOccurred())
+				return nil, tfs.WriteFile(output, data, vfs.FilePerm)
+			case "inspect":
+				return tfs.ReadFile(args[len(args)-1])
+			}
+			return nil, fmt.Errorf("ukify %s, %w", args[0], errors.ErrUnsupported)
+		}
+
+		sdboot = bootloader.NewSystemdBoot(s)
+	})
+	AfterEach(func() {
+		cleanup()
+	})
+
+	It("Installs systemd-boot and a UKI per snapshot", func() {
+		err := sdboot.Install("/target/dir", "/target/dir/boot", "EFI", "1", "kernel cmdline", "recovery cmdline")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(vfs.Exists(tfs, "/target/dir/boot/EFI/ELEMENTAL/bootx64.efi")).To(BeTrue())
+		Expect(vfs.Exists(tfs, "/target/dir/boot/EFI/BOOT/bootx64.efi")).To(BeTrue())
+		Expect(vfs.Exists(tfs, "/target/dir/boot/EFI/Linux/elemental-1.efi")).To(BeTrue())
+		Expect(vfs.Exists(tfs, "/target/dir/boot/EFI/Linux/elemental-recovery.efi")).To(BeTrue())
+
+		Expect(runner.MatchMilestones([][]string{
+			{
+				"ukify", "build", "--linux=/target/dir/usr/lib/modules/6.14.4-1-default/vmlinuz",
+				"--initrd=/target/dir/usr/lib/modules/6.14.4-1-default/initrd", "--cmdline=kernel cmdline",
+			},
+		})).To(Succeed())
+
+		loaderConf, err := tfs.ReadFile("/target/dir/boot/loader/loader.conf")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(loaderConf)).To(ContainSubstring("default elemental-1.efi\n"))
+
+		err = sdboot.Install("/target/dir", "/target/dir/boot", "EFI", "2", "new cmdline", "recovery cmdline")
+		Expect(err).ToNot(HaveOccurred())
+
+		entries, err := sdboot.GetEntries("/target/dir/boot")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(Equal([]bootloader.BootEntry{
+			{ID: "active", DisplayName: "openSUSE Tumbleweed", Linux: "/EFI/Linux/elemental-2.efi", CmdLine: "new cmdline"},
+			{ID: "2", DisplayName: "openSUSE Tumbleweed (2)", Linux: "/EFI/Linux/elemental-2.efi", CmdLine: "new cmdline"},
+			{ID: "1", DisplayName: "openSUSE Tumbleweed (1)", Linux: "/EFI/Linux/elemental-1.efi", CmdLine: "kernel cmdline"},
+			{ID: "recovery", DisplayName: "openSUSE Tumbleweed (recovery)", Linux: "/EFI/Linux/elemental-recovery.efi", CmdLine: "recovery cmdline"},
+		}))
+	})
+
+	It("Prunes UKIs of removed snapshots", func() {
+		for _, id := range []string{"1", "2", "3"} {
+			Expect(sdboot.Install("/target/dir", "/target/dir/boot", "EFI", id, "cmdline", "recovery")).To(Succeed())
+		}
+
+		Expect(sdboot.Prune("/target/dir", "/target/dir/boot", []int{3})).To(Succeed())
+
+		Expect(vfs.Exists(tfs, "/target/dir/boot/EFI/Linux/elemental-1.efi")).To(BeFalse())
+		Expect(vfs.Exists(tfs, "/target/dir/boot/EFI/Linux/elemental-2.efi")).To(BeFalse())
+		Expect(vfs.Exists(tfs, "/target/dir/boot/EFI/Linux/elemental-3.efi")).To(BeTrue())
+		Expect(vfs.Exists(tfs, "/target/dir/boot/EFI/Linux/elemental-recovery.efi")).To(BeTrue())
+	})
+
+	It("Sets an existing entry as the default one", func() {
+		Expect(sdboot.Install("/target/dir", "/target/dir/boot", "EFI", "1", "cmdline", "")).To(Succeed())
+		Expect(sdboot.Install("/target/dir", "/target/dir/boot", "EFI", "2", "cmdline", "")).To(Succeed())
+
+		Expect(sdboot.SetDefaultEntry("/target/dir/boot", "1")).To(Succeed())
+		loaderConf, err := tfs.ReadFile("/target/dir/boot/loader/loader.conf")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(loaderConf)).To(ContainSubstring("default elemental-1.efi\n"))
+
+		Expect(sdboot.SetDefaultEntry("/target/dir/boot", "5")).To(MatchError("boot entry '5' not found"))
+	})
+
+	It("Installs systemd-boot for live media", func() {
+		err := sdboot.InstallLive("/target/dir", "/iso", "root=live:CDLABEL=LIVE")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(vfs.Exists(tfs, "/iso/EFI/BOOT/bootx64.efi")).To(BeTrue())
+		Expect(vfs.Exists(tfs, "/iso/EFI/Linux/elemental-live.efi")).To(BeTrue())
+		Expect(runner.MatchMilestones([][]string{
+			{"ukify", "build", "--linux=/target/dir/usr/lib/modules/6.14.4-1-default/vmlinuz"},
+		})).To(Succeed())
+	})
+
+	It("Fails to build a UKI without initrd", func() {
+		Expect(tfs.Remove("/target/dir/usr/lib/modules/6.14.4-1-default/initrd")).To(Succeed())
+		err := sdboot.Install("/target/dir", "/target/dir/boot", "EFI", "1", "cmdline", "")
+		Expect(err).To(MatchError(ContainSubstring("initrd not found")))
+	})
+
+	It("Fails if ukify fails", func() {
+		runner.SideEffect = func(_ string, _ ...string) ([]byte, error) {
+			return nil, fmt.Errorf("ukify error")
+		}
+		err := sdboot.Install("/target/dir", "/target/dir/boot", "EFI", "1", "cmdline", "")
+		Expect(err).To(MatchError(ContainSubstring("running ukify: ukify error")))
+		Expect(vfs.Exists(tfs, "/target/dir/boot/loader/loader.conf")).To(BeFalse())
+	})
+})
@@ -27,6 +27,38 @@ import (
 
 const TopSubVol = "@"
 
+// Subvolume is a subvolume created by mkfs.btrfs while populating a new filesystem from a root tree
+type Subvolume struct {
+	// Path of the subvolume relative to the root tree, it must be an existing directory of the tree
+	Path          string
+	ReadOnly      bool
+	Default       bool
+	NoCopyOnWrite bool
+}
+
+// RootDirMkfsOpts returns the mkfs.btrfs options to populate a new filesystem with the content of the
+// given root tree, creating the given subvolumes from directories of the tree. No mount is required.
+func RootDirMkfsOpts(root string, subvolumes ...Subvolume) []string {
+	opts := []string{"--rootdir", root}
+	for _, subvol := range subvolumes {
+		path := subvol.Path
+		switch {
+		case subvol.Default && subvol.ReadOnly:
+			path = "default-ro:" + path
+		case subvol.Default:
+			path = "default:" + path
+		case subvol.ReadOnly:
+			path = "ro:" + path
+		}
+		opts = append(opts, "--subvol", path)
+		if !subvol.NoCopyOnWrite {
+			continue
+		}
+		opts = append(opts, "--inode-flags", "nodatacow:"+subvol.Path)
+	}
+	return opts
+}
+
 // EnableQuota enables btrfs quota the btrfs filesystem, path is usually the
 // mountpoint of the btrfs filesystem
 func EnableQuota(s *sys.System, path string) error {
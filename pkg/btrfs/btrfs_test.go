@@ -103,4 +103,14 @@ var _ = Describe("DirectoryUnpacker", Label("directory"), func() {
 			{"btrfs", "subvolume", "set-default", "/path/to/mountpoint/@"},
 		})).To(Succeed())
 	})
+	It("sets the mkfs options to create subvolumes from a root tree", func() {
+		Expect(btrfs.RootDirMkfsOpts("/root",
+			btrfs.Subvolume{Path: "@"},
+			btrfs.Subvolume{Path: "@/.snapshots/1/snapshot", Default: true, ReadOnly: true},
+			btrfs.Subvolume{Path: "@/var", NoCopyOnWrite: true},
+		)).To(Equal([]string{
+			"--rootdir", "/root", "--subvol", "@", "--subvol", "default-ro:@/.snapshots/1/snapshot",
+			"--subvol", "@/var", "--inode-flags", "nodatacow:@/var",
+		}))
+	})
 })
@@ -0,0 +1,250 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/suse/elemental/v3/pkg/sys"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+const (
+	entriesDir   = "entries"
+	ociDir       = "oci"
+	downloadsDir = "downloads"
+)
+
+type Kind string
+
+const (
+	OCIImage Kind = "oci"
+	Download Kind = "download"
+)
+
+// Entry describes an item stored in the cache
+type Entry struct {
+	Kind Kind `json:"kind"`
+	// Source is the image reference or the URL the entry was fetched from
+	Source string `json:"source"`
+	// Digest is the OCI digest the image reference resolved to or the ETag of the downloaded URL
+	Digest   string    `json:"digest"`
+	Platform string    `json:"platform,omitempty"`
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+// Key returns the content address of the entry within the cache. Images are addressed by
+// digest and platform regardless of the reference used to pull them, downloads by URL and ETag.
+func (e Entry) Key() string {
+	if e.Kind == OCIImage {
+		return key(e.Kind, e.Digest, e.Platform)
+	}
+	return key(e.Kind, e.Source, e.Digest)
+}
+
+// Cache is a content-addressed store of OCI images and downloaded files persisted across builds.
+// OCI images are keyed by digest and platform and stored in an OCI image layout, hence layers
+// are shared across images. Downloads are keyed by URL and ETag.
+type Cache struct {
+	s   *sys.System
+	dir string
+}
+
+func New(s *sys.System, dir string) *Cache {
+	return &Cache{s: s, dir: dir}
+}
+
+// Dir returns the root directory of the cache
+func (c Cache) Dir() string {
+	return c.dir
+}
+
+// List returns all the entries of the cache, the most recently used first
+func (c Cache) List() ([]Entry, error) {
+	dir := filepath.Join(c.dir, entriesDir)
+	files, err := c.s.FS().ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading cache entries: %w", err)
+	}
+
+	var entries []Entry
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		entry, err := c.readEntry(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+
+	slices.SortFunc(entries, func(a, b Entry) int {
+		return b.LastUsed.Compare(a.LastUsed)
+	})
+	return entries, nil
+}
+
+// ResolveFunc resolves the digest of an image reference or the ETag of a URL
+type ResolveFunc func() (string, error)
+
+// Resolve returns the digest or ETag of the given source as returned by the given resolve function.
+// If the remote source can't be reached, the one of the most recently used entry of the source is
+// returned instead, so cached items remain usable without network access. Any other error, such as
+// a cancellation or an error status of the remote source, is returned as is, as well as the resolve
+// error if the source is not cached.
+func (c Cache) Resolve(kind Kind, source, platform string, resolve ResolveFunc) (string, error) {
+	digest, rErr := resolve()
+	if rErr == nil {
+		return digest, nil
+	} else if !isUnreachable(rErr) {
+		return "", rErr
+	}
+
+	entries, err := c.List()
+	if err != nil {
+		return "", errors.Join(rErr, err)
+	}
+	for _, entry := range entries {
+		if entry.Kind == kind && entry.Source == source && entry.Platform == platform {
+			c.s.Logger().Warn("Could not resolve %s, using the cached %s: %v", source, entry.Digest, rErr)
+			return entry.Digest, nil
+		}
+	}
+	return "", rErr
+}
+
+// isUnreachable returns true if the given error is a network error reaching the remote source
+func isUnreachable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return errors.As(err, &opErr) || errors.As(err, &dnsErr)
+}
+
+// Prune removes the entries not used within the given duration, a zero duration removes all
+// entries. Returns the removed entries.
+func (c Cache) Prune(olderThan time.Duration) ([]Entry, error) {
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []Entry
+	var images []string
+	for _, entry := range entries {
+		if olderThan > 0 && time.Since(entry.LastUsed) < olderThan {
+			continue
+		}
+
+		k := entry.Key()
+		switch entry.Kind {
+		case OCIImage:
+			images = append(images, k)
+		case Download:
+			err = c.s.FS().RemoveAll(filepath.Join(c.dir, downloadsDir, k))
+			if err != nil {
+				return nil, fmt.Errorf("removing download '%s': %w", entry.Source, err)
+			}
+		}
+		err = c.s.FS().Remove(c.entryPath(k))
+		if err != nil {
+			return nil, fmt.Errorf("removing cache entry '%s': %w", entry.Source, err)
+		}
+		pruned = append(pruned, entry)
+	}
+
+	if len(images) > 0 {
+		err = c.removeImages(images...)
+		if err != nil {
+			return nil, fmt.Errorf("removing cached images: %w", err)
+		}
+	}
+	return pruned, nil
+}
+
+// key computes the content address of an entry
+func key(kind Kind, fields ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(append([]string{string(kind)}, fields...), "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c Cache) entryPath(key string) string {
+	return filepath.Join(c.dir, entriesDir, key+".json")
+}
+
+// readEntry reads the entry at the given path
+func (c Cache) readEntry(path string) (*Entry, error) {
+	data, err := c.s.FS().ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading cache entry: %w", err)
+	}
+
+	entry := &Entry{}
+	err = json.Unmarshal(data, entry)
+	if err != nil {
+		return nil, fmt.Errorf("parsing cache entry '%s': %w", path, err)
+	}
+	return entry, nil
+}
+
+// lookup returns the entry for the given key, nil if not cached
+func (c Cache) lookup(key string) (*Entry, error) {
+	path := c.entryPath(key)
+	if ok, _ := vfs.Exists(c.s.FS(), path); !ok {
+		return nil, nil
+	}
+	return c.readEntry(path)
+}
+
+// writeEntry stores the given entry setting its last usage time to now
+func (c Cache) writeEntry(entry *Entry) error {
+	entry.LastUsed = time.Now()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshalling cache entry: %w", err)
+	}
+
+	err = vfs.MkdirAll(c.s.FS(), filepath.Join(c.dir, entriesDir), vfs.DirPerm)
+	if err != nil {
+		return fmt.Errorf("creating cache entries directory: %w", err)
+	}
+
+	err = c.s.FS().WriteFile(c.entryPath(entry.Key()), data, vfs.FilePerm)
+	if err != nil {
+		return fmt.Errorf("writing cache entry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	containerregistry "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/pkg/cache"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+// errUnreachable is the error of a connection refused by the remote source
+var errUnreachable = fmt.Errorf("executing request: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+
+var _ = Describe("Cache", Label("cache"), func() {
+	var tfs vfs.FS
+	var s *sys.System
+	var c *cache.Cache
+	var cleanup func()
+	BeforeEach(func() {
+		var err error
+		tfs, cleanup, err = sysmock.TestFS(map[string]any{"/target": map[string]any{}})
+		Expect(err).NotTo(HaveOccurred())
+		s, err = sys.NewSystem(sys.WithFS(tfs), sys.WithLogger(log.New(log.WithDiscardAll())))
+		Expect(err).NotTo(HaveOccurred())
+		c = cache.New(s, "/cache")
+	})
+	AfterEach(func() {
+		cleanup()
+	})
+	Describe("OCI images", func() {
+		var img containerregistry.Image
+		var fetched int
+		var fetch cache.FetchFunc
+		BeforeEach(func() {
+			var err error
+			img, err = random.Image(1024, 2)
+			Expect(err).NotTo(HaveOccurred())
+			fetched = 0
+			fetch = func() (containerregistry.Image, error) {
+				fetched++
+				return img, nil
+			}
+		})
+		It("fetches images only on cache misses", func() {
+			digest, err := img.Digest()
+			Expect(err).NotTo(HaveOccurred())
+
+			for range 2 {
+				cached, err := c.Image("registry.org/my/os:v1", digest.String(), "linux/amd64", fetch)
+				Expect(err).NotTo(HaveOccurred())
+				cachedDigest, err := cached.Digest()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cachedDigest).To(Equal(digest))
+			}
+			Expect(fetched).To(Equal(1))
+
+			// Same digest for another platform is a different entry
+			_, err = c.Image("registry.org/my/os:v1", digest.String(), "linux/arm64", fetch)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fetched).To(Equal(2))
+
+			entries, err := c.List()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(2))
+			Expect(entries[0].Kind).To(Equal(cache.OCIImage))
+			Expect(entries[0].Platform).To(Equal("linux/arm64"))
+			Expect(entries[0].Size).To(BeNumerically(">", 2048))
+		})
+		It("fails if the image can't be fetched", func() {
+			_, err := c.Image("registry.org/my/os:v1", "sha256:abc", "linux/amd64", func() (containerregistry.Image, error) {
+				return nil, fmt.Errorf("fetch failed")
+			})
+			Expect(err).To(MatchError("fetch failed"))
+			Expect(c.List()).To(BeEmpty())
+		})
+		It("resolves the cached digest of a reference if the registry is not reachable", func() {
+			digest, err := img.Digest()
+			Expect(err).NotTo(HaveOccurred())
+			unreachable := func() (string, error) { return "", errUnreachable }
+
+			_, err = c.Resolve(cache.OCIImage, "registry.org/my/os:v1", "linux/amd64", unreachable)
+			Expect(err).To(MatchError(errUnreachable))
+
+			resolved, err := c.Resolve(cache.OCIImage, "registry.org/my/os:v1", "linux/amd64", func() (string, error) {
+				return digest.String(), nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = c.Image("registry.org/my/os:v1", resolved, "linux/amd64", fetch)
+			Expect(err).NotTo(HaveOccurred())
+
+			resolved, err = c.Resolve(cache.OCIImage, "registry.org/my/os:v1", "linux/amd64", unreachable)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resolved).To(Equal(digest.String()))
+			_, err = c.Image("registry.org/my/os:v1", resolved, "linux/amd64", fetch)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fetched).To(Equal(1))
+
+			// other platforms are not cached
+			_, err = c.Resolve(cache.OCIImage, "registry.org/my/os:v1", "linux/arm64", unreachable)
+			Expect(err).To(MatchError(errUnreachable))
+		})
+		It("does not use the cached digest if the registry rejects the reference or it is cancelled", func() {
+			digest, err := img.Digest()
+			Expect(err).NotTo(HaveOccurred())
+			_, err = c.Image("registry.org/my/os:v1", digest.String(), "linux/amd64", fetch)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = c.Resolve(cache.OCIImage, "registry.org/my/os:v1", "linux/amd64", func() (string, error) {
+				return "", fmt.Errorf("unexpected status code 404 Not Found")
+			})
+			Expect(err).To(MatchError("unexpected status code 404 Not Found"))
+
+			_, err = c.Resolve(cache.OCIImage, "registry.org/my/os:v1", "linux/amd64", func() (string, error) {
+				return "", fmt.Errorf("executing request: %w", context.Canceled)
+			})
+			Expect(err).To(MatchError(context.Canceled))
+		})
+		It("prunes images and their layers", func() {
+			digest, err := img.Digest()
+			Expect(err).NotTo(HaveOccurred())
+			_, err = c.Image("registry.org/my/os:v1", digest.String(), "linux/amd64", fetch)
+			Expect(err).NotTo(HaveOccurred())
+
+			pruned, err := c.Prune(time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pruned).To(BeEmpty())
+
+			pruned, err = c.Prune(0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pruned).To(HaveLen(1))
+			Expect(c.List()).To(BeEmpty())
+
+			blobs, err := tfs.ReadDir("/cache/oci/blobs/sha256")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(blobs).To(BeEmpty())
+		})
+	})
+	Describe("Downloads", func() {
+		var downloads int
+		var etag string
+		var download cache.DownloadFunc
+		BeforeEach(func() {
+			downloads = 0
+			etag = `"v1"`
+			download = func(_ context.Context, fs vfs.FS, url, path string) error {
+				downloads++
+				return fs.WriteFile(path, []byte(url), vfs.FilePerm)
+			}
+		})
+		etagFunc := func(context.Context, string) (string, error) {
+			return etag, nil
+		}
+		It("downloads files only on cache misses", func() {
+			downloader := c.Downloader(download, etagFunc)
+			Expect(downloader(context.Background(), tfs, "https://example.com/ext.raw", "/target/first.raw")).To(Succeed())
+			Expect(downloader(context.Background(), tfs, "https://example.com/ext.raw", "/target/second.raw")).To(Succeed())
+			Expect(downloads).To(Equal(1))
+
+			data, err := tfs.ReadFile("/target/second.raw")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("https://example.com/ext.raw"))
+
+			// A new ETag invalidates the cached file
+			etag = `"v2"`
+			Expect(downloader(context.Background(), tfs, "https://example.com/ext.raw", "/target/third.raw")).To(Succeed())
+			Expect(downloads).To(Equal(2))
+
+			entries, err := c.List()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(2))
+			Expect(entries[0].Digest).To(Equal(`"v2"`))
+			Expect(entries[0].Size).To(Equal(int64(len("https://example.com/ext.raw"))))
+		})
+		It("uses the cached file if the ETag can't be fetched", func() {
+			etagErr := errUnreachable
+			failingETag := func(context.Context, string) (string, error) {
+				if etagErr != nil {
+					return "", etagErr
+				}
+				return etag, nil
+			}
+			downloader := c.Downloader(download, failingETag)
+
+			// not cached yet, the file is downloaded without caching it
+			Expect(downloader(context.Background(), tfs, "https://example.com/ext.raw", "/target/first.raw")).To(Succeed())
+			Expect(downloads).To(Equal(1))
+			Expect(c.List()).To(BeEmpty())
+
+			etagErr = nil
+			Expect(downloader(context.Background(), tfs, "https://example.com/ext.raw", "/target/second.raw")).To(Succeed())
+			Expect(downloads).To(Equal(2))
+
+			etagErr = errUnreachable
+			Expect(downloader(context.Background(), tfs, "https://example.com/ext.raw", "/target/third.raw")).To(Succeed())
+			Expect(downloads).To(Equal(2))
+			data, err := tfs.ReadFile("/target/third.raw")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("https://example.com/ext.raw"))
+		})
+		It("stops if the download is cancelled while fetching the ETag", func() {
+			downloader := c.Downloader(download, etagFunc)
+			Expect(downloader(context.Background(), tfs, "https://example.com/ext.raw", "/target/first.raw")).To(Succeed())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			downloader = c.Downloader(download, func(ctx context.Context, _ string) (string, error) {
+				return "", fmt.Errorf("executing request: %w", ctx.Err())
+			})
+			err := downloader(ctx, tfs, "https://example.com/ext.raw", "/target/second.raw")
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(downloads).To(Equal(1))
+			Expect(vfs.Exists(tfs, "/target/second.raw")).To(BeFalse())
+		})
+		It("does not cache files without an ETag", func() {
+			etag = ""
+			downloader := c.Downloader(download, etagFunc)
+			Expect(downloader(context.Background(), tfs, "https://example.com/ext.raw", "/target/first.raw")).To(Succeed())
+			Expect(downloader(context.Background(), tfs, "https://example.com/ext.raw", "/target/second.raw")).To(Succeed())
+			Expect(downloads).To(Equal(2))
+			Expect(c.List()).To(BeEmpty())
+		})
+		It("prunes downloaded files", func() {
+			downloader := c.Downloader(download, etagFunc)
+			Expect(downloader(context.Background(), tfs, "https://example.com/ext.raw", "/target/first.raw")).To(Succeed())
+
+			pruned, err := c.Prune(0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pruned).To(HaveLen(1))
+			Expect(pruned[0].Source).To(Equal("https://example.com/ext.raw"))
+
+			entries, err := tfs.ReadDir("/cache/downloads")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		})
+	})
+})
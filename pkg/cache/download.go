@@ -0,0 +1,108 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+const downloadFile = "data"
+
+// DownloadFunc downloads the given URL to the given path
+type DownloadFunc func(ctx context.Context, fs vfs.FS, url, path string) error
+
+// ETagFunc resolves the ETag of the given URL
+type ETagFunc func(ctx context.Context, url string) (string, error)
+
+// Downloader wraps the given download function to serve the files from the cache. Files are
+// keyed by URL and ETag, so only the ETag is fetched on a cache hit. If the server can't be reached
+// the most recently cached file of the URL is used. URLs without an ETag are always downloaded
+// and never cached.
+func (c Cache) Downloader(download DownloadFunc, etag ETagFunc) DownloadFunc {
+	return func(ctx context.Context, fs vfs.FS, url, path string) error {
+		tag, err := c.Resolve(Download, url, "", func() (string, error) { return etag(ctx, url) })
+		if err != nil && ctx.Err() != nil {
+			return err
+		}
+		if err != nil || tag == "" {
+			c.s.Logger().Debug("Could not determine ETag of %s, skipping cache: %v", url, err)
+			return download(ctx, fs, url, path)
+		}
+
+		entry := &Entry{Kind: Download, Source: url, Digest: tag}
+		dir := filepath.Join(c.dir, downloadsDir, entry.Key())
+		data := filepath.Join(dir, downloadFile)
+
+		cached, err := c.lookup(entry.Key())
+		if err != nil {
+			return err
+		}
+		if cached != nil {
+			c.s.Logger().Info("Using cached download %s", url)
+			entry.Size = cached.Size
+		} else {
+			err = vfs.MkdirAll(c.s.FS(), dir, vfs.DirPerm)
+			if err != nil {
+				return fmt.Errorf("creating cache download directory: %w", err)
+			}
+			err = download(ctx, c.s.FS(), url, data)
+			if err != nil {
+				_ = c.s.FS().RemoveAll(dir)
+				return err
+			}
+			info, err := c.s.FS().Stat(data)
+			if err != nil {
+				return fmt.Errorf("reading downloaded file: %w", err)
+			}
+			entry.Size = info.Size()
+		}
+
+		err = copyFile(c.s.FS(), data, fs, path)
+		if err != nil {
+			return fmt.Errorf("copying cached download: %w", err)
+		}
+		return c.writeEntry(entry)
+	}
+}
+
+// copyFile copies the source file into the target path of the given target filesystem
+func copyFile(srcFS vfs.FS, src string, targetFS vfs.FS, target string) error {
+	in, err := srcFS.OpenFile(src, os.O_RDONLY, vfs.FilePerm)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := targetFS.Create(target)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
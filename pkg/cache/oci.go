@@ -0,0 +1,208 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	containerregistry "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+// keyAnnotation is the annotation holding the entry key of each image descriptor within the OCI layout
+const keyAnnotation = "com.suse.elemental.cache.key"
+
+// FetchFunc fetches an image from its origin
+type FetchFunc func() (containerregistry.Image, error)
+
+// Image returns the image of the given source resolved to the given digest for the given platform.
+// On a cache hit the image is read from the cache without any network access, otherwise it is
+// fetched and stored in the cache first.
+func (c Cache) Image(source, digest, platform string, fetch FetchFunc) (containerregistry.Image, error) {
+	entry := &Entry{Kind: OCIImage, Source: source, Digest: digest, Platform: platform}
+	k := entry.Key()
+
+	p, err := c.layout()
+	if err != nil {
+		return nil, err
+	}
+
+	cached, err := c.lookup(k)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		img, err := cachedImage(p, k)
+		if err == nil {
+			c.s.Logger().Info("Using cached image %s (%s)", source, digest)
+			entry.Size = cached.Size
+			return img, c.writeEntry(entry)
+		}
+		c.s.Logger().Warn("Cached image %s is not readable, fetching it again: %s", source, err.Error())
+	}
+
+	img, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	c.s.Logger().Info("Storing image %s (%s) in cache", source, digest)
+	err = p.ReplaceImage(img, match.Annotation(keyAnnotation, k), layout.WithAnnotations(map[string]string{keyAnnotation: k}))
+	if err != nil {
+		return nil, fmt.Errorf("storing image in cache: %w", err)
+	}
+
+	entry.Size, err = imageSize(img)
+	if err != nil {
+		return nil, err
+	}
+	err = c.writeEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+	return cachedImage(p, k)
+}
+
+// layout returns the OCI image layout of the cache, it is created if it does not exist
+func (c Cache) layout() (layout.Path, error) {
+	dir := filepath.Join(c.dir, ociDir)
+	err := vfs.MkdirAll(c.s.FS(), dir, vfs.DirPerm)
+	if err != nil {
+		return "", fmt.Errorf("creating OCI cache directory: %w", err)
+	}
+
+	raw, err := c.s.FS().RawPath(dir)
+	if err != nil {
+		return "", err
+	}
+
+	if ok, _ := vfs.Exists(c.s.FS(), filepath.Join(dir, "index.json")); ok {
+		return layout.FromPath(raw)
+	}
+
+	p, err := layout.Write(raw, empty.Index)
+	if err != nil {
+		return "", fmt.Errorf("initializing OCI cache layout: %w", err)
+	}
+	return p, nil
+}
+
+// removeImages drops the images of the given keys from the layout and removes all the blobs
+// not referenced by any of the remaining images
+func (c Cache) removeImages(keys ...string) error {
+	p, err := c.layout()
+	if err != nil {
+		return err
+	}
+
+	err = p.RemoveDescriptors(func(desc containerregistry.Descriptor) bool {
+		return slices.Contains(keys, desc.Annotations[keyAnnotation])
+	})
+	if err != nil {
+		return err
+	}
+
+	keep := map[containerregistry.Hash]bool{}
+	idx, err := p.ImageIndex()
+	if err != nil {
+		return err
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return err
+	}
+	for _, desc := range manifest.Manifests {
+		img, err := p.Image(desc.Digest)
+		if err != nil {
+			return err
+		}
+		m, err := img.Manifest()
+		if err != nil {
+			return err
+		}
+		keep[desc.Digest] = true
+		keep[m.Config.Digest] = true
+		for _, l := range m.Layers {
+			keep[l.Digest] = true
+		}
+	}
+
+	blobsDir := filepath.Join(c.dir, ociDir, "blobs")
+	algorithms, err := c.s.FS().ReadDir(blobsDir)
+	if err != nil {
+		return err
+	}
+	for _, algorithm := range algorithms {
+		blobs, err := c.s.FS().ReadDir(filepath.Join(blobsDir, algorithm.Name()))
+		if err != nil {
+			return err
+		}
+		for _, blob := range blobs {
+			h := containerregistry.Hash{Algorithm: algorithm.Name(), Hex: blob.Name()}
+			if keep[h] {
+				continue
+			}
+			err = p.RemoveBlob(h)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cachedImage returns the image of the given key from the layout
+func cachedImage(p layout.Path, key string) (containerregistry.Image, error) {
+	idx, err := p.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	for _, desc := range manifest.Manifests {
+		if desc.Annotations[keyAnnotation] == key {
+			return p.Image(desc.Digest)
+		}
+	}
+	return nil, fmt.Errorf("image not found in cache layout")
+}
+
+// imageSize returns the size of the manifest, the config and the compressed layers of the image
+func imageSize(img containerregistry.Image) (int64, error) {
+	m, err := img.Manifest()
+	if err != nil {
+		return 0, fmt.Errorf("reading image manifest: %w", err)
+	}
+	size, err := img.Size()
+	if err != nil {
+		return 0, fmt.Errorf("reading image manifest size: %w", err)
+	}
+	size += m.Config.Size
+	for _, l := range m.Layers {
+		size += l.Size
+	}
+	return size, nil
+}
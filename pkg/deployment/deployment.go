@@ -25,6 +25,7 @@ import (
 	"slices"
 	"sort"
 	"strings"
+	"time"
 
 	"go.yaml.in/yaml/v3"
 
@@ -40,6 +41,9 @@ const (
 	EfiMnt       = "/boot"
 	EfiSize  MiB = 1024
 
+	BiosLabel     = "BIOS"
+	BiosSize  MiB = 1
+
 	RecoveryLabel = "RECOVERY"
 	RecoverySize  = 0
 
@@ -52,6 +56,8 @@ const (
 
 	deploymentFile = "/etc/elemental/deployment.yaml"
 
+	DefaultHealthCheckTimeout = 5 * time.Minute
+
 	Unknown = "unknown"
 )
 
@@ -62,6 +68,8 @@ const (
 	System
 	Recovery
 	Data
+	BIOS
+	Swap
 )
 
 type FileSystem int
@@ -72,6 +80,7 @@ const (
 	Ext4
 	XFS
 	VFat
+	SwapFS
 )
 
 func ParseFileSystem(f string) (FileSystem, error) {
@@ -86,6 +95,8 @@ func ParseFileSystem(f string) (FileSystem, error) {
 		return XFS, nil
 	case "vfat":
 		return VFat, nil
+	case "swap":
+		return SwapFS, nil
 	default:
 		return FileSystem(0), fmt.Errorf("filesystem not supported: %s", f)
 	}
@@ -103,6 +114,8 @@ func (f FileSystem) String() string {
 		return "xfs"
 	case VFat:
 		return "vfat"
+	case SwapFS:
+		return "swap"
 	default:
 		return Unknown
 	}
@@ -129,6 +142,66 @@ func (f *FileSystem) UnmarshalYAML(data *yaml.Node) (err error) {
 	return err
 }
 
+// MergePolicy sets how conflicting changes of a snapshotted RW volume are merged on upgrades.
+// A conflict happens when a path was both customized locally and changed by the new OS image.
+type MergePolicy int
+
+const (
+	// PreferLocal keeps local changes over the changes of the OS image, this is the default
+	PreferLocal MergePolicy = iota + 1
+	// PreferImage keeps the changes of the OS image over local changes
+	PreferImage
+	// FailOnConflict makes the upgrade fail on conflicts
+	FailOnConflict
+)
+
+func ParseMergePolicy(p string) (MergePolicy, error) {
+	switch p {
+	case "prefer-local":
+		return PreferLocal, nil
+	case "prefer-image":
+		return PreferImage, nil
+	case "fail-on-conflict":
+		return FailOnConflict, nil
+	default:
+		return MergePolicy(0), fmt.Errorf("merge policy not supported: %s", p)
+	}
+}
+
+func (m MergePolicy) String() string {
+	switch m {
+	case PreferLocal:
+		return "prefer-local"
+	case PreferImage:
+		return "prefer-image"
+	case FailOnConflict:
+		return "fail-on-conflict"
+	default:
+		return Unknown
+	}
+}
+
+var (
+	_ yaml.Marshaler   = MergePolicy(0)
+	_ yaml.Unmarshaler = (*MergePolicy)(nil)
+)
+
+func (m MergePolicy) MarshalYAML() (any, error) {
+	if str := m.String(); str != Unknown {
+		return str, nil
+	}
+	return nil, fmt.Errorf("unknown merge policy: %d", m)
+}
+
+func (m *MergePolicy) UnmarshalYAML(data *yaml.Node) (err error) {
+	var policy string
+	if err = data.Decode(&policy); err != nil {
+		return err
+	}
+	*m, err = ParseMergePolicy(policy)
+	return err
+}
+
 func ParseRole(function string) (PartRole, error) {
 	switch function {
 	case "efi":
@@ -139,6 +212,10 @@ func ParseRole(function string) (PartRole, error) {
 		return Recovery, nil
 	case "data":
 		return Data, nil
+	case "bios":
+		return BIOS, nil
+	case "swap":
+		return Swap, nil
 	default:
 		return PartRole(0), fmt.Errorf("unknown partition function: %s", function)
 	}
@@ -154,6 +231,10 @@ func (p PartRole) String() string {
 		return "recovery"
 	case Data:
 		return "data"
+	case BIOS:
+		return "bios"
+	case Swap:
+		return "swap"
 	default:
 		return Unknown
 	}
@@ -183,6 +264,34 @@ type RWVolume struct {
 	Snapshotted   bool     `yaml:"snapshotted,omitempty"`
 	NoCopyOnWrite bool     `yaml:"noCopyOnWrite,omitempty"`
 	MountOpts     []string `yaml:"mountOpts,omitempty"`
+	// MergePolicy is the policy applied to conflicts of a snapshotted volume, defaults to PreferLocal
+	MergePolicy MergePolicy `yaml:"mergePolicy,omitempty"`
+	// PathMergePolicies overwrite the volume merge policy for specific paths
+	PathMergePolicies []PathMergePolicy `yaml:"pathMergePolicies,omitempty"`
+}
+
+// PathMergePolicy sets the merge policy of the volume paths matching the given path. The path
+// is either a shell pattern or a directory, in which case the policy applies to all of its content.
+type PathMergePolicy struct {
+	Path   string      `yaml:"path"`
+	Policy MergePolicy `yaml:"policy"`
+}
+
+// GetMergePolicy returns the merge policy applied to the given absolute path of the volume. The
+// first matching path merge policy applies, otherwise the volume merge policy is returned.
+func (r RWVolume) GetMergePolicy(path string) MergePolicy {
+	for _, pmp := range r.PathMergePolicies {
+		if ok, _ := filepath.Match(pmp.Path, path); ok {
+			return pmp.Policy
+		}
+		if strings.HasPrefix(path, strings.TrimSuffix(pmp.Path, "/")+"/") {
+			return pmp.Policy
+		}
+	}
+	if r.MergePolicy == MergePolicy(0) {
+		return PreferLocal
+	}
+	return r.MergePolicy
 }
 
 type RWVolumes []RWVolume
@@ -197,22 +306,37 @@ type Partition struct {
 	RWVolumes  RWVolumes  `yaml:"rwVolumes,omitempty"`
 	UUID       string     `yaml:"uuid,omitempty"`
 	Hidden     bool       `yaml:"hidden,omitempty"`
+	// Grow expands the partition and its filesystem to the available disk space on boot, only
+	// the last partition of the system disk can grow
+	Grow bool `yaml:"grow,omitempty"`
+	// Encryption sets LUKS2 encryption of the partition if defined
+	Encryption *Encryption `yaml:"encryption,omitempty"`
+	// Verity marks the partition as a verity data or hash partition, those are managed by elemental
+	Verity *VerityPartition `yaml:"verity,omitempty"`
 }
 
 type Partitions []*Partition
 
 type Disk struct {
-	Device     string     `yaml:"target,omitempty"`
-	Partitions Partitions `yaml:"partitions"`
+	Device string `yaml:"target,omitempty"`
+	// Selector picks the disk device at installation time if no device is set
+	Selector   *DiskSelector `yaml:"selector,omitempty"`
+	Partitions Partitions    `yaml:"partitions"`
 }
 
 type BootConfig struct {
 	Bootloader    string `yaml:"name"`
 	KernelCmdline string `yaml:"kernelCmdline"`
+	// BootAttempts is the number of failed boots of a new snapshot before falling back
+	// to the previous one, zero disables boot counting
+	BootAttempts int `yaml:"bootAttempts,omitempty"`
 }
 
 type FirmwareConfig struct {
 	BootEntries []*firmware.EfiBootEntry `yaml:"entries"`
+	// BIOS installs the bootloader for legacy BIOS boot in addition to EFI, it requires
+	// a 'bios' partition in the system disk which is added if missing
+	BIOS bool `yaml:"bios,omitempty"`
 }
 
 type FipsConfig struct {
@@ -221,12 +345,46 @@ type FipsConfig struct {
 
 type SnapshotterConfig struct {
 	Name string `yaml:"name"`
+	// MaxSnapshots is the maximum number of unpinned snapshots kept on cleanup, zero sets the snapshotter default
+	MaxSnapshots int `yaml:"maxSnapshots,omitempty"`
+	// MaxAge is the maximum age of unpinned snapshots kept on cleanup, zero keeps snapshots regardless of their age
+	MaxAge time.Duration `yaml:"maxAge,omitempty"`
+}
+
+// RollbackInfo records the rollback that made a deployment the default one again
+type RollbackInfo struct {
+	Date string       `yaml:"date"`
+	From *ImageSource `yaml:"from,omitempty"`
+}
+
+// HealthCheck is a command to verify the system is healthy after booting a new snapshot
+type HealthCheck struct {
+	Name string `yaml:"name"`
+	// Command is executed by a shell, the check passes if it exits with a zero status
+	Command string `yaml:"command"`
+	// Timeout is the maximum time the command is allowed to run, defaults to DefaultHealthCheckTimeout
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// ReleaseInfo records the release manifest a deployment was built or upgraded from
+type ReleaseInfo struct {
+	ManifestURI string          `yaml:"manifestURI"`
+	Version     string          `yaml:"version,omitempty"`
+	Extensions  []ExtensionInfo `yaml:"extensions,omitempty"`
+}
+
+// ExtensionInfo records a systemd extension installed from a release manifest
+type ExtensionInfo struct {
+	Name string `yaml:"name"`
+	// File is the name of the extension image or directory within the extensions directory
+	File string `yaml:"file"`
 }
 
 type LiveInstaller struct {
 	OverlayTree   *ImageSource `yaml:"overlayTree,omitempty"`
 	CfgScript     string       `yaml:"configScript,omitempty"`
 	KernelCmdline string       `yaml:"kernelCmdline,omitempty"`
+	Image         LiveImage    `yaml:"image,omitempty"`
 }
 
 type Deployment struct {
@@ -239,13 +397,24 @@ type Deployment struct {
 	OverlayTree *ImageSource       `yaml:"overlayTree,omitempty"`
 	CfgScript   string             `yaml:"configScript,omitempty"`
 	Installer   LiveInstaller      `yaml:"installer,omitempty"`
+	Rollback    *RollbackInfo      `yaml:"rollback,omitempty"`
+	Release     *ReleaseInfo       `yaml:"release,omitempty"`
+	// HealthChecks are executed on the first boot of a new snapshot, any failure rolls back to the previous one
+	HealthChecks []HealthCheck `yaml:"healthChecks,omitempty"`
+	// Verity protects the /usr tree of each deployment with dm-verity if set
+	Verity *VerityConfig `yaml:"verity,omitempty"`
+	// SecureBoot signs the boot artifacts installed into the ESP with the given keys if set
+	SecureBoot *SecureBoot `yaml:"secureBoot,omitempty"`
+	// Swap sets a swap file and a zram device if set, swap partitions are defined with the 'swap' role
+	Swap *SwapConfig `yaml:"swap,omitempty"`
 }
 
 type Opt func(d *Deployment)
 
 // LiveKernelCmdline returns the default kernel command line to live boot with the givel label
-func LiveKernelCmdline(label string) string {
-	return fmt.Sprintf("root=live:LABEL=%s rd.live.overlay.overlayfs=1", label)
+// from the given image
+func LiveKernelCmdline(label string, img LiveImage) string {
+	return strings.TrimSpace(fmt.Sprintf("root=live:LABEL=%s rd.live.overlay.overlayfs=1 %s", label, img.KernelCmdline()))
 }
 
 // GetSnapshottedVolumes returns a list of snapshotted rw volumes defined in the
@@ -278,9 +447,10 @@ func (s SanitizeDeployment) name() string {
 }
 
 var sanitizers = []SanitizeDeployment{
-	checkSystemPart, checkEFIPart, checkRecoveryPart,
-	checkAllAvailableSize, checkPartitionsFS, checkRWVolumes,
-	CheckSourceOS, CheckDiskDevice,
+	checkSystemPart, checkEFIPart, checkRecoveryPart, checkBIOSPart,
+	checkAllAvailableSize, checkSwap, checkPartitionsFS, checkGrowPart, checkRWVolumes, checkDiskSelectors,
+	CheckSourceOS, CheckDiskDevice, checkBootConfig, checkHealthChecks,
+	checkSnapshotter, checkEncryption, checkVerity, checkSecureBoot, checkLiveImage,
 }
 
 // GetSystemPartition returns the system partition from the disk.
@@ -371,7 +541,11 @@ func (d Deployment) GetEfiDisk() *Disk {
 
 // BaseKernelCmdline returns the base kernel command line for the current deployment
 func (d Deployment) BaseKernelCmdline() string {
-	return fmt.Sprintf("root=LABEL=%s", d.GetSystemLabel())
+	cmdline := fmt.Sprintf("root=LABEL=%s", d.GetSystemLabel())
+	if sysPart := d.GetSystemPartition(); sysPart != nil && sysPart.Encryption != nil && sysPart.Encryption.UUID != "" {
+		cmdline = fmt.Sprintf("%s %s", cmdline, sysPart.Encryption.KernelCmdline())
+	}
+	return cmdline
 }
 
 // RecoveryKernelCmdline returns the base kernel command line for the current deployment
@@ -381,7 +555,7 @@ func (d Deployment) RecoveryKernelCmdline() string {
 	if rec != nil {
 		label = rec.Label
 	}
-	return LiveKernelCmdline(label)
+	return LiveKernelCmdline(label, d.Installer.Image)
 }
 
 // Sanitize checks the consistency of the current Disk structure. ExcludeChecks parameter
@@ -408,6 +582,11 @@ func (d *Deployment) IsFipsEnabled() bool {
 	return d.Fips != nil && d.Fips.Enabled
 }
 
+// IsBIOSEnabled returns true if legacy BIOS boot is enabled for the deployment, otherwise false.
+func (d *Deployment) IsBIOSEnabled() bool {
+	return d.Firmware != nil && d.Firmware.BIOS
+}
+
 // WriteDeploymentFile serialized the Deployment variable into a file. As part of the
 // serialization it omits runtime information such as device paths, overlay and config
 // script paths.
@@ -444,6 +623,8 @@ func (d Deployment) WriteDeploymentFile(s *sys.System, root string) error {
 	dep.OverlayTree = nil
 	dep.CfgScript = ""
 	dep.Installer = LiveInstaller{}
+	// omit the Secure Boot keys, they are not expected on the installed system
+	dep.SecureBoot = dep.SecureBoot.WithoutKeys()
 
 	data, err = yaml.Marshal(dep)
 	if err != nil {
@@ -574,6 +755,17 @@ func WithRecoveryPartition(size MiB) Opt {
 	return WithPartitions(1, part)
 }
 
+// WithBIOSPartition enables legacy BIOS boot, the 'bios' partition is inserted to the system
+// disk right after the EFI partition once the deployment is sanitized.
+func WithBIOSPartition() Opt {
+	return func(d *Deployment) {
+		if d.Firmware == nil {
+			d.Firmware = &FirmwareConfig{}
+		}
+		d.Firmware.BIOS = true
+	}
+}
+
 // checkSystemPart verifies the system partition is properly defined and forces mandatory values
 func checkSystemPart(s *sys.System, d *Deployment) error {
 	var found bool
@@ -641,6 +833,57 @@ func checkEFIPart(s *sys.System, d *Deployment) error {
 	return nil
 }
 
+// checkBIOSPart verifies the BIOS boot partition is properly defined if any and inserts it
+// to the system disk if legacy BIOS boot is enabled
+func checkBIOSPart(_ *sys.System, d *Deployment) error {
+	var bios *Partition
+	for _, disk := range d.Disks {
+		for _, part := range disk.Partitions {
+			if part.Role != BIOS {
+				continue
+			}
+			if bios != nil {
+				return fmt.Errorf("multiple 'bios' partitions defined, there must be only one")
+			}
+			if disk != d.GetSystemDisk() {
+				return fmt.Errorf("the 'bios' partition must be in the system disk")
+			}
+			if part.MountPoint != "" || len(part.RWVolumes) > 0 || part.Encryption != nil {
+				return fmt.Errorf("the 'bios' partition can't be mounted, include volumes nor be encrypted")
+			}
+			if part.Label == "" {
+				part.Label = BiosLabel
+			}
+			if part.Size == AllAvailableSize {
+				part.Size = BiosSize
+			}
+			part.FileSystem = FileSystem(0)
+			bios = part
+		}
+	}
+
+	if bios == nil && !d.IsBIOSEnabled() {
+		return nil
+	}
+
+	if d.BootConfig != nil && d.BootConfig.Bootloader == "systemd-boot" {
+		return fmt.Errorf("legacy BIOS boot requires the grub bootloader")
+	}
+
+	WithBIOSPartition()(d)
+	if bios != nil {
+		return nil
+	}
+
+	disk := d.GetSystemDisk()
+	if disk == nil {
+		return fmt.Errorf("no system disk found to add the 'bios' partition")
+	}
+	pos := slices.IndexFunc(disk.Partitions, func(p *Partition) bool { return p.Role == EFI }) + 1
+	disk.Partitions = slices.Insert(disk.Partitions, pos, &Partition{Label: BiosLabel, Role: BIOS, Size: BiosSize})
+	return nil
+}
+
 // checkRecoveryPart verifies Recovery partition is properly defined if any
 func checkRecoveryPart(s *sys.System, d *Deployment) error {
 	var found bool
@@ -656,7 +899,7 @@ func checkRecoveryPart(s *sys.System, d *Deployment) error {
 					s.Logger().Info("cleared read-write volumes for recovery")
 					part.RWVolumes = []RWVolume{}
 				}
-				if part.FileSystem.String() == Unknown {
+				if part.FileSystem.String() == Unknown && part.Verity == nil {
 					part.FileSystem = Ext2
 				}
 				if part.Label == "" {
@@ -688,7 +931,7 @@ func checkAllAvailableSize(_ *sys.System, d *Deployment) error {
 func checkPartitionsFS(_ *sys.System, d *Deployment) error {
 	for _, disk := range d.Disks {
 		for _, part := range disk.Partitions {
-			if part.FileSystem.String() == Unknown {
+			if part.FileSystem.String() == Unknown && part.Role != BIOS && part.Role != Swap {
 				part.FileSystem = Btrfs
 			}
 		}
@@ -696,6 +939,28 @@ func checkPartitionsFS(_ *sys.System, d *Deployment) error {
 	return nil
 }
 
+// checkGrowPart ensures only the last partition of the system disk is set to grow and
+// its filesystem can be grown online once mounted
+func checkGrowPart(_ *sys.System, d *Deployment) error {
+	for _, disk := range d.Disks {
+		for i, part := range disk.Partitions {
+			if !part.Grow {
+				continue
+			}
+			if disk != d.GetSystemDisk() || i != len(disk.Partitions)-1 {
+				return fmt.Errorf("only the last partition of the system disk can grow")
+			}
+			if part.Verity != nil || !slices.Contains([]FileSystem{Btrfs, Ext4, XFS}, part.FileSystem) {
+				return fmt.Errorf("partition '%s' can't grow, it requires a btrfs, ext4 or xfs filesystem", part.Label)
+			}
+			if part.MountPoint == "" {
+				return fmt.Errorf("partition '%s' can't grow without a mount point", part.Label)
+			}
+		}
+	}
+	return nil
+}
+
 // checkRWVolumes ensures all rw volumes are at a unique absolute path, not
 // nested and defined on a btrfs partition
 func checkRWVolumes(_ *sys.System, d *Deployment) error {
@@ -709,6 +974,9 @@ func checkRWVolumes(_ *sys.System, d *Deployment) error {
 				if !filepath.IsAbs(rwVol.Path) {
 					return fmt.Errorf("rw volume paths must be absolute")
 				}
+				if err := checkMergePolicies(rwVol); err != nil {
+					return err
+				}
 				if _, ok := pathMap[rwVol.Path]; !ok {
 					pathMap[rwVol.Path] = true
 					continue
@@ -731,6 +999,71 @@ func checkRWVolumes(_ *sys.System, d *Deployment) error {
 	return nil
 }
 
+// checkMergePolicies verifies merge policies are only set to snapshotted volumes and
+// path merge policies refer to valid patterns within the volume
+func checkMergePolicies(rwVol RWVolume) error {
+	if rwVol.MergePolicy == MergePolicy(0) && len(rwVol.PathMergePolicies) == 0 {
+		return nil
+	}
+	if !rwVol.Snapshotted {
+		return fmt.Errorf("merge policies are only supported for snapshotted rw volumes, '%s' is not snapshotted", rwVol.Path)
+	}
+	for _, pmp := range rwVol.PathMergePolicies {
+		if pmp.Policy.String() == Unknown {
+			return fmt.Errorf("missing merge policy for path '%s'", pmp.Path)
+		}
+		if _, err := filepath.Match(pmp.Path, ""); err != nil {
+			return fmt.Errorf("invalid merge policy path '%s': %w", pmp.Path, err)
+		}
+		if !strings.HasPrefix(pmp.Path, strings.TrimSuffix(rwVol.Path, "/")+"/") {
+			return fmt.Errorf("merge policy path '%s' is not within rw volume '%s'", pmp.Path, rwVol.Path)
+		}
+	}
+	return nil
+}
+
+// checkBootConfig verifies the boot counting setup
+func checkBootConfig(_ *sys.System, d *Deployment) error {
+	if d.BootConfig != nil && d.BootConfig.BootAttempts < 0 {
+		return fmt.Errorf("invalid number of boot attempts: %d", d.BootConfig.BootAttempts)
+	}
+	if d.BootConfig != nil && d.BootConfig.BootAttempts > 0 && d.BootConfig.Bootloader == "systemd-boot" {
+		return fmt.Errorf("boot counting is not supported by the systemd-boot bootloader")
+	}
+	return nil
+}
+
+// checkHealthChecks verifies health checks are properly defined and sets default timeouts
+func checkHealthChecks(_ *sys.System, d *Deployment) error {
+	for i := range d.HealthChecks {
+		check := &d.HealthChecks[i]
+		if check.Command == "" {
+			return fmt.Errorf("no command defined for health check %d: '%s'", i, check.Name)
+		}
+		if check.Timeout < 0 {
+			return fmt.Errorf("invalid timeout for health check '%s': %s", check.Name, check.Timeout)
+		}
+		if check.Timeout == 0 {
+			check.Timeout = DefaultHealthCheckTimeout
+		}
+	}
+	return nil
+}
+
+// checkSnapshotter verifies the snapshots retention setup
+func checkSnapshotter(_ *sys.System, d *Deployment) error {
+	if d.Snapshotter == nil {
+		return nil
+	}
+	if d.Snapshotter.MaxSnapshots < 0 {
+		return fmt.Errorf("invalid maximum number of snapshots: %d", d.Snapshotter.MaxSnapshots)
+	}
+	if d.Snapshotter.MaxAge < 0 {
+		return fmt.Errorf("invalid maximum age of snapshots: %s", d.Snapshotter.MaxAge)
+	}
+	return nil
+}
+
 // CheckSourceOS ensures the deployment includes an OS image
 func CheckSourceOS(_ *sys.System, d *Deployment) error {
 	if d.SourceOS == nil || d.SourceOS.IsEmpty() {
@@ -19,7 +19,9 @@ package deployment_test
 
 import (
 	"bytes"
+	"slices"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -75,6 +77,294 @@ var _ = Describe("Deployment", Label("deployment"), func() {
 			d.Disks[0].Device = "/dev/nonexisting"
 			Expect(d.Sanitize(s)).NotTo(Succeed())
 		})
+		It("fails if a negative number of boot attempts is set", func() {
+			d := deployment.DefaultDeployment()
+			d.SourceOS = deployment.NewDirSrc("/some/dir")
+			d.BootConfig.BootAttempts = -1
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("invalid number of boot attempts: -1"))
+		})
+		It("fails if boot counting is set for systemd-boot", func() {
+			d := deployment.DefaultDeployment()
+			d.SourceOS = deployment.NewDirSrc("/some/dir")
+			d.BootConfig.Bootloader = "systemd-boot"
+			d.BootConfig.BootAttempts = 3
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("boot counting is not supported by the systemd-boot bootloader"))
+		})
+		It("fails on inconsistent secure boot setup", func() {
+			d := deployment.DefaultDeployment()
+			d.SourceOS = deployment.NewDirSrc("/some/dir")
+			d.BootConfig.Bootloader = "grub"
+			d.SecureBoot = &deployment.SecureBoot{Key: "/etc/db.key"}
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("secure boot signing requires both a key and a certificate"))
+
+			d.SecureBoot.Cert = "db.crt"
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("secure boot path 'db.crt' is not absolute"))
+
+			d.SecureBoot.Cert = "/etc/db.crt"
+			Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+
+			d.BootConfig.Bootloader = "none"
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("secure boot signing requires a bootloader"))
+		})
+		It("fails if a negative snapshots retention is set", func() {
+			d := deployment.DefaultDeployment()
+			d.SourceOS = deployment.NewDirSrc("/some/dir")
+			d.Snapshotter.MaxSnapshots = -1
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("invalid maximum number of snapshots: -1"))
+
+			d.Snapshotter.MaxSnapshots = 4
+			d.Snapshotter.MaxAge = -time.Hour
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("invalid maximum age of snapshots: -1h0m0s"))
+		})
+		It("sets default timeouts of health checks", func() {
+			d := deployment.DefaultDeployment()
+			d.SourceOS = deployment.NewDirSrc("/some/dir")
+			d.HealthChecks = []deployment.HealthCheck{
+				{Name: "rke2", Command: "kubectl get nodes", Timeout: time.Minute},
+				{Name: "service", Command: "curl -f http://localhost"},
+			}
+			Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+			Expect(d.HealthChecks[0].Timeout).To(Equal(time.Minute))
+			Expect(d.HealthChecks[1].Timeout).To(Equal(deployment.DefaultHealthCheckTimeout))
+
+			d.HealthChecks = []deployment.HealthCheck{{Name: "empty"}}
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("no command defined for health check 0: 'empty'"))
+		})
+		It("validates merge policies of rw volumes", func() {
+			d := deployment.DefaultDeployment()
+			d.SourceOS = deployment.NewDirSrc("/some/dir")
+			rwVols := d.GetSystemPartition().RWVolumes
+			rwVols[2].MergePolicy = deployment.PreferImage
+			rwVols[2].PathMergePolicies = []deployment.PathMergePolicy{
+				{Path: "/etc/ssh", Policy: deployment.PreferLocal},
+				{Path: "/etc/*.conf", Policy: deployment.FailOnConflict},
+			}
+			Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+			Expect(rwVols[2].GetMergePolicy("/etc/ssh/sshd_config")).To(Equal(deployment.PreferLocal))
+			Expect(rwVols[2].GetMergePolicy("/etc/sshd")).To(Equal(deployment.PreferImage))
+			Expect(rwVols[2].GetMergePolicy("/etc/resolv.conf")).To(Equal(deployment.FailOnConflict))
+			Expect(rwVols[4].GetMergePolicy("/srv/file")).To(Equal(deployment.PreferLocal))
+
+			rwVols[2].PathMergePolicies = []deployment.PathMergePolicy{{Path: "/var/lib", Policy: deployment.PreferLocal}}
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("merge policy path '/var/lib' is not within rw volume '/etc'"))
+
+			rwVols[2].PathMergePolicies = []deployment.PathMergePolicy{{Path: "/etc/hosts"}}
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("missing merge policy for path '/etc/hosts'"))
+
+			rwVols[2].PathMergePolicies = []deployment.PathMergePolicy{{Path: "/etc/[a-", Policy: deployment.PreferLocal}}
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError(ContainSubstring("invalid merge policy path '/etc/[a-'")))
+
+			rwVols[2].PathMergePolicies = nil
+			rwVols[0].MergePolicy = deployment.PreferImage
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("merge policies are only supported for snapshotted rw volumes, '/var' is not snapshotted"))
+		})
+		It("validates encrypted partitions", func() {
+			d := deployment.DefaultDeployment()
+			d.SourceOS = deployment.NewDirSrc("/some/dir")
+			sysPart := d.GetSystemPartition()
+			sysPart.Encryption = &deployment.Encryption{
+				KeyFile: "/etc/keyfile",
+				TPM2:    &deployment.TPM2Binding{PCRs: []int{7, 11}},
+			}
+			Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+			Expect(d.BaseKernelCmdline()).To(Equal("root=LABEL=SYSTEM"))
+
+			sysPart.Encryption.UUID = "1234"
+			Expect(d.BaseKernelCmdline()).To(Equal(
+				"root=LABEL=SYSTEM rd.luks.uuid=1234 rd.luks.options=1234=tpm2-device=auto",
+			))
+			Expect(sysPart.Encryption.MappedDevice()).To(Equal("/dev/mapper/luks-1234"))
+			Expect(sysPart.Encryption.TPM2.PCRList()).To(Equal("7+11"))
+
+			sysPart.Encryption.TPM2.PCRs = []int{24}
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("invalid TPM2 PCR 24 for partition 'SYSTEM'"))
+
+			sysPart.Encryption.TPM2 = nil
+			sysPart.Encryption.KeyFile = "keyfile"
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("key file of partition 'SYSTEM' requires an absolute path"))
+
+			sysPart.Encryption.KeyFile = ""
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("missing key file to encrypt partition 'SYSTEM'"))
+
+			sysPart.Encryption = nil
+			d.GetEfiPartition().Encryption = &deployment.Encryption{KeyFile: "/etc/keyfile"}
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("encryption is not supported for efi partitions"))
+		})
+		It("adds verity partitions to the system disk", func() {
+			d := deployment.DefaultDeployment()
+			d.SourceOS = deployment.NewDirSrc("/some/dir")
+			d.Verity = &deployment.VerityConfig{Size: 2048}
+			Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+			Expect(d.Verity.HashSize).To(Equal(deployment.MiB(32)))
+
+			var labels []string
+			for _, part := range d.Disks[0].Partitions {
+				labels = append(labels, part.Label)
+			}
+			Expect(labels).To(Equal([]string{"EFI", "USR_A", "USR_A_VERITY", "USR_B", "USR_B_VERITY", "SYSTEM"}))
+			Expect(d.Disks[0].Partitions[1].FileSystem.String()).To(Equal(deployment.Unknown))
+
+			// Sanitizing again keeps the existing verity partitions
+			Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+			Expect(d.Disks[0].Partitions).To(HaveLen(6))
+
+			Expect(d.Verity.NextSlot()).To(Equal("a"))
+			d.Verity.Slot = "a"
+			Expect(d.Verity.NextSlot()).To(Equal("b"))
+
+			data, hash := d.GetVerityPartitions("a")
+			data.UUID, hash.UUID = "data-uuid", "hash-uuid"
+			Expect(d.VerityKernelCmdline("1234")).To(Equal(
+				"usrhash=1234 systemd.verity_usr_data=PARTUUID=data-uuid systemd.verity_usr_hash=PARTUUID=hash-uuid " +
+					"mount.usr=/dev/mapper/usr mount.usrfstype=squashfs mount.usrflags=ro",
+			))
+
+			d.Disks[0].Partitions = slices.Delete(d.Disks[0].Partitions, 2, 3)
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("incomplete verity partitions for slot 'a'"))
+
+			d.Verity = &deployment.VerityConfig{}
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("missing size of verity data partitions"))
+		})
+		It("adds a bios partition to the system disk", func() {
+			d := deployment.New(deployment.WithBIOSPartition())
+			d.SourceOS = deployment.NewDirSrc("/some/dir")
+			d.BootConfig.Bootloader = "grub"
+			Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+			Expect(d.IsBIOSEnabled()).To(BeTrue())
+
+			var labels []string
+			for _, part := range d.Disks[0].Partitions {
+				labels = append(labels, part.Label)
+			}
+			Expect(labels).To(Equal([]string{"EFI", "BIOS", "SYSTEM"}))
+			Expect(d.Disks[0].Partitions[1].Size).To(Equal(deployment.BiosSize))
+			Expect(d.Disks[0].Partitions[1].FileSystem.String()).To(Equal(deployment.Unknown))
+
+			// Sanitizing again keeps the existing bios partition
+			Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+			Expect(d.Disks[0].Partitions).To(HaveLen(3))
+
+			d.Disks[0].Partitions[1].MountPoint = "/bios"
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("the 'bios' partition can't be mounted, include volumes nor be encrypted"))
+
+			d.Disks[0].Partitions[1].MountPoint = ""
+			d.BootConfig.Bootloader = "systemd-boot"
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("legacy BIOS boot requires the grub bootloader"))
+		})
+		It("enables legacy BIOS boot if a bios partition is defined", func() {
+			d := deployment.New(deployment.WithPartitions(1, &deployment.Partition{Role: deployment.BIOS}))
+			d.SourceOS = deployment.NewDirSrc("/some/dir")
+			Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+			Expect(d.IsBIOSEnabled()).To(BeTrue())
+			Expect(d.Disks[0].Partitions[1].Label).To(Equal(deployment.BiosLabel))
+
+			d.Disks[0].Partitions = append(d.Disks[0].Partitions, &deployment.Partition{Role: deployment.BIOS})
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("multiple 'bios' partitions defined, there must be only one"))
+		})
+		It("sets swap partitions and validates the swap file", func() {
+			d := deployment.New(deployment.WithPartitions(1, &deployment.Partition{Role: deployment.Swap, Size: 2048}))
+			d.SourceOS = deployment.NewDirSrc("/some/dir")
+			Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+			Expect(d.Disks[0].Partitions[1].Label).To(Equal(deployment.SwapLabel))
+			Expect(d.Disks[0].Partitions[1].FileSystem).To(Equal(deployment.SwapFS))
+
+			d.Disks[0].Partitions[1].MountPoint = "/swap"
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("'swap' partitions can't be mounted nor include volumes"))
+
+			d.Disks[0].Partitions[1].MountPoint = ""
+			d.Disks[0].Partitions[2].FileSystem = deployment.SwapFS
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("the swap filesystem is only supported by 'swap' partitions"))
+			d.Disks[0].Partitions[2].FileSystem = deployment.Btrfs
+
+			d.Swap = &deployment.SwapConfig{File: &deployment.SwapFile{Path: "/var/swap/swapfile", Size: 1024}}
+			Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+			Expect(d.GetSwapFile().GetVolume(d.GetSystemPartition()).Path).To(Equal("/var"))
+
+			// copy on write is only disabled for the directory of the swap file
+			d.GetSwapFile().GetVolume(d.GetSystemPartition()).NoCopyOnWrite = false
+			Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+
+			d.Swap.File.Path = "/var/swapfile"
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("swap file '/var/swapfile' requires a dedicated directory within the '/var' RW volume"))
+			d.Swap.File.Path = "/var/swap/swapfile"
+
+			d.Swap.File.Size = 0
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("missing size of swap file '/var/swap/swapfile'"))
+
+			d.Swap.File = &deployment.SwapFile{Path: "swapfile", Size: 1024}
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("swap file path 'swapfile' is not absolute"))
+
+			d.Swap.File.Path = "/etc/swapfile"
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("swap file '/etc/swapfile' requires a non snapshotted btrfs RW volume"))
+
+			d.Swap.File.Path = "/swapfile"
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("no RW volume found for swap file '/swapfile'"))
+		})
+		It("only allows the last partition of the system disk to grow", func() {
+			d := deployment.DefaultDeployment()
+			d.SourceOS = deployment.NewDirSrc("/some/dir")
+			d.GetSystemPartition().Grow = true
+			Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+
+			d.GetSystemPartition().Grow = false
+			d.GetEfiPartition().Grow = true
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("only the last partition of the system disk can grow"))
+
+			d = deployment.New(deployment.WithPartitions(2, &deployment.Partition{Role: deployment.Swap, Size: 1024, Grow: true}))
+			d.GetSystemPartition().Size = 4096
+			d.SourceOS = deployment.NewDirSrc("/some/dir")
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("partition 'SWAP' can't grow, it requires a btrfs, ext4 or xfs filesystem"))
+
+			d = deployment.New(deployment.WithPartitions(2, &deployment.Partition{Label: "DATA", Role: deployment.Data, Grow: true}))
+			d.GetSystemPartition().Size = 4096
+			d.SourceOS = deployment.NewDirSrc("/some/dir")
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("partition 'DATA' can't grow without a mount point"))
+		})
+		It("validates the live image compression", func() {
+			d := deployment.DefaultDeployment()
+			d.SourceOS = deployment.NewDirSrc("/some/dir")
+			deployment.WithRecoveryPartition(0)(d)
+			d.Installer.Image.Compression = "lz4hc"
+			err = d.Sanitize(s, deployment.CheckDiskDevice)
+			Expect(err).To(MatchError("compression 'lz4hc' is not supported by squashfs images"))
+
+			d.Installer.Image.Format = deployment.EroFS
+			Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+			Expect(d.RecoveryKernelCmdline()).To(Equal(
+				"root=live:LABEL=RECOVERY rd.live.overlay.overlayfs=1 rd.live.squashimg=erofs.img",
+			))
+		})
 		It("creates a default deployment with a configuration partition and without a device assigned", func() {
 			d := deployment.New(deployment.WithConfigPartition(127))
 			d.SourceOS = deployment.NewDirSrc("/some/dir")
@@ -182,6 +472,20 @@ var _ = Describe("Deployment", Label("deployment"), func() {
 			Expect(err).To(Succeed())
 			Expect(d.Device).To(Equal("/dev/sometarget"))
 		})
+		It("omits the secure boot keys in the deployment file", func() {
+			d := deployment.DefaultDeployment()
+			d.SourceOS = deployment.NewDirSrc("/some/image")
+			d.BootConfig.Bootloader = "grub"
+			d.SecureBoot = &deployment.SecureBoot{Key: "/etc/db.key", Cert: "/etc/db.crt", EnrollDir: "/etc/enroll"}
+			Expect(d.WriteDeploymentFile(s, "/some/dir")).To(Succeed())
+			Expect(d.SecureBoot.Key).To(Equal("/etc/db.key"))
+
+			rD, err := deployment.Parse(s, "/some/dir")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rD.SecureBoot).To(Equal(&deployment.SecureBoot{}))
+			Expect(rD.SecureBoot.HasKeys()).To(BeFalse())
+			Expect(rD.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+		})
 		It("overwrites any pre-existing deployment file", func() {
 			d := deployment.DefaultDeployment()
 			Expect(d.WriteDeploymentFile(s, "/some/dir")).To(Succeed())
@@ -243,7 +547,7 @@ var _ = Describe("Deployment", Label("deployment"), func() {
 
 	Describe("Deployment utilities", Label("yaml"), func() {
 		It("Un/marshals FileSystem", func() {
-			filesystems := []string{"btrfs", "xfs", "ext2", "ext4", "vfat"}
+			filesystems := []string{"btrfs", "xfs", "ext2", "ext4", "vfat", "swap"}
 			var t deployment.FileSystem
 
 			for _, fs := range filesystems {
@@ -258,8 +562,40 @@ var _ = Describe("Deployment", Label("deployment"), func() {
 			err := yaml.Unmarshal([]byte("not an fs"), &t)
 			Expect(err).To(HaveOccurred())
 		})
+		It("Un/marshals MergePolicy", func() {
+			policies := []string{"prefer-local", "prefer-image", "fail-on-conflict"}
+			var m deployment.MergePolicy
+
+			for _, policy := range policies {
+				Expect(yaml.Unmarshal([]byte(policy), &m)).To(Succeed())
+				Expect(m.String()).To(Equal(policy))
+
+				actual, err := yaml.Marshal(m)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(actual)).To(ContainSubstring(policy))
+			}
+
+			err := yaml.Unmarshal([]byte("not a policy"), &m)
+			Expect(err).To(HaveOccurred())
+		})
+		It("Un/marshals ImageFormat", func() {
+			formats := []string{"squashfs", "erofs"}
+			var f deployment.ImageFormat
+
+			for _, format := range formats {
+				Expect(yaml.Unmarshal([]byte(format), &f)).To(Succeed())
+				Expect(f.String()).To(Equal(format))
+
+				actual, err := yaml.Marshal(f)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(actual)).To(ContainSubstring(format))
+			}
+
+			err := yaml.Unmarshal([]byte("not a format"), &f)
+			Expect(err).To(HaveOccurred())
+		})
 		It("Un/marshals PartRole", func() {
-			roles := []string{"efi", "system", "recovery", "data"}
+			roles := []string{"efi", "system", "recovery", "data", "bios", "swap"}
 			var r deployment.PartRole
 
 			for _, role := range roles {
@@ -0,0 +1,202 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/suse/elemental/v3/pkg/block"
+	"github.com/suse/elemental/v3/pkg/sys"
+)
+
+const (
+	PickSmallest = "smallest"
+	PickLargest  = "largest"
+
+	diskByIDPath   = "/dev/disk/by-id"
+	diskByPathPath = "/dev/disk/by-path"
+)
+
+// bootMediaMountPoints are the mount points of the media the running system booted from
+var bootMediaMountPoints = []string{"/", "/run/initramfs/live"}
+
+// DiskSelector describes the disk to install to when the disk device is unknown beforehand. All the
+// defined rules must match. Disks holding the boot media are never selected.
+type DiskSelector struct {
+	// Pick selects the smallest or the largest matching disk, the first matching disk is selected if unset
+	Pick string `yaml:"pick,omitempty"`
+	// MinSize is the minimum disk size in MiB
+	MinSize MiB `yaml:"minSize,omitempty"`
+	// Rotational selects only rotational or only non rotational disks if set
+	Rotational *bool `yaml:"rotational,omitempty"`
+	// Transport is the transport type reported by lsblk, such as nvme, sata or usb
+	Transport string `yaml:"transport,omitempty"`
+	// ByID is a shell pattern matching any of the disk links under /dev/disk/by-id
+	ByID string `yaml:"byId,omitempty"`
+	// ByPath is a shell pattern matching any of the disk links under /dev/disk/by-path
+	ByPath string `yaml:"byPath,omitempty"`
+	WWN    string `yaml:"wwn,omitempty"`
+	Serial string `yaml:"serial,omitempty"`
+}
+
+// ResolveDiskSelectors sets the device of the disks with a selector and no device defined. Each
+// selector picks a different disk and disks already assigned to other disks are not considered.
+func (d *Deployment) ResolveDiskSelectors(s *sys.System, b block.Device) error {
+	if err := checkDiskSelectors(s, d); err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(d.Disks, func(disk *Disk) bool { return disk.Device == "" && disk.Selector != nil }) {
+		return nil
+	}
+
+	disks, err := b.GetAllDisks()
+	if err != nil {
+		return fmt.Errorf("listing disks: %w", err)
+	}
+
+	parts, err := b.GetAllPartitions()
+	if err != nil {
+		return fmt.Errorf("listing partitions: %w", err)
+	}
+
+	var used []string
+	for _, disk := range d.Disks {
+		if disk.Device != "" {
+			used = append(used, disk.Device)
+		}
+	}
+
+	for i, disk := range d.Disks {
+		if disk.Device != "" || disk.Selector == nil {
+			continue
+		}
+
+		var candidates block.DiskList
+		for _, bDisk := range disks {
+			if slices.Contains(used, bDisk.Path) || isBootMedia(bDisk, parts) {
+				continue
+			}
+			if disk.Selector.matches(s, bDisk) {
+				candidates = append(candidates, bDisk)
+			}
+		}
+		if len(candidates) == 0 {
+			return fmt.Errorf("no disk matches the selector of disk %d", i)
+		}
+
+		selected := candidates[0]
+		switch disk.Selector.Pick {
+		case PickSmallest:
+			selected = slices.MinFunc(candidates, func(a, b *block.Disk) int { return int(a.Size) - int(b.Size) })
+		case PickLargest:
+			selected = slices.MaxFunc(candidates, func(a, b *block.Disk) int { return int(a.Size) - int(b.Size) })
+		}
+
+		s.Logger().Info("Selected disk '%s' for disk %d", selected.Path, i)
+		disk.Device = selected.Path
+		used = append(used, selected.Path)
+	}
+	return nil
+}
+
+// matches returns true if the given disk satisfies all the selector rules
+func (ds DiskSelector) matches(s *sys.System, disk *block.Disk) bool {
+	switch {
+	case ds.MinSize > 0 && MiB(disk.Size) < ds.MinSize:
+		return false
+	case ds.Rotational != nil && *ds.Rotational != disk.Rotational:
+		return false
+	case ds.Transport != "" && !strings.EqualFold(ds.Transport, disk.Transport):
+		return false
+	case ds.WWN != "" && !strings.EqualFold(ds.WWN, disk.WWN):
+		return false
+	case ds.Serial != "" && ds.Serial != disk.Serial:
+		return false
+	case ds.ByID != "" && !matchDiskLink(s, diskByIDPath, ds.ByID, disk.Path):
+		return false
+	case ds.ByPath != "" && !matchDiskLink(s, diskByPathPath, ds.ByPath, disk.Path):
+		return false
+	}
+	return true
+}
+
+// matchDiskLink returns true if any link within the given directory matching the given
+// pattern points to the given device
+func matchDiskLink(s *sys.System, dir, pattern, device string) bool {
+	entries, err := s.FS().ReadDir(dir)
+	if err != nil {
+		s.Logger().Debug("Could not read disk links at '%s': %v", dir, err)
+		return false
+	}
+
+	for _, entry := range entries {
+		if ok, _ := filepath.Match(pattern, entry.Name()); !ok {
+			continue
+		}
+		target, err := s.FS().Readlink(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(dir, target)
+		}
+		if filepath.Clean(target) == device {
+			return true
+		}
+	}
+	return false
+}
+
+// isBootMedia returns true if the given disk or any of its partitions is mounted as the boot media
+func isBootMedia(disk *block.Disk, parts block.PartitionList) bool {
+	mounted := func(mountPoints []string) bool {
+		return slices.ContainsFunc(mountPoints, func(m string) bool { return slices.Contains(bootMediaMountPoints, m) })
+	}
+
+	if mounted(disk.MountPoints) {
+		return true
+	}
+	for _, part := range parts {
+		if part.Disk == disk.Path && mounted(part.MountPoints) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDiskSelectors verifies disk selectors are properly defined
+func checkDiskSelectors(_ *sys.System, d *Deployment) error {
+	for i, disk := range d.Disks {
+		sel := disk.Selector
+		if sel == nil {
+			continue
+		}
+		if sel.Pick != "" && sel.Pick != PickSmallest && sel.Pick != PickLargest {
+			return fmt.Errorf("invalid disk selector pick for disk %d: '%s'", i, sel.Pick)
+		}
+		for _, pattern := range []string{sel.ByID, sel.ByPath} {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid disk selector pattern for disk %d '%s': %w", i, pattern, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/pkg/block"
+	blockmock "github.com/suse/elemental/v3/pkg/block/mock"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+var _ = Describe("Disk selectors", Label("deployment", "disk"), func() {
+	var s *sys.System
+	var tfs vfs.FS
+	var cleanup func()
+	var err error
+	var b *blockmock.Device
+	var d *deployment.Deployment
+
+	BeforeEach(func() {
+		tfs, cleanup, err = sysmock.TestFS(nil)
+		Expect(err).NotTo(HaveOccurred())
+		s, err = sys.NewSystem(sys.WithFS(tfs), sys.WithLogger(log.New(log.WithDiscardAll())))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(vfs.MkdirAll(tfs, "/dev/disk/by-id", vfs.DirPerm)).To(Succeed())
+		Expect(vfs.MkdirAll(tfs, "/dev/disk/by-path", vfs.DirPerm)).To(Succeed())
+		Expect(tfs.Symlink("../../nvme0n1", "/dev/disk/by-id/nvme-Samsung_SSD_980_S4EWNX0")).To(Succeed())
+		Expect(tfs.Symlink("../../sdb", "/dev/disk/by-path/pci-0000:00:17.0-ata-2")).To(Succeed())
+
+		b = blockmock.NewBlockDevice(
+			&block.Partition{Path: "/dev/sdc1", Disk: "/dev/sdc", MountPoints: []string{"/run/initramfs/live"}},
+		)
+		b.SetDisks(block.DiskList{
+			{Path: "/dev/sda", Size: 512000, Rotational: true, Transport: "sata", Serial: "WD-1"},
+			{Path: "/dev/sdb", Size: 256000, Transport: "sata", WWN: "0x5002538e4"},
+			{Path: "/dev/nvme0n1", Size: 1024000, Transport: "nvme", Serial: "S4EWNX0"},
+			{Path: "/dev/sdc", Size: 16000, Transport: "usb"},
+		})
+
+		d = deployment.DefaultDeployment()
+	})
+	AfterEach(func() {
+		cleanup()
+	})
+	It("picks the smallest or the largest matching disk", func() {
+		d.Disks[0].Selector = &deployment.DiskSelector{Pick: deployment.PickSmallest}
+		Expect(d.ResolveDiskSelectors(s, b)).To(Succeed())
+		Expect(d.Disks[0].Device).To(Equal("/dev/sdb"))
+
+		d.Disks[0].Device = ""
+		d.Disks[0].Selector = &deployment.DiskSelector{Pick: deployment.PickLargest}
+		Expect(d.ResolveDiskSelectors(s, b)).To(Succeed())
+		Expect(d.Disks[0].Device).To(Equal("/dev/nvme0n1"))
+	})
+	It("filters disks by size, rotational and transport", func() {
+		rotational := false
+		d.Disks[0].Selector = &deployment.DiskSelector{MinSize: 100000, Rotational: &rotational, Transport: "SATA"}
+		Expect(d.ResolveDiskSelectors(s, b)).To(Succeed())
+		Expect(d.Disks[0].Device).To(Equal("/dev/sdb"))
+	})
+	It("filters disks by identifiers and links", func() {
+		d.Disks[0].Selector = &deployment.DiskSelector{ByID: "nvme-Samsung*"}
+		Expect(d.ResolveDiskSelectors(s, b)).To(Succeed())
+		Expect(d.Disks[0].Device).To(Equal("/dev/nvme0n1"))
+
+		d.Disks[0].Device = ""
+		d.Disks[0].Selector = &deployment.DiskSelector{ByPath: "pci-*-ata-2"}
+		Expect(d.ResolveDiskSelectors(s, b)).To(Succeed())
+		Expect(d.Disks[0].Device).To(Equal("/dev/sdb"))
+
+		d.Disks[0].Device = ""
+		d.Disks[0].Selector = &deployment.DiskSelector{WWN: "0x5002538E4"}
+		Expect(d.ResolveDiskSelectors(s, b)).To(Succeed())
+		Expect(d.Disks[0].Device).To(Equal("/dev/sdb"))
+
+		d.Disks[0].Device = ""
+		d.Disks[0].Selector = &deployment.DiskSelector{Serial: "WD-1"}
+		Expect(d.ResolveDiskSelectors(s, b)).To(Succeed())
+		Expect(d.Disks[0].Device).To(Equal("/dev/sda"))
+	})
+	It("never selects the boot media or disks already in use", func() {
+		d.Disks = append(d.Disks, &deployment.Disk{Device: "/dev/sdb"})
+		d.Disks[0].Selector = &deployment.DiskSelector{Pick: deployment.PickSmallest}
+		Expect(d.ResolveDiskSelectors(s, b)).To(Succeed())
+		Expect(d.Disks[0].Device).To(Equal("/dev/sda"))
+
+		d.Disks[0].Device = ""
+		d.Disks[0].Selector = &deployment.DiskSelector{Transport: "usb"}
+		err = d.ResolveDiskSelectors(s, b)
+		Expect(err).To(MatchError("no disk matches the selector of disk 0"))
+	})
+	It("keeps defined devices", func() {
+		d.Disks[0].Device = "/dev/sda"
+		d.Disks[0].Selector = &deployment.DiskSelector{Transport: "nvme"}
+		b.SetError(fmt.Errorf("lsblk failed"))
+		Expect(d.ResolveDiskSelectors(s, b)).To(Succeed())
+		Expect(d.Disks[0].Device).To(Equal("/dev/sda"))
+	})
+	It("fails on invalid selectors", func() {
+		d.Disks[0].Selector = &deployment.DiskSelector{Pick: "fastest"}
+		err = d.ResolveDiskSelectors(s, b)
+		Expect(err).To(MatchError("invalid disk selector pick for disk 0: 'fastest'"))
+
+		d.Disks[0].Selector = &deployment.DiskSelector{ByID: "[nvme"}
+		err = d.ResolveDiskSelectors(s, b)
+		Expect(err).To(MatchError(ContainSubstring("invalid disk selector pattern for disk 0 '[nvme'")))
+	})
+	It("fails to list disks", func() {
+		d.Disks[0].Selector = &deployment.DiskSelector{Pick: deployment.PickLargest}
+		b.SetError(fmt.Errorf("lsblk failed"))
+		err = d.ResolveDiskSelectors(s, b)
+		Expect(err).To(MatchError("listing disks: lsblk failed"))
+	})
+})
@@ -0,0 +1,143 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/suse/elemental/v3/pkg/sys"
+)
+
+const (
+	DefaultTPM2Device = "auto"
+
+	maxTPM2PCR = 23
+)
+
+// Encryption describes the LUKS2 encryption of a partition. The key file is used to format the
+// partition and remains enrolled as a passphrase keyslot, a recovery key and a TPM2 bound keyslot
+// can be enrolled in addition.
+type Encryption struct {
+	// KeyFile is the absolute path of the passphrase file used to format and unlock the partition
+	KeyFile string `yaml:"keyFile"`
+	// RecoveryKeyFile is the file the generated recovery key is written to, no recovery key is enrolled if empty
+	RecoveryKeyFile string `yaml:"recoveryKeyFile,omitempty"`
+	// TPM2 enrolls a keyslot bound to the TPM2 device if set
+	TPM2 *TPM2Binding `yaml:"tpm2,omitempty"`
+	// UUID is the UUID of the LUKS2 header, it is set at installation time
+	UUID string `yaml:"uuid,omitempty"`
+}
+
+// TPM2Binding describes a LUKS2 keyslot sealed to the state of the given PCRs
+type TPM2Binding struct {
+	// Device is the TPM2 device path, defaults to 'auto'
+	Device string `yaml:"device,omitempty"`
+	// PCRs are the registers the keyslot is bound to, the systemd-cryptenroll default applies if empty
+	PCRs []int `yaml:"pcrs,omitempty"`
+}
+
+// MapperName returns the device mapper name of the unlocked partition
+func (e Encryption) MapperName() string {
+	return fmt.Sprintf("luks-%s", e.UUID)
+}
+
+// MappedDevice returns the device path of the unlocked partition
+func (e Encryption) MappedDevice() string {
+	return filepath.Join("/dev/mapper", e.MapperName())
+}
+
+// CrypttabOptions returns the options to unlock the partition at boot
+func (e Encryption) CrypttabOptions() []string {
+	opts := []string{"luks"}
+	if e.TPM2 != nil {
+		opts = append(opts, fmt.Sprintf("tpm2-device=%s", e.TPM2.GetDevice()))
+	}
+	return opts
+}
+
+// KernelCmdline returns the kernel parameters to unlock the partition from the initrd
+func (e Encryption) KernelCmdline() string {
+	if e.UUID == "" {
+		return ""
+	}
+	cmdline := fmt.Sprintf("rd.luks.uuid=%s", e.UUID)
+	if e.TPM2 != nil {
+		cmdline += fmt.Sprintf(" rd.luks.options=%s=tpm2-device=%s", e.UUID, e.TPM2.GetDevice())
+	}
+	return cmdline
+}
+
+// GetDevice returns the TPM2 device path or the default one if unset
+func (t TPM2Binding) GetDevice() string {
+	if t.Device == "" {
+		return DefaultTPM2Device
+	}
+	return t.Device
+}
+
+// PCRList returns the PCRs in the systemd-cryptenroll format, for instance '7+11'
+func (t TPM2Binding) PCRList() string {
+	var pcrs []string
+	for _, pcr := range t.PCRs {
+		pcrs = append(pcrs, strconv.Itoa(pcr))
+	}
+	return strings.Join(pcrs, "+")
+}
+
+// checkEncryption verifies encrypted partitions define a key file and valid TPM2 PCRs. EFI and recovery
+// partitions can't be encrypted as they are read before any device is unlocked. All encrypted partitions
+// of a disk share the same key file as it is set once for systemd-repart.
+func checkEncryption(_ *sys.System, d *Deployment) error {
+	for i, disk := range d.Disks {
+		var keyFile string
+		for _, part := range disk.Partitions {
+			enc := part.Encryption
+			if enc == nil {
+				continue
+			}
+			if part.Role == EFI || part.Role == Recovery {
+				return fmt.Errorf("encryption is not supported for %s partitions", part.Role.String())
+			}
+			if enc.KeyFile == "" {
+				return fmt.Errorf("missing key file to encrypt partition '%s'", part.Label)
+			}
+			if !filepath.IsAbs(enc.KeyFile) {
+				return fmt.Errorf("key file of partition '%s' requires an absolute path", part.Label)
+			}
+			if keyFile != "" && keyFile != enc.KeyFile {
+				return fmt.Errorf("encrypted partitions of disk %d must share the same key file", i)
+			}
+			keyFile = enc.KeyFile
+			if enc.RecoveryKeyFile != "" && !filepath.IsAbs(enc.RecoveryKeyFile) {
+				return fmt.Errorf("recovery key file of partition '%s' requires an absolute path", part.Label)
+			}
+			if enc.TPM2 == nil {
+				continue
+			}
+			for _, pcr := range enc.TPM2.PCRs {
+				if pcr < 0 || pcr > maxTPM2PCR {
+					return fmt.Errorf("invalid TPM2 PCR %d for partition '%s'", pcr, part.Label)
+				}
+			}
+		}
+	}
+	return nil
+}
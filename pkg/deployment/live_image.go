@@ -0,0 +1,128 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"fmt"
+	"slices"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/suse/elemental/v3/pkg/sys"
+)
+
+const (
+	SquashfsImage = "squashfs.img"
+	ErofsImage    = "erofs.img"
+
+	NoCompression = "none"
+)
+
+type ImageFormat int
+
+const (
+	Squashfs ImageFormat = iota + 1
+	EroFS
+)
+
+var imageCompressions = map[ImageFormat][]string{
+	Squashfs: {NoCompression, "gzip", "lzo", "lz4", "xz", "zstd"},
+	EroFS:    {NoCompression, "lz4", "lz4hc", "lzma", "deflate", "zstd"},
+}
+
+func ParseImageFormat(f string) (ImageFormat, error) {
+	switch f {
+	case "squashfs":
+		return Squashfs, nil
+	case "erofs":
+		return EroFS, nil
+	default:
+		return ImageFormat(0), fmt.Errorf("image format not supported: %s", f)
+	}
+}
+
+func (f ImageFormat) String() string {
+	switch f {
+	case Squashfs:
+		return "squashfs"
+	case EroFS:
+		return "erofs"
+	default:
+		return Unknown
+	}
+}
+
+var (
+	_ yaml.Marshaler   = ImageFormat(0)
+	_ yaml.Unmarshaler = (*ImageFormat)(nil)
+)
+
+func (f ImageFormat) MarshalYAML() (any, error) {
+	if str := f.String(); str != Unknown {
+		return str, nil
+	}
+	return nil, fmt.Errorf("unknown image format: %d", f)
+}
+
+func (f *ImageFormat) UnmarshalYAML(data *yaml.Node) (err error) {
+	var format string
+	if err = data.Decode(&format); err != nil {
+		return err
+	}
+	*f, err = ParseImageFormat(format)
+	return err
+}
+
+// LiveImage describes the compressed read-only image holding the OS of the live installer media.
+// The recovery partition is a copy of the installer media, so it shares the same image.
+type LiveImage struct {
+	// Format is the image format, defaults to squashfs
+	Format ImageFormat `yaml:"format,omitempty"`
+	// Compression is the compression algorithm of the image, 'none' disables compression.
+	// Defaults to the image format tool default.
+	Compression string `yaml:"compression,omitempty"`
+}
+
+// FileName returns the file name of the image within the LiveOS directory of the media
+func (l LiveImage) FileName() string {
+	if l.Format == EroFS {
+		return ErofsImage
+	}
+	return SquashfsImage
+}
+
+// KernelCmdline returns the kernel parameters required to find the image at live boot, if any
+func (l LiveImage) KernelCmdline() string {
+	if l.Format == EroFS {
+		return fmt.Sprintf("rd.live.squashimg=%s", ErofsImage)
+	}
+	return ""
+}
+
+// checkLiveImage verifies the live image compression is supported by the image format
+func checkLiveImage(_ *sys.System, d *Deployment) error {
+	img := d.Installer.Image
+	format := img.Format
+	if format == ImageFormat(0) {
+		format = Squashfs
+	}
+	if img.Compression != "" && !slices.Contains(imageCompressions[format], img.Compression) {
+		return fmt.Errorf("compression '%s' is not supported by %s images", img.Compression, format)
+	}
+	return nil
+}
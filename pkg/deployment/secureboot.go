@@ -0,0 +1,74 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/suse/elemental/v3/pkg/sys"
+)
+
+// SecureBoot describes the user provided Secure Boot keys used to sign the boot artifacts
+// installed into the ESP. The paths are only meaningful on the host running the installation,
+// hence they are not stored in the deployment file of the installed system. A section without
+// keys records the installed boot artifacts are signed, they are kept as they are on upgrades
+// unless the keys are given again.
+type SecureBoot struct {
+	// Key is the absolute path of the private key used to sign EFI binaries
+	Key string `yaml:"key,omitempty"`
+	// Cert is the absolute path of the PEM certificate matching the key
+	Cert string `yaml:"cert,omitempty"`
+	// EnrollDir is the absolute path of a directory including the PK.auth, KEK.auth and db.auth
+	// signed EFI variable updates to auto enroll, nothing is enrolled if empty
+	EnrollDir string `yaml:"enrollDir,omitempty"`
+}
+
+// HasKeys returns true if the key and certificate to sign the boot artifacts are set
+func (sb SecureBoot) HasKeys() bool {
+	return sb.Key != "" && sb.Cert != ""
+}
+
+// WithoutKeys returns a copy of the Secure Boot setup without the paths of the keys and enrollment
+// files, nil if not set
+func (sb *SecureBoot) WithoutKeys() *SecureBoot {
+	if sb == nil {
+		return nil
+	}
+	return &SecureBoot{}
+}
+
+// checkSecureBoot verifies the Secure Boot keys are properly defined
+func checkSecureBoot(_ *sys.System, d *Deployment) error {
+	sb := d.SecureBoot
+	if sb == nil {
+		return nil
+	}
+	if (sb.Key == "") != (sb.Cert == "") {
+		return fmt.Errorf("secure boot signing requires both a key and a certificate")
+	}
+	for _, path := range []string{sb.Key, sb.Cert, sb.EnrollDir} {
+		if path != "" && !filepath.IsAbs(path) {
+			return fmt.Errorf("secure boot path '%s' is not absolute", path)
+		}
+	}
+	if d.BootConfig == nil || d.BootConfig.Bootloader == "" || d.BootConfig.Bootloader == "none" {
+		return fmt.Errorf("secure boot signing requires a bootloader")
+	}
+	return nil
+}
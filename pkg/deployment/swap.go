@@ -0,0 +1,123 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/suse/elemental/v3/pkg/sys"
+)
+
+const SwapLabel = "SWAP"
+
+// SwapConfig describes the swap devices of the deployment other than swap partitions
+type SwapConfig struct {
+	// File is a swap file created at installation time within a dedicated directory of a non
+	// snapshotted RW volume, copy on write is disabled for that directory
+	File *SwapFile `yaml:"file,omitempty"`
+	// Zram sets a compressed swap device in RAM configured by the zram generator
+	Zram *ZramConfig `yaml:"zram,omitempty"`
+}
+
+type SwapFile struct {
+	// Path is the absolute path of the swap file
+	Path string `yaml:"path"`
+	// Size is the size of the swap file
+	Size MiB `yaml:"size"`
+}
+
+type ZramConfig struct {
+	// Size is the size expression of the zram device, defaults to the zram generator default
+	Size string `yaml:"size,omitempty"`
+	// Compression is the compression algorithm of the zram device, defaults to the kernel default
+	Compression string `yaml:"compression,omitempty"`
+}
+
+// GetSwapFile returns the swap file of the deployment, nil if none
+func (d Deployment) GetSwapFile() *SwapFile {
+	if d.Swap == nil {
+		return nil
+	}
+	return d.Swap.File
+}
+
+// GetVolume returns the RW volume of the given partition holding the swap file, nil if none
+func (f SwapFile) GetVolume(part *Partition) *RWVolume {
+	var vol *RWVolume
+	for i, rwVol := range part.RWVolumes {
+		if !strings.HasPrefix(f.Path, strings.TrimSuffix(rwVol.Path, "/")+"/") {
+			continue
+		}
+		if vol == nil || len(rwVol.Path) > len(vol.Path) {
+			vol = &part.RWVolumes[i]
+		}
+	}
+	return vol
+}
+
+// checkSwap verifies the swap partitions and the swap file are properly defined
+func checkSwap(_ *sys.System, d *Deployment) error {
+	for _, disk := range d.Disks {
+		for _, part := range disk.Partitions {
+			if part.Role != Swap {
+				if part.FileSystem == SwapFS {
+					return fmt.Errorf("the swap filesystem is only supported by 'swap' partitions")
+				}
+				continue
+			}
+			if part.MountPoint != "" || len(part.RWVolumes) > 0 {
+				return fmt.Errorf("'swap' partitions can't be mounted nor include volumes")
+			}
+			if part.Label == "" {
+				part.Label = SwapLabel
+			}
+			part.FileSystem = SwapFS
+		}
+	}
+
+	if d.Swap == nil || d.Swap.File == nil {
+		return nil
+	}
+
+	file := d.Swap.File
+	if !filepath.IsAbs(file.Path) {
+		return fmt.Errorf("swap file path '%s' is not absolute", file.Path)
+	}
+	if file.Size == 0 {
+		return fmt.Errorf("missing size of swap file '%s'", file.Path)
+	}
+	for _, disk := range d.Disks {
+		for _, part := range disk.Partitions {
+			rwVol := file.GetVolume(part)
+			if rwVol == nil {
+				continue
+			}
+			if part.FileSystem != Btrfs || rwVol.Snapshotted {
+				return fmt.Errorf("swap file '%s' requires a non snapshotted btrfs RW volume", file.Path)
+			}
+			// copy on write is disabled for the directory of the swap file, not for the whole volume
+			if filepath.Dir(file.Path) == filepath.Clean(rwVol.Path) {
+				return fmt.Errorf("swap file '%s' requires a dedicated directory within the '%s' RW volume", file.Path, rwVol.Path)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no RW volume found for swap file '%s'", file.Path)
+}
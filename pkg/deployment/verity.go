@@ -0,0 +1,157 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/suse/elemental/v3/pkg/sys"
+)
+
+const (
+	VerityData = "data"
+	VerityHash = "hash"
+
+	VerityLabel = "USR"
+
+	// minVerityHashSize is the minimum size in MiB of a verity hash partition
+	minVerityHashSize MiB = 8
+)
+
+// veritySlots are the A/B slots of verity partitions, each deployment uses the slot
+// not used by the deployment it was upgraded from
+var veritySlots = []string{"a", "b"}
+
+// VerityConfig enables dm-verity protected read-only images of the /usr tree of each deployment.
+// Images are written to A/B slots of verity data and hash partitions, so the current and the
+// previous deployment remain bootable.
+type VerityConfig struct {
+	// Size is the size in MiB of each verity data partition
+	Size MiB `yaml:"size"`
+	// HashSize is the size in MiB of each verity hash partition, defaults to 1/64 of Size
+	HashSize MiB `yaml:"hashSize,omitempty"`
+	// Slot is the slot used by the deployment, it is set at installation and upgrade time
+	Slot string `yaml:"slot,omitempty"`
+}
+
+// VerityPartition marks a partition as the verity data or hash partition of a slot
+type VerityPartition struct {
+	Type string `yaml:"type"`
+	Slot string `yaml:"slot"`
+}
+
+// NextSlot returns the verity slot for a new deployment upgrading the current one
+func (v VerityConfig) NextSlot() string {
+	idx := slices.Index(veritySlots, v.Slot)
+	return veritySlots[(idx+1)%len(veritySlots)]
+}
+
+// MaxSnapshots returns the maximum number of snapshots which can be bootable at once, one per slot.
+// Older snapshots have their slot overwritten by a newer deployment.
+func (v VerityConfig) MaxSnapshots() int {
+	return len(veritySlots)
+}
+
+// GetVerityPartitions returns the verity data and hash partitions of the given slot,
+// nil if not found.
+func (d Deployment) GetVerityPartitions(slot string) (data *Partition, hash *Partition) {
+	for _, disk := range d.Disks {
+		for _, part := range disk.Partitions {
+			if part.Verity == nil || part.Verity.Slot != slot {
+				continue
+			}
+			switch part.Verity.Type {
+			case VerityData:
+				data = part
+			case VerityHash:
+				hash = part
+			}
+		}
+	}
+	return data, hash
+}
+
+// VerityKernelCmdline returns the kernel parameters to mount /usr from the verity image of the
+// deployment slot with the given root hash
+func (d Deployment) VerityKernelCmdline(rootHash string) string {
+	if d.Verity == nil {
+		return ""
+	}
+	data, hash := d.GetVerityPartitions(d.Verity.Slot)
+	if data == nil || hash == nil {
+		return ""
+	}
+	return fmt.Sprintf(
+		"usrhash=%s systemd.verity_usr_data=PARTUUID=%s systemd.verity_usr_hash=PARTUUID=%s "+
+			"mount.usr=/dev/mapper/usr mount.usrfstype=squashfs mount.usrflags=ro",
+		rootHash, data.UUID, hash.UUID,
+	)
+}
+
+// checkVerity verifies the verity setup and adds the verity partitions of all slots to the
+// system disk, right before the system partition, if they are not defined yet.
+func checkVerity(_ *sys.System, d *Deployment) error {
+	if d.Verity == nil {
+		return nil
+	}
+	if d.Verity.Size == 0 {
+		return fmt.Errorf("missing size of verity data partitions")
+	}
+	if d.Verity.Slot != "" && !slices.Contains(veritySlots, d.Verity.Slot) {
+		return fmt.Errorf("invalid verity slot: '%s'", d.Verity.Slot)
+	}
+	if d.Verity.HashSize == 0 {
+		d.Verity.HashSize = max(d.Verity.Size/64, minVerityHashSize)
+	}
+
+	disk := d.GetSystemDisk()
+	if disk == nil {
+		return fmt.Errorf("no system disk defined for verity partitions")
+	}
+
+	var parts Partitions
+	for _, slot := range veritySlots {
+		data, hash := d.GetVerityPartitions(slot)
+		if data != nil && hash != nil {
+			continue
+		}
+		if data != nil || hash != nil {
+			return fmt.Errorf("incomplete verity partitions for slot '%s'", slot)
+		}
+		label := fmt.Sprintf("%s_%s", VerityLabel, strings.ToUpper(slot))
+		parts = append(parts, &Partition{
+			Label:  label,
+			Role:   Data,
+			Size:   d.Verity.Size,
+			Verity: &VerityPartition{Type: VerityData, Slot: slot},
+		}, &Partition{
+			Label:  label + "_VERITY",
+			Role:   Data,
+			Size:   d.Verity.HashSize,
+			Verity: &VerityPartition{Type: VerityHash, Slot: slot},
+		})
+	}
+
+	if len(parts) > 0 {
+		idx := slices.IndexFunc(disk.Partitions, func(p *Partition) bool { return p.Role == System })
+		disk.Partitions = slices.Insert(disk.Partitions, idx, parts...)
+	}
+	return nil
+}
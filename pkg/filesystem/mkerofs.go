@@ -0,0 +1,47 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filesystem
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/suse/elemental/v3/pkg/sys"
+)
+
+// CreateEroFS creates an EROFS image at destination from a source, with options
+func CreateEroFS(ctx context.Context, s *sys.System, source string, destination string, options []string) error {
+	args := append([]string{}, options...)
+	args = append(args, destination, source)
+
+	out, err := s.Runner().RunContext(ctx, "mkfs.erofs", args...)
+	if err != nil {
+		s.Logger().Error("Error running mkfs.erofs, stdout and stderr output: %s", out)
+		return fmt.Errorf("error creating erofs from %s to %s: %w", source, destination, err)
+	}
+	return nil
+}
+
+func DefaultErofsCompressionOptions() []string {
+	return ErofsCompressionOptions("lz4hc")
+}
+
+// ErofsCompressionOptions returns the options to compress the image with the given algorithm
+func ErofsCompressionOptions(algorithm string) []string {
+	return []string{fmt.Sprintf("-z%s", algorithm)}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filesystem_test
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/pkg/filesystem"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+)
+
+var _ = Describe("Mkerofs", Label("mkerofs"), func() {
+	var s *sys.System
+	var runner *sysmock.Runner
+	BeforeEach(func() {
+		var err error
+		runner = sysmock.NewRunner()
+		s, err = sys.NewSystem(
+			sys.WithRunner(runner),
+			sys.WithLogger(log.New(log.WithDiscardAll())),
+		)
+		Expect(err).ToNot(HaveOccurred())
+	})
+	It("Creates an erofs image with default parameters", func() {
+		Expect(filesystem.CreateEroFS(
+			context.Background(), s, "/some/root", "/some/rootfs.erofs",
+			filesystem.DefaultErofsCompressionOptions(),
+		)).To(Succeed())
+		Expect(runner.CmdsMatch([][]string{
+			{"mkfs.erofs", "-zlz4hc", "/some/rootfs.erofs", "/some/root"},
+		})).To(Succeed())
+	})
+	It("Creates an erofs image without compression", func() {
+		Expect(filesystem.CreateEroFS(context.Background(), s, "/some/root", "/some/rootfs.erofs", nil)).To(Succeed())
+		Expect(runner.CmdsMatch([][]string{
+			{"mkfs.erofs", "/some/rootfs.erofs", "/some/root"},
+		})).To(Succeed())
+	})
+	It("Fails to create an erofs image", func() {
+		runner.ReturnError = fmt.Errorf("mkfs.erofs failed")
+		err := filesystem.CreateEroFS(context.Background(), s, "/some/root", "/some/rootfs.erofs", nil)
+		Expect(err).To(MatchError(ContainSubstring("mkfs.erofs failed")))
+	})
+})
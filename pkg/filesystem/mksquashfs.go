@@ -45,6 +45,11 @@ func DefaultSquashfsCompressionOptions() []string {
 	return []string{"-b", "1024k"}
 }
 
+// SquashfsCompressionOptions returns the default options using the given compression algorithm
+func SquashfsCompressionOptions(algorithm string) []string {
+	return append(DefaultSquashfsCompressionOptions(), "-comp", algorithm)
+}
+
 func SquashfsExcludeOptions(excludes ...string) []string {
 	opts := []string{}
 	if len(excludes) == 0 {
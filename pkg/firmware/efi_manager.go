@@ -22,11 +22,13 @@ import (
 
 	"github.com/suse/elemental/v3/pkg/sys"
 	"github.com/suse/elemental/v3/pkg/sys/platform"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
 )
 
 const (
 	EfiEntryPath     = "/EFI/ELEMENTAL"
 	EfiFallbackPath  = "/EFI/BOOT"
+	EfiFirmwarePath  = "/sys/firmware/efi"
 	EfivarsMountPath = "/sys/firmware/efi/efivars"
 	EfiBootEntryName = "elemental-shim"
 	EfiImgX86        = "bootx64.efi"
@@ -66,6 +68,12 @@ func (b *EfiBootManager) CreateBootEntries(entries []*EfiBootEntry) error {
 	return nil
 }
 
+// IsEFI returns true if the running system was booted by EFI firmware
+func IsEFI(s *sys.System) bool {
+	ok, _ := vfs.Exists(s.FS(), EfiFirmwarePath)
+	return ok
+}
+
 // DefaultBootEntry generates the default EFI boot entry for the platform.
 func DefaultBootEntry(p *platform.Platform, disk string) *EfiBootEntry {
 	efiImgName := ""
@@ -0,0 +1,107 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/sys"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+const (
+	UnitName = "elemental-health-check.service"
+
+	unitsPath = "/etc/systemd/system"
+	wantsDir  = "multi-user.target.wants"
+)
+
+//go:embed elemental-health-check.service
+var healthCheckUnit []byte
+
+// Run executes the given health checks in order and returns an error including the
+// output of the first failing one. Each check is interrupted once its timeout expires.
+func Run(ctx context.Context, s *sys.System, checks []deployment.HealthCheck) error {
+	for _, check := range checks {
+		s.Logger().Info("Running health check '%s'", check.Name)
+
+		timeout := check.Timeout
+		if timeout <= 0 {
+			timeout = deployment.DefaultHealthCheckTimeout
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		out, err := s.Runner().RunContext(checkCtx, "/bin/sh", "-c", check.Command)
+		timedOut := errors.Is(checkCtx.Err(), context.DeadlineExceeded)
+		cancel()
+
+		if timedOut {
+			return fmt.Errorf("health check '%s' timed out after %s", check.Name, timeout)
+		} else if err != nil {
+			return fmt.Errorf("health check '%s' failed: %w: %s", check.Name, err, strings.TrimSpace(string(out)))
+		}
+		s.Logger().Info("Health check '%s' passed", check.Name)
+	}
+	return nil
+}
+
+// EnableUnit installs and enables the health check unit in the given root, so checks
+// are executed on the next boot of it
+func EnableUnit(s *sys.System, root string) error {
+	unitPath := filepath.Join(root, unitsPath, UnitName)
+	wantsPath := filepath.Join(root, unitsPath, wantsDir, UnitName)
+
+	err := vfs.MkdirAll(s.FS(), filepath.Dir(wantsPath), vfs.DirPerm)
+	if err != nil {
+		return fmt.Errorf("creating directory '%s': %w", filepath.Dir(wantsPath), err)
+	}
+
+	err = s.FS().WriteFile(unitPath, healthCheckUnit, vfs.FilePerm)
+	if err != nil {
+		return fmt.Errorf("writing unit file '%s': %w", unitPath, err)
+	}
+
+	if ok, _ := vfs.Exists(s.FS(), wantsPath); ok {
+		return nil
+	}
+	err = s.FS().Symlink(filepath.Join("..", UnitName), wantsPath)
+	if err != nil {
+		return fmt.Errorf("enabling unit '%s': %w", UnitName, err)
+	}
+	return nil
+}
+
+// DisableUnit disables the health check unit in the given root, so checks are not
+// executed again on following boots
+func DisableUnit(s *sys.System, root string) error {
+	wantsPath := filepath.Join(root, unitsPath, wantsDir, UnitName)
+	if ok, _ := vfs.Exists(s.FS(), wantsPath); !ok {
+		return nil
+	}
+
+	err := s.FS().Remove(wantsPath)
+	if err != nil {
+		return fmt.Errorf("disabling unit '%s': %w", UnitName, err)
+	}
+	return nil
+}
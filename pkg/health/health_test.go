@@ -0,0 +1,106 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/health"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+func TestHealthSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Health test suite")
+}
+
+var _ = Describe("Health checks", Label("health"), func() {
+	var runner *sysmock.Runner
+	var fs vfs.FS
+	var cleanup func()
+	var s *sys.System
+	var checks []deployment.HealthCheck
+
+	BeforeEach(func() {
+		var err error
+		runner = sysmock.NewRunner()
+		fs, cleanup, err = sysmock.TestFS(nil)
+		Expect(err).ToNot(HaveOccurred())
+		s, err = sys.NewSystem(
+			sys.WithRunner(runner), sys.WithFS(fs),
+			sys.WithLogger(log.New(log.WithDiscardAll())),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		checks = []deployment.HealthCheck{
+			{Name: "rke2", Command: "kubectl get nodes", Timeout: time.Minute},
+			{Name: "service", Command: "curl -f http://localhost", Timeout: time.Minute},
+		}
+	})
+	AfterEach(func() {
+		cleanup()
+	})
+	It("runs all health checks", func() {
+		Expect(health.Run(context.Background(), s, checks)).To(Succeed())
+		Expect(runner.CmdsMatch([][]string{
+			{"/bin/sh", "-c", "kubectl get nodes"},
+			{"/bin/sh", "-c", "curl -f http://localhost"},
+		})).To(Succeed())
+	})
+	It("stops at the first failing health check", func() {
+		runner.SideEffect = func(_ string, args ...string) ([]byte, error) {
+			return []byte("node not ready\n"), fmt.Errorf("exit status 1")
+		}
+		err := health.Run(context.Background(), s, checks)
+		Expect(err).To(MatchError("health check 'rke2' failed: exit status 1: node not ready"))
+		Expect(runner.GetCmds()).To(HaveLen(1))
+	})
+	It("fails if a health check times out", func() {
+		checks[0].Timeout = time.Millisecond
+		runner.SideEffect = func(_ string, args ...string) ([]byte, error) {
+			time.Sleep(10 * time.Millisecond)
+			return nil, nil
+		}
+		err := health.Run(context.Background(), s, checks)
+		Expect(err).To(MatchError("health check 'rke2' timed out after 1ms"))
+	})
+	It("enables and disables the health check unit", func() {
+		Expect(health.EnableUnit(s, "/root")).To(Succeed())
+		Expect(vfs.Exists(fs, "/root/etc/systemd/system/elemental-health-check.service")).To(BeTrue())
+		link, err := fs.Readlink("/root/etc/systemd/system/multi-user.target.wants/elemental-health-check.service")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(link).To(Equal("../elemental-health-check.service"))
+
+		// enabling an already enabled unit is fine
+		Expect(health.EnableUnit(s, "/root")).To(Succeed())
+
+		Expect(health.DisableUnit(s, "/root")).To(Succeed())
+		Expect(vfs.Exists(fs, "/root/etc/systemd/system/multi-user.target.wants/elemental-health-check.service")).To(BeFalse())
+		Expect(health.DisableUnit(s, "/root")).To(Succeed())
+	})
+})
@@ -17,6 +17,8 @@ limitations under the License.
 
 package helm
 
+import "encoding/base64"
+
 const (
 	helmChartAPIVersion = "helm.cattle.io/v1"
 	helmChartKind       = "HelmChart"
@@ -40,6 +42,7 @@ type CRDSpec struct {
 	Chart           string `yaml:"chart"`
 	Version         string `yaml:"version"`
 	Repo            string `yaml:"repo,omitempty"`
+	ChartContent    string `yaml:"chartContent,omitempty"`
 	ValuesContent   string `yaml:"valuesContent,omitempty"`
 	TargetNamespace string `yaml:"targetNamespace,omitempty"`
 	CreateNamespace bool   `yaml:"createNamespace,omitempty"`
@@ -65,3 +68,10 @@ func NewCRD(namespace, chart, version, valuesContent, repositoryURL string) *CRD
 		},
 	}
 }
+
+// EmbedChart embeds the given chart archive within the resource, so the chart is deployed
+// without accessing its repository
+func (c *CRD) EmbedChart(archive []byte) {
+	c.Spec.ChartContent = base64.StdEncoding.EncodeToString(archive)
+	c.Spec.Repo = ""
+}
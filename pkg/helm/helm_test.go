@@ -28,3 +28,13 @@ func TestHelmSuite(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Helm test suite")
 }
+
+var _ = Describe("CRD", func() {
+	It("Embeds the chart archive", func() {
+		crd := NewCRD("cattle-system", "rancher", "2.11.1", "", "https://releases.rancher.com/server-charts/stable")
+		crd.EmbedChart([]byte("archive"))
+		Expect(crd.Spec.ChartContent).To(Equal("YXJjaGl2ZQ=="))
+		Expect(crd.Spec.Repo).To(BeEmpty())
+		Expect(crd.Spec.Chart).To(Equal("rancher"))
+	})
+})
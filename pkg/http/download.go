@@ -61,3 +61,24 @@ func DownloadFile(ctx context.Context, fs vfs.FS, url, path string) error {
 
 	return nil
 }
+
+// ETag returns the ETag of the given URL as reported by a HEAD request, empty if not provided
+func ETag(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("creating request: %w", err)
+	}
+
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("executing request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return resp.Header.Get("ETag"), nil
+}
@@ -19,6 +19,8 @@ package http
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -63,3 +65,22 @@ var _ = Describe("Invalid download attempts", func() {
 		Expect(err).To(MatchError("creating file: Create downloads/abc: operation not permitted"))
 	})
 })
+
+var _ = Describe("ETag", func() {
+	It("Returns the ETag of the given URL", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Method).To(Equal(http.MethodHead))
+			w.Header().Set("ETag", `"abc"`)
+		}))
+		DeferCleanup(server.Close)
+
+		etag, err := ETag(context.Background(), server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(etag).To(Equal(`"abc"`))
+	})
+
+	It("Fails to execute a request for invalid URL", func() {
+		_, err := ETag(context.Background(), "invalid-url")
+		Expect(err).To(MatchError("executing request: Head \"invalid-url\": unsupported protocol scheme \"\""))
+	})
+})
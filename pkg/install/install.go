@@ -29,7 +29,9 @@ import (
 	"github.com/suse/elemental/v3/pkg/cleanstack"
 	"github.com/suse/elemental/v3/pkg/deployment"
 	"github.com/suse/elemental/v3/pkg/installer"
+	"github.com/suse/elemental/v3/pkg/luks"
 	"github.com/suse/elemental/v3/pkg/repart"
+	"github.com/suse/elemental/v3/pkg/swap"
 	"github.com/suse/elemental/v3/pkg/sys"
 	"github.com/suse/elemental/v3/pkg/sys/vfs"
 	"github.com/suse/elemental/v3/pkg/unpack"
@@ -88,8 +90,12 @@ func IsLiveMedia(s *sys.System) bool {
 	if !mnt || err != nil {
 		return false
 	}
-	exists, _ := vfs.Exists(s.FS(), installer.SquashfsPath)
-	return exists
+	for _, img := range []string{installer.SquashfsPath, installer.ErofsPath} {
+		if exists, _ := vfs.Exists(s.FS(), img); exists {
+			return true
+		}
+	}
+	return false
 }
 
 func (i Installer) Install(d *deployment.Deployment) (err error) {
@@ -102,8 +108,14 @@ func (i Installer) Install(d *deployment.Deployment) (err error) {
 			return fmt.Errorf("partitioning disk '%s': %w", disk.Device, err)
 		}
 		for _, part := range disk.Partitions {
+			if part.Encryption != nil {
+				err = unlockPartition(i.s, cleanup, part)
+				if err != nil {
+					return fmt.Errorf("setting up encrypted partition '%s': %w", part.Label, err)
+				}
+			}
 			i.s.Logger().Debug("creating partition volumes: %+v", part.RWVolumes)
-			err = createPartitionVolumes(i.s, cleanup, part)
+			err = createPartitionVolumes(i.s, cleanup, part, d.GetSwapFile())
 			if err != nil {
 				return fmt.Errorf("creating partition volumes: %w", err)
 			}
@@ -159,11 +171,40 @@ func (i Installer) installRecoveryPartition(cleanup *cleanstack.CleanStack, d *d
 	if err != nil {
 		return fmt.Errorf("failed preparing recovery partition root: %w", err)
 	}
-	d.SourceOS = deployment.NewRawSrc(filepath.Join(mountPoint, installer.SquashfsRelPath))
+	d.SourceOS = deployment.NewRawSrc(installer.LiveImagePath(mountPoint, d.Installer.Image))
+	return nil
+}
+
+// unlockPartition enrolls the configured keyslots of the given encrypted partition and unlocks it
+// to its mapped device. The LUKS UUID is recorded in the partition encryption setup. The mapped
+// device is closed once the given clean stack is executed.
+func unlockPartition(s *sys.System, cleanStack *cleanstack.CleanStack, part *deployment.Partition) error {
+	bPart, err := block.GetPartitionByUUID(s, lsblk.NewLsDevice(s), part.UUID, 4)
+	if err != nil {
+		return fmt.Errorf("finding partition '%s': %w", part.UUID, err)
+	}
+
+	part.Encryption.UUID, err = luks.GetUUID(s, bPart.Path)
+	if err != nil {
+		return err
+	}
+
+	err = luks.Enroll(s, bPart.Path, part.Encryption)
+	if err != nil {
+		return err
+	}
+
+	err = luks.Open(s, bPart.Path, part.Encryption)
+	if err != nil {
+		return err
+	}
+	cleanStack.Push(func() error { return luks.Close(s, part.Encryption) })
 	return nil
 }
 
-func createPartitionVolumes(s *sys.System, cleanStack *cleanstack.CleanStack, part *deployment.Partition) (err error) {
+// createPartitionVolumes creates the non snapshotted RW volumes of the given partition and the
+// swap file, if any, within its volume
+func createPartitionVolumes(s *sys.System, cleanStack *cleanstack.CleanStack, part *deployment.Partition, swapFile *deployment.SwapFile) (err error) {
 	var mountPoint string
 
 	if len(part.RWVolumes) > 0 || part.Role == deployment.System {
@@ -178,9 +219,10 @@ func createPartitionVolumes(s *sys.System, cleanStack *cleanstack.CleanStack, pa
 		if err != nil {
 			return fmt.Errorf("finding partition '%s': %w", part.UUID, err)
 		}
-		err = s.Mounter().Mount(bPart.Path, mountPoint, "", []string{})
+		device := luks.PartitionDevice(part, bPart.Path)
+		err = s.Mounter().Mount(device, mountPoint, "", []string{})
 		if err != nil {
-			return fmt.Errorf("mounting partition '%s': %w", bPart.Path, err)
+			return fmt.Errorf("mounting partition '%s': %w", device, err)
 		}
 		cleanStack.Push(func() error { return s.Mounter().Unmount(mountPoint) })
 
@@ -203,6 +245,12 @@ func createPartitionVolumes(s *sys.System, cleanStack *cleanstack.CleanStack, pa
 				return fmt.Errorf("creating subvolume '%s': %w", subvolume, err)
 			}
 		}
+		if swapFile != nil && swapFile.GetVolume(part) != nil {
+			err = swap.CreateFile(s, filepath.Join(mountPoint, btrfs.TopSubVol, swapFile.Path), swapFile.Size)
+			if err != nil {
+				return fmt.Errorf("creating swap file: %w", err)
+			}
+		}
 	}
 
 	return nil
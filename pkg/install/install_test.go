@@ -96,10 +96,14 @@ const lsblkJson = `{
  }`
 
 type upgraderMock struct {
-	Error error
+	Error    error
+	Callback func()
 }
 
 func (u upgraderMock) Upgrade(_ *deployment.Deployment) error {
+	if u.Callback != nil {
+		u.Callback()
+	}
 	return u.Error
 }
 
@@ -167,6 +171,57 @@ var _ = Describe("Install", Label("install"), func() {
 			{"mksquashfs"},
 		}))
 	})
+	It("installs a recovery partition with an erofs image", func() {
+		deployment.WithRecoveryPartition(0)(d)
+		d.Installer.Image = deployment.LiveImage{Format: deployment.EroFS, Compression: "zstd"}
+		Expect(i.Install(d)).To(Succeed())
+		Expect(runner.MatchMilestones([][]string{
+			{"systemd-repart"},
+			{"mkfs.erofs", "-zzstd"},
+		})).To(Succeed())
+		Expect(d.SourceOS.URI()).To(HaveSuffix("/LiveOS/erofs.img"))
+	})
+	It("installs the given deployment on an encrypted system partition", func() {
+		deployment.WithRecoveryPartition(0)(d)
+		d.GetSystemPartition().Encryption = &deployment.Encryption{KeyFile: "/etc/keyfile"}
+		sideEffects["cryptsetup"] = func(args ...string) ([]byte, error) {
+			if slices.Contains(args, "luksUUID") {
+				return []byte("1234\n"), nil
+			}
+			return nil, nil
+		}
+		upgrader.Callback = func() {
+			Expect(mounter.GetMountPoints("/dev/mapper/luks-1234")).To(HaveLen(1))
+		}
+		Expect(i.Install(d)).To(Succeed())
+		Expect(d.GetSystemPartition().Encryption.UUID).To(Equal("1234"))
+		Expect(runner.MatchMilestones([][]string{
+			{"systemd-repart", "--empty=force"},
+			{"cryptsetup", "luksUUID", "/dev/device3"},
+			{"cryptsetup", "open", "--type", "luks2", "--key-file=/etc/keyfile", "/dev/device3", "luks-1234"},
+			{"btrfs", "subvolume", "create"},
+			{"cryptsetup", "close", "luks-1234"},
+		})).To(Succeed())
+	})
+	It("creates a swap file within a directory with copy on write disabled", func() {
+		deployment.WithRecoveryPartition(0)(d)
+		d.Swap = &deployment.SwapConfig{File: &deployment.SwapFile{Path: "/var/swap/swapfile", Size: 1024}}
+		Expect(d.Sanitize(s)).To(Succeed())
+		Expect(i.Install(d)).To(Succeed())
+		Expect(runner.MatchMilestones([][]string{
+			{"btrfs", "subvolume", "create", "/tmp/elemental_system/@/var"},
+			{"chattr", "+C", "/tmp/elemental_system/@/var/swap"},
+			{"btrfs", "filesystem", "mkswapfile", "--size", "1024m", "/tmp/elemental_system/@/var/swap/swapfile"},
+		})).To(Succeed())
+		chattrs := slices.DeleteFunc(runner.GetCmds(), func(cmd []string) bool { return cmd[0] != "chattr" })
+		Expect(chattrs).To(HaveLen(1))
+	})
+	It("keeps copy on write for the volumes of the default deployment", func() {
+		deployment.WithRecoveryPartition(0)(d)
+		Expect(i.Install(d)).To(Succeed())
+		Expect(runner.IncludesCmds([][]string{{"btrfs", "subvolume", "create", "/tmp/elemental_system/@/var"}})).To(Succeed())
+		Expect(runner.IncludesCmds([][]string{{"chattr"}})).NotTo(Succeed())
+	})
 	It("fails if systemd-repart partitions do not match deployment", func() {
 		// systemd-repart reports a recovery partition that is not part of the deployment
 		Expect(i.Install(d)).To(MatchError(ContainSubstring("failed parsing systemd-repart JSON")))
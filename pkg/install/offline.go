@@ -0,0 +1,156 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/google/uuid"
+
+	"github.com/suse/elemental/v3/pkg/btrfs"
+	"github.com/suse/elemental/v3/pkg/cleanstack"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/filesystem"
+	"github.com/suse/elemental/v3/pkg/firmware"
+	"github.com/suse/elemental/v3/pkg/repart"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+	"github.com/suse/elemental/v3/pkg/transaction"
+	"github.com/suse/elemental/v3/pkg/upgrade"
+)
+
+// offlineDiskMargin is the disk image space in MiB left for the partition table and partitions alignment
+const offlineDiskMargin = 4
+
+// InstallImage installs the given deployment into a new disk image file of the given size without
+// requiring privileges: no loop device, mount nor chroot are involved. The partitions are staged in a
+// temporary directory next to the image and the disk image is assembled with systemd-repart.
+func (i Installer) InstallImage(d *deployment.Deployment, image string, size deployment.MiB) (err error) {
+	cleanup := cleanstack.NewCleanStack()
+	defer func() { err = cleanup.Cleanup(err) }()
+
+	err = checkOfflineDeployment(d)
+	if err != nil {
+		return err
+	}
+
+	disk := d.Disks[0]
+	for _, part := range disk.Partitions {
+		if part.UUID == "" {
+			part.UUID = uuid.NewString()
+		}
+	}
+
+	stagingDir, err := vfs.TempDir(i.s.FS(), filepath.Dir(image), "elemental-staging")
+	if err != nil {
+		return fmt.Errorf("creating staging directory: %w", err)
+	}
+	cleanup.Push(func() error { return vfs.ForceRemoveAll(i.s.FS(), stagingDir) })
+
+	t := transaction.NewOffline(i.ctx, i.s, stagingDir)
+	u := upgrade.New(
+		i.ctx, i.s, upgrade.WithTransaction(t), upgrade.WithBootloader(i.b),
+		upgrade.WithBootManager(firmware.NewEfiBootManager(i.s)), upgrade.WithoutChroot(),
+		upgrade.WithUnpackOpts(i.unpackOpts...),
+	)
+	err = u.Upgrade(d)
+	if err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+
+	contents := map[string]repart.PartitionContent{}
+	for _, part := range disk.Partitions {
+		dir := transaction.StagedPartitionDir(stagingDir, part)
+		if part.Role == deployment.System {
+			sysImage := dir + ".img"
+			err = createSystemImage(i, t, part, dir, sysImage, systemPartitionSize(disk, size))
+			if err != nil {
+				return fmt.Errorf("creating system filesystem image: %w", err)
+			}
+			contents[part.UUID] = repart.PartitionContent{CopyBlocks: sysImage}
+			continue
+		}
+		if ok, _ := vfs.Exists(i.s.FS(), dir); ok {
+			contents[part.UUID] = repart.PartitionContent{CopyFiles: dir + ":/"}
+		}
+	}
+
+	err = repart.CreateDiskImage(i.s, disk, image, size, contents)
+	if err != nil {
+		return fmt.Errorf("assembling disk image: %w", err)
+	}
+	return nil
+}
+
+// checkOfflineDeployment verifies the given deployment can be installed without privileges
+func checkOfflineDeployment(d *deployment.Deployment) error {
+	switch {
+	case len(d.Disks) != 1:
+		return fmt.Errorf("offline installation requires a single disk deployment")
+	case d.Verity != nil:
+		return fmt.Errorf("offline installation does not support verity")
+	case d.IsBIOSEnabled():
+		return fmt.Errorf("offline installation does not support legacy BIOS boot")
+	case d.GetSwapFile() != nil:
+		return fmt.Errorf("offline installation does not support swap files")
+	case d.GetRecoveryPartition() != nil:
+		return fmt.Errorf("offline installation does not support recovery partitions")
+	case d.Firmware != nil && len(d.Firmware.BootEntries) > 0:
+		return fmt.Errorf("offline installation does not support EFI boot entries")
+	}
+
+	for _, part := range d.Disks[0].Partitions {
+		if part.Encryption != nil {
+			return fmt.Errorf("offline installation does not support encrypted partitions")
+		}
+		if part.Role == deployment.System && part.FileSystem != deployment.Btrfs {
+			return fmt.Errorf("offline installation requires a btrfs system partition")
+		}
+		if part.Role != deployment.System && len(part.RWVolumes) > 0 {
+			return fmt.Errorf("offline installation only supports RW volumes in the system partition")
+		}
+	}
+	return nil
+}
+
+// systemPartitionSize returns the size in MiB of the system partition within a disk image of the
+// given size. Partitions of size zero take all the space left by the other partitions.
+func systemPartitionSize(disk *deployment.Disk, size deployment.MiB) deployment.MiB {
+	sysSize := size - offlineDiskMargin
+	for _, part := range disk.Partitions {
+		if part.Role == deployment.System && part.Size > 0 {
+			return part.Size
+		}
+		if part.Role != deployment.System {
+			sysSize -= part.Size
+		}
+	}
+	return sysSize
+}
+
+// createSystemImage creates a btrfs filesystem image of the given size populated with the staged system
+// partition tree, including the subvolumes of the transaction
+func createSystemImage(i Installer, t *transaction.Offline, part *deployment.Partition, root, image string, size deployment.MiB) error {
+	err := filesystem.CreateEmptyFile(i.s.FS(), image, int64(size), false)
+	if err != nil {
+		return err
+	}
+
+	opts := btrfs.RootDirMkfsOpts(root, t.Subvolumes()...)
+	return filesystem.NewMkfsCall(i.s, image, part.FileSystem.String(), part.Label, "", opts...).Apply()
+}
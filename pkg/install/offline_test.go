@@ -0,0 +1,118 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/install"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+var _ = Describe("Offline install", Label("install", "offline"), func() {
+	var runner *sysmock.Runner
+	var mounter *sysmock.Mounter
+	var fs vfs.FS
+	var cleanup func()
+	var s *sys.System
+	var d *deployment.Deployment
+	var i *install.Installer
+	BeforeEach(func() {
+		var err error
+		runner = sysmock.NewRunner()
+		mounter = sysmock.NewMounter()
+		fs, cleanup, err = sysmock.TestFS(map[string]any{
+			"/some/dir/etc/os-release": []byte{},
+			"/build/empty":             []byte{},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		s, err = sys.NewSystem(
+			sys.WithMounter(mounter), sys.WithRunner(runner),
+			sys.WithFS(fs), sys.WithLogger(log.New(log.WithDiscardAll())),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		d = deployment.DefaultDeployment()
+		d.SourceOS = deployment.NewDirSrc("/some/dir")
+		Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+		i = install.New(context.Background(), s)
+
+		// Simulates the OS image content synced into the first snapshot
+		runner.SideEffect = func(cmd string, args ...string) ([]byte, error) {
+			target := args[len(args)-1]
+			if cmd != "rsync" || !strings.HasSuffix(target, "/@/.snapshots/1/snapshot/") {
+				return []byte{}, nil
+			}
+			for _, file := range []string{
+				"etc/snapper/config-templates/default", "etc/sysconfig/snapper",
+				"etc/snapper/configs/.keep", "boot/vmlinuz",
+			} {
+				Expect(os.MkdirAll(filepath.Dir(filepath.Join(target, file)), vfs.DirPerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(target, file), []byte{}, vfs.FilePerm)).To(Succeed())
+			}
+			return []byte{}, nil
+		}
+	})
+	AfterEach(func() {
+		cleanup()
+	})
+	It("installs the given deployment into a disk image", func() {
+		Expect(i.InstallImage(d, "/build/disk.raw", 4096)).To(Succeed())
+		Expect(d.GetSystemPartition().UUID).NotTo(BeEmpty())
+		Expect(runner.MatchMilestones([][]string{
+			{"rsync"},
+			{"mkfs.btrfs", "-L", deployment.SystemLabel, "-f", "--rootdir"},
+			{"systemd-repart", "--empty=create", "--size=4096M", "--offline=yes"},
+		})).To(Succeed())
+
+		mkfs := runner.GetCmds()[slices.IndexFunc(runner.GetCmds(), func(cmd []string) bool {
+			return cmd[0] == "mkfs.btrfs"
+		})]
+		Expect(mkfs).To(ContainElement("default-ro:@/.snapshots/1/snapshot"))
+		Expect(mkfs).NotTo(ContainElement("nodatacow:@/var"))
+		Expect(mounter.List()).To(BeEmpty())
+
+		// The staging directory is removed
+		entries, err := fs.ReadDir("/build")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+	It("fails to install deployments requiring privileges", func() {
+		d.GetSystemPartition().Encryption = &deployment.Encryption{KeyFile: "/etc/keyfile"}
+		Expect(i.InstallImage(d, "/build/disk.raw", 4096)).To(
+			MatchError("offline installation does not support encrypted partitions"),
+		)
+		Expect(runner.GetCmds()).To(BeEmpty())
+	})
+	It("fails to install a deployment with a recovery partition", func() {
+		deployment.WithRecoveryPartition(0)(d)
+		Expect(i.InstallImage(d, "/build/disk.raw", 4096)).To(
+			MatchError("offline installation does not support recovery partitions"),
+		)
+	})
+})
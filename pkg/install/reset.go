@@ -0,0 +1,232 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/suse/elemental/v3/pkg/block"
+	"github.com/suse/elemental/v3/pkg/block/lsblk"
+	"github.com/suse/elemental/v3/pkg/btrfs"
+	"github.com/suse/elemental/v3/pkg/cleanstack"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/filesystem"
+	"github.com/suse/elemental/v3/pkg/luks"
+	"github.com/suse/elemental/v3/pkg/swap"
+	"github.com/suse/elemental/v3/pkg/sys"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+// keptVolsDir is the directory, relative to the top level volume of the system partition,
+// where kept volumes are moved to while the system partition is wiped
+const keptVolsDir = "elemental-reset"
+
+// Reset reinstalls the system partition of an already installed deployment. The partition
+// table and any other partition are left untouched. The non snapshotted RW volumes of the
+// system partition listed in keep are preserved, all other volumes are recreated empty. An
+// encrypted system partition is unlocked with its key file and reset within its LUKS volume.
+func (i Installer) Reset(d *deployment.Deployment, keep ...string) (err error) {
+	cleanup := cleanstack.NewCleanStack()
+	defer func() { err = cleanup.Cleanup(err) }()
+
+	sysPart := d.GetSystemPartition()
+	if sysPart == nil {
+		return fmt.Errorf("no system partition defined in deployment")
+	}
+
+	keep, err = keptVolumes(sysPart, keep)
+	if err != nil {
+		return fmt.Errorf("checking volumes to keep: %w", err)
+	}
+
+	bPart, err := block.GetPartitionByUUID(i.s, lsblk.NewLsDevice(i.s), sysPart.UUID, 4)
+	if err != nil {
+		return fmt.Errorf("finding partition '%s': %w", sysPart.UUID, err)
+	}
+
+	if sysPart.Encryption != nil {
+		// the LUKS header and its keyslots are kept, only the mapped device is wiped
+		err = openPartition(i.s, cleanup, bPart.Path, sysPart)
+		if err != nil {
+			return fmt.Errorf("opening encrypted partition '%s': %w", bPart.Path, err)
+		}
+	}
+	device := luks.PartitionDevice(sysPart, bPart.Path)
+
+	if len(keep) == 0 {
+		i.s.Logger().Info("Formatting system partition '%s'", device)
+		mkfs := filesystem.NewMkfsCall(i.s, device, sysPart.FileSystem.String(), sysPart.Label, "")
+		err = mkfs.Apply()
+		if err != nil {
+			return fmt.Errorf("formatting partition '%s': %w", device, err)
+		}
+		err = createPartitionVolumes(i.s, cleanup, sysPart, d.GetSwapFile())
+		if err != nil {
+			return fmt.Errorf("creating partition volumes: %w", err)
+		}
+	} else {
+		i.s.Logger().Info("Wiping system partition '%s' keeping volumes %v", device, keep)
+		err = resetPartitionVolumes(i.s, cleanup, device, sysPart, d.GetSwapFile(), keep)
+		if err != nil {
+			return fmt.Errorf("resetting partition volumes: %w", err)
+		}
+	}
+
+	err = i.u.Upgrade(d)
+	if err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// openPartition unlocks the given encrypted partition with its key file to its mapped device, keyslots
+// are left untouched. The LUKS UUID is recorded in the partition encryption setup. The mapped device
+// is closed once the given clean stack is executed.
+func openPartition(s *sys.System, cleanStack *cleanstack.CleanStack, device string, part *deployment.Partition) (err error) {
+	if ok, _ := vfs.Exists(s.FS(), part.Encryption.KeyFile); !ok {
+		return fmt.Errorf("key file '%s' is required to unlock the partition and it was not found", part.Encryption.KeyFile)
+	}
+
+	part.Encryption.UUID, err = luks.GetUUID(s, device)
+	if err != nil {
+		return err
+	}
+
+	err = luks.Open(s, device, part.Encryption)
+	if err != nil {
+		return err
+	}
+	cleanStack.Push(func() error { return luks.Close(s, part.Encryption) })
+	return nil
+}
+
+// keptVolumes validates the given list of volumes to keep against the system partition
+// definition and returns it cleaned and without duplicates
+func keptVolumes(part *deployment.Partition, keep []string) ([]string, error) {
+	var vols []string
+
+	for _, path := range keep {
+		path = filepath.Clean(filepath.Join("/", path))
+		if slices.Contains(vols, path) {
+			continue
+		}
+		idx := slices.IndexFunc(part.RWVolumes, func(v deployment.RWVolume) bool { return v.Path == path })
+		if idx < 0 {
+			return nil, fmt.Errorf("'%s' is not a RW volume of the system partition", path)
+		}
+		if part.RWVolumes[idx].Snapshotted {
+			return nil, fmt.Errorf("'%s' is a snapshotted volume, only non snapshotted volumes can be kept", path)
+		}
+		vols = append(vols, path)
+	}
+
+	if len(vols) > 0 && part.FileSystem != deployment.Btrfs {
+		return nil, fmt.Errorf("volumes can only be kept on a btrfs system partition")
+	}
+
+	return vols, nil
+}
+
+// resetPartitionVolumes deletes the top level volume of the given btrfs partition, including
+// all snapshots, and recreates the non snapshotted RW volumes. Volumes listed in keep are moved
+// out of the top level volume before deleting it and moved back once it has been recreated.
+// The swap file, if any, is recreated unless its volume is kept. The partition is left mounted at a
+// temporary directory until the given clean stack is executed.
+func resetPartitionVolumes(s *sys.System, cleanStack *cleanstack.CleanStack, device string, part *deployment.Partition, swapFile *deployment.SwapFile, keep []string) error {
+	mountPoint, err := vfs.TempDir(s.FS(), "", "elemental_"+part.Role.String())
+	if err != nil {
+		return fmt.Errorf("creating temporary directory to mount system partition: %w", err)
+	}
+	cleanStack.PushSuccessOnly(func() error { return s.FS().RemoveAll(mountPoint) })
+
+	// Mount the btrfs root, the default subvolume points to the current snapshot
+	err = s.Mounter().Mount(device, mountPoint, "", []string{"subvolid=5"})
+	if err != nil {
+		return fmt.Errorf("mounting partition '%s': %w", device, err)
+	}
+	cleanStack.Push(func() error { return s.Mounter().Unmount(mountPoint) })
+
+	topVol := filepath.Join(mountPoint, btrfs.TopSubVol)
+	keptDir := filepath.Join(mountPoint, keptVolsDir)
+	err = vfs.MkdirAll(s.FS(), keptDir, vfs.DirPerm)
+	if err != nil {
+		return fmt.Errorf("creating directory for kept volumes: %w", err)
+	}
+
+	for _, path := range keep {
+		s.Logger().Debug("Moving volume '%s' out of the top level volume", path)
+		err = moveVolume(s, filepath.Join(topVol, path), filepath.Join(keptDir, path))
+		if err != nil {
+			return fmt.Errorf("keeping volume '%s': %w", path, err)
+		}
+	}
+
+	err = btrfs.DeleteSubvolume(s, topVol)
+	if err != nil {
+		return fmt.Errorf("deleting top level volume: %w", err)
+	}
+	err = btrfs.CreateSubvolume(s, topVol, true)
+	if err != nil {
+		return fmt.Errorf("creating top level volume: %w", err)
+	}
+	err = btrfs.SetDefaultSubvolume(s, topVol)
+	if err != nil {
+		return err
+	}
+
+	for _, rwVol := range part.RWVolumes {
+		if rwVol.Snapshotted {
+			continue
+		}
+		subvolume := filepath.Join(topVol, rwVol.Path)
+		if slices.Contains(keep, rwVol.Path) {
+			err = moveVolume(s, filepath.Join(keptDir, rwVol.Path), subvolume)
+			if err != nil {
+				return fmt.Errorf("restoring volume '%s': %w", rwVol.Path, err)
+			}
+			continue
+		}
+		err = btrfs.CreateSubvolume(s, subvolume, true)
+		if err != nil {
+			return fmt.Errorf("creating subvolume '%s': %w", subvolume, err)
+		}
+	}
+
+	if swapFile != nil {
+		if rwVol := swapFile.GetVolume(part); rwVol != nil && !slices.Contains(keep, rwVol.Path) {
+			err = swap.CreateFile(s, filepath.Join(topVol, swapFile.Path), swapFile.Size)
+			if err != nil {
+				return fmt.Errorf("creating swap file: %w", err)
+			}
+		}
+	}
+
+	return s.FS().RemoveAll(keptDir)
+}
+
+// moveVolume renames the given subvolume to the target path, creating parent directories if needed
+func moveVolume(s *sys.System, source, target string) error {
+	err := vfs.MkdirAll(s.FS(), filepath.Dir(target), vfs.DirPerm)
+	if err != nil {
+		return fmt.Errorf("creating parent directory of '%s': %w", target, err)
+	}
+	return s.FS().Rename(source, target)
+}
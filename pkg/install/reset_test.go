@@ -0,0 +1,200 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/install"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+var _ = Describe("Reset", Label("reset"), func() {
+	var runner *sysmock.Runner
+	var mounter *sysmock.Mounter
+	var fs vfs.FS
+	var cleanup func()
+	var s *sys.System
+	var d *deployment.Deployment
+	var i *install.Installer
+	var upgrader *upgraderMock
+	var sideEffects map[string]func(...string) ([]byte, error)
+	BeforeEach(func() {
+		var err error
+		upgrader = &upgraderMock{}
+		runner = sysmock.NewRunner()
+		mounter = sysmock.NewMounter()
+		sideEffects = map[string]func(...string) ([]byte, error){}
+
+		fs, cleanup, err = sysmock.TestFS(map[string]any{
+			"/tmp/elemental_system/@/home/user/file": "user data",
+			"/tmp/elemental_system/@/var/log/file":   "log data",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		s, err = sys.NewSystem(
+			sys.WithMounter(mounter), sys.WithRunner(runner),
+			sys.WithFS(fs), sys.WithLogger(log.New(log.WithDiscardAll())),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		d = deployment.DefaultDeployment()
+		d.SourceOS = deployment.NewRawSrc("/run/initramfs/live/LiveOS/squashfs.img")
+		d.GetSystemPartition().UUID = "34a8abb8-ddb3-48a2-8ecc-2443e92c7510"
+		i = install.New(context.Background(), s, install.WithUpgrader(upgrader))
+
+		runner.SideEffect = func(cmd string, args ...string) ([]byte, error) {
+			if f := sideEffects[cmd]; f != nil {
+				return f(args...)
+			}
+			return runner.ReturnValue, runner.ReturnError
+		}
+		sideEffects["lsblk"] = func(args ...string) ([]byte, error) {
+			return []byte(lsblkJson), runner.ReturnError
+		}
+	})
+	AfterEach(func() {
+		cleanup()
+	})
+	It("formats the system partition if no volume is kept", func() {
+		Expect(i.Reset(d)).To(Succeed())
+		Expect(runner.MatchMilestones([][]string{
+			{"mkfs.btrfs", "-L", "SYSTEM", "-f", "/dev/device3"},
+			{"btrfs", "quota", "enable"},
+			{"btrfs", "subvolume", "create", "/tmp/elemental_system/@/home"},
+		})).To(Succeed())
+	})
+	It("keeps the given volumes and recreates the others", func() {
+		upgrader.Callback = func() {
+			data, err := fs.ReadFile("/tmp/elemental_system/@/home/user/file")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("user data"))
+			Expect(vfs.Exists(fs, "/tmp/elemental_system/elemental-reset")).To(BeFalse())
+		}
+		Expect(i.Reset(d, "home/")).To(Succeed())
+		Expect(mounter.IsMountPoint("/tmp/elemental_system")).To(BeFalse())
+		Expect(runner.MatchMilestones([][]string{
+			{"btrfs", "subvolume", "delete", "-c", "-R", "/tmp/elemental_system/@"},
+			{"btrfs", "subvolume", "create", "/tmp/elemental_system/@"},
+			{"btrfs", "subvolume", "set-default", "/tmp/elemental_system/@"},
+			{"btrfs", "subvolume", "create", "/tmp/elemental_system/@/var"},
+		})).To(Succeed())
+		Expect(runner.IncludesCmds([][]string{{"mkfs.btrfs"}})).NotTo(Succeed())
+		Expect(runner.IncludesCmds([][]string{
+			{"btrfs", "subvolume", "create", "/tmp/elemental_system/@/home"},
+		})).NotTo(Succeed())
+	})
+	It("recreates the swap file unless its volume is kept", func() {
+		d.Swap = &deployment.SwapConfig{File: &deployment.SwapFile{Path: "/var/swap/swapfile", Size: 512}}
+		Expect(i.Reset(d, "/home")).To(Succeed())
+		Expect(runner.MatchMilestones([][]string{
+			{"btrfs", "subvolume", "create", "/tmp/elemental_system/@/var"},
+			{"chattr", "+C", "/tmp/elemental_system/@/var/swap"},
+			{"btrfs", "filesystem", "mkswapfile", "--size", "512m", "/tmp/elemental_system/@/var/swap/swapfile"},
+		})).To(Succeed())
+
+		runner.ClearCmds()
+		Expect(vfs.MkdirAll(fs, "/tmp/elemental_system/@/var", vfs.DirPerm)).To(Succeed())
+		Expect(i.Reset(d, "/var")).To(Succeed())
+		Expect(runner.IncludesCmds([][]string{{"btrfs", "filesystem", "mkswapfile"}})).NotTo(Succeed())
+	})
+	It("fails to keep a snapshotted volume", func() {
+		err := i.Reset(d, "/etc")
+		Expect(err).To(MatchError(ContainSubstring("'/etc' is a snapshotted volume")))
+		Expect(runner.GetCmds()).To(BeEmpty())
+	})
+	It("fails to keep an unknown volume", func() {
+		err := i.Reset(d, "/data")
+		Expect(err).To(MatchError(ContainSubstring("'/data' is not a RW volume of the system partition")))
+	})
+	It("fails to keep volumes on a non btrfs system partition", func() {
+		d.GetSystemPartition().FileSystem = deployment.Ext4
+		err := i.Reset(d, "/home")
+		Expect(err).To(MatchError(ContainSubstring("volumes can only be kept on a btrfs system partition")))
+	})
+	It("fails if formatting the system partition fails", func() {
+		sideEffects["mkfs.btrfs"] = func(args ...string) ([]byte, error) {
+			return nil, fmt.Errorf("mkfs failed")
+		}
+		err := i.Reset(d)
+		Expect(err).To(MatchError("formatting partition '/dev/device3': mkfs failed"))
+	})
+	It("fails if deleting the top level volume fails", func() {
+		sideEffects["btrfs"] = func(args ...string) ([]byte, error) {
+			if slices.Contains(args, "delete") {
+				return nil, fmt.Errorf("delete failed")
+			}
+			return []byte{}, nil
+		}
+		err := i.Reset(d, "/home")
+		Expect(err).To(MatchError(ContainSubstring("deleting top level volume: delete failed")))
+	})
+	Describe("with an encrypted system partition", func() {
+		BeforeEach(func() {
+			d.GetSystemPartition().Encryption = &deployment.Encryption{KeyFile: "/etc/keyfile"}
+			sideEffects["cryptsetup"] = func(args ...string) ([]byte, error) {
+				if args[0] == "luksUUID" {
+					return []byte("1234\n"), nil
+				}
+				return []byte{}, nil
+			}
+			Expect(vfs.MkdirAll(fs, "/etc", vfs.DirPerm)).To(Succeed())
+			Expect(fs.WriteFile("/etc/keyfile", []byte("passphrase"), vfs.FilePerm)).To(Succeed())
+		})
+		It("formats the unlocked device", func() {
+			Expect(i.Reset(d)).To(Succeed())
+			Expect(d.GetSystemPartition().Encryption.UUID).To(Equal("1234"))
+			Expect(runner.MatchMilestones([][]string{
+				{"cryptsetup", "luksUUID", "/dev/device3"},
+				{"cryptsetup", "open", "--type", "luks2", "--key-file=/etc/keyfile", "/dev/device3", "luks-1234"},
+				{"mkfs.btrfs", "-L", "SYSTEM", "-f", "/dev/mapper/luks-1234"},
+				{"btrfs", "subvolume", "create", "/tmp/elemental_system/@/home"},
+				{"cryptsetup", "close", "luks-1234"},
+			})).To(Succeed())
+			Expect(runner.IncludesCmds([][]string{{"mkfs.btrfs", "-L", "SYSTEM", "-f", "/dev/device3"}})).NotTo(Succeed())
+			Expect(runner.IncludesCmds([][]string{{"systemd-cryptenroll"}})).NotTo(Succeed())
+		})
+		It("keeps volumes within the unlocked device", func() {
+			Expect(i.Reset(d, "/home")).To(Succeed())
+			Expect(runner.MatchMilestones([][]string{
+				{"cryptsetup", "open", "--type", "luks2", "--key-file=/etc/keyfile", "/dev/device3", "luks-1234"},
+				{"btrfs", "subvolume", "delete", "-c", "-R", "/tmp/elemental_system/@"},
+				{"cryptsetup", "close", "luks-1234"},
+			})).To(Succeed())
+			Expect(runner.IncludesCmds([][]string{{"mkfs.btrfs"}})).NotTo(Succeed())
+		})
+		It("fails if the key file is not found", func() {
+			Expect(fs.Remove("/etc/keyfile")).To(Succeed())
+			err := i.Reset(d)
+			Expect(err).To(MatchError(ContainSubstring("key file '/etc/keyfile' is required to unlock the partition")))
+			Expect(runner.IncludesCmds([][]string{{"mkfs.btrfs"}})).NotTo(Succeed())
+		})
+	})
+	It("fails if upgrader errors out", func() {
+		upgrader.Error = fmt.Errorf("transaction failed")
+		err := i.Reset(d)
+		Expect(err).To(MatchError("executing transaction: transaction failed"))
+	})
+})
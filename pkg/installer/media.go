@@ -42,19 +42,26 @@ const (
 	liveDir        = "LiveOS"
 	installDir     = "Install"
 	overlayDir     = "Overlay"
-	squashfsImg    = "squashfs.img"
 	installCfg     = "install.yaml"
 	isoBootCatalog = "boot.catalog"
 	cfgScript      = "setup.sh"
 	xorriso        = "xorriso"
 
 	LiveMountPoint  = "/run/initramfs/live"
-	SquashfsRelPath = liveDir + "/" + squashfsImg
+	SquashfsRelPath = liveDir + "/" + deployment.SquashfsImage
 	SquashfsPath    = LiveMountPoint + "/" + SquashfsRelPath
+	ErofsRelPath    = liveDir + "/" + deployment.ErofsImage
+	ErofsPath       = LiveMountPoint + "/" + ErofsRelPath
 	InstallDesc     = LiveMountPoint + "/" + installDir + "/" + installCfg
 	InstallScript   = LiveMountPoint + "/" + installDir + "/" + cfgScript
+	OverlayPath     = LiveMountPoint + "/" + installDir + "/" + overlayDir
 )
 
+// LiveImagePath returns the path of the OS image of the live media mounted at the given root
+func LiveImagePath(root string, img deployment.LiveImage) string {
+	return filepath.Join(root, liveDir, img.FileName())
+}
+
 type Option func(*ISO)
 
 type ISO struct {
@@ -180,7 +187,7 @@ func (i ISO) Build(d *deployment.Deployment) (err error) {
 		return fmt.Errorf("failed creating EFI image for the installer image: %w", err)
 	}
 
-	err = i.burnISO(isoDir, i.outputFile, efiImg)
+	err = i.burnISO(isoDir, i.outputFile, efiImg, d.IsBIOSEnabled())
 	if err != nil {
 		return fmt.Errorf("failed creating live iso image: %w", err)
 	}
@@ -197,13 +204,13 @@ func (i *ISO) PrepareInstallerFS(rootDir, workDir string, d *deployment.Deployme
 	if err != nil {
 		return fmt.Errorf("failed preparing ISO, could not create %s: %w", imgDir, err)
 	}
-	squashImg := filepath.Join(imgDir, squashfsImg)
+	liveImg := filepath.Join(imgDir, d.Installer.Image.FileName())
 
 	switch {
 	case d.SourceOS.IsRaw():
 		// We assume this is comming from a ready to be used installer media
 		// no need to unpack and repack
-		err = vfs.CopyFile(i.s.FS(), d.SourceOS.URI(), squashImg)
+		err = vfs.CopyFile(i.s.FS(), d.SourceOS.URI(), liveImg)
 		if err != nil {
 			return fmt.Errorf("failed copying OS image to installer root tree: %w", err)
 		}
@@ -212,9 +219,9 @@ func (i *ISO) PrepareInstallerFS(rootDir, workDir string, d *deployment.Deployme
 		if err != nil {
 			return fmt.Errorf("preparing unpack: %w", err)
 		}
-		err = filesystem.CreateSquashFS(i.ctx, i.s, workDir, squashImg, filesystem.DefaultSquashfsCompressionOptions())
+		err = i.createLiveImage(workDir, liveImg, d.Installer.Image)
 		if err != nil {
-			return fmt.Errorf("failed creating image (%s) for live ISO: %w", squashImg, err)
+			return fmt.Errorf("failed creating image (%s) for live ISO: %w", liveImg, err)
 		}
 	}
 
@@ -277,8 +284,11 @@ func (i *ISO) Customize(d *deployment.Deployment) (err error) {
 	m := map[string]string{}
 
 	if d.Installer.KernelCmdline != "" {
+		if installDesc.BootConfig != nil && installDesc.BootConfig.Bootloader == bootloader.BootSystemdBoot {
+			return fmt.Errorf("kernel command line of %s installers is embedded in the kernel image and can't be customized", bootloader.BootSystemdBoot)
+		}
 		grubEnvPath := filepath.Join(tempDir, "grubenv")
-		cmdline := strings.TrimSpace(fmt.Sprintf("%s %s", deployment.LiveKernelCmdline(i.Label), d.Installer.KernelCmdline))
+		cmdline := strings.TrimSpace(fmt.Sprintf("%s %s", deployment.LiveKernelCmdline(i.Label, installDesc.Installer.Image), d.Installer.KernelCmdline))
 		err = i.writeGrubEnv(grubEnvPath, map[string]string{"cmdline": cmdline})
 		if err != nil {
 			return fmt.Errorf("error writing %s: %s", grubEnvPath, err.Error())
@@ -426,19 +436,56 @@ func (i ISO) prepareOSRoot(sourceOS *deployment.ImageSource, rootDir string) err
 	return nil
 }
 
-// prepareEFI sets the root directory tree of the EFI partition
+// prepareEFI sets the root directory tree of the EFI partition. The EFI binaries are expected to be
+// already signed by the bootloader if Secure Boot signing is enabled. The loader directory, holding
+// the Secure Boot auto enrollment files, is included if present.
 func (i ISO) prepareEFI(isoDir, efiDir string) error {
 	i.s.Logger().Info("Preparing EFI partition at %s", efiDir)
 
-	err := vfs.MkdirAll(i.s.FS(), filepath.Join(efiDir, "EFI"), vfs.FilePerm)
-	if err != nil {
-		return fmt.Errorf("failed creating EFI directory tree: %w", err)
-	}
 	r := rsync.NewRsync(
 		i.s, rsync.WithFlags("--archive", "--recursive", "--no-links"),
 		rsync.WithContext(i.ctx),
 	)
-	return r.SyncData(filepath.Join(isoDir, "EFI"), filepath.Join(efiDir, "EFI"))
+	for _, dir := range []string{"EFI", "loader"} {
+		if ok, _ := vfs.Exists(i.s.FS(), filepath.Join(isoDir, dir)); !ok && dir != "EFI" {
+			continue
+		}
+
+		err := vfs.MkdirAll(i.s.FS(), filepath.Join(efiDir, dir), vfs.FilePerm)
+		if err != nil {
+			return fmt.Errorf("failed creating %s directory tree: %w", dir, err)
+		}
+		err = r.SyncData(filepath.Join(isoDir, dir), filepath.Join(efiDir, dir))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createLiveImage creates the compressed OS image of the live media from the given root tree
+func (i ISO) createLiveImage(rootDir, output string, img deployment.LiveImage) error {
+	if img.Format == deployment.EroFS {
+		opts := filesystem.DefaultErofsCompressionOptions()
+		switch img.Compression {
+		case deployment.NoCompression:
+			opts = nil
+		case "":
+		default:
+			opts = filesystem.ErofsCompressionOptions(img.Compression)
+		}
+		return filesystem.CreateEroFS(i.ctx, i.s, rootDir, output, opts)
+	}
+
+	opts := filesystem.DefaultSquashfsCompressionOptions()
+	switch img.Compression {
+	case deployment.NoCompression:
+		opts = filesystem.SquashfsNoCompressionOptions()
+	case "":
+	default:
+		opts = filesystem.SquashfsCompressionOptions(img.Compression)
+	}
+	return filesystem.CreateSquashFS(i.ctx, i.s, rootDir, output, opts)
 }
 
 // prepareISO sets the root directory three of the ISO filesystem
@@ -450,7 +497,7 @@ func (i ISO) prepareISO(isoDir, rootfs string, d *deployment.Deployment) error {
 		return fmt.Errorf("failed to populate ISO directory tree: %w", err)
 	}
 
-	cmdline := strings.TrimSpace(fmt.Sprintf("%s %s", deployment.LiveKernelCmdline(i.Label), d.Installer.KernelCmdline))
+	cmdline := strings.TrimSpace(fmt.Sprintf("%s %s", deployment.LiveKernelCmdline(i.Label, d.Installer.Image), d.Installer.KernelCmdline))
 	err = i.bl.InstallLive(rootfs, isoDir, cmdline)
 	if err != nil {
 		return fmt.Errorf("failed installing bootloader in ISO directory tree: %w", err)
@@ -531,6 +578,7 @@ func (i ISO) writeInstallDescription(installPath string, d *deployment.Deploymen
 	overlay := d.OverlayTree
 	installerScript := d.Installer.CfgScript
 	installerOverlay := d.Installer.OverlayTree
+	secureBoot := d.SecureBoot
 
 	if overlay != nil && !overlay.IsEmpty() {
 		switch {
@@ -554,8 +602,10 @@ func (i ISO) writeInstallDescription(installPath string, d *deployment.Deploymen
 		d.Installer.CfgScript = filepath.Join(LiveMountPoint, liveDir, cfgScript)
 	}
 
-	d.SourceOS = deployment.NewRawSrc(SquashfsPath)
+	d.SourceOS = deployment.NewRawSrc(LiveImagePath(LiveMountPoint, d.Installer.Image))
 	d.Installer.OverlayTree = deployment.NewDirSrc(LiveMountPoint)
+	// the Secure Boot keys are not included in the media, they have to be given at installation time
+	d.SecureBoot = d.SecureBoot.WithoutKeys()
 
 	installFile := filepath.Join(installPath, installCfg)
 	dBytes, err := yaml.Marshal(d)
@@ -574,17 +624,18 @@ func (i ISO) writeInstallDescription(installPath string, d *deployment.Deploymen
 	d.CfgScript = script
 	d.Installer.CfgScript = installerScript
 	d.Installer.OverlayTree = installerOverlay
+	d.SecureBoot = secureBoot
 
 	return nil
 }
 
 // burnISO creates the ISO image from the prepared data
-func (i ISO) burnISO(isoDir, output, efiImg string) error {
+func (i ISO) burnISO(isoDir, output, efiImg string, bios bool) error {
 	args := []string{
 		"-volid", "LIVE", "-padding", "0",
 		"-outdev", output, "-map", isoDir, "/", "-chmod", "0755", "--",
 	}
-	args = append(args, xorrisoBootloaderArgs(efiImg)...)
+	args = append(args, xorrisoBootloaderArgs(isoDir, efiImg, bios)...)
 
 	_, err := i.s.Runner().RunContext(i.ctx, xorriso, args...)
 	if err != nil {
@@ -605,17 +656,32 @@ func (i ISO) burnISO(isoDir, output, efiImg string) error {
 	return nil
 }
 
-// xorrisoBootloaderArgs returns a slice of flags for xorriso to defined a common bootloader parameters
-func xorrisoBootloaderArgs(efiImg string) []string {
+// xorrisoBootloaderArgs returns a slice of flags for xorriso to defined a common bootloader parameters.
+// If bios is set the legacy BIOS El Torito image and hybrid MBR are included before the EFI image.
+func xorrisoBootloaderArgs(isoDir, efiImg string, bios bool) []string {
 	args := []string{
 		"-append_partition", "2", "0xef", efiImg,
 		"-boot_image", "any", fmt.Sprintf("cat_path=%s", isoBootCatalog),
 		"-boot_image", "any", "cat_hidden=on",
+	}
+	if bios {
+		args = append(args,
+			"-boot_image", "grub", fmt.Sprintf("bin_path=%s", bootloader.BIOSEltoritoImg),
+			"-boot_image", "grub", fmt.Sprintf("grub2_mbr=%s", filepath.Join(isoDir, bootloader.BIOSHybridMBR)),
+			"-boot_image", "grub", "grub2_boot_info=on",
+			"-boot_image", "any", "platform_id=0x00",
+			"-boot_image", "any", "emul_type=no_emulation",
+			"-boot_image", "any", "load_size=2048",
+			"-boot_image", "any", "boot_info_table=on",
+			"-boot_image", "any", "next",
+		)
+	}
+	args = append(args,
 		"-boot_image", "any", "efi_path=--interval:appended_partition_2:all::",
 		"-boot_image", "any", "platform_id=0xef",
 		"-boot_image", "any", "appended_part_as=gpt",
 		"-boot_image", "any", "partition_offset=16",
-	}
+	)
 	return args
 }
 
@@ -107,6 +107,54 @@ var _ = Describe("Install", Label("install"), func() {
 			{"xorriso", "-volid", "LIVE", "-padding", "0", "-outdev", "/some/dir/build/installer.iso"},
 		}))
 	})
+	It("Creates an installation ISO with an erofs image", func() {
+		var installDesc []byte
+		sideEffects["xorriso"] = func(args ...string) ([]byte, error) {
+			var err error
+			installDesc, err = fs.ReadFile("/some/dir/build/elemental-installer/iso/Install/install.yaml")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fs.WriteFile("/some/dir/build/installer.iso", []byte("data"), vfs.FilePerm)).To(Succeed())
+			return []byte{}, nil
+		}
+
+		d.SourceOS = deployment.NewDirSrc("/some/root")
+		d.Installer.Image = deployment.LiveImage{Format: deployment.EroFS}
+
+		iso := installer.NewISO(context.Background(), s, installer.WithBootloader(bootloader.NewNone(s)))
+		iso.OutputDir = "/some/dir/build"
+
+		Expect(iso.Build(d)).To(Succeed())
+		Expect(runner.MatchMilestones([][]string{
+			{
+				"mkfs.erofs", "-zlz4hc", "/some/dir/build/elemental-installer/iso/LiveOS/erofs.img",
+				"/some/dir/build/elemental-installer/rootfs",
+			},
+			{"xorriso"},
+		})).To(Succeed())
+
+		Expect(string(installDesc)).To(ContainSubstring("/run/initramfs/live/LiveOS/erofs.img"))
+	})
+	It("Creates a legacy BIOS bootable installation ISO", func() {
+		var xorrisoArgs []string
+		sideEffects["xorriso"] = func(args ...string) ([]byte, error) {
+			xorrisoArgs = args
+			Expect(fs.WriteFile("/some/dir/build/installer.iso", []byte("data"), vfs.FilePerm)).To(Succeed())
+			return []byte{}, nil
+		}
+
+		d.SourceOS = deployment.NewDirSrc("/some/root")
+		deployment.WithBIOSPartition()(d)
+
+		iso := installer.NewISO(context.Background(), s, installer.WithBootloader(bootloader.NewNone(s)))
+		iso.OutputDir = "/some/dir/build"
+
+		Expect(iso.Build(d)).To(Succeed())
+		Expect(xorrisoArgs).To(ContainElements(
+			"bin_path=/boot/grub2/i386-pc/eltorito.img",
+			"grub2_mbr=/some/dir/build/elemental-installer/iso/boot/grub2/i386-pc/boot_hybrid.img",
+			"platform_id=0x00", "platform_id=0xef",
+		))
+	})
 	It("fails to create an ISO without an output directory defined", func() {
 		d.SourceOS = deployment.NewDirSrc("/some/root")
 		iso := installer.NewISO(context.Background(), s, installer.WithBootloader(bootloader.NewNone(s)))
@@ -195,6 +243,27 @@ var _ = Describe("Install", Label("install"), func() {
 
 		Expect(vfs.Exists(fs, "/some/dir/build/installer2.iso")).To(BeTrue())
 	})
+	It("fails to customize the kernel command line of a systemd-boot ISO", func() {
+		Expect(vfs.MkdirAll(fs, "/some/dir/build", vfs.DirPerm)).To(Succeed())
+
+		sideEffects["xorriso"] = func(args ...string) ([]byte, error) {
+			if i := slices.Index(args, "-extract"); i >= 0 {
+				return nil, fs.WriteFile(args[i+2], []byte("bootloader:\n  name: systemd-boot\n"), vfs.FilePerm)
+			}
+			return []byte{}, nil
+		}
+
+		_, err := fs.Create("/some/dir/installer.iso")
+		Expect(err).To(Succeed())
+
+		iso := installer.NewISO(context.Background(), s, installer.WithBootloader(bootloader.NewNone(s)))
+		iso.InputFile = "/some/dir/installer.iso"
+		iso.OutputDir = "/some/dir/build"
+		iso.Name = "installer2"
+
+		d.Installer.KernelCmdline = "console=ttyS0"
+		Expect(iso.Customize(d)).To(MatchError(ContainSubstring("can't be customized")))
+	})
 	It("fails to customize an iso that is not including an install.yaml file", func() {
 		Expect(vfs.MkdirAll(fs, "/some/dir/build", vfs.DirPerm)).To(Succeed())
 
@@ -0,0 +1,159 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package luks
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/sys"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+const (
+	CrypttabFile = "/etc/crypttab"
+
+	recoveryKeyPerm = 0600
+)
+
+// CrypttabLine is an entry of the crypttab file
+type CrypttabLine struct {
+	Name    string
+	Device  string
+	KeyFile string
+	Options []string
+}
+
+// GetUUID returns the UUID of the LUKS header of the given device
+func GetUUID(s *sys.System, device string) (string, error) {
+	out, err := s.Runner().Run("cryptsetup", "luksUUID", device)
+	if err != nil {
+		return "", fmt.Errorf("reading LUKS UUID of '%s': %w", device, err)
+	}
+	uuid := strings.TrimSpace(string(out))
+	if uuid == "" {
+		return "", fmt.Errorf("empty LUKS UUID for device '%s'", device)
+	}
+	return uuid, nil
+}
+
+// Enroll adds the recovery key and the TPM2 keyslots defined in the given encryption setup to the
+// given device. The device is unlocked with the encryption key file. The generated recovery key is
+// written to the configured recovery key file.
+func Enroll(s *sys.System, device string, enc *deployment.Encryption) error {
+	unlock := fmt.Sprintf("--unlock-key-file=%s", enc.KeyFile)
+
+	if enc.RecoveryKeyFile != "" {
+		s.Logger().Info("Enrolling recovery key for '%s'", device)
+		out, err := s.Runner().Run("systemd-cryptenroll", unlock, "--recovery-key", device)
+		if err != nil {
+			return fmt.Errorf("enrolling recovery key for '%s': %w", device, err)
+		}
+		err = s.FS().WriteFile(enc.RecoveryKeyFile, out, recoveryKeyPerm)
+		if err != nil {
+			return fmt.Errorf("writing recovery key file '%s': %w", enc.RecoveryKeyFile, err)
+		}
+	}
+
+	if enc.TPM2 != nil {
+		s.Logger().Info("Enrolling TPM2 keyslot for '%s'", device)
+		args := []string{unlock, fmt.Sprintf("--tpm2-device=%s", enc.TPM2.GetDevice())}
+		if len(enc.TPM2.PCRs) > 0 {
+			args = append(args, fmt.Sprintf("--tpm2-pcrs=%s", enc.TPM2.PCRList()))
+		}
+		args = append(args, device)
+		_, err := s.Runner().Run("systemd-cryptenroll", args...)
+		if err != nil {
+			return fmt.Errorf("enrolling TPM2 keyslot for '%s': %w", device, err)
+		}
+	}
+	return nil
+}
+
+// Open unlocks the given device with the encryption key file and maps it to the encryption
+// mapped device.
+func Open(s *sys.System, device string, enc *deployment.Encryption) error {
+	_, err := s.Runner().Run(
+		"cryptsetup", "open", "--type", "luks2", fmt.Sprintf("--key-file=%s", enc.KeyFile),
+		device, enc.MapperName(),
+	)
+	if err != nil {
+		return fmt.Errorf("unlocking device '%s': %w", device, err)
+	}
+	return nil
+}
+
+// Close locks the given mapped device
+func Close(s *sys.System, enc *deployment.Encryption) error {
+	_, err := s.Runner().Run("cryptsetup", "close", enc.MapperName())
+	if err != nil {
+		return fmt.Errorf("locking device '%s': %w", enc.MappedDevice(), err)
+	}
+	return nil
+}
+
+// PartitionDevice returns the device to mount for the given partition. Encrypted partitions
+// are mounted from their mapped device, any other partition from the given block device.
+func PartitionDevice(part *deployment.Partition, device string) string {
+	if part.Encryption != nil {
+		return part.Encryption.MappedDevice()
+	}
+	return device
+}
+
+// CrypttabLines returns the crypttab entries for the encrypted partitions of the given list.
+// Key files are not included, devices are unlocked with the TPM2 or a passphrase prompt at boot.
+func CrypttabLines(parts deployment.Partitions) []CrypttabLine {
+	var lines []CrypttabLine
+	for _, part := range parts {
+		if part.Encryption == nil {
+			continue
+		}
+		lines = append(lines, CrypttabLine{
+			Name:    part.Encryption.MapperName(),
+			Device:  fmt.Sprintf("UUID=%s", part.Encryption.UUID),
+			KeyFile: "none",
+			Options: part.Encryption.CrypttabOptions(),
+		})
+	}
+	return lines
+}
+
+// WriteCrypttab writes a crypttab file at the given location including the given lines
+func WriteCrypttab(s *sys.System, crypttabFile string, lines []CrypttabLine) (err error) {
+	var sb strings.Builder
+
+	tw := tabwriter.NewWriter(&sb, 1, 4, 1, ' ', 0)
+	for _, line := range lines {
+		_, err = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", line.Name, line.Device, line.KeyFile, strings.Join(line.Options, ","))
+		if err != nil {
+			return fmt.Errorf("writing crypttab line: %w", err)
+		}
+	}
+	if err = tw.Flush(); err != nil {
+		return fmt.Errorf("flushing crypttab content: %w", err)
+	}
+
+	err = s.FS().WriteFile(crypttabFile, []byte(sb.String()), vfs.FilePerm)
+	if err != nil {
+		return fmt.Errorf("writing file '%s': %w", crypttabFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package luks_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/luks"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+func TestLuksSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "LUKS test suite")
+}
+
+var _ = Describe("LUKS", Label("luks"), func() {
+	var runner *sysmock.Runner
+	var tfs vfs.FS
+	var s *sys.System
+	var cleanup func()
+	var enc *deployment.Encryption
+
+	BeforeEach(func() {
+		var err error
+		runner = sysmock.NewRunner()
+		tfs, cleanup, err = sysmock.TestFS(map[string]any{"/etc/keyfile": "secret"})
+		Expect(err).NotTo(HaveOccurred())
+		s, err = sys.NewSystem(
+			sys.WithFS(tfs), sys.WithRunner(runner),
+			sys.WithLogger(log.New(log.WithDiscardAll())),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		enc = &deployment.Encryption{KeyFile: "/etc/keyfile", UUID: "1234"}
+	})
+	AfterEach(func() {
+		cleanup()
+	})
+	It("reads the LUKS UUID of a device", func() {
+		runner.SideEffect = func(cmd string, args ...string) ([]byte, error) {
+			return []byte("1234\n"), nil
+		}
+		uuid, err := luks.GetUUID(s, "/dev/sda2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(uuid).To(Equal("1234"))
+		Expect(runner.CmdsMatch([][]string{{"cryptsetup", "luksUUID", "/dev/sda2"}})).To(Succeed())
+
+		runner.SideEffect = func(cmd string, args ...string) ([]byte, error) {
+			return nil, nil
+		}
+		_, err = luks.GetUUID(s, "/dev/sda2")
+		Expect(err).To(MatchError("empty LUKS UUID for device '/dev/sda2'"))
+	})
+	It("enrolls recovery key and TPM2 keyslots", func() {
+		runner.SideEffect = func(cmd string, args ...string) ([]byte, error) {
+			if cmd == "systemd-cryptenroll" && args[1] == "--recovery-key" {
+				return []byte("recovery-key\n"), nil
+			}
+			return nil, nil
+		}
+		enc.RecoveryKeyFile = "/recovery.key"
+		enc.TPM2 = &deployment.TPM2Binding{PCRs: []int{7}}
+
+		Expect(luks.Enroll(s, "/dev/sda2", enc)).To(Succeed())
+		Expect(runner.CmdsMatch([][]string{
+			{"systemd-cryptenroll", "--unlock-key-file=/etc/keyfile", "--recovery-key", "/dev/sda2"},
+			{"systemd-cryptenroll", "--unlock-key-file=/etc/keyfile", "--tpm2-device=auto", "--tpm2-pcrs=7", "/dev/sda2"},
+		})).To(Succeed())
+
+		data, err := tfs.ReadFile("/recovery.key")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("recovery-key\n"))
+	})
+	It("fails to enroll the TPM2 keyslot", func() {
+		runner.SideEffect = func(cmd string, args ...string) ([]byte, error) {
+			return nil, fmt.Errorf("no TPM2 device")
+		}
+		enc.TPM2 = &deployment.TPM2Binding{}
+
+		err := luks.Enroll(s, "/dev/sda2", enc)
+		Expect(err).To(MatchError("enrolling TPM2 keyslot for '/dev/sda2': no TPM2 device"))
+	})
+	It("opens and closes encrypted devices", func() {
+		Expect(luks.Open(s, "/dev/sda2", enc)).To(Succeed())
+		Expect(luks.Close(s, enc)).To(Succeed())
+		Expect(runner.CmdsMatch([][]string{
+			{"cryptsetup", "open", "--type", "luks2", "--key-file=/etc/keyfile", "/dev/sda2", "luks-1234"},
+			{"cryptsetup", "close", "luks-1234"},
+		})).To(Succeed())
+	})
+	It("resolves the device of a partition", func() {
+		part := &deployment.Partition{}
+		Expect(luks.PartitionDevice(part, "/dev/sda2")).To(Equal("/dev/sda2"))
+		part.Encryption = enc
+		Expect(luks.PartitionDevice(part, "/dev/sda2")).To(Equal("/dev/mapper/luks-1234"))
+	})
+	It("writes the crypttab file", func() {
+		parts := deployment.Partitions{
+			{Label: "EFI"},
+			{Label: "SYSTEM", Encryption: enc},
+			{Label: "DATA", Encryption: &deployment.Encryption{UUID: "5678", TPM2: &deployment.TPM2Binding{}}},
+		}
+		Expect(vfs.MkdirAll(tfs, "/etc", vfs.DirPerm)).To(Succeed())
+		Expect(luks.WriteCrypttab(s, luks.CrypttabFile, luks.CrypttabLines(parts))).To(Succeed())
+
+		data, err := tfs.ReadFile(luks.CrypttabFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal(
+			"luks-1234 UUID=1234 none luks\n" +
+				"luks-5678 UUID=5678 none luks,tpm2-device=auto\n",
+		))
+	})
+})
@@ -25,6 +25,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/suse/elemental/v3/pkg/manifest/api"
 	"github.com/suse/elemental/v3/pkg/manifest/api/core"
 )
 
@@ -73,6 +74,9 @@ var _ = Describe("ReleaseManifest", Label("release-manifest"), func() {
 		Expect(rm.Components.Systemd.Extensions[1].Name).To(Equal("rke2"))
 		Expect(rm.Components.Systemd.Extensions[1].Image).To(Equal("https://example.com/rke2-1.32_0.0.raw"))
 		Expect(rm.Components.Systemd.Extensions[1].Required).To(BeFalse())
+		Expect(rm.Components.Systemd.Extensions[1].Images).To(Equal([]api.ExtensionImage{
+			{Name: "pause", Image: "registry.com/rancher/mirrored-pause:3.6"},
+		}))
 
 		Expect(rm.Components.Helm).ToNot(BeNil())
 		Expect(len(rm.Components.Helm.Charts)).To(Equal(1))
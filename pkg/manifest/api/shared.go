@@ -102,4 +102,12 @@ type SystemdExtension struct {
 	Name     string `yaml:"name"`
 	Image    string `yaml:"image"`
 	Required bool   `yaml:"required"`
+	// Images lists the container images required by the workloads the extension ships,
+	// e.g. the core images of a Kubernetes distribution
+	Images []ExtensionImage `yaml:"images,omitempty"`
+}
+
+type ExtensionImage struct {
+	Name  string `yaml:"name"`
+	Image string `yaml:"image"`
 }
@@ -18,11 +18,13 @@ limitations under the License.
 package repart
 
 import (
+	"bytes"
 	_ "embed"
 	"encoding/json"
 	"fmt"
 	"io"
 	"path/filepath"
+	"slices"
 	"strings"
 	"text/template"
 
@@ -33,11 +35,31 @@ import (
 )
 
 const (
-	rootType = "root"
-	dataType = "linux-generic"
-	espType  = "esp"
+	rootType      = "root"
+	dataType      = "linux-generic"
+	espType       = "esp"
+	usrType       = "usr"
+	usrVerityType = "usr-verity"
+	biosType      = "21686148-6449-6e6f-744e-656564454649"
+	swapType      = "swap"
+
+	encryptKeyFile = "key-file"
 )
 
+// DropInsDir is the systemd-repart configuration directory of the installed system
+const DropInsDir = "/etc/repart.d"
+
+// imageSectorSize is the sector size of disk images created by systemd-repart
+const imageSectorSize = 512
+
+// PartitionContent defines how a partition of a disk image is populated
+type PartitionContent struct {
+	// CopyFiles is a systemd-repart CopyFiles= source, a directory tree copied into the new filesystem
+	CopyFiles string
+	// CopyBlocks is a filesystem image copied as is into the partition, no filesystem is created
+	CopyBlocks string
+}
+
 //go:embed templates/partition.conf.tpl
 var partTpl []byte
 
@@ -64,27 +86,20 @@ func PartitionAndFormatDevice(s *sys.System, d *deployment.Disk) (err error) {
 		return err
 	}
 
-	for i, part := range d.Partitions {
-		partConf := fmt.Sprintf("%d-%s.conf", i, part.Role.String())
-		file, err := s.FS().Create(filepath.Join(dir, partConf))
-		if err != nil {
-			return fmt.Errorf("failed creating systemd-repart configuration file '%s': %w", partConf, err)
-		}
-		err = CreatePartitionConf(file, part, "")
-		if err != nil {
-			return fmt.Errorf("failed generation of '%s' systemd-repart configuration file: %w", partConf, err)
-		}
-		err = file.Close()
-		if err != nil {
-			return fmt.Errorf("failed closing systemd-repart configuration file '%s': %w", partConf, err)
-		}
+	err = writePartitionConfs(s, dir, d, nil)
+	if err != nil {
+		return err
 	}
 
 	s.Logger().Info("Partitioning device '%s'", d.Device)
 	args := []string{
 		"--empty=force", "--json=pretty", fmt.Sprintf("--definitions=%s", dir),
-		"--dry-run=no", fmt.Sprintf("--sector-size=%d", sSize), d.Device,
+		"--dry-run=no", fmt.Sprintf("--sector-size=%d", sSize),
+	}
+	if keyFile := encryptionKeyFile(d); keyFile != "" {
+		args = append(args, fmt.Sprintf("--key-file=%s", keyFile))
 	}
+	args = append(args, d.Device)
 	out, err := s.Runner().RunEnv("systemd-repart", []string{"PATH=/sbin:/usr/sbin:/usr/bin:/bin"}, args...)
 	s.Logger().Debug("systemd-repart output:\n%s", string(out))
 	if err != nil {
@@ -110,33 +125,153 @@ func PartitionAndFormatDevice(s *sys.System, d *deployment.Disk) (err error) {
 	return nil
 }
 
+// WriteGrowDropIns writes the systemd-repart configuration of the given disk partitions to the
+// given root, so the partition set to grow is expanded to the available disk space on boot. Existing
+// partitions are not formatted again, hence the configuration only describes the partition layout.
+// Nothing is written if there is no partition set to grow.
+func WriteGrowDropIns(s *sys.System, root string, d *deployment.Disk) error {
+	if !slices.ContainsFunc(d.Partitions, func(p *deployment.Partition) bool { return p.Grow }) {
+		return nil
+	}
+
+	dir := filepath.Join(root, DropInsDir)
+	err := vfs.MkdirAll(s.FS(), dir, vfs.DirPerm)
+	if err != nil {
+		return fmt.Errorf("creating systemd-repart configuration directory: %w", err)
+	}
+
+	for i, part := range d.Partitions {
+		layout := &deployment.Partition{
+			Role: part.Role, Label: part.Label, Size: part.Size, Grow: part.Grow, Verity: part.Verity,
+		}
+		var buf bytes.Buffer
+		err = CreatePartitionConf(&buf, layout, "")
+		if err != nil {
+			return fmt.Errorf("failed generation of systemd-repart configuration for '%s': %w", part.Label, err)
+		}
+		partConf := filepath.Join(dir, fmt.Sprintf("%02d-%s.conf", i, part.Role.String()))
+		err = s.FS().WriteFile(partConf, buf.Bytes(), vfs.FilePerm)
+		if err != nil {
+			return fmt.Errorf("failed writing systemd-repart configuration file '%s': %w", partConf, err)
+		}
+	}
+	return nil
+}
+
+// CreateDiskImage creates a new disk image file of the given size including all the partitions of
+// the given disk. Partitions are created and populated offline, without attaching the image to a loop
+// device nor mounting any filesystem. The content of each partition is looked up by its UUID in the
+// given map, partitions without content are just formatted.
+func CreateDiskImage(s *sys.System, d *deployment.Disk, image string, size deployment.MiB, contents map[string]PartitionContent) (err error) {
+	dir, err := vfs.TempDir(s.FS(), "", "elemental-repart.d")
+	if err != nil {
+		return fmt.Errorf("failed creating a temporary directory for systemd-repart configuration: %w", err)
+	}
+	defer func() {
+		nErr := s.FS().RemoveAll(dir)
+		if err == nil && nErr != nil {
+			err = nErr
+		}
+	}()
+
+	s.Logger().Info("Creating systemd-repart configuration at %s", dir)
+	err = writePartitionConfs(s, dir, d, contents)
+	if err != nil {
+		return err
+	}
+
+	s.Logger().Info("Creating disk image '%s'", image)
+	args := []string{
+		"--empty=create", fmt.Sprintf("--size=%dM", size), "--offline=yes", fmt.Sprintf("--definitions=%s", dir),
+		"--dry-run=no", fmt.Sprintf("--sector-size=%d", imageSectorSize), image,
+	}
+	out, err := s.Runner().RunEnv("systemd-repart", []string{"PATH=/sbin:/usr/sbin:/usr/bin:/bin"}, args...)
+	s.Logger().Debug("systemd-repart output:\n%s", string(out))
+	if err != nil {
+		return fmt.Errorf("failed creating disk image '%s' with systemd-repart: %w", image, err)
+	}
+	return nil
+}
+
 // CreatePartitionConf writes a partition configuration for systemd-repart for the given partition
 func CreatePartitionConf(wr io.Writer, part *deployment.Partition, copyFiles string) error {
+	return createPartitionConf(wr, part, PartitionContent{CopyFiles: copyFiles})
+}
+
+// writePartitionConfs writes the systemd-repart configuration files of the partitions of the given
+// disk to the given directory
+func writePartitionConfs(s *sys.System, dir string, d *deployment.Disk, contents map[string]PartitionContent) error {
+	for i, part := range d.Partitions {
+		partConf := fmt.Sprintf("%d-%s.conf", i, part.Role.String())
+		file, err := s.FS().Create(filepath.Join(dir, partConf))
+		if err != nil {
+			return fmt.Errorf("failed creating systemd-repart configuration file '%s': %w", partConf, err)
+		}
+		err = createPartitionConf(file, part, contents[part.UUID])
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed generation of '%s' systemd-repart configuration file: %w", partConf, err)
+		}
+		err = file.Close()
+		if err != nil {
+			return fmt.Errorf("failed closing systemd-repart configuration file '%s': %w", partConf, err)
+		}
+	}
+	return nil
+}
+
+func createPartitionConf(wr io.Writer, part *deployment.Partition, content PartitionContent) error {
 	pType := roleToType(part.Role)
 	if pType == deployment.Unknown {
 		return fmt.Errorf("invalid partition role: %s", part.Role.String())
 	}
 
+	copyFiles := content.CopyFiles
 	if copyFiles != "" && !filepath.IsAbs(copyFiles) {
 		return fmt.Errorf("requires an absolute path to copy files from, given path is '%s'", copyFiles)
 	}
 
+	if content.CopyBlocks != "" && !filepath.IsAbs(content.CopyBlocks) {
+		return fmt.Errorf("requires an absolute path to copy blocks from, given path is '%s'", content.CopyBlocks)
+	}
+
 	values := struct {
-		Type      string
-		Format    string
-		Size      deployment.MiB
-		Label     string
-		UUID      string
-		CopyFiles string
-		ReadOnly  string
+		Type           string
+		Format         string
+		Size           deployment.MiB
+		Grow           bool
+		Label          string
+		UUID           string
+		CopyFiles      string
+		CopyBlocks     string
+		ReadOnly       string
+		Encrypt        string
+		Verity         string
+		VerityMatchKey string
 	}{
-		Type:      pType,
-		Format:    fileSystemToFormat(part.FileSystem),
-		Size:      part.Size,
-		Label:     part.Label,
-		UUID:      part.UUID,
-		CopyFiles: copyFiles,
-		ReadOnly:  readOnlyPart(part),
+		Type:       pType,
+		Format:     fileSystemToFormat(part.FileSystem),
+		Size:       part.Size,
+		Grow:       part.Grow,
+		Label:      part.Label,
+		UUID:       part.UUID,
+		CopyFiles:  copyFiles,
+		CopyBlocks: content.CopyBlocks,
+		ReadOnly:   readOnlyPart(part),
+	}
+	if content.CopyBlocks != "" {
+		// The partition is populated with an already formatted filesystem image
+		values.Format = ""
+	}
+	if part.Encryption != nil {
+		values.Encrypt = encryptKeyFile
+	}
+	if part.Verity != nil {
+		// Verity partitions are written on upgrades, they are created unformatted
+		values.Type = verityType(part.Verity.Type)
+		values.Format = ""
+		values.Verity = part.Verity.Type
+		values.VerityMatchKey = part.Verity.Slot
 	}
 
 	partCfg := template.New("partition")
@@ -156,11 +291,22 @@ func roleToType(role deployment.PartRole) string {
 		return espType
 	case deployment.System:
 		return rootType
+	case deployment.BIOS:
+		return biosType
+	case deployment.Swap:
+		return swapType
 	default:
 		return deployment.Unknown
 	}
 }
 
+func verityType(vType string) string {
+	if vType == deployment.VerityHash {
+		return usrVerityType
+	}
+	return usrType
+}
+
 func fileSystemToFormat(f deployment.FileSystem) string {
 	switch {
 	case f.String() == deployment.Unknown:
@@ -178,3 +324,13 @@ func readOnlyPart(part *deployment.Partition) string {
 	}
 	return ""
 }
+
+// encryptionKeyFile returns the key file of the encrypted partitions of the given disk, if any
+func encryptionKeyFile(d *deployment.Disk) string {
+	for _, part := range d.Partitions {
+		if part.Encryption != nil {
+			return part.Encryption.KeyFile
+		}
+	}
+	return ""
+}
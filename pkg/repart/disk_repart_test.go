@@ -19,12 +19,19 @@ package repart_test
 
 import (
 	"bytes"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+
 	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/log"
 	"github.com/suse/elemental/v3/pkg/repart"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
 )
 
 func TestRepartSuite(t *testing.T) {
@@ -61,6 +68,113 @@ var _ = Describe("Systemd-repart tests", Label("systemd-repart"), func() {
 		Expect(buffer.String()).To(ContainSubstring("CopyFiles=/some/root:/"))
 		Expect(buffer.String()).To(ContainSubstring("ReadOnly=on"))
 		Expect(buffer.String()).ToNot(ContainSubstring("UUID"))
+		Expect(buffer.String()).ToNot(ContainSubstring("Encrypt"))
+
+		buffer.Reset()
+		part.Encryption = &deployment.Encryption{KeyFile: "/etc/keyfile"}
+		Expect(repart.CreatePartitionConf(&buffer, &part, "")).To(Succeed())
+		Expect(buffer.String()).To(ContainSubstring("Encrypt=key-file"))
+		Expect(buffer.String()).ToNot(ContainSubstring("Verity"))
+
+		buffer.Reset()
+		part = deployment.Partition{
+			Label:      "USR_A_VERITY",
+			Role:       deployment.Data,
+			FileSystem: deployment.Btrfs,
+			Verity:     &deployment.VerityPartition{Type: deployment.VerityHash, Slot: "a"},
+		}
+		Expect(repart.CreatePartitionConf(&buffer, &part, "")).To(Succeed())
+		Expect(buffer.String()).To(ContainSubstring("Type=usr-verity"))
+		Expect(buffer.String()).To(ContainSubstring("Verity=hash"))
+		Expect(buffer.String()).To(ContainSubstring("VerityMatchKey=a"))
+		Expect(buffer.String()).ToNot(ContainSubstring("Format"))
+
+		buffer.Reset()
+		part = deployment.Partition{Label: "BIOS", Role: deployment.BIOS, Size: 1}
+		Expect(repart.CreatePartitionConf(&buffer, &part, "")).To(Succeed())
+		Expect(buffer.String()).To(ContainSubstring("Type=21686148-6449-6e6f-744e-656564454649"))
+		Expect(buffer.String()).ToNot(ContainSubstring("Format"))
+
+		buffer.Reset()
+		part = deployment.Partition{Label: "SWAP", Role: deployment.Swap, FileSystem: deployment.SwapFS, Size: 2048}
+		Expect(repart.CreatePartitionConf(&buffer, &part, "")).To(Succeed())
+		Expect(buffer.String()).To(ContainSubstring("Type=swap"))
+		Expect(buffer.String()).To(ContainSubstring("Format=swap"))
+
+		buffer.Reset()
+		part = deployment.Partition{Label: "SYSTEM", Role: deployment.System, Size: 4096, Grow: true}
+		Expect(repart.CreatePartitionConf(&buffer, &part, "")).To(Succeed())
+		Expect(buffer.String()).To(ContainSubstring("SizeMinBytes=4096M"))
+		Expect(buffer.String()).ToNot(ContainSubstring("SizeMaxBytes"))
+		Expect(buffer.String()).To(ContainSubstring("GrowFileSystem=on"))
+	})
+
+	It("writes the systemd-repart drop-ins of a disk with a partition to grow", func() {
+		tfs, cleanup, err := sysmock.TestFS(nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer cleanup()
+		s, err := sys.NewSystem(sys.WithFS(tfs), sys.WithLogger(log.New(log.WithDiscardAll())))
+		Expect(err).NotTo(HaveOccurred())
+
+		d := deployment.DefaultDeployment()
+		disk := d.GetSystemDisk()
+		disk.GetSystemPartition().Encryption = &deployment.Encryption{KeyFile: "/etc/keyfile"}
+		Expect(repart.WriteGrowDropIns(s, "/root", disk)).To(Succeed())
+		Expect(vfs.Exists(tfs, "/root/etc/repart.d")).To(BeFalse())
+
+		disk.Partitions[1].Grow = true
+		Expect(repart.WriteGrowDropIns(s, "/root", disk)).To(Succeed())
+
+		data, err := tfs.ReadFile("/root/etc/repart.d/00-efi.conf")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("Type=esp"))
+		Expect(string(data)).To(ContainSubstring("SizeMaxBytes=1024M"))
+		Expect(string(data)).ToNot(ContainSubstring("Format"))
+
+		data, err = tfs.ReadFile("/root/etc/repart.d/01-system.conf")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("Type=root"))
+		Expect(string(data)).To(ContainSubstring("GrowFileSystem=on"))
+		Expect(string(data)).ToNot(ContainSubstring("Encrypt"))
+	})
+
+	It("creates a disk image offline", func() {
+		tfs, cleanup, err := sysmock.TestFS(nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer cleanup()
+		runner := sysmock.NewRunner()
+		s, err := sys.NewSystem(sys.WithFS(tfs), sys.WithRunner(runner), sys.WithLogger(log.New(log.WithDiscardAll())))
+		Expect(err).NotTo(HaveOccurred())
+
+		disk := deployment.DefaultDeployment().GetSystemDisk()
+		disk.Partitions[0].UUID = "efi-uuid"
+		disk.Partitions[1].UUID = "system-uuid"
+		contents := map[string]repart.PartitionContent{
+			"efi-uuid":    {CopyFiles: "/staging/efi:/"},
+			"system-uuid": {CopyBlocks: "/staging/system.img"},
+		}
+
+		var efiConf, systemConf []byte
+		runner.SideEffect = func(cmd string, args ...string) ([]byte, error) {
+			if cmd == "systemd-repart" {
+				dir := strings.TrimPrefix(args[3], "--definitions=")
+				efiConf, _ = tfs.ReadFile(filepath.Join(dir, "0-efi.conf"))
+				systemConf, _ = tfs.ReadFile(filepath.Join(dir, "1-system.conf"))
+			}
+			return []byte{}, nil
+		}
+
+		Expect(repart.CreateDiskImage(s, disk, "/build/disk.raw", 8192, contents)).To(Succeed())
+		Expect(runner.MatchMilestones([][]string{{
+			"systemd-repart", "--empty=create", "--size=8192M", "--offline=yes",
+		}})).To(Succeed())
+		Expect(runner.GetCmds()[0]).To(ContainElement("/build/disk.raw"))
+
+		Expect(string(efiConf)).To(ContainSubstring("Format=vfat"))
+		Expect(string(efiConf)).To(ContainSubstring("CopyFiles=/staging/efi:/"))
+		Expect(string(efiConf)).To(ContainSubstring("UUID=efi-uuid"))
+		Expect(string(systemConf)).To(ContainSubstring("CopyBlocks=/staging/system.img"))
+		Expect(string(systemConf)).ToNot(ContainSubstring("Format"))
 	})
 
 	It("fails to create partition configuration with invalid data", func() {
@@ -5,8 +5,13 @@ Format={{ .Format }}
 {{- end }}
 {{- if .Size }}
 SizeMinBytes={{ .Size }}M
+{{- if not .Grow }}
 SizeMaxBytes={{ .Size }}M
 {{- end }}
+{{- end }}
+{{- if .Grow }}
+GrowFileSystem=on
+{{- end }}
 {{- if .Label }}
 Label={{ .Label }}
 {{- end }}
@@ -16,6 +21,16 @@ UUID={{ .UUID }}
 {{- if .CopyFiles }}
 CopyFiles={{ .CopyFiles }}
 {{- end }}
+{{- if .CopyBlocks }}
+CopyBlocks={{ .CopyBlocks }}
+{{- end }}
 {{- if .ReadOnly }}
 ReadOnly={{ .ReadOnly }}
+{{- end }}
+{{- if .Encrypt }}
+Encrypt={{ .Encrypt }}
+{{- end }}
+{{- if .Verity }}
+Verity={{ .Verity }}
+VerityMatchKey={{ .VerityMatchKey }}
 {{- end }}
\ No newline at end of file
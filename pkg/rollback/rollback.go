@@ -0,0 +1,113 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rollback
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/suse/elemental/v3/pkg/bootloader"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/sys"
+	"github.com/suse/elemental/v3/pkg/transaction"
+)
+
+type Option func(*Rollbacker)
+
+type Rollbacker struct {
+	ctx context.Context
+	s   *sys.System
+	t   transaction.Interface
+	b   bootloader.Bootloader
+}
+
+func WithTransaction(t transaction.Interface) Option {
+	return func(r *Rollbacker) {
+		r.t = t
+	}
+}
+
+func WithBootloader(b bootloader.Bootloader) Option {
+	return func(r *Rollbacker) {
+		r.b = b
+	}
+}
+
+func New(ctx context.Context, s *sys.System, opts ...Option) *Rollbacker {
+	r := &Rollbacker{
+		s:   s,
+		ctx: ctx,
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	if r.t == nil {
+		r.t = transaction.NewSnapper(ctx, s)
+	}
+	if r.b == nil {
+		r.b = bootloader.NewNone(s)
+	}
+	return r
+}
+
+// Rollback sets the snapshot of the given ID as the default one and points the default
+// boot entry to it. If the ID is zero the snapshot previous to the current default one is
+// used. The given deployment is the one of the running system.
+func (r Rollbacker) Rollback(d *deployment.Deployment, id int) error {
+	esp := d.GetEfiPartition()
+	if esp == nil {
+		return fmt.Errorf("no EFI partition defined in deployment")
+	}
+
+	_, err := r.t.Init(*d)
+	if err != nil {
+		return fmt.Errorf("initializing transaction: %w", err)
+	}
+
+	trans, err := r.t.RollbackTo(id)
+	if err != nil {
+		return fmt.Errorf("rolling back snapshot: %w", err)
+	}
+
+	err = r.b.SetDefaultEntry(filepath.Join("/", esp.MountPoint), strconv.Itoa(trans.ID))
+	if err != nil {
+		return fmt.Errorf("setting default boot entry: %w", err)
+	}
+
+	target, err := deployment.Parse(r.s, trans.Path)
+	if err != nil {
+		return fmt.Errorf("parsing deployment of snapshot %d: %w", trans.ID, err)
+	} else if target == nil {
+		r.s.Logger().Warn("No deployment file found in snapshot %d, skipping rollback record", trans.ID)
+		return nil
+	}
+
+	target.Rollback = &deployment.RollbackInfo{
+		Date: time.Now().UTC().Format(time.RFC3339),
+		From: d.SourceOS,
+	}
+	err = target.WriteDeploymentFile(r.s, trans.Path)
+	if err != nil {
+		return fmt.Errorf("writing deployment file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rollback_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/rollback"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+	"github.com/suse/elemental/v3/pkg/transaction"
+	transmock "github.com/suse/elemental/v3/pkg/transaction/mock"
+)
+
+func TestRollbackSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Rollback test suite")
+}
+
+var _ = Describe("Rollback", Label("rollback"), func() {
+	var fs vfs.FS
+	var cleanup func()
+	var s *sys.System
+	var d *deployment.Deployment
+	var r *rollback.Rollbacker
+	var t *transmock.Transactioner
+
+	BeforeEach(func() {
+		var err error
+		t = &transmock.Transactioner{}
+		fs, cleanup, err = sysmock.TestFS(map[string]any{
+			"/snapshot/path/empty": []byte{},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		s, err = sys.NewSystem(
+			sys.WithFS(fs), sys.WithLogger(log.New(log.WithDiscardAll())),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		d = deployment.DefaultDeployment()
+		d.SourceOS = deployment.NewOCISrc("registry.org/my/os:v2")
+		Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+
+		target := deployment.DefaultDeployment()
+		target.SourceOS = deployment.NewOCISrc("registry.org/my/os:v1")
+		Expect(target.WriteDeploymentFile(s, "/snapshot/path")).To(Succeed())
+
+		r = rollback.New(context.Background(), s, rollback.WithTransaction(t))
+		t.Trans = &transaction.Transaction{
+			ID:   2,
+			Path: "/snapshot/path",
+		}
+	})
+	AfterEach(func() {
+		cleanup()
+	})
+	It("rolls back and records it in the deployment file of the target snapshot", func() {
+		Expect(r.Rollback(d, 2)).To(Succeed())
+
+		target, err := deployment.Parse(s, "/snapshot/path")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(target.SourceOS.String()).To(Equal("oci://registry.org/my/os:v1"))
+		Expect(target.Rollback).NotTo(BeNil())
+		Expect(target.Rollback.Date).NotTo(BeEmpty())
+		Expect(target.Rollback.From.String()).To(Equal("oci://registry.org/my/os:v2"))
+	})
+	It("rolls back even if the target snapshot has no deployment file", func() {
+		Expect(fs.RemoveAll("/snapshot/path/etc")).To(Succeed())
+		Expect(r.Rollback(d, 2)).To(Succeed())
+	})
+	It("fails on transaction initialization", func() {
+		t.InitErr = fmt.Errorf("init failed")
+		Expect(r.Rollback(d, 2)).To(MatchError("initializing transaction: init failed"))
+	})
+	It("fails if the snapshotter can't roll back", func() {
+		t.RollbackToErr = fmt.Errorf("not supported")
+		Expect(r.Rollback(d, 2)).To(MatchError("rolling back snapshot: not supported"))
+	})
+	It("fails if there is no EFI partition", func() {
+		d.Disks[0].Partitions = d.Disks[0].Partitions[1:]
+		Expect(r.Rollback(d, 2)).To(MatchError("no EFI partition defined in deployment"))
+	})
+})
@@ -0,0 +1,129 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secureboot
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/sys"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+// EnrollKeysDir is the ESP directory of the auto enrollment files, as expected by systemd-boot
+const EnrollKeysDir = "/loader/keys/elemental"
+
+var enrollFiles = []string{"PK.auth", "KEK.auth", "db.auth"}
+
+// Sign signs the given EFI binaries in place with the Secure Boot key and verifies the result
+// against the certificate.
+func Sign(s *sys.System, sb *deployment.SecureBoot, files ...string) error {
+	for _, file := range files {
+		s.Logger().Info("Signing '%s'", file)
+
+		signed := file + ".signed"
+		out, err := s.Runner().Run("sbsign", "--key", sb.Key, "--cert", sb.Cert, "--output", signed, file)
+		s.Logger().Debug("sbsign output: %s", string(out))
+		if err != nil {
+			return fmt.Errorf("signing '%s': %w", file, err)
+		}
+
+		err = s.FS().Rename(signed, file)
+		if err != nil {
+			return fmt.Errorf("replacing '%s' with its signed copy: %w", file, err)
+		}
+	}
+
+	return Verify(s, sb, files...)
+}
+
+// SignKernel signs the given kernel in place and refreshes its FIPS .hmac file, if any, as the
+// signature changes the kernel image.
+func SignKernel(s *sys.System, sb *deployment.SecureBoot, kernel string) error {
+	err := Sign(s, sb, kernel)
+	if err != nil {
+		return err
+	}
+
+	hmac, err := vfs.FindKernelHmac(s.FS(), kernel)
+	if err != nil {
+		// no FIPS hmac to refresh
+		return nil
+	}
+
+	out, err := s.Runner().Run("sha512hmac", kernel)
+	if err != nil {
+		return fmt.Errorf("computing hmac of '%s': %w", kernel, err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return fmt.Errorf("empty hmac for '%s'", kernel)
+	}
+
+	err = s.FS().WriteFile(hmac, fmt.Appendf(nil, "%s  %s\n", fields[0], filepath.Base(kernel)), vfs.FilePerm)
+	if err != nil {
+		return fmt.Errorf("writing hmac file '%s': %w", hmac, err)
+	}
+	return nil
+}
+
+// Verify checks the given EFI binaries are signed by the Secure Boot certificate
+func Verify(s *sys.System, sb *deployment.SecureBoot, files ...string) error {
+	for _, file := range files {
+		out, err := s.Runner().Run("sbverify", "--cert", sb.Cert, file)
+		s.Logger().Debug("sbverify output: %s", string(out))
+		if err != nil {
+			return fmt.Errorf("verifying signature of '%s': %w", file, err)
+		}
+	}
+	return nil
+}
+
+// InstallEnrollFiles copies the signed EFI variable updates of the enrollment directory into the
+// given ESP. Nothing is installed if no enrollment directory is set.
+func InstallEnrollFiles(s *sys.System, sb *deployment.SecureBoot, espDir string) error {
+	if sb.EnrollDir == "" {
+		return nil
+	}
+
+	targetDir := filepath.Join(espDir, EnrollKeysDir)
+	err := vfs.MkdirAll(s.FS(), targetDir, vfs.DirPerm)
+	if err != nil {
+		return fmt.Errorf("creating dir '%s': %w", targetDir, err)
+	}
+
+	installed := 0
+	for _, name := range enrollFiles {
+		src := filepath.Join(sb.EnrollDir, name)
+		if ok, _ := vfs.Exists(s.FS(), src); !ok {
+			continue
+		}
+		err = vfs.CopyFile(s.FS(), src, filepath.Join(targetDir, name))
+		if err != nil {
+			return fmt.Errorf("copying file '%s': %w", src, err)
+		}
+		installed++
+	}
+
+	if installed == 0 {
+		return fmt.Errorf("no enrollment files found in '%s'", sb.EnrollDir)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secureboot_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/secureboot"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+func TestSecureBootSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Secure Boot test suite")
+}
+
+var _ = Describe("Secure Boot", Label("secureboot"), func() {
+	var runner *sysmock.Runner
+	var tfs vfs.FS
+	var s *sys.System
+	var cleanup func()
+	var sb *deployment.SecureBoot
+
+	BeforeEach(func() {
+		var err error
+		runner = sysmock.NewRunner()
+		tfs, cleanup, err = sysmock.TestFS(map[string]any{
+			"/esp/EFI/BOOT/bootx64.efi":     "shim",
+			"/esp/vmlinuz":                  "kernel",
+			"/esp/.vmlinuz.hmac":            "old  vmlinuz\n",
+			"/etc/secureboot/db.auth":       "db",
+			"/etc/secureboot/KEK.auth":      "kek",
+			"/etc/secureboot/not-used.auth": "other",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		s, err = sys.NewSystem(
+			sys.WithFS(tfs), sys.WithRunner(runner),
+			sys.WithLogger(log.New(log.WithDiscardAll())),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		sb = &deployment.SecureBoot{Key: "/etc/secureboot/db.key", Cert: "/etc/secureboot/db.crt"}
+
+		runner.SideEffect = func(cmd string, args ...string) ([]byte, error) {
+			switch cmd {
+			case "sbsign":
+				return nil, tfs.WriteFile(args[5], []byte("signed"), vfs.FilePerm)
+			case "sha512hmac":
+				return []byte("newhmac  " + args[0] + "\n"), nil
+			}
+			return nil, nil
+		}
+	})
+	AfterEach(func() {
+		cleanup()
+	})
+	It("signs and verifies EFI binaries in place", func() {
+		Expect(secureboot.Sign(s, sb, "/esp/EFI/BOOT/bootx64.efi")).To(Succeed())
+		Expect(runner.CmdsMatch([][]string{
+			{"sbsign", "--key", "/etc/secureboot/db.key", "--cert", "/etc/secureboot/db.crt", "--output", "/esp/EFI/BOOT/bootx64.efi.signed", "/esp/EFI/BOOT/bootx64.efi"},
+			{"sbverify", "--cert", "/etc/secureboot/db.crt", "/esp/EFI/BOOT/bootx64.efi"},
+		})).To(Succeed())
+
+		data, err := tfs.ReadFile("/esp/EFI/BOOT/bootx64.efi")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("signed"))
+		Expect(vfs.Exists(tfs, "/esp/EFI/BOOT/bootx64.efi.signed")).To(BeFalse())
+	})
+	It("refreshes the FIPS hmac of signed kernels", func() {
+		Expect(secureboot.SignKernel(s, sb, "/esp/vmlinuz")).To(Succeed())
+		data, err := tfs.ReadFile("/esp/.vmlinuz.hmac")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("newhmac  vmlinuz\n"))
+	})
+	It("fails if the signature can't be verified", func() {
+		runner.SideEffect = func(cmd string, args ...string) ([]byte, error) {
+			if cmd == "sbverify" {
+				return nil, fmt.Errorf("invalid signature")
+			}
+			return nil, tfs.WriteFile(args[5], []byte("signed"), vfs.FilePerm)
+		}
+		err := secureboot.Sign(s, sb, "/esp/EFI/BOOT/bootx64.efi")
+		Expect(err).To(MatchError("verifying signature of '/esp/EFI/BOOT/bootx64.efi': invalid signature"))
+	})
+	It("installs the auto enrollment files", func() {
+		Expect(secureboot.InstallEnrollFiles(s, sb, "/esp")).To(Succeed())
+		Expect(vfs.Exists(tfs, "/esp/loader/keys/elemental")).To(BeFalse())
+
+		sb.EnrollDir = "/etc/secureboot"
+		Expect(secureboot.InstallEnrollFiles(s, sb, "/esp")).To(Succeed())
+		Expect(vfs.Exists(tfs, "/esp/loader/keys/elemental/db.auth")).To(BeTrue())
+		Expect(vfs.Exists(tfs, "/esp/loader/keys/elemental/KEK.auth")).To(BeTrue())
+		Expect(vfs.Exists(tfs, "/esp/loader/keys/elemental/PK.auth")).To(BeFalse())
+		Expect(vfs.Exists(tfs, "/esp/loader/keys/elemental/not-used.auth")).To(BeFalse())
+
+		sb.EnrollDir = "/etc"
+		err := secureboot.InstallEnrollFiles(s, sb, "/esp")
+		Expect(err).To(MatchError("no enrollment files found in '/etc'"))
+	})
+})
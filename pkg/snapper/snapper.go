@@ -19,10 +19,14 @@ package snapper
 
 import (
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/suse/elemental/v3/pkg/btrfs"
 	"github.com/suse/elemental/v3/pkg/sys"
@@ -36,8 +40,14 @@ const (
 
 	snapperDefaultConfig = "/etc/default/snapper"
 	snapperSysconfig     = "/etc/sysconfig/snapper"
-	snapperRootConfig    = "/etc/snapper/configs/" + rootConfig
+	snapperConfigsDir    = "/etc/snapper/configs"
+	snapperRootConfig    = snapperConfigsDir + "/" + rootConfig
 	rootConfig           = "root"
+	dateLayout           = "2006-01-02 15:04:05"
+	infoFile             = "info.xml"
+
+	// Pinned is the metadata key of snapshots excluded from any cleanup
+	Pinned = "pinned"
 )
 
 type Snapper struct {
@@ -46,13 +56,59 @@ type Snapper struct {
 
 type Snapshot struct {
 	Number   int      `json:"number"`
+	Date     string   `json:"date,omitempty"`
 	Default  bool     `json:"default"`
 	Active   bool     `json:"active"`
 	UserData Metadata `json:"userdata,omitempty"`
 }
 
+// IsPinned returns true if the snapshot is pinned and hence never cleaned up
+func (s Snapshot) IsPinned() bool {
+	return s.UserData[Pinned] == "yes"
+}
+
+// Age returns the time elapsed since the snapshot was created, zero if the creation date is unknown
+func (s Snapshot) Age() time.Duration {
+	date, err := time.ParseInLocation(dateLayout, s.Date, time.Local)
+	if err != nil {
+		return 0
+	}
+	return time.Since(date)
+}
+
+// Retention sets the snapshots kept on cleanup, pinned, default and active snapshots are always kept
+type Retention struct {
+	// MaxSnapshots is the maximum number of unpinned snapshots to keep, zero means no limit
+	MaxSnapshots int
+	// MaxAge is the maximum age of unpinned snapshots to keep, zero means no limit
+	MaxAge time.Duration
+}
+
 type Metadata map[string]string
 
+// Change is a file change between two snapshots as reported by 'snapper status'
+type Change struct {
+	// Flags are the status flags reported by snapper, e.g. 'c.....' for a file with modified content
+	Flags string `json:"flags"`
+	// Path is the absolute path of the changed file
+	Path string `json:"path"`
+}
+
+// Created returns true if the file was created
+func (c Change) Created() bool {
+	return strings.HasPrefix(c.Flags, "+")
+}
+
+// Deleted returns true if the file was deleted
+func (c Change) Deleted() bool {
+	return strings.HasPrefix(c.Flags, "-")
+}
+
+// ContentChanged returns true if the file was created, deleted or its content modified
+func (c Change) ContentChanged() bool {
+	return strings.HasPrefix(c.Flags, "c") || c.Created() || c.Deleted()
+}
+
 type Snapshots []*Snapshot
 
 func (s Snapshots) GetDefault() int {
@@ -73,6 +129,16 @@ func (s Snapshots) GetActive() int {
 	return 0
 }
 
+// Get returns the snapshot with the given number, nil if not found
+func (s Snapshots) Get(id int) *Snapshot {
+	for _, snap := range s {
+		if snap.Number == id {
+			return snap
+		}
+	}
+	return nil
+}
+
 func (s Snapshots) GetWithUserdata(key, value string) []int {
 	ids := []int{}
 	for _, snap := range s {
@@ -125,7 +191,7 @@ func (sn Snapper) ListSnapshots(root string, config string) (Snapshots, error) {
 	if config == "" {
 		config = root
 	}
-	args = append(args, "-c", config, "--jsonout", "list", "--columns", "number,default,active,userdata")
+	args = append(args, "-c", config, "--jsonout", "list", "--columns", "number,date,default,active,userdata")
 	cmdOut, err := sn.s.Runner().Run("snapper", args...)
 	if err != nil {
 		return nil, fmt.Errorf("collecting snapshots: %s: %w", string(cmdOut), err)
@@ -206,58 +272,94 @@ func (sn Snapper) CreateSnapshot(root string, config string, base int, rw bool,
 }
 
 func (sn Snapper) SetPermissions(root string, id int, rw bool) error {
-	args := []string{"--no-dbus"}
-
-	if root != "" && root != "/" {
-		args = append(args, "--root", root)
-	}
-	args = append(args, "modify")
+	flag := "--read-only"
 	if rw {
-		args = append(args, "--read-write")
-	} else {
-		args = append(args, "--read-only")
+		flag = "--read-write"
 	}
-	args = append(args, strconv.Itoa(id))
 	sn.s.Logger().Info("Setting permissions to snapshot")
-	_, err := sn.s.Runner().Run("snapper", args...)
-	return err
+	return sn.modify(root, id, flag)
 }
 
 func (sn Snapper) SetDefault(root string, id int, metadata Metadata) error {
-	args := []string{"--no-dbus"}
-
-	if root != "" && root != "/" {
-		args = append(args, "--root", root)
-	}
-	args = append(args, "modify", "--default")
+	flags := []string{"--default"}
 	if len(metadata) > 0 {
-		args = append(args, "--userdata", metadata.String())
+		flags = append(flags, "--userdata", metadata.String())
 	}
-	args = append(args, strconv.Itoa(id))
 	sn.s.Logger().Info("Setting default snapshot")
-	_, err := sn.s.Runner().Run("snapper", args...)
-	return err
+	return sn.modify(root, id, flags...)
 }
 
-func (sn Snapper) Cleanup(root string, maxSnaps int) error {
+// SetUserData sets the given metadata to the snapshot of the given ID. Keys with an empty value
+// are removed from the snapshot metadata.
+func (sn Snapper) SetUserData(root string, id int, metadata Metadata) error {
+	sn.s.Logger().Info("Setting snapshot metadata")
+	return sn.modify(root, id, "--userdata", metadata.String())
+}
+
+// Cleanup deletes the oldest root snapshots exceeding the given retention. Pinned, default and
+// active snapshots are never deleted, pinned snapshots do not count for the maximum number of snapshots.
+func (sn Snapper) Cleanup(root string, retention Retention) error {
 	// TODO instead of relying on manual cleanup we could provide a snapper plugin
 	// to handle cleanup and rely on 'snapper cleanup' command
 	snaps, err := sn.ListSnapshots(root, rootConfig)
 	if err != nil {
 		return fmt.Errorf("listing snapshots: %w", err)
 	}
-	deletes := len(snaps) - maxSnaps
-	i := 0
-	for deletes > 0 {
-		if !snaps[i].Active && !snaps[i].Default {
-			path := filepath.Join(root, SnapshotsPath, strconv.Itoa(snaps[i].Number), "snapshot")
-			err = sn.DeleteByPath(path)
-			if err != nil {
-				return fmt.Errorf("cleaning up snapshot '%s': %w", path, err)
-			}
-			deletes--
+
+	var candidates Snapshots
+	pinned := 0
+	for _, snap := range snaps {
+		switch {
+		case snap.IsPinned():
+			pinned++
+		case !snap.Active && !snap.Default:
+			candidates = append(candidates, snap)
+		}
+	}
+
+	deletes := 0
+	if retention.MaxSnapshots > 0 {
+		deletes = len(snaps) - pinned - retention.MaxSnapshots
+	}
+	for _, snap := range candidates {
+		expired := retention.MaxAge > 0 && snap.Age() > retention.MaxAge
+		if deletes <= 0 && !expired {
+			continue
+		}
+		path := filepath.Join(root, SnapshotsPath, strconv.Itoa(snap.Number), "snapshot")
+		err = sn.DeleteByPath(path)
+		if err != nil {
+			return fmt.Errorf("cleaning up snapshot '%s': %w", path, err)
 		}
-		i++
+		deletes--
+	}
+	return nil
+}
+
+// Pin sets the pinned flag to the snapshot of the given ID and disables its cleanup algorithm, so
+// neither Cleanup nor snapper itself deletes it
+func (sn Snapper) Pin(root string, id int) error {
+	return sn.modify(root, id, "--userdata", Metadata{Pinned: "yes"}.String(), "--cleanup-algorithm", "")
+}
+
+// Unpin removes the pinned flag from the snapshot of the given ID and restores the number cleanup algorithm
+func (sn Snapper) Unpin(root string, id int) error {
+	return sn.modify(root, id, "--userdata", Metadata{Pinned: ""}.String(), "--cleanup-algorithm", "number")
+}
+
+// modify runs 'snapper modify' with the given flags on the snapshot of the given ID
+func (sn Snapper) modify(root string, id int, flags ...string) error {
+	args := []string{"--no-dbus"}
+
+	if root != "" && root != "/" {
+		args = append(args, "--root", root)
+	}
+	args = append(args, "modify")
+	args = append(args, flags...)
+	args = append(args, strconv.Itoa(id))
+	out, err := sn.s.Runner().Run("snapper", args...)
+	if err != nil {
+		return fmt.Errorf("modifying snapshot %d: %s: %w", id, strings.TrimSpace(string(out)), err)
 	}
 	return nil
 }
@@ -284,17 +386,9 @@ func (sn Snapper) ConfigureRoot(snapshotPath string, maxSnapshots int) error {
 		return fmt.Errorf("finding default snapper configuration template: %w", err)
 	}
 
-	sysconfigData := map[string]string{}
-	sysconfig := filepath.Join(snapshotPath, snapperDefaultConfig)
-	if ok, _ := vfs.Exists(sn.s.FS(), sysconfig); !ok {
-		sysconfig = filepath.Join(snapshotPath, snapperSysconfig)
-	}
-
-	if ok, _ := vfs.Exists(sn.s.FS(), sysconfig); ok {
-		sysconfigData, err = vfs.LoadEnvFile(sn.s.FS(), sysconfig)
-		if err != nil {
-			return fmt.Errorf("loading global snapper sysconfig: %w", err)
-		}
+	sysconfig, sysconfigData, err := sn.loadSysconfig(snapshotPath)
+	if err != nil {
+		return err
 	}
 	sysconfigData["SNAPPER_CONFIGS"] = rootConfig
 
@@ -323,6 +417,147 @@ func (sn Snapper) ConfigureRoot(snapshotPath string, maxSnapshots int) error {
 	return nil
 }
 
+// WriteConfig writes the snapper configuration of the given volume path within the given snapshot and
+// registers it in the global snapper configuration. As opposed to CreateConfig it does not require
+// snapper nor a mounted btrfs filesystem, the snapshots subvolume of the volume is not created.
+func (sn Snapper) WriteConfig(snapshotPath, volumePath string) error {
+	tmpl, err := vfs.FindFile(sn.s.FS(), snapshotPath, configTemplatesPaths()...)
+	if err != nil {
+		return fmt.Errorf("finding default snapper configuration template: %w", err)
+	}
+
+	snapCfg, err := vfs.LoadEnvFile(sn.s.FS(), tmpl)
+	if err != nil {
+		return fmt.Errorf("loading default snapper configuration template: %w", err)
+	}
+	snapCfg["SUBVOLUME"] = volumePath
+	snapCfg["FSTYPE"] = "btrfs"
+
+	name := ConfigName(volumePath)
+	configsDir := filepath.Join(snapshotPath, snapperConfigsDir)
+	err = vfs.MkdirAll(sn.s.FS(), configsDir, vfs.DirPerm)
+	if err != nil {
+		return fmt.Errorf("creating snapper configurations directory: %w", err)
+	}
+	err = vfs.WriteEnvFile(sn.s.FS(), snapCfg, filepath.Join(configsDir, name))
+	if err != nil {
+		return fmt.Errorf("writing snapper '%s' configuration: %w", name, err)
+	}
+
+	sysconfig, sysconfigData, err := sn.loadSysconfig(snapshotPath)
+	if err != nil {
+		return err
+	}
+	configs := strings.Fields(sysconfigData["SNAPPER_CONFIGS"])
+	if !slices.Contains(configs, name) {
+		configs = append(configs, name)
+	}
+	sysconfigData["SNAPPER_CONFIGS"] = strings.Join(configs, " ")
+
+	err = vfs.WriteEnvFile(sn.s.FS(), sysconfigData, sysconfig)
+	if err != nil {
+		return fmt.Errorf("writing global snapper configuration: %w", err)
+	}
+	return nil
+}
+
+// DisableQuotaGroups unsets the quota group of all the snapper configurations within the given
+// snapshot. Required for btrfs filesystems created without the 1/0 quota group.
+func (sn Snapper) DisableQuotaGroups(snapshotPath string) error {
+	configsDir := filepath.Join(snapshotPath, snapperConfigsDir)
+	entries, err := sn.s.FS().ReadDir(configsDir)
+	if err != nil {
+		return fmt.Errorf("reading snapper configurations directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		config := filepath.Join(configsDir, entry.Name())
+		snapCfg, err := vfs.LoadEnvFile(sn.s.FS(), config)
+		if err != nil {
+			return fmt.Errorf("loading snapper configuration '%s': %w", entry.Name(), err)
+		}
+		snapCfg["QGROUP"] = ""
+		err = vfs.WriteEnvFile(sn.s.FS(), snapCfg, config)
+		if err != nil {
+			return fmt.Errorf("writing snapper configuration '%s': %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+type snapshotInfo struct {
+	XMLName     xml.Name           `xml:"snapshot"`
+	Type        string             `xml:"type"`
+	Num         int                `xml:"num"`
+	Date        string             `xml:"date"`
+	Description string             `xml:"description,omitempty"`
+	UserData    []snapshotUserData `xml:"userdata"`
+}
+
+type snapshotUserData struct {
+	Key   string `xml:"key"`
+	Value string `xml:"value"`
+}
+
+// WriteSnapshotInfo writes the snapper metadata of the snapshot of the given ID within the given
+// snapshots directory. It describes snapshots created without snapper, for instance the subvolumes
+// of a btrfs filesystem populated from a directory tree.
+func (sn Snapper) WriteSnapshotInfo(snapshotsDir string, id int, description string, metadata Metadata) error {
+	info := snapshotInfo{
+		Type:        "single",
+		Num:         id,
+		Date:        time.Now().UTC().Format(dateLayout),
+		Description: description,
+	}
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		info.UserData = append(info.UserData, snapshotUserData{Key: k, Value: metadata[k]})
+	}
+
+	data, err := xml.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshalling snapshot %d metadata: %w", id, err)
+	}
+
+	dir := filepath.Join(snapshotsDir, strconv.Itoa(id))
+	err = vfs.MkdirAll(sn.s.FS(), dir, vfs.DirPerm)
+	if err != nil {
+		return fmt.Errorf("creating snapshot %d directory: %w", id, err)
+	}
+	err = sn.s.FS().WriteFile(filepath.Join(dir, infoFile), append([]byte(xml.Header), data...), vfs.FilePerm)
+	if err != nil {
+		return fmt.Errorf("writing snapshot %d metadata: %w", id, err)
+	}
+	return nil
+}
+
+// loadSysconfig returns the path and the content of the global snapper configuration within the
+// given snapshot
+func (sn Snapper) loadSysconfig(snapshotPath string) (string, map[string]string, error) {
+	var err error
+
+	sysconfigData := map[string]string{}
+	sysconfig := filepath.Join(snapshotPath, snapperDefaultConfig)
+	if ok, _ := vfs.Exists(sn.s.FS(), sysconfig); !ok {
+		sysconfig = filepath.Join(snapshotPath, snapperSysconfig)
+	}
+
+	if ok, _ := vfs.Exists(sn.s.FS(), sysconfig); ok {
+		sysconfigData, err = vfs.LoadEnvFile(sn.s.FS(), sysconfig)
+		if err != nil {
+			return "", nil, fmt.Errorf("loading global snapper sysconfig: %w", err)
+		}
+	}
+	return sysconfig, sysconfigData, nil
+}
+
 func (sn Snapper) Status(root, config, output string, num1, num2 int) error {
 	args := []string{"--no-dbus"}
 
@@ -340,6 +575,69 @@ func (sn Snapper) Status(root, config, output string, num1, num2 int) error {
 	return nil
 }
 
+// Changes returns the file changes between the given snapshots. Snapshot 0 refers to the current
+// content of the volume.
+func (sn Snapper) Changes(root, config string, num1, num2 int) (changes []Change, err error) {
+	tmpDir, err := vfs.TempDir(sn.s.FS(), "", "snapStatus")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary directory to store snapper output: %w", err)
+	}
+	defer func() {
+		e := sn.s.FS().RemoveAll(tmpDir)
+		if err == nil && e != nil {
+			err = fmt.Errorf("removing temporary directory: %w", e)
+		}
+	}()
+
+	output := filepath.Join(tmpDir, "status")
+	err = sn.Status(root, config, output, num1, num2)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := sn.s.FS().ReadFile(output)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapper status: %w", err)
+	}
+
+	return parseStatus(data), nil
+}
+
+// Diff returns the unified diff of the given files between the given snapshots. Snapshot 0 refers
+// to the current content of the volume. All changed files are included if no file is given.
+func (sn Snapper) Diff(root, config string, num1, num2 int, files ...string) (string, error) {
+	args := []string{"--no-dbus"}
+
+	if root != "" && root != "/" {
+		args = append(args, "--root", root)
+	}
+	if config == "" {
+		config = rootConfig
+	}
+	args = append(args, "-c", config, "diff", fmt.Sprintf("%d..%d", num1, num2))
+	args = append(args, files...)
+	out, err := sn.s.Runner().RunEnv("snapper", []string{env.CLocale}, args...)
+	if err != nil {
+		return "", fmt.Errorf("snapper failed to diff snapshots %d and %d: %s: %w", num1, num2, strings.TrimSpace(string(out)), err)
+	}
+	return string(out), nil
+}
+
+// parseStatus parses the output of 'snapper status', each line includes the status flags and the file path
+func parseStatus(data []byte) []Change {
+	changes := []Change{}
+	r := regexp.MustCompile(`^([-+ct.][p.][u.][g.][x.][a.])\s+(.*)$`)
+
+	for _, line := range strings.Split(string(data), "\n") {
+		match := r.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		changes = append(changes, Change{Flags: match[1], Path: match[2]})
+	}
+	return changes
+}
+
 func unmarshalSnapperList(snapperOut []byte, config string) (Snapshots, error) {
 	var objmap map[string]*json.RawMessage
 	err := json.Unmarshal(snapperOut, &objmap)
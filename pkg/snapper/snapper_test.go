@@ -22,7 +22,10 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/joho/godotenv"
 	. "github.com/onsi/ginkgo/v2"
@@ -192,7 +195,7 @@ var _ = Describe("Snapper", Label("snapper"), func() {
 		runner.ReturnError = fmt.Errorf("snapper modify failed")
 		err := snap.SetDefault("/some/root", 3, nil)
 		Expect(err).To(HaveOccurred())
-		Expect(err).To(MatchError("snapper modify failed"))
+		Expect(err).To(MatchError("modifying snapshot 3: : snapper modify failed"))
 	})
 	It("sets snapshot permissions", func() {
 		Expect(snap.SetPermissions("/some/root", 3, true)).To(Succeed())
@@ -210,7 +213,33 @@ var _ = Describe("Snapper", Label("snapper"), func() {
 		runner.ReturnError = fmt.Errorf("snapper modify failed")
 		err := snap.SetPermissions("/some/root", 3, false)
 		Expect(err).To(HaveOccurred())
-		Expect(err).To(MatchError("snapper modify failed"))
+		Expect(err).To(MatchError("modifying snapshot 3: : snapper modify failed"))
+	})
+	It("sets snapshot metadata", func() {
+		Expect(snap.SetUserData("/some/root", 3, map[string]string{"key": "value"})).To(Succeed())
+		Expect(runner.CmdsMatch([][]string{{
+			"snapper", "--no-dbus", "--root", "/some/root", "modify",
+			"--userdata", "key=value", "3",
+		}})).To(Succeed())
+
+		runner.ReturnError = fmt.Errorf("snapper modify failed")
+		err := snap.SetUserData("/some/root", 3, map[string]string{"key": ""})
+		Expect(err).To(HaveOccurred())
+		Expect(err).To(MatchError("modifying snapshot 3: : snapper modify failed"))
+	})
+	It("pins and unpins snapshots", func() {
+		Expect(snap.Pin("/some/root", 3)).To(Succeed())
+		Expect(snap.Unpin("/", 3)).To(Succeed())
+		Expect(runner.CmdsMatch([][]string{{
+			"snapper", "--no-dbus", "--root", "/some/root", "modify",
+			"--userdata", "pinned=yes", "--cleanup-algorithm", "", "3",
+		}, {
+			"snapper", "--no-dbus", "modify",
+			"--userdata", "pinned=", "--cleanup-algorithm", "number", "3",
+		}})).To(Succeed())
+
+		runner.ReturnError = fmt.Errorf("snapper modify failed")
+		Expect(snap.Pin("/", 3)).To(MatchError("modifying snapshot 3: : snapper modify failed"))
 	})
 	It("runs snapper status and writes to a file", func() {
 		Expect(snap.Status("/some/root", "", "/status_file", 3, 4)).To(Succeed())
@@ -229,6 +258,47 @@ var _ = Describe("Snapper", Label("snapper"), func() {
 			},
 		})).To(Succeed())
 	})
+	It("lists changes between snapshots", func() {
+		runner.SideEffect = func(_ string, args ...string) ([]byte, error) {
+			output := args[slices.Index(args, "--output")+1]
+			return nil, fs.WriteFile(output, []byte(
+				"c..... /etc/hosts\n+..... /etc/new file\n-..... /etc/old\n.p.... /etc/shadow\ngarbage\n",
+			), vfs.FilePerm)
+		}
+		changes, err := snap.Changes("", "etc", 3, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(Equal([]snapper.Change{
+			{Flags: "c.....", Path: "/etc/hosts"},
+			{Flags: "+.....", Path: "/etc/new file"},
+			{Flags: "-.....", Path: "/etc/old"},
+			{Flags: ".p....", Path: "/etc/shadow"},
+		}))
+		Expect(changes[0].ContentChanged()).To(BeTrue())
+		Expect(changes[1].Created()).To(BeTrue())
+		Expect(changes[2].Deleted()).To(BeTrue())
+		Expect(changes[3].ContentChanged()).To(BeFalse())
+		Expect(runner.CmdsMatch([][]string{{
+			"snapper", "--no-dbus", "-c", "etc", "status", "--output",
+		}})).To(Succeed())
+
+		runner.SideEffect = nil
+		runner.ReturnError = fmt.Errorf("snapper status failed")
+		_, err = snap.Changes("", "etc", 3, 0)
+		Expect(err).To(HaveOccurred())
+	})
+	It("diffs files between snapshots", func() {
+		runner.ReturnValue = []byte("--- /etc/.snapshots/3/snapshot/hosts\n+++ /etc/hosts\n")
+		diff, err := snap.Diff("", "etc", 3, 0, "/etc/hosts")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diff).To(ContainSubstring("+++ /etc/hosts"))
+		Expect(runner.CmdsMatch([][]string{{
+			"snapper", "--no-dbus", "-c", "etc", "diff", "3..0", "/etc/hosts",
+		}})).To(Succeed())
+
+		runner.ReturnError = fmt.Errorf("snapper diff failed")
+		_, err = snap.Diff("/some/root", "etc", 3, 0)
+		Expect(err).To(MatchError(ContainSubstring("snapper failed to diff snapshots 3 and 0")))
+	})
 	Describe("ListSnapshots", func() {
 		It("gets the list of snapshots", func() {
 			runner.SideEffect = func(_ string, _ ...string) ([]byte, error) {
@@ -239,6 +309,8 @@ var _ = Describe("Snapper", Label("snapper"), func() {
 			Expect(snaps.GetActive()).To(Equal(192))
 			Expect(snaps.GetDefault()).To(Equal(192))
 			Expect(snaps.GetWithUserdata("important", "no")).To(Equal([]int{336}))
+			Expect(snaps.Get(337).UserData).To(Equal(snapper.Metadata{"important": "yes"}))
+			Expect(snaps.Get(400)).To(BeNil())
 		})
 		It("fails to list snapshots for a wrong configuration", func() {
 			runner.SideEffect = func(_ string, _ ...string) ([]byte, error) {
@@ -270,34 +342,61 @@ var _ = Describe("Snapper", Label("snapper"), func() {
 			runner.SideEffect = func(_ string, _ ...string) ([]byte, error) {
 				return []byte(snapperList), nil
 			}
-			Expect(snap.Cleanup("/some/root", 4)).To(Succeed())
+			Expect(snap.Cleanup("/some/root", snapper.Retention{MaxSnapshots: 4})).To(Succeed())
 			Expect(runner.CmdsMatch([][]string{{
 				"snapper", "--no-dbus", "--root", "/some/root", "-c", "root",
-				"--jsonout", "list", "--columns", "number,default,active,userdata",
+				"--jsonout", "list", "--columns", "number,date,default,active,userdata",
 			}})).To(Succeed())
 		})
 		It("clears old snapshots until snapshots count is not higher than maximum", func() {
 			runner.SideEffect = func(_ string, _ ...string) ([]byte, error) {
 				return []byte(snapperList), nil
 			}
-			Expect(snap.Cleanup("/some/root", 2)).To(Succeed())
+			Expect(snap.Cleanup("/some/root", snapper.Retention{MaxSnapshots: 2})).To(Succeed())
 			Expect(runner.CmdsMatch([][]string{
 				{
 					"snapper", "--no-dbus", "--root", "/some/root", "-c", "root",
-					"--jsonout", "list", "--columns", "number,default,active,userdata",
+					"--jsonout", "list", "--columns", "number,date,default,active,userdata",
 				}, {"btrfs", "property"}, {"btrfs", "subvolume"}, {"btrfs", "property"}, {"btrfs", "subvolume"},
 			})).To(Succeed())
 		})
+		It("keeps pinned snapshots out of the cleanup", func() {
+			list := strings.Replace(snapperList, `"important": "no"`, `"pinned": "yes"`, 1)
+			runner.SideEffect = func(_ string, _ ...string) ([]byte, error) {
+				return []byte(list), nil
+			}
+			Expect(snap.Cleanup("/some/root", snapper.Retention{MaxSnapshots: 2})).To(Succeed())
+			Expect(runner.CmdsMatch([][]string{
+				{"snapper", "--no-dbus", "--root", "/some/root", "-c", "root", "--jsonout", "list"},
+				{"btrfs", "property", "set", "-ts", "/some/root/.snapshots/337/snapshot"},
+				{"btrfs", "subvolume", "delete", "-c", "-R", "/some/root/.snapshots/337/snapshot"},
+			})).To(Succeed())
+		})
+		It("clears snapshots older than the maximum age", func() {
+			old := time.Now().Add(-48 * time.Hour).Format("2006-01-02 15:04:05")
+			recent := time.Now().Add(-time.Hour).Format("2006-01-02 15:04:05")
+			list := strings.Replace(snapperList, `"number": 336,`, fmt.Sprintf(`"number": 336, "date": "%s",`, old), 1)
+			list = strings.Replace(list, `"number": 337,`, fmt.Sprintf(`"number": 337, "date": "%s",`, recent), 1)
+			runner.SideEffect = func(_ string, _ ...string) ([]byte, error) {
+				return []byte(list), nil
+			}
+			Expect(snap.Cleanup("/some/root", snapper.Retention{MaxAge: 24 * time.Hour})).To(Succeed())
+			Expect(runner.CmdsMatch([][]string{
+				{"snapper", "--no-dbus", "--root", "/some/root", "-c", "root", "--jsonout", "list"},
+				{"btrfs", "property", "set", "-ts", "/some/root/.snapshots/336/snapshot"},
+				{"btrfs", "subvolume", "delete", "-c", "-R", "/some/root/.snapshots/336/snapshot"},
+			})).To(Succeed())
+		})
 		It("fails to list current snapshots", func() {
 			runner.SideEffect = func(_ string, _ ...string) ([]byte, error) {
 				return []byte("<list-output>"), fmt.Errorf("listing failed")
 			}
-			err := snap.Cleanup("/some/root", 4)
+			err := snap.Cleanup("/some/root", snapper.Retention{MaxSnapshots: 4})
 			Expect(err).To(HaveOccurred())
 			Expect(err).To(MatchError("listing snapshots: collecting snapshots: <list-output>: listing failed"))
 			Expect(runner.CmdsMatch([][]string{{
 				"snapper", "--no-dbus", "--root", "/some/root", "-c", "root",
-				"--jsonout", "list", "--columns", "number,default,active,userdata",
+				"--jsonout", "list", "--columns", "number,date,default,active,userdata",
 			}})).To(Succeed())
 		})
 		It("fails to delete specific snapshot", func() {
@@ -309,14 +408,14 @@ var _ = Describe("Snapper", Label("snapper"), func() {
 				}
 				return []byte(snapperList), nil
 			}
-			err := snap.Cleanup("/some/root", 2)
+			err := snap.Cleanup("/some/root", snapper.Retention{MaxSnapshots: 2})
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("cleaning up snapshot"))
 			Expect(err.Error()).To(ContainSubstring("deleting subvolume: delete failed"))
 			Expect(runner.CmdsMatch([][]string{
 				{
 					"snapper", "--no-dbus", "--root", "/some/root", "-c", "root",
-					"--jsonout", "list", "--columns", "number,default,active,userdata",
+					"--jsonout", "list", "--columns", "number,date,default,active,userdata",
 				},
 				{"btrfs", "property"},
 				{"btrfs", "subvolume", "delete"},
@@ -344,4 +443,48 @@ var _ = Describe("Snapper", Label("snapper"), func() {
 			Expect(envMap["NUMBER_LIMIT"]).To(Equal("1-4"))
 		})
 	})
+	Describe("Offline configuration", func() {
+		var rootDir string
+		BeforeEach(func() {
+			rootDir = "/some/root"
+			template := filepath.Join(rootDir, "/usr/share/snapper/config-templates/default")
+			sysconfig := filepath.Join(rootDir, "/etc/sysconfig/snapper")
+			Expect(vfs.MkdirAll(fs, filepath.Dir(template), vfs.DirPerm)).To(Succeed())
+			Expect(fs.WriteFile(template, []byte("QGROUP=\"\"\n"), vfs.FilePerm)).To(Succeed())
+			Expect(vfs.MkdirAll(fs, filepath.Dir(sysconfig), vfs.DirPerm)).To(Succeed())
+			Expect(fs.WriteFile(sysconfig, []byte{}, vfs.FilePerm)).To(Succeed())
+			Expect(vfs.MkdirAll(fs, filepath.Join(rootDir, "/etc/snapper/configs"), vfs.DirPerm)).To(Succeed())
+			Expect(snap.ConfigureRoot(rootDir, 4)).To(Succeed())
+		})
+		It("writes a volume configuration", func() {
+			Expect(snap.WriteConfig(rootDir, "/etc")).To(Succeed())
+
+			envMap, err := vfs.LoadEnvFile(fs, filepath.Join(rootDir, "/etc/snapper/configs/etc"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(envMap["SUBVOLUME"]).To(Equal("/etc"))
+			Expect(envMap["FSTYPE"]).To(Equal("btrfs"))
+
+			envMap, err = vfs.LoadEnvFile(fs, filepath.Join(rootDir, "/etc/sysconfig/snapper"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(envMap["SNAPPER_CONFIGS"]).To(Equal("root etc"))
+			Expect(runner.GetCmds()).To(BeEmpty())
+		})
+		It("disables quota groups", func() {
+			Expect(snap.WriteConfig(rootDir, "/etc")).To(Succeed())
+			Expect(snap.DisableQuotaGroups(rootDir)).To(Succeed())
+			for _, config := range []string{"root", "etc"} {
+				envMap, err := vfs.LoadEnvFile(fs, filepath.Join(rootDir, "/etc/snapper/configs", config))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(envMap["QGROUP"]).To(BeEmpty())
+			}
+		})
+		It("writes the snapshot metadata", func() {
+			Expect(snap.WriteSnapshotInfo("/some/.snapshots", 1, "stock contents", snapper.Metadata{"stock": "true"})).To(Succeed())
+			data, err := fs.ReadFile("/some/.snapshots/1/info.xml")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(ContainSubstring("<num>1</num>"))
+			Expect(string(data)).To(ContainSubstring("<description>stock contents</description>"))
+			Expect(string(data)).To(ContainSubstring("<userdata>\n    <key>stock</key>\n    <value>true</value>\n  </userdata>"))
+		})
+	})
 })
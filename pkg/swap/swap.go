@@ -0,0 +1,79 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package swap
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+
+	"github.com/suse/elemental/v3/pkg/btrfs"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/sys"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+// ZramConfigFile is the zram generator configuration file
+const ZramConfigFile = "/etc/systemd/zram-generator.conf"
+
+// CreateFile creates a swap file of the given size at the given path of a btrfs filesystem.
+// Copy on write is disabled for the directory of the swap file, as required to swap on btrfs,
+// hence the directory is expected to be dedicated to the swap file.
+func CreateFile(s *sys.System, path string, size deployment.MiB) error {
+	s.Logger().Info("Creating swap file '%s'", path)
+
+	err := vfs.MkdirAll(s.FS(), filepath.Dir(path), vfs.DirPerm)
+	if err != nil {
+		return fmt.Errorf("creating swap file directory: %w", err)
+	}
+	err = btrfs.NoCopyOnWrite(s, filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("creating swap file directory: %w", err)
+	}
+
+	out, err := s.Runner().Run("btrfs", "filesystem", "mkswapfile", "--size", fmt.Sprintf("%dm", size), path)
+	if err != nil {
+		return fmt.Errorf("creating swap file '%s': %s: %w", path, string(out), err)
+	}
+	return nil
+}
+
+// WriteZramConfig writes the zram generator configuration of the given zram device in the given root
+func WriteZramConfig(s *sys.System, root string, zram *deployment.ZramConfig) error {
+	var buf bytes.Buffer
+
+	buf.WriteString("# Generated by Elemental3, do not edit\n[zram0]\n")
+	if zram.Size != "" {
+		fmt.Fprintf(&buf, "zram-size = %s\n", zram.Size)
+	}
+	if zram.Compression != "" {
+		fmt.Fprintf(&buf, "compression-algorithm = %s\n", zram.Compression)
+	}
+
+	cfgFile := filepath.Join(root, ZramConfigFile)
+	err := vfs.MkdirAll(s.FS(), filepath.Dir(cfgFile), vfs.DirPerm)
+	if err != nil {
+		return fmt.Errorf("creating directory '%s': %w", filepath.Dir(cfgFile), err)
+	}
+
+	err = s.FS().WriteFile(cfgFile, buf.Bytes(), vfs.FilePerm)
+	if err != nil {
+		return fmt.Errorf("writing zram configuration '%s': %w", cfgFile, err)
+	}
+	return nil
+}
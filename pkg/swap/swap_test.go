@@ -0,0 +1,83 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package swap_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/swap"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+func TestSwapSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Swap test suite")
+}
+
+var _ = Describe("Swap", Label("swap"), func() {
+	var s *sys.System
+	var tfs vfs.FS
+	var runner *sysmock.Runner
+	var cleanup func()
+
+	BeforeEach(func() {
+		var err error
+		runner = sysmock.NewRunner()
+		tfs, cleanup, err = sysmock.TestFS(nil)
+		Expect(err).NotTo(HaveOccurred())
+		s, err = sys.NewSystem(
+			sys.WithFS(tfs), sys.WithRunner(runner),
+			sys.WithLogger(log.New(log.WithDiscardAll())),
+		)
+		Expect(err).NotTo(HaveOccurred())
+	})
+	AfterEach(func() {
+		cleanup()
+	})
+	It("creates a swap file", func() {
+		Expect(swap.CreateFile(s, "/mnt/@/var/swap/swapfile", 2048)).To(Succeed())
+		Expect(runner.CmdsMatch([][]string{
+			{"chattr", "+C", "/mnt/@/var/swap"},
+			{"btrfs", "filesystem", "mkswapfile", "--size", "2048m", "/mnt/@/var/swap/swapfile"},
+		})).To(Succeed())
+		Expect(vfs.Exists(tfs, "/mnt/@/var/swap")).To(BeTrue())
+
+		runner.ReturnError = fmt.Errorf("mkswapfile failed")
+		err := swap.CreateFile(s, "/mnt/@/var/swap/swapfile", 2048)
+		Expect(err).To(MatchError(ContainSubstring("mkswapfile failed")))
+	})
+	It("writes the zram generator configuration", func() {
+		Expect(swap.WriteZramConfig(s, "/root", &deployment.ZramConfig{Size: "ram / 2", Compression: "zstd"})).To(Succeed())
+		data, err := tfs.ReadFile("/root/etc/systemd/zram-generator.conf")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("[zram0]\nzram-size = ram / 2\ncompression-algorithm = zstd\n"))
+
+		Expect(swap.WriteZramConfig(s, "/root", &deployment.ZramConfig{})).To(Succeed())
+		data, err = tfs.ReadFile("/root/etc/systemd/zram-generator.conf")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).NotTo(ContainSubstring("zram-size"))
+	})
+})
@@ -27,11 +27,16 @@ type Transactioner struct {
 	InitErr           error
 	StartErr          error
 	CommitErr         error
+	StageErr          error
+	DiscardErr        error
 	RollbackErr       error
+	RollbackToErr     error
 	Trans             *transaction.Transaction
 	UpgradeHelper     UpgradeHelper
 	SrcDigest         string
+	DefaultID         int
 	rollbackCalled    bool
+	staged            bool
 	activeSnapshotIDs []int
 }
 
@@ -82,11 +87,32 @@ func (t Transactioner) Commit(_ *transaction.Transaction, _ func() error) error
 	return t.CommitErr
 }
 
+func (t *Transactioner) Stage(_ *transaction.Transaction) error {
+	t.staged = t.StageErr == nil
+	return t.StageErr
+}
+
+func (t Transactioner) CommitStaged(_ func() error) (*transaction.Transaction, error) {
+	return t.Trans, t.CommitErr
+}
+
+func (t Transactioner) DiscardStaged() error {
+	return t.DiscardErr
+}
+
+func (t Transactioner) Staged() bool {
+	return t.staged
+}
+
 func (t *Transactioner) Rollback(_ *transaction.Transaction, _ error) error {
 	t.rollbackCalled = true
 	return t.RollbackErr
 }
 
+func (t Transactioner) RollbackTo(_ int) (*transaction.Transaction, error) {
+	return t.Trans, t.RollbackToErr
+}
+
 func (t Transactioner) RollbackCalled() bool {
 	return t.rollbackCalled
 }
@@ -94,3 +120,7 @@ func (t Transactioner) RollbackCalled() bool {
 func (t Transactioner) GetActiveSnapshotIDs() ([]int, error) {
 	return t.activeSnapshotIDs, nil
 }
+
+func (t Transactioner) GetDefaultSnapshotID() (int, error) {
+	return t.DefaultID, nil
+}
@@ -0,0 +1,320 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/suse/elemental/v3/pkg/btrfs"
+	"github.com/suse/elemental/v3/pkg/cleanstack"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/rsync"
+	"github.com/suse/elemental/v3/pkg/snapper"
+	"github.com/suse/elemental/v3/pkg/sys"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+)
+
+// Offline transaction populates the first snapshot of a deployment within a staging directory instead
+// of mounted partitions. Each partition is staged in its own directory, see StagedPartitionDir, and the
+// system partition tree follows the btrfs subvolumes layout of the snapper transaction, see Subvolumes.
+// The staged trees are meant to be turned into filesystem images without privileges, hence no mounts,
+// loop devices nor snapper calls are involved.
+type Offline struct {
+	snapperContext
+	stagingDir string
+	sysPart    *deployment.Partition
+}
+
+func NewOffline(ctx context.Context, s *sys.System, stagingDir string) *Offline {
+	return &Offline{
+		snapperContext: snapperContext{
+			ctx:        ctx,
+			s:          s,
+			cleanStack: cleanstack.NewCleanStack(),
+			snap:       snapper.New(s),
+			retention:  snapper.Retention{MaxSnapshots: maxSnapshots},
+		},
+		stagingDir: stagingDir,
+	}
+}
+
+var _ Interface = (*Offline)(nil)
+var _ UpgradeHelper = (*Offline)(nil)
+
+// StagedPartitionDir returns the directory within the staging directory holding the given partition content
+func StagedPartitionDir(stagingDir string, part *deployment.Partition) string {
+	return filepath.Join(stagingDir, part.UUID)
+}
+
+// Init sets the partitions of the deployment to stage
+func (o *Offline) Init(d deployment.Deployment) (UpgradeHelper, error) {
+	for _, disk := range d.Disks {
+		o.partitions = append(o.partitions, disk.Partitions...)
+	}
+	o.swap = d.Swap
+	o.setRetention(d)
+
+	o.sysPart = d.GetSystemPartition()
+	if o.sysPart == nil {
+		return nil, fmt.Errorf("no system partition found in deployment")
+	}
+	return o, nil
+}
+
+// Start creates the first snapshot path within the staged system partition tree
+func (o *Offline) Start() (*Transaction, error) {
+	if o.sysPart == nil {
+		return nil, fmt.Errorf("uninitialized snapshotter")
+	}
+
+	o.s.Logger().Info("Starting an offline transaction at '%s'", o.stagingDir)
+	trans := &Transaction{
+		ID:     1,
+		Path:   filepath.Join(o.rootDir(), fmt.Sprintf(snapshotPathTmpl, 1)),
+		Merges: map[string]*Merge{},
+		status: started,
+	}
+	err := vfs.MkdirAll(o.s.FS(), trans.Path, vfs.DirPerm)
+	if err != nil {
+		return nil, fmt.Errorf("creating snapshot path: %w", err)
+	}
+	return trans, nil
+}
+
+// Merge writes the snapper configuration of root and of the snapshotted volumes and stages the stock
+// snapshot of each snapshotted volume. There is nothing to merge on a first snapshot.
+func (o *Offline) Merge(trans *Transaction) (err error) {
+	defer func() { err = o.checkCancelled(err) }()
+	if trans.status != started {
+		return fmt.Errorf("transaction '%d' is not started", trans.ID)
+	}
+
+	o.s.Logger().Info("Configure snapper")
+	err = o.snap.ConfigureRoot(trans.Path, o.retention.MaxSnapshots)
+	if err != nil {
+		return fmt.Errorf("setting root configuration: %w", err)
+	}
+
+	err = vfs.MkdirAll(o.s.FS(), filepath.Join(trans.Path, snapper.SnapshotsPath), vfs.DirPerm)
+	if err != nil {
+		return fmt.Errorf("creating snapshots dir: %w", err)
+	}
+
+	for _, rwVol := range o.partitions.GetSnapshottedVolumes() {
+		err = o.snap.WriteConfig(trans.Path, rwVol.Path)
+		if err != nil {
+			return fmt.Errorf("writing config for '%s': %w", rwVol.Path, err)
+		}
+
+		volume := filepath.Join(trans.Path, rwVol.Path)
+		snapshotsDir := filepath.Join(volume, snapper.SnapshotsPath)
+		stock := filepath.Join(volume, fmt.Sprintf(snapshotPathTmpl, 1))
+		err = vfs.MkdirAll(o.s.FS(), stock, vfs.DirPerm)
+		if err != nil {
+			return fmt.Errorf("creating stock snapshot path of '%s': %w", rwVol.Path, err)
+		}
+
+		r := rsync.NewRsync(o.s, rsync.WithContext(o.ctx))
+		err = r.SyncData(volume, stock, filepath.Join("/", snapper.SnapshotsPath))
+		if err != nil {
+			return fmt.Errorf("staging stock snapshot of '%s': %w", rwVol.Path, err)
+		}
+
+		description := fmt.Sprintf("stock %s contents", rwVol.Path)
+		err = o.snap.WriteSnapshotInfo(snapshotsDir, 1, description, map[string]string{"stock": "true"})
+		if err != nil {
+			return fmt.Errorf("writing stock snapshot metadata of '%s': %w", rwVol.Path, err)
+		}
+	}
+
+	// Filesystems populated from a directory tree have no quota groups
+	err = o.snap.DisableQuotaGroups(trans.Path)
+	if err != nil {
+		return fmt.Errorf("disabling snapper quota groups: %w", err)
+	}
+	return nil
+}
+
+// Lock does nothing, the snapshot is flagged as read-only once the filesystem image is created
+func (o *Offline) Lock(trans *Transaction) error {
+	if trans.status != started {
+		return fmt.Errorf("transaction '%d' is not started", trans.ID)
+	}
+	o.s.Logger().Debug("Snapshot %d is set read-only at filesystem creation", trans.ID)
+	return nil
+}
+
+// Commit writes the root snapshot metadata and relocates the content of the partitions other than
+// the system partition and of the non snapshotted RW volumes to their staged directories
+func (o *Offline) Commit(trans *Transaction, cleanup func() error) (err error) {
+	defer func() { err = o.checkCancelled(err) }()
+
+	if trans.status != started {
+		return fmt.Errorf("transaction '%d' is not started", trans.ID)
+	}
+	o.s.Logger().Info("Committing transaction")
+
+	err = o.snap.WriteSnapshotInfo(
+		filepath.Join(o.rootDir(), snapper.SnapshotsPath), trans.ID, "first root filesystem, snapshot 1", nil,
+	)
+	if err != nil {
+		return fmt.Errorf("writing snapshot metadata: %w", err)
+	}
+	trans.status = committed
+
+	if cleanup != nil {
+		o.cleanStack.Push(cleanup)
+	}
+	err = o.cleanStack.Cleanup(err)
+	if err != nil {
+		return err
+	}
+
+	o.s.Logger().Info("Relocating partitions content")
+	for _, part := range o.partitions {
+		if part.Role != deployment.System && part.MountPoint != "" {
+			err = o.relocate(filepath.Join(trans.Path, part.MountPoint), StagedPartitionDir(o.stagingDir, part))
+			if err != nil {
+				return fmt.Errorf("relocating partition '%s' content: %w", part.Label, err)
+			}
+		}
+		if part.Role != deployment.System {
+			continue
+		}
+		for _, rwVol := range part.RWVolumes {
+			if rwVol.Snapshotted {
+				continue
+			}
+			err = o.relocate(filepath.Join(trans.Path, rwVol.Path), filepath.Join(o.rootDir(), rwVol.Path))
+			if err != nil {
+				return fmt.Errorf("relocating volume '%s' content: %w", rwVol.Path, err)
+			}
+		}
+	}
+	o.s.Logger().Info("Transaction closed")
+	return nil
+}
+
+// Subvolumes returns the btrfs subvolumes of the staged system partition tree, the first root snapshot
+// is the default subvolume
+func (o Offline) Subvolumes() []btrfs.Subvolume {
+	root := btrfs.TopSubVol
+	snapshot := filepath.Join(root, fmt.Sprintf(snapshotPathTmpl, 1))
+
+	subvolumes := []btrfs.Subvolume{
+		{Path: root},
+		{Path: filepath.Join(root, snapper.SnapshotsPath)},
+		{Path: snapshot, Default: true, ReadOnly: true},
+	}
+	if o.sysPart == nil {
+		return subvolumes
+	}
+
+	for _, rwVol := range o.sysPart.RWVolumes {
+		if !rwVol.Snapshotted {
+			continue
+		}
+		volume := filepath.Join(snapshot, rwVol.Path)
+		subvolumes = append(subvolumes,
+			btrfs.Subvolume{Path: volume, NoCopyOnWrite: rwVol.NoCopyOnWrite},
+			btrfs.Subvolume{Path: filepath.Join(volume, snapper.SnapshotsPath)},
+			btrfs.Subvolume{Path: filepath.Join(volume, fmt.Sprintf(snapshotPathTmpl, 1)), ReadOnly: true},
+		)
+	}
+	for _, rwVol := range o.sysPart.RWVolumes {
+		if rwVol.Snapshotted {
+			continue
+		}
+		subvolumes = append(subvolumes, btrfs.Subvolume{Path: filepath.Join(root, rwVol.Path)})
+	}
+	return subvolumes
+}
+
+// Rollback runs the pending cleanup tasks, the staging directory is left to the caller
+func (o *Offline) Rollback(trans *Transaction, e error) error {
+	if trans.status == committed {
+		o.s.Logger().Warn("cannot rollback a committed transaction")
+		return e
+	}
+	o.s.Logger().Error("Closing transaction due to a failure: %v", e)
+	trans.status = failed
+	return o.cleanStack.Cleanup(e)
+}
+
+func (o *Offline) RollbackTo(int) (*Transaction, error) {
+	return nil, fmt.Errorf("'offline' snapshotter keeps no previous snapshots to roll back to: %w", errors.ErrUnsupported)
+}
+
+func (o *Offline) Stage(*Transaction) error {
+	return fmt.Errorf("'offline' snapshotter can't stage transactions: %w", errors.ErrUnsupported)
+}
+
+func (o *Offline) CommitStaged(func() error) (*Transaction, error) {
+	return nil, fmt.Errorf("'offline' snapshotter keeps no staged transactions: %w", errors.ErrUnsupported)
+}
+
+func (o *Offline) DiscardStaged() error {
+	return fmt.Errorf("'offline' snapshotter keeps no staged transactions: %w", errors.ErrUnsupported)
+}
+
+func (o *Offline) GetActiveSnapshotIDs() ([]int, error) {
+	return []int{1}, nil
+}
+
+func (o *Offline) GetDefaultSnapshotID() (int, error) {
+	return 0, nil
+}
+
+// rootDir returns the top subvolume path of the staged system partition
+func (o Offline) rootDir() string {
+	return filepath.Join(StagedPartitionDir(o.stagingDir, o.sysPart), btrfs.TopSubVol)
+}
+
+// relocate moves the given path to the given target and leaves an empty directory in place,
+// as it is a mountpoint of the deployed system
+func (o Offline) relocate(path, target string) error {
+	if ok, _ := vfs.Exists(o.s.FS(), path); !ok {
+		err := vfs.MkdirAll(o.s.FS(), path, vfs.DirPerm)
+		if err != nil {
+			return fmt.Errorf("creating mountpoint '%s': %w", path, err)
+		}
+		return vfs.MkdirAll(o.s.FS(), target, vfs.DirPerm)
+	}
+
+	fi, err := o.s.FS().Stat(path)
+	if err != nil {
+		return fmt.Errorf("inspecting '%s': %w", path, err)
+	}
+
+	err = vfs.MkdirAll(o.s.FS(), filepath.Dir(target), vfs.DirPerm)
+	if err != nil {
+		return fmt.Errorf("creating directory '%s': %w", filepath.Dir(target), err)
+	}
+	err = o.s.FS().Rename(path, target)
+	if err != nil {
+		return fmt.Errorf("moving '%s' to '%s': %w", path, target, err)
+	}
+	err = o.s.FS().Mkdir(path, fi.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("creating mountpoint '%s': %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transaction_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/pkg/btrfs"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+	"github.com/suse/elemental/v3/pkg/transaction"
+)
+
+var _ = Describe("OfflineTransaction", Label("transaction", "offline"), func() {
+	var offline *transaction.Offline
+	var d *deployment.Deployment
+	var runner *sysmock.Runner
+	var cleanup func()
+	var tfs vfs.FS
+
+	BeforeEach(func() {
+		runner = sysmock.NewRunner()
+		tfs, cleanup, err = sysmock.TestFS(map[string]any{
+			"/staging/sys-uuid": map[string]any{},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		s, err = sys.NewSystem(
+			sys.WithFS(tfs), sys.WithLogger(log.New(log.WithDiscardAll())),
+			sys.WithRunner(runner), sys.WithMounter(sysmock.NewMounter()),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		d = deployment.DefaultDeployment()
+		d.GetEfiPartition().UUID = "efi-uuid"
+		d.GetSystemPartition().UUID = "sys-uuid"
+
+		offline = transaction.NewOffline(context.Background(), s, "/staging")
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	It("stages the first snapshot of a deployment", func() {
+		uh, err := offline.Init(*d)
+		Expect(err).NotTo(HaveOccurred())
+
+		trans, err := offline.Start()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trans.ID).To(Equal(1))
+		Expect(trans.Path).To(Equal("/staging/sys-uuid/@/.snapshots/1/snapshot"))
+
+		// Simulate the synced image content
+		for _, dir := range []string{"/etc/snapper/configs", "/etc/sysconfig", "/var/lib", "/boot/EFI"} {
+			Expect(vfs.MkdirAll(tfs, filepath.Join(trans.Path, dir), vfs.DirPerm)).To(Succeed())
+		}
+		template := filepath.Join(trans.Path, "/etc/snapper/config-templates/default")
+		Expect(vfs.MkdirAll(tfs, filepath.Dir(template), vfs.DirPerm)).To(Succeed())
+		Expect(tfs.WriteFile(template, []byte("QGROUP=\"1/0\"\n"), vfs.FilePerm)).To(Succeed())
+		Expect(tfs.WriteFile(filepath.Join(trans.Path, "/etc/sysconfig/snapper"), []byte{}, vfs.FilePerm)).To(Succeed())
+		Expect(tfs.WriteFile(filepath.Join(trans.Path, "/var/lib/data"), []byte("data"), vfs.FilePerm)).To(Succeed())
+		Expect(tfs.WriteFile(filepath.Join(trans.Path, "/boot/EFI/grub.efi"), []byte("efi"), vfs.FilePerm)).To(Succeed())
+
+		Expect(uh.Merge(trans)).To(Succeed())
+		Expect(uh.Lock(trans)).To(Succeed())
+		Expect(runner.MatchMilestones([][]string{{"rsync"}})).To(Succeed())
+
+		envMap, err := vfs.LoadEnvFile(tfs, filepath.Join(trans.Path, "/etc/snapper/configs/etc"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envMap["SUBVOLUME"]).To(Equal("/etc"))
+		Expect(envMap["QGROUP"]).To(BeEmpty())
+		Expect(vfs.Exists(tfs, filepath.Join(trans.Path, "/etc/.snapshots/1/info.xml"))).To(BeTrue())
+
+		Expect(offline.Commit(trans, nil)).To(Succeed())
+		Expect(vfs.Exists(tfs, "/staging/sys-uuid/@/.snapshots/1/info.xml")).To(BeTrue())
+		Expect(vfs.Exists(tfs, "/staging/efi-uuid/EFI/grub.efi")).To(BeTrue())
+		Expect(vfs.Exists(tfs, "/staging/sys-uuid/@/var/lib/data")).To(BeTrue())
+		Expect(vfs.Exists(tfs, "/staging/sys-uuid/@/home")).To(BeTrue())
+
+		entries, err := tfs.ReadDir(filepath.Join(trans.Path, "/var"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+		Expect(vfs.Exists(tfs, filepath.Join(trans.Path, "/boot"))).To(BeTrue())
+	})
+
+	It("lists the subvolumes of the staged system partition", func() {
+		_, err := offline.Init(*d)
+		Expect(err).NotTo(HaveOccurred())
+
+		subvolumes := offline.Subvolumes()
+		Expect(subvolumes[:5]).To(Equal([]btrfs.Subvolume{
+			{Path: "@"},
+			{Path: "@/.snapshots"},
+			{Path: "@/.snapshots/1/snapshot", Default: true, ReadOnly: true},
+			{Path: "@/.snapshots/1/snapshot/etc"},
+			{Path: "@/.snapshots/1/snapshot/etc/.snapshots"},
+		}))
+		Expect(subvolumes).To(ContainElements(
+			btrfs.Subvolume{Path: "@/.snapshots/1/snapshot/etc/.snapshots/1/snapshot", ReadOnly: true},
+			btrfs.Subvolume{Path: "@/var"},
+			btrfs.Subvolume{Path: "@/home"},
+		))
+	})
+
+	It("fails to initialize without a system partition", func() {
+		d.Disks[0].Partitions = d.Disks[0].Partitions[:1]
+		_, err := offline.Init(*d)
+		Expect(err).To(MatchError("no system partition found in deployment"))
+	})
+
+	It("does not support staging nor rolling back to a previous snapshot", func() {
+		_, err := offline.RollbackTo(0)
+		Expect(err).To(MatchError(errors.ErrUnsupported))
+		Expect(offline.Stage(nil)).To(MatchError(errors.ErrUnsupported))
+	})
+})
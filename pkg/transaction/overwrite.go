@@ -19,6 +19,7 @@ package transaction
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
 
@@ -26,6 +27,7 @@ import (
 	"github.com/suse/elemental/v3/pkg/cleanstack"
 	"github.com/suse/elemental/v3/pkg/deployment"
 	"github.com/suse/elemental/v3/pkg/fstab"
+	"github.com/suse/elemental/v3/pkg/luks"
 	"github.com/suse/elemental/v3/pkg/sys"
 	"github.com/suse/elemental/v3/pkg/sys/vfs"
 	"github.com/suse/elemental/v3/pkg/unpack"
@@ -86,7 +88,7 @@ func (n Overwrite) Start() (*Transaction, error) {
 	}
 
 	for _, p := range sysDisk.Partitions {
-		if p.Role == deployment.System {
+		if p.Role == deployment.System || p.Role == deployment.BIOS || p.Role == deployment.Swap {
 			continue
 		}
 
@@ -113,7 +115,7 @@ func (n Overwrite) MountPartition(root string, hwParts block.PartitionList, p *d
 		return fmt.Errorf("failed creating mountpoint %s: %w", target, err)
 	}
 
-	err := n.s.Mounter().Mount(dev.Path, target, p.FileSystem.String(), p.MountOpts)
+	err := n.s.Mounter().Mount(luks.PartitionDevice(p, dev.Path), target, p.FileSystem.String(), p.MountOpts)
 	if err != nil {
 		return fmt.Errorf("failed mounting partition '%s': %w", p.Label, err)
 	}
@@ -130,10 +132,30 @@ func (n Overwrite) Rollback(*Transaction, error) error {
 	return fmt.Errorf("cannot rollback transactions using 'overwrite' snapshotter")
 }
 
+func (n Overwrite) RollbackTo(int) (*Transaction, error) {
+	return nil, fmt.Errorf("'overwrite' snapshotter keeps no previous snapshots to roll back to: %w", errors.ErrUnsupported)
+}
+
+func (n Overwrite) Stage(*Transaction) error {
+	return fmt.Errorf("'overwrite' snapshotter can't stage transactions: %w", errors.ErrUnsupported)
+}
+
+func (n Overwrite) CommitStaged(func() error) (*Transaction, error) {
+	return nil, fmt.Errorf("'overwrite' snapshotter keeps no staged transactions: %w", errors.ErrUnsupported)
+}
+
+func (n Overwrite) DiscardStaged() error {
+	return fmt.Errorf("'overwrite' snapshotter keeps no staged transactions: %w", errors.ErrUnsupported)
+}
+
 func (n Overwrite) GetActiveSnapshotIDs() ([]int, error) {
 	return []int{0}, nil
 }
 
+func (n Overwrite) GetDefaultSnapshotID() (int, error) {
+	return 0, nil
+}
+
 func (n Overwrite) SyncImageContent(imgSrc *deployment.ImageSource, trans *Transaction, opts ...unpack.Opt) (err error) {
 	if trans.status != started {
 		return fmt.Errorf("given transaction '%d' is not started", trans.ID)
@@ -166,16 +188,28 @@ func (n Overwrite) UpdateFstab(trans *Transaction) error {
 	}
 
 	for _, part := range sysDisk.Partitions {
+		if part.Role == deployment.BIOS || part.Role == deployment.Swap {
+			continue
+		}
 		lines = append(lines, fstab.Line{
-			Device:     fmt.Sprintf("PARTUUID=%s", part.UUID),
+			Device:     fstabDevice(part),
 			MountPoint: part.MountPoint,
-			Options:    part.MountOpts,
+			Options:    fstabOptions(part),
 			FileSystem: part.FileSystem.String(),
 		})
-
 	}
+	lines = append(lines, swapFstabLines(sysDisk.Partitions, n.d.Swap)...)
+
 	fstabFile := filepath.Join(trans.Path, fstab.File)
-	return fstab.Write(n.s, fstabFile, lines)
+	err := fstab.Write(n.s, fstabFile, lines)
+	if err != nil {
+		return err
+	}
+
+	if cLines := luks.CrypttabLines(sysDisk.Partitions); len(cLines) > 0 {
+		return luks.WriteCrypttab(n.s, filepath.Join(trans.Path, luks.CrypttabFile), cLines)
+	}
+	return nil
 }
 
 func (n Overwrite) Lock(*Transaction) error {
@@ -19,6 +19,7 @@ package transaction_test
 
 import (
 	"context"
+	"errors"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -93,4 +94,9 @@ var _ = Describe("OverwriteTransaction", Label("transaction", "overwrite"), func
 		Expect(err).ToNot(Succeed())
 		Expect(err.Error()).To(Equal("cannot rollback transactions using 'overwrite' snapshotter"))
 	})
+
+	It("does not support rolling back to a previous snapshot", func() {
+		_, err := overwrite.RollbackTo(0)
+		Expect(err).To(MatchError(errors.ErrUnsupported))
+	})
 })
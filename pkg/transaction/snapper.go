@@ -23,12 +23,14 @@ import (
 	"fmt"
 	"path/filepath"
 	"regexp"
+	"strconv"
 
 	"github.com/suse/elemental/v3/pkg/block"
 	"github.com/suse/elemental/v3/pkg/block/lsblk"
 	"github.com/suse/elemental/v3/pkg/btrfs"
 	"github.com/suse/elemental/v3/pkg/cleanstack"
 	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/luks"
 	"github.com/suse/elemental/v3/pkg/snapper"
 	"github.com/suse/elemental/v3/pkg/sys"
 	"github.com/suse/elemental/v3/pkg/sys/vfs"
@@ -37,16 +39,34 @@ import (
 const (
 	snapshotPathTmpl = ".snapshots/%d/snapshot"
 	updateProgress   = "update-in-progress"
+	updateStaged     = "update-staged"
 	maxSnapshots     = 8
 )
 
 type snapperContext struct {
-	ctx          context.Context
-	s            *sys.System
-	partitions   deployment.Partitions
-	cleanStack   *cleanstack.CleanStack
-	snap         *snapper.Snapper
-	maxSnapshots int
+	ctx        context.Context
+	s          *sys.System
+	partitions deployment.Partitions
+	swap       *deployment.SwapConfig
+	cleanStack *cleanstack.CleanStack
+	snap       *snapper.Snapper
+	retention  snapper.Retention
+	verity     bool
+}
+
+// setRetention sets the snapshots retention of the given deployment. With verity the number of
+// snapshots is capped to the number of verity slots, as older snapshots are no longer bootable.
+func (sc *snapperContext) setRetention(d deployment.Deployment) {
+	if d.Snapshotter != nil {
+		if d.Snapshotter.MaxSnapshots > 0 {
+			sc.retention.MaxSnapshots = d.Snapshotter.MaxSnapshots
+		}
+		sc.retention.MaxAge = d.Snapshotter.MaxAge
+	}
+	if d.Verity != nil {
+		sc.verity = true
+		sc.retention.MaxSnapshots = min(sc.retention.MaxSnapshots, d.Verity.MaxSnapshots())
+	}
 }
 
 // checkCancelled returns the given error if not nil, otherwise it returns the context error if any.
@@ -67,11 +87,11 @@ type snapperT struct {
 
 func NewSnapper(ctx context.Context, s *sys.System) Interface {
 	sc := snapperContext{
-		ctx:          ctx,
-		s:            s,
-		cleanStack:   cleanstack.NewCleanStack(),
-		snap:         snapper.New(s),
-		maxSnapshots: maxSnapshots,
+		ctx:        ctx,
+		s:          s,
+		cleanStack: cleanstack.NewCleanStack(),
+		snap:       snapper.New(s),
+		retention:  snapper.Retention{MaxSnapshots: maxSnapshots},
 	}
 	return &snapperT{
 		snapperContext: sc,
@@ -85,6 +105,8 @@ func (sn *snapperT) Init(d deployment.Deployment) (uh UpgradeHelper, err error)
 	for _, disk := range d.Disks {
 		sn.partitions = append(sn.partitions, disk.Partitions...)
 	}
+	sn.swap = d.Swap
+	sn.setRetention(d)
 
 	if ok, err := sn.isInitiated(d); ok {
 		return sn.snapperContext, nil
@@ -108,6 +130,13 @@ func (sn snapperT) Start() (trans *Transaction, err error) {
 		return nil, fmt.Errorf("uninitialized snapshotter")
 	}
 
+	if sn.defaultID > 0 {
+		err = sn.deleteStaged()
+		if err != nil {
+			return nil, fmt.Errorf("cleaning up stale staged snapshots: %w", err)
+		}
+	}
+
 	sn.s.Logger().Info("Creating new snapshot")
 	trans, err = sn.createNewSnapshot(sn.defaultID)
 	if err != nil {
@@ -150,7 +179,7 @@ func (sn snapperT) Commit(trans *Transaction, cleanup func() error) (err error)
 	if cleanup != nil {
 		sn.cleanStack.Push(cleanup)
 	}
-	sn.cleanStack.Push(func() error { return sn.snap.Cleanup(sn.rootDir, sn.maxSnapshots) })
+	sn.cleanStack.Push(func() error { return sn.snap.Cleanup(sn.rootDir, sn.retention) })
 
 	err = sn.cleanStack.Cleanup(err)
 	if err != nil {
@@ -161,6 +190,106 @@ func (sn snapperT) Commit(trans *Transaction, cleanup func() error) (err error)
 	return err
 }
 
+// Stage closes the given transaction without setting it as the default snapshot. The snapshot is kept
+// as an incomplete transaction tagged with the snapshot it is based on, so it can be committed later on
+// with CommitStaged or dropped with DiscardStaged.
+func (sn snapperT) Stage(trans *Transaction) (err error) {
+	defer func() { err = sn.checkCancelled(err) }()
+
+	if trans.status != started {
+		return fmt.Errorf("transaction '%d' is not started", trans.ID)
+	}
+	sn.s.Logger().Info("Staging transaction")
+
+	sn.s.Logger().Info("Creating post-transaction snapshots")
+	err = sn.createPostSnapshots(trans.Path)
+	if err != nil {
+		return fmt.Errorf("creating post transaction snapshots: %w", err)
+	}
+
+	err = sn.snap.SetUserData(trans.Path, trans.ID, map[string]string{updateStaged: strconv.Itoa(sn.defaultID)})
+	if err != nil {
+		return fmt.Errorf("tagging staged snapshot: %w", err)
+	}
+	trans.status = staged
+
+	err = sn.cleanStack.Cleanup(err)
+	if err != nil {
+		sn.s.Logger().Error("transaction cleanup procedure failed after staging")
+	}
+	sn.s.Logger().Info("Transaction staged as snapshot %d", trans.ID)
+
+	return err
+}
+
+// CommitStaged sets the staged snapshot as the new default one. It fails if the default snapshot
+// changed since the snapshot was staged. It returns the committed transaction of the staged snapshot.
+func (sn snapperT) CommitStaged(cleanup func() error) (trans *Transaction, err error) {
+	defer func() { err = sn.checkCancelled(err) }()
+
+	if len(sn.hwPartitions) == 0 {
+		return nil, fmt.Errorf("uninitialized snapshotter")
+	}
+
+	snaps, err := sn.stagedSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	if len(snaps) == 0 {
+		return nil, fmt.Errorf("no staged snapshot found")
+	}
+	snap := snaps[len(snaps)-1]
+
+	if base := snap.UserData[updateStaged]; base != strconv.Itoa(sn.defaultID) {
+		return nil, fmt.Errorf(
+			"staged snapshot %d is stale: it is based on snapshot %s, but the default snapshot is %d",
+			snap.Number, base, sn.defaultID,
+		)
+	}
+
+	sn.s.Logger().Info("Setting staged snapshot %d as the new default snapshot", snap.Number)
+	err = sn.snap.SetDefault(sn.rootDir, snap.Number, map[string]string{updateProgress: "", updateStaged: ""})
+	if err != nil {
+		return nil, fmt.Errorf("setting snapshot %d as default: %w", snap.Number, err)
+	}
+	trans = &Transaction{
+		ID:     snap.Number,
+		Path:   filepath.Join(sn.rootDir, fmt.Sprintf(snapshotPathTmpl, snap.Number)),
+		status: committed,
+	}
+
+	if cleanup != nil {
+		sn.cleanStack.Push(cleanup)
+	}
+	sn.cleanStack.Push(func() error { return sn.snap.Cleanup(sn.rootDir, sn.retention) })
+
+	err = sn.cleanStack.Cleanup(err)
+	if err != nil {
+		sn.s.Logger().Error("transaction cleanup procedure failed after committing")
+	}
+
+	return trans, err
+}
+
+// DiscardStaged deletes the staged snapshots
+func (sn snapperT) DiscardStaged() (err error) {
+	defer func() { err = sn.checkCancelled(err) }()
+
+	if len(sn.hwPartitions) == 0 {
+		return fmt.Errorf("uninitialized snapshotter")
+	}
+
+	snaps, err := sn.stagedSnapshots()
+	if err != nil {
+		return err
+	}
+	if len(snaps) == 0 {
+		return fmt.Errorf("no staged snapshot found")
+	}
+
+	return sn.deleteStaged()
+}
+
 // Rollback closes the given in progress transaction by deleting the
 // associated resources. This is a cleanup method in case occurs during a transaction.
 func (sn snapperT) Rollback(trans *Transaction, e error) (err error) {
@@ -175,6 +304,126 @@ func (sn snapperT) Rollback(trans *Transaction, e error) (err error) {
 	return err
 }
 
+// RollbackTo sets the given snapshot as the default one to boot from. If the given ID is zero
+// it rolls back to the newest complete snapshot older than the current default. It returns the
+// transaction of the new default snapshot, which is already committed.
+func (sn snapperT) RollbackTo(id int) (trans *Transaction, err error) {
+	defer func() { err = sn.checkCancelled(err) }()
+
+	if len(sn.hwPartitions) == 0 {
+		return nil, fmt.Errorf("uninitialized snapshotter")
+	}
+	if sn.defaultID == 0 {
+		return nil, fmt.Errorf("no snapshots found to roll back to")
+	}
+
+	snaps, err := sn.snap.ListSnapshots(sn.rootDir, "root")
+	if err != nil {
+		return nil, fmt.Errorf("listing snapshots: %w", err)
+	}
+
+	if id == 0 {
+		for _, snap := range snaps {
+			if snap.Number < sn.defaultID && snap.UserData[updateProgress] != "yes" {
+				id = snap.Number
+			}
+		}
+		if id == 0 {
+			return nil, fmt.Errorf("no snapshot found previous to the default snapshot %d", sn.defaultID)
+		}
+	}
+
+	snap := snaps.Get(id)
+	switch {
+	case snap == nil:
+		return nil, fmt.Errorf("snapshot %d not found", id)
+	case snap.Number == sn.defaultID:
+		return nil, fmt.Errorf("snapshot %d is already the default snapshot", id)
+	case snap.UserData[updateProgress] == "yes":
+		return nil, fmt.Errorf("snapshot %d is an incomplete transaction", id)
+	}
+
+	if sn.verity {
+		err = sn.checkVeritySlot(snaps, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sn.s.Logger().Info("Rolling back from snapshot %d to snapshot %d", sn.defaultID, id)
+	err = sn.snap.SetDefault(sn.rootDir, id, nil)
+	if err != nil {
+		return nil, fmt.Errorf("setting snapshot %d as default: %w", id, err)
+	}
+
+	return &Transaction{
+		ID:     id,
+		Path:   filepath.Join(sn.rootDir, fmt.Sprintf(snapshotPathTmpl, id)),
+		status: committed,
+	}, nil
+}
+
+// checkVeritySlot fails if the verity slot of the given snapshot was overwritten by a newer snapshot,
+// as its /usr image no longer matches the root hash of its boot entry
+func (sn snapperT) checkVeritySlot(snaps snapper.Snapshots, id int) error {
+	target, err := deployment.Parse(sn.s, filepath.Join(sn.rootDir, fmt.Sprintf(snapshotPathTmpl, id)))
+	if err != nil {
+		return fmt.Errorf("parsing deployment of snapshot %d: %w", id, err)
+	} else if target == nil || target.Verity == nil {
+		return nil
+	}
+
+	for _, snap := range snaps {
+		if snap.Number <= id {
+			continue
+		}
+		d, err := deployment.Parse(sn.s, filepath.Join(sn.rootDir, fmt.Sprintf(snapshotPathTmpl, snap.Number)))
+		if err != nil {
+			return fmt.Errorf("parsing deployment of snapshot %d: %w", snap.Number, err)
+		}
+		if d != nil && d.Verity != nil && d.Verity.Slot == target.Verity.Slot {
+			return fmt.Errorf(
+				"snapshot %d is not bootable: its verity slot '%s' was overwritten by snapshot %d",
+				id, target.Verity.Slot, snap.Number,
+			)
+		}
+	}
+	return nil
+}
+
+// stagedSnapshots returns the root snapshots staged for a later commit
+func (sn snapperT) stagedSnapshots() (snapper.Snapshots, error) {
+	snaps, err := sn.snap.ListSnapshots(sn.rootDir, "root")
+	if err != nil {
+		return nil, fmt.Errorf("listing snapshots: %w", err)
+	}
+
+	var staged snapper.Snapshots
+	for _, snap := range snaps {
+		if snap.UserData[updateStaged] != "" && !snap.Default {
+			staged = append(staged, snap)
+		}
+	}
+	return staged, nil
+}
+
+// deleteStaged deletes all the root snapshots staged for a later commit
+func (sn snapperT) deleteStaged() error {
+	snaps, err := sn.stagedSnapshots()
+	if err != nil {
+		return err
+	}
+
+	for _, snap := range snaps {
+		sn.s.Logger().Info("Deleting staged snapshot %d", snap.Number)
+		err = sn.snap.DeleteByPath(filepath.Join(sn.rootDir, fmt.Sprintf(snapshotPathTmpl, snap.Number)))
+		if err != nil {
+			return fmt.Errorf("deleting staged snapshot %d: %w", snap.Number, err)
+		}
+	}
+	return nil
+}
+
 // isInitiatied checks if the current snapper instance is already initiated.
 // Does nothing if it is already initiated or initiates it if it is not.
 func (sn *snapperT) isInitiated(d deployment.Deployment) (bool, error) {
@@ -207,11 +456,12 @@ func (sn *snapperT) probe(d deployment.Deployment) (err error) {
 		return fmt.Errorf("system partition not found: %+v", sysPart)
 	}
 
-	mountPoints, err := sn.s.Mounter().GetMountPoints(part.Path)
+	device := luks.PartitionDevice(sysPart, part.Path)
+	mountPoints, err := sn.s.Mounter().GetMountPoints(device)
 	if err != nil {
 		return fmt.Errorf("getting mount points: %w", err)
 	} else if len(mountPoints) == 0 {
-		return fmt.Errorf("no mountpoints found for device '%s'", part.Path)
+		return fmt.Errorf("no mountpoints found for device '%s'", device)
 	}
 
 	r := regexp.MustCompile(fmt.Sprintf(`%s/.snapshots/\d+/snapshot$`, btrfs.TopSubVol))
@@ -254,6 +504,15 @@ func (sn snapperT) GetActiveSnapshotIDs() ([]int, error) {
 	return snapIDs, nil
 }
 
+// GetDefaultSnapshotID returns the ID of the current default snapshot, which is the base
+// for new transactions. Returns 0 if there are no snapshots yet.
+func (sn snapperT) GetDefaultSnapshotID() (int, error) {
+	if len(sn.hwPartitions) == 0 {
+		return 0, fmt.Errorf("uninitialized snapshotter")
+	}
+	return sn.defaultID, nil
+}
+
 // mountPartition mounts the given partition to the given mount point. In addition it also
 // sets the umount cleanup task.
 func (sn snapperT) mountPartition(part *deployment.Partition, mountPoint string) error {
@@ -265,7 +524,7 @@ func (sn snapperT) mountPartition(part *deployment.Partition, mountPoint string)
 	if bPart == nil {
 		return fmt.Errorf("partition '%s' not found", part.UUID)
 	}
-	err = sn.s.Mounter().Mount(bPart.Path, mountPoint, "", []string{"rw"})
+	err = sn.s.Mounter().Mount(luks.PartitionDevice(part, bPart.Path), mountPoint, "", []string{"rw"})
 	if err != nil {
 		return fmt.Errorf("mounting partition at '%s': %w", mountPoint, err)
 	}
@@ -302,7 +561,7 @@ func (sn snapperT) mountVol(part *deployment.Partition, volumePath, mountPoint s
 		return fmt.Errorf("creating mountpoint at '%s': %w", mountPoint, err)
 	}
 	err = sn.s.Mounter().Mount(
-		bPart.Path, mountPoint, "",
+		luks.PartitionDevice(part, bPart.Path), mountPoint, "",
 		[]string{"rw", fmt.Sprintf("subvol=%s", filepath.Join(btrfs.TopSubVol, volumePath))},
 	)
 	if err != nil {
@@ -24,6 +24,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/suse/elemental/v3/pkg/deployment"
 	"github.com/suse/elemental/v3/pkg/transaction"
 )
 
@@ -105,7 +106,7 @@ var _ = Describe("SnapperTransaction", Label("transaction"), func() {
 				}
 				err = sn.Commit(trans, nil)
 				Expect(err).To(HaveOccurred())
-				Expect(err).To(MatchError("setting new default snapshot: failed setting default"))
+				Expect(err).To(MatchError("setting new default snapshot: modifying snapshot 1: error setting default: failed setting default"))
 			})
 			It("fails to commit a non started transaction", func() {
 				trans = &transaction.Transaction{ID: 4}
@@ -177,12 +178,197 @@ var _ = Describe("SnapperTransaction", Label("transaction"), func() {
 					{"snapper", "--no-dbus", "--root", "/.snapshots/5/snapshot", "modify", "--default"},
 				})).To(Succeed())
 			})
+			It("stages a transaction", func() {
+				sideEffects["snapper"] = func(args ...string) ([]byte, error) {
+					if slices.Contains(args, "create") {
+						return []byte("2\n"), nil
+					}
+					return runner.ReturnValue, runner.ReturnError
+				}
+				Expect(sn.Stage(trans)).To(Succeed())
+				Expect(runner.MatchMilestones([][]string{
+					{"snapper", "--no-dbus", "--root", "/.snapshots/5/snapshot", "-c", "etc", "create"},
+					{"snapper", "--no-dbus", "--root", "/.snapshots/5/snapshot", "modify", "--userdata", "update-staged=4", "5"},
+				})).To(Succeed())
+				for _, cmd := range runner.GetCmds() {
+					Expect(cmd).NotTo(ContainElement("--default"))
+				}
+				Expect(sn.Commit(trans, nil)).To(MatchError("transaction '5' is not started"))
+			})
+			It("fails to stage a transaction if it can't be tagged", func() {
+				sideEffects["snapper"] = func(args ...string) ([]byte, error) {
+					if slices.Contains(args, "create") {
+						return []byte("2\n"), nil
+					}
+					if slices.Contains(args, "--userdata") && slices.Contains(args, "modify") {
+						return []byte{}, fmt.Errorf("failed modifying snapshot")
+					}
+					return runner.ReturnValue, runner.ReturnError
+				}
+				Expect(sn.Stage(trans)).To(MatchError("tagging staged snapshot: modifying snapshot 5: : failed modifying snapshot"))
+			})
+		})
+		Describe("handling staged snapshots", func() {
+			var snapList string
+			BeforeEach(func() {
+				snapList = fmt.Sprintf(stagedSnapList, 4)
+				sideEffects["snapper"] = func(args ...string) ([]byte, error) {
+					if slices.Contains(args, "list") {
+						return []byte(snapList), nil
+					}
+					return runner.ReturnValue, runner.ReturnError
+				}
+			})
+			It("commits the staged snapshot", func() {
+				trans, err = sn.CommitStaged(nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(trans.ID).To(Equal(5))
+				Expect(trans.Path).To(Equal("/.snapshots/5/snapshot"))
+				Expect(runner.MatchMilestones([][]string{
+					{"snapper", "--no-dbus", "-c", "root", "--jsonout", "list"},
+					{"snapper", "--no-dbus", "modify", "--default", "--userdata"},
+				})).To(Succeed())
+			})
+			It("fails to commit a stale staged snapshot", func() {
+				snapList = fmt.Sprintf(stagedSnapList, 3)
+				_, err = sn.CommitStaged(nil)
+				Expect(err).To(MatchError(
+					"staged snapshot 5 is stale: it is based on snapshot 3, but the default snapshot is 4",
+				))
+			})
+			It("fails to commit if there is no staged snapshot", func() {
+				snapList = upgradeSnapList
+				_, err = sn.CommitStaged(nil)
+				Expect(err).To(MatchError("no staged snapshot found"))
+			})
+			It("discards the staged snapshot", func() {
+				Expect(sn.DiscardStaged()).To(Succeed())
+				Expect(runner.MatchMilestones([][]string{
+					{"btrfs", "property", "set", "-ts", "/.snapshots/5/snapshot", "ro", "false"},
+					{"btrfs", "subvolume", "delete", "-c", "-R", "/.snapshots/5/snapshot"},
+				})).To(Succeed())
+
+				snapList = upgradeSnapList
+				Expect(sn.DiscardStaged()).To(MatchError("no staged snapshot found"))
+			})
+			It("deletes stale staged snapshots when starting a new transaction", func() {
+				sideEffects["snapper"] = func(args ...string) ([]byte, error) {
+					if slices.Contains(args, "create") {
+						return []byte("6\n"), nil
+					}
+					if slices.Contains(args, "root") && slices.Contains(args, "list") {
+						return []byte(snapList), nil
+					}
+					if slices.Contains(args, "etc") && slices.Contains(args, "list") {
+						return []byte(etcSnaps), nil
+					}
+					if slices.Contains(args, "home") && slices.Contains(args, "list") {
+						return []byte(homeSnaps), nil
+					}
+					return runner.ReturnValue, runner.ReturnError
+				}
+				trans, err = sn.Start()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(trans.ID).To(Equal(6))
+				Expect(runner.MatchMilestones([][]string{
+					{"btrfs", "subvolume", "delete", "-c", "-R", "/.snapshots/5/snapshot"},
+					{"snapper", "--no-dbus", "-c", "root", "create", "--print-number"},
+				})).To(Succeed())
+			})
+		})
+		Describe("rolling back", func() {
+			It("rolls back to the previous snapshot", func() {
+				trans, err = sn.RollbackTo(0)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(trans.ID).To(Equal(3))
+				Expect(trans.Path).To(Equal("/.snapshots/3/snapshot"))
+				Expect(runner.MatchMilestones([][]string{
+					{"snapper", "--no-dbus", "-c", "root", "--jsonout", "list"},
+					{"snapper", "--no-dbus", "modify", "--default", "3"},
+				})).To(Succeed())
+			})
+			It("rolls back to the given snapshot", func() {
+				trans, err = sn.RollbackTo(1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(trans.ID).To(Equal(1))
+				Expect(runner.MatchMilestones([][]string{
+					{"snapper", "--no-dbus", "modify", "--default", "1"},
+				})).To(Succeed())
+			})
+			It("fails to roll back to the current default snapshot", func() {
+				_, err = sn.RollbackTo(4)
+				Expect(err).To(MatchError("snapshot 4 is already the default snapshot"))
+			})
+			It("fails to roll back to an unknown snapshot", func() {
+				_, err = sn.RollbackTo(7)
+				Expect(err).To(MatchError("snapshot 7 not found"))
+			})
+			It("fails to roll back if setting the default snapshot fails", func() {
+				sideEffects["snapper"] = func(args ...string) ([]byte, error) {
+					if slices.Contains(args, "--default") {
+						return []byte{}, fmt.Errorf("failed setting default")
+					}
+					return []byte(upgradeSnapList), nil
+				}
+				_, err = sn.RollbackTo(2)
+				Expect(err).To(MatchError("setting snapshot 2 as default: modifying snapshot 2: : failed setting default"))
+			})
+		})
+		Describe("with verity", func() {
+			BeforeEach(func() {
+				d.Verity = &deployment.VerityConfig{Size: 1024}
+				for id, slot := range []string{"a", "b", "a", "b"} {
+					snapD := deployment.DefaultDeployment()
+					snapD.Verity = &deployment.VerityConfig{Size: 1024, Slot: slot}
+					Expect(snapD.WriteDeploymentFile(s, fmt.Sprintf("/.snapshots/%d/snapshot", id+1))).To(Succeed())
+				}
+				runner.ClearCmds()
+				_ = initSnapperUpgrade(root)
+			})
+			It("keeps only the snapshots of the verity slots", func() {
+				trans = startUpgradeTransaction()
+				sideEffects["snapper"] = func(args ...string) ([]byte, error) {
+					if slices.Contains(args, "create") {
+						return []byte("2\n"), nil
+					}
+					if slices.Contains(args, "list") {
+						return []byte(upgradeSnapList), nil
+					}
+					return runner.ReturnValue, runner.ReturnError
+				}
+				Expect(sn.Commit(trans, nil)).To(Succeed())
+				Expect(runner.MatchMilestones([][]string{
+					{"btrfs", "subvolume", "delete", "-c", "-R", "/.snapshots/1/snapshot"},
+					{"btrfs", "subvolume", "delete", "-c", "-R", "/.snapshots/2/snapshot"},
+				})).To(Succeed())
+				Expect(runner.IncludesCmds([][]string{
+					{"btrfs", "subvolume", "delete", "-c", "-R", "/.snapshots/3/snapshot"},
+				})).NotTo(Succeed())
+			})
+			It("rolls back to the snapshot of the other verity slot", func() {
+				trans, err = sn.RollbackTo(0)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(trans.ID).To(Equal(3))
+			})
+			It("fails to roll back to a snapshot with an overwritten verity slot", func() {
+				_, err = sn.RollbackTo(2)
+				Expect(err).To(MatchError("snapshot 2 is not bootable: its verity slot 'b' was overwritten by snapshot 4"))
+				Expect(runner.IncludesCmds([][]string{{"snapper", "--no-dbus", "modify", "--default", "2"}})).NotTo(Succeed())
+			})
+		})
+		It("returns the default snapshot ID", func() {
+			id, err := sn.GetDefaultSnapshotID()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).To(Equal(4))
 		})
 		It("it fails to start a transaction if it does not find previous snapshotted volumes", func() {
 			sideEffects["snapper"] = func(args ...string) ([]byte, error) {
 				if slices.Contains(args, "create") {
 					return []byte("5\n"), nil
 				}
+				if slices.Contains(args, "root") && slices.Contains(args, "list") {
+					return []byte(upgradeSnapList), nil
+				}
 				return runner.ReturnValue, runner.ReturnError
 			}
 			trans, err = sn.Start()
@@ -195,6 +381,16 @@ var _ = Describe("SnapperTransaction", Label("transaction"), func() {
 			})).To(Succeed())
 		})
 	})
+	It("fails to roll back with an uninitialized snapper transactioner", func() {
+		sn = transaction.NewSnapper(ctx, s)
+		_, err = sn.RollbackTo(0)
+		Expect(err).To(MatchError("uninitialized snapshotter"))
+	})
+	It("fails to get the default snapshot with an uninitialized snapper transactioner", func() {
+		sn = transaction.NewSnapper(ctx, s)
+		_, err = sn.GetDefaultSnapshotID()
+		Expect(err).To(MatchError("uninitialized snapshotter"))
+	})
 	It("fails to init snapper transactioner if it can't list snapshots", func() {
 		Expect(mount.Mount("/dev/sda2", "/", "", []string{"ro", "subvol=@/.snapshots/4/snapshot"})).To(Succeed())
 		sideEffects["lsblk"] = func(args ...string) ([]byte, error) {
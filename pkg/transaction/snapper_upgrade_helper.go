@@ -19,17 +19,23 @@ package transaction
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 
+	"go.yaml.in/yaml/v3"
+
 	"github.com/suse/elemental/v3/pkg/btrfs"
 	"github.com/suse/elemental/v3/pkg/chroot"
 	"github.com/suse/elemental/v3/pkg/deployment"
 	"github.com/suse/elemental/v3/pkg/fstab"
+	"github.com/suse/elemental/v3/pkg/luks"
 	"github.com/suse/elemental/v3/pkg/rsync"
 	"github.com/suse/elemental/v3/pkg/snapper"
 	"github.com/suse/elemental/v3/pkg/sys/vfs"
@@ -99,6 +105,13 @@ func (sc snapperContext) UpdateFstab(trans *Transaction) (err error) {
 	if err != nil {
 		return fmt.Errorf("creating fstab: %w", err)
 	}
+
+	if lines := luks.CrypttabLines(sc.partitions); len(lines) > 0 {
+		err = luks.WriteCrypttab(sc.s, filepath.Join(trans.Path, luks.CrypttabFile), lines)
+		if err != nil {
+			return fmt.Errorf("creating crypttab: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -159,7 +172,7 @@ func (sc snapperContext) syncSnapshotDeleteExcludes() []string {
 
 // configureSnapper sets the snapper configuration for root and any snapshotted volume.
 func (sc snapperContext) configureSnapper(trans *Transaction) error {
-	err := sc.snap.ConfigureRoot(trans.Path, sc.maxSnapshots)
+	err := sc.snap.ConfigureRoot(trans.Path, sc.retention.MaxSnapshots)
 	if err != nil {
 		return fmt.Errorf("setting root configuration: %w", err)
 	}
@@ -211,12 +224,14 @@ func (sc snapperContext) configureRWVolumes(trans *Transaction) error {
 	return chroot.ChrootedCallback(sc.s, trans.Path, nil, callback, chroot.WithoutDefaultBinds())
 }
 
-// merge runs a 3 way merge for snapshotted RW volumes.
-// Current implementation solves potential conflicts by always keeping
-// custom changes over changes coming from the OS image.
+// merge runs a 3 way merge for snapshotted RW volumes. Conflicts, paths changed both locally
+// and in the OS image, are solved according to the merge policies of each volume and listed in
+// a merge report written into the new snapshot.
 func (sc snapperContext) merge(trans *Transaction) (err error) {
 	var status, tmpDir string
+	var conflicts []MergeConflict
 
+	report := &MergeReport{Snapshot: trans.ID}
 	for _, rwVol := range sc.partitions.GetSnapshottedVolumes() {
 		m := trans.Merges[rwVol.Path]
 		if m == nil {
@@ -240,12 +255,21 @@ func (sc snapperContext) merge(trans *Transaction) (err error) {
 			return err
 		}
 
-		err = sc.applyCustomChanges(status, rwVol.Path, m)
+		conflicts, err = sc.applyCustomChanges(status, rwVol, m)
 		if err != nil {
 			return err
 		}
+		report.Conflicts = append(report.Conflicts, conflicts...)
 	}
-	return nil
+
+	if len(trans.Merges) == 0 {
+		return nil
+	}
+
+	for _, conflict := range report.Conflicts {
+		sc.s.Logger().Warn("Merge conflict on '%s', keeping the %s version", conflict.Path, conflict.Kept)
+	}
+	return sc.writeMergeReport(trans.Path, report)
 }
 
 // customChangesStatus checks the status between the old stock content and the current customized content
@@ -275,26 +299,23 @@ func (sc snapperContext) customChangesStatus(volPath string, merge *Merge, outpu
 }
 
 // applyCustomChanges reads the given status file and applies reported changes in to the target destination.
-// This method is the responsible of applying customizations to the new volume
-func (sc snapperContext) applyCustomChanges(status, rwVolPath string, merge *Merge) (err error) {
-	sc.s.Logger().Debug("rw volume path: %s", rwVolPath)
+// This method is the responsible of applying customizations to the new volume. Changes conflicting with
+// the new OS image are applied according to the volume merge policies and returned.
+func (sc snapperContext) applyCustomChanges(status string, rwVol deployment.RWVolume, merge *Merge) (conflicts []MergeConflict, err error) {
+	var removals, syncs, failed []string
+
+	sc.s.Logger().Debug("rw volume path: %s", rwVol.Path)
 	statusF, err := sc.s.FS().OpenFile(status, os.O_RDONLY, vfs.FilePerm)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer func() {
 		e := statusF.Close()
-		if err != nil {
+		if err == nil && e != nil {
 			err = fmt.Errorf("failed closing status file: %w", e)
 		}
 	}()
 
-	syncFiles := filepath.Join(filepath.Dir(status), fmt.Sprintf("sync_%s", snapper.ConfigName(rwVolPath)))
-	syncF, err := sc.s.FS().OpenFile(syncFiles, os.O_CREATE|os.O_WRONLY, vfs.FilePerm)
-	if err != nil {
-		return fmt.Errorf("failed opening modified files list: %w", err)
-	}
-
 	r := regexp.MustCompile(`(([-+ct.])[p.][u.][g.][x.][a.])\s+(.*)`)
 
 	scanner := bufio.NewScanner(statusF)
@@ -302,31 +323,62 @@ func (sc snapperContext) applyCustomChanges(status, rwVolPath string, merge *Mer
 		line := scanner.Text()
 		match := r.FindStringSubmatch(line)
 
-		switch {
-		case len(match) == 0:
-			continue
-		case match[1] == "....":
+		if len(match) == 0 || match[1] == "....x." {
 			// Ignore extended attributes changes because the stock snapshot used for
 			// comparison was taken before SELINUX relabelling, hence this is likely to
 			// list almost every single file.
 			continue
-		case match[2] == "-":
-			err = sc.s.FS().RemoveAll(filepath.Join(merge.New, match[3]))
-			if err != nil {
-				_ = syncF.Close()
-				return err
-			}
-		default:
-			_, err = fmt.Fprintln(syncF, strings.TrimPrefix(match[3], rwVolPath))
-			if err != nil {
-				_ = syncF.Close()
-				return err
+		}
+
+		path := strings.TrimPrefix(match[3], rwVol.Path)
+		changed, err := sc.imageChanged(merge, path)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			policy := rwVol.GetMergePolicy(match[3])
+			conflict := MergeConflict{Volume: rwVol.Path, Path: match[3], Policy: policy.String(), Kept: "local"}
+			switch policy {
+			case deployment.FailOnConflict:
+				failed = append(failed, match[3])
+				continue
+			case deployment.PreferImage:
+				conflict.Kept = "image"
+				conflicts = append(conflicts, conflict)
+				continue
 			}
+			conflicts = append(conflicts, conflict)
+		}
+
+		if match[2] == "-" {
+			removals = append(removals, path)
+		} else {
+			syncs = append(syncs, path)
 		}
 	}
-	err = syncF.Close()
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading status file: %w", err)
+	}
+
+	if len(failed) > 0 {
+		return nil, fmt.Errorf("conflicting changes in '%s': %s", rwVol.Path, strings.Join(failed, ", "))
+	}
+
+	for _, path := range removals {
+		err = sc.s.FS().RemoveAll(filepath.Join(merge.New, path))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var syncList strings.Builder
+	for _, path := range syncs {
+		syncList.WriteString(path + "\n")
+	}
+	syncFiles := filepath.Join(filepath.Dir(status), fmt.Sprintf("sync_%s", snapper.ConfigName(rwVol.Path)))
+	err = sc.s.FS().WriteFile(syncFiles, []byte(syncList.String()), vfs.FilePerm)
 	if err != nil {
-		return fmt.Errorf("failed closing modified files list: %w", err)
+		return nil, fmt.Errorf("failed writing modified files list: %w", err)
 	}
 
 	syncFlags := append(rsync.DefaultFlags(), "--files-from", syncFiles)
@@ -334,9 +386,76 @@ func (sc snapperContext) applyCustomChanges(status, rwVolPath string, merge *Mer
 	sync := rsync.NewRsync(sc.s, rsync.WithContext(sc.ctx), rsync.WithFlags(syncFlags...))
 	err = sync.SyncData(merge.Modified, merge.New, snapper.SnapshotsPath)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return conflicts, nil
+}
+
+// imageChanged checks if the given volume path differs between the old stock tree and the new tree
+func (sc snapperContext) imageChanged(merge *Merge, path string) (bool, error) {
+	oldPath := filepath.Join(merge.Old, path)
+	newPath := filepath.Join(merge.New, path)
+
+	oldInfo, oldErr := sc.s.FS().Lstat(oldPath)
+	if oldErr != nil && !errors.Is(oldErr, fs.ErrNotExist) {
+		return false, fmt.Errorf("inspecting '%s': %w", oldPath, oldErr)
+	}
+	newInfo, newErr := sc.s.FS().Lstat(newPath)
+	if newErr != nil && !errors.Is(newErr, fs.ErrNotExist) {
+		return false, fmt.Errorf("inspecting '%s': %w", newPath, newErr)
+	}
+
+	switch {
+	case oldErr != nil || newErr != nil:
+		return (oldErr == nil) != (newErr == nil), nil
+	case oldInfo.Mode().Type() != newInfo.Mode().Type():
+		return true, nil
+	case oldInfo.Mode().Type() == fs.ModeSymlink:
+		oldTarget, err := sc.s.FS().Readlink(oldPath)
+		if err != nil {
+			return false, err
+		}
+		newTarget, err := sc.s.FS().Readlink(newPath)
+		if err != nil {
+			return false, err
+		}
+		return oldTarget != newTarget, nil
+	case oldInfo.Mode().IsRegular():
+		if oldInfo.Size() != newInfo.Size() {
+			return true, nil
+		}
+		oldData, err := sc.s.FS().ReadFile(oldPath)
+		if err != nil {
+			return false, err
+		}
+		newData, err := sc.s.FS().ReadFile(newPath)
+		if err != nil {
+			return false, err
+		}
+		return !bytes.Equal(oldData, newData), nil
+	}
+	return false, nil
+}
+
+// writeMergeReport writes the given merge report into the given root, replacing the report of any
+// previous upgrade
+func (sc snapperContext) writeMergeReport(root string, report *MergeReport) error {
+	path := filepath.Join(root, MergeReportFile)
+	err := vfs.MkdirAll(sc.s.FS(), filepath.Dir(path), vfs.DirPerm)
+	if err != nil {
+		return fmt.Errorf("creating merge report directory: %w", err)
+	}
+
+	data, err := yaml.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("marshalling merge report: %w", err)
 	}
 
+	err = sc.s.FS().WriteFile(path, data, vfs.FilePerm)
+	if err != nil {
+		return fmt.Errorf("writing merge report '%s': %w", path, err)
+	}
 	return nil
 }
 
@@ -383,7 +502,7 @@ func (sc snapperContext) updateFstab(trans *Transaction) error {
 			opts := rwVol.MountOpts
 			oldLines = append(oldLines, fstab.Line{MountPoint: rwVol.Path})
 			newLines = append(newLines, fstab.Line{
-				Device:     fmt.Sprintf("PARTUUID=%s", part.UUID),
+				Device:     fstabDevice(part),
 				MountPoint: rwVol.Path,
 				Options:    append(opts, fmt.Sprintf("subvol=%s", subVol)),
 				FileSystem: part.FileSystem.String(),
@@ -404,7 +523,7 @@ func (sc snapperContext) createFstab(trans *Transaction) error {
 		if part.MountPoint != "" {
 			var line fstab.Line
 
-			opts := part.MountOpts
+			opts := fstabOptions(part)
 			if part.Role == deployment.System {
 				line.FsckOrder = 1
 			} else {
@@ -413,7 +532,7 @@ func (sc snapperContext) createFstab(trans *Transaction) error {
 			if len(opts) == 0 {
 				opts = []string{"defaults"}
 			}
-			line.Device = fmt.Sprintf("PARTUUID=%s", part.UUID)
+			line.Device = fstabDevice(part)
 			line.MountPoint = part.MountPoint
 			line.Options = opts
 			line.FileSystem = part.FileSystem.String()
@@ -430,7 +549,7 @@ func (sc snapperContext) createFstab(trans *Transaction) error {
 			}
 			opts := rwVol.MountOpts
 			opts = append(opts, fmt.Sprintf("subvol=%s", subVol))
-			line.Device = fmt.Sprintf("PARTUUID=%s", part.UUID)
+			line.Device = fstabDevice(part)
 			line.MountPoint = rwVol.Path
 			line.Options = opts
 			line.FileSystem = part.FileSystem.String()
@@ -439,13 +558,14 @@ func (sc snapperContext) createFstab(trans *Transaction) error {
 		if part.Role == deployment.System {
 			var line fstab.Line
 			subVol := filepath.Join(btrfs.TopSubVol, snapper.SnapshotsPath)
-			line.Device = fmt.Sprintf("PARTUUID=%s", part.UUID)
+			line.Device = fstabDevice(part)
 			line.MountPoint = filepath.Join("/", snapper.SnapshotsPath)
 			line.Options = []string{fmt.Sprintf("subvol=%s", subVol)}
 			line.FileSystem = part.FileSystem.String()
 			fstabLines = append(fstabLines, line)
 		}
 	}
+	fstabLines = append(fstabLines, swapFstabLines(sc.partitions, sc.swap)...)
 
 	return fstab.Write(sc.s, filepath.Join(trans.Path, fstab.File), fstabLines)
 }
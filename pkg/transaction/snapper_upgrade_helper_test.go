@@ -21,11 +21,13 @@ import (
 	"fmt"
 	"path/filepath"
 	"slices"
+	"strings"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	"github.com/suse/elemental/v3/pkg/btrfs"
+	"github.com/suse/elemental/v3/pkg/deployment"
 	"github.com/suse/elemental/v3/pkg/sys/vfs"
 	"github.com/suse/elemental/v3/pkg/transaction"
 )
@@ -35,6 +37,7 @@ const snapperStatus = `{
 +..... /etc/createdFile
 c..... /etc/modifiedFile
 ....x. /etc/relabelledFile
+.....a /etc/aclFile
 `
 
 var _ = Describe("SnapperUpgradeHelper", Label("transaction"), func() {
@@ -105,6 +108,29 @@ var _ = Describe("SnapperUpgradeHelper", Label("transaction"), func() {
 				{"rsync"},
 			})).NotTo(Succeed())
 		})
+		It("configures the snapshots retention of the deployment", func() {
+			snapshotP := filepath.Join(root, btrfs.TopSubVol, ".snapshots/1/snapshot")
+			template := filepath.Join(snapshotP, "/usr/share/snapper/config-templates/default")
+			Expect(vfs.MkdirAll(tfs, filepath.Join(snapshotP, "/etc/snapper/configs"), vfs.DirPerm)).To(Succeed())
+			Expect(vfs.MkdirAll(tfs, filepath.Join(snapshotP, "/etc/sysconfig"), vfs.DirPerm)).To(Succeed())
+			Expect(vfs.MkdirAll(tfs, filepath.Dir(template), vfs.DirPerm)).To(Succeed())
+			Expect(tfs.WriteFile(template, []byte{}, vfs.FilePerm)).To(Succeed())
+
+			runner.ClearCmds()
+			d.Snapshotter.MaxSnapshots = 4
+			upgradeH = initSnapperInstall(root)
+			sideEffects["snapper"] = func(args ...string) ([]byte, error) {
+				if slices.Contains(args, "create") {
+					return []byte("2\n"), nil
+				}
+				return []byte{}, nil
+			}
+
+			Expect(upgradeH.Merge(trans)).To(Succeed())
+			config, err := vfs.LoadEnvFile(tfs, filepath.Join(snapshotP, "/etc/snapper/configs/root"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config["NUMBER_LIMIT"]).To(Equal("1-4"))
+		})
 		It("fails to create snapper configuration if templates are not found", func() {
 			err = upgradeH.Merge(trans)
 			Expect(err).To(HaveOccurred())
@@ -125,6 +151,56 @@ var _ = Describe("SnapperUpgradeHelper", Label("transaction"), func() {
 			Expect(err).NotTo(HaveOccurred())
 			Expect(string(data)).To(Not(ContainSubstring("PARTUUID=d7dd841f-aeaa-4fe3-a383-8913f4e8d4de")))
 		})
+		It("creates fstab and crypttab for encrypted partitions", func() {
+			d.GetSystemPartition().Encryption = &deployment.Encryption{KeyFile: "/etc/keyfile", UUID: "1234"}
+			mount.Mount("/dev/mapper/luks-1234", root, "", []string{"subvol=@"})
+			upgradeH = initSnapperInstall(root)
+			trans = startInstallTransaction()
+
+			path := filepath.Join(root, btrfs.TopSubVol, ".snapshots/1/snapshot/etc")
+			Expect(vfs.MkdirAll(tfs, path, vfs.DirPerm)).To(Succeed())
+			Expect(upgradeH.UpdateFstab(trans)).To(Succeed())
+
+			data, err := tfs.ReadFile(filepath.Join(trans.Path, transaction.FstabFile))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(MatchRegexp(`/dev/mapper/luks-1234\s+/etc\s+btrfs`))
+			Expect(string(data)).NotTo(ContainSubstring("PARTUUID=34a8abb8-ddb3-48a2-8ecc-2443e92c7510"))
+
+			data, err = tfs.ReadFile(filepath.Join(trans.Path, "/etc/crypttab"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("luks-1234 UUID=1234 none luks\n"))
+		})
+		It("creates fstab including swap entries", func() {
+			d.Disks[0].Partitions = append(d.Disks[0].Partitions, &deployment.Partition{
+				Role: deployment.Swap, Label: deployment.SwapLabel, FileSystem: deployment.SwapFS, UUID: "5678",
+			})
+			d.Swap = &deployment.SwapConfig{File: &deployment.SwapFile{Path: "/var/swap/swapfile", Size: 1024}}
+			upgradeH = initSnapperInstall(root)
+			trans = startInstallTransaction()
+
+			path := filepath.Join(root, btrfs.TopSubVol, ".snapshots/1/snapshot/etc")
+			Expect(vfs.MkdirAll(tfs, path, vfs.DirPerm)).To(Succeed())
+			Expect(upgradeH.UpdateFstab(trans)).To(Succeed())
+
+			data, err := tfs.ReadFile(filepath.Join(trans.Path, transaction.FstabFile))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(MatchRegexp(`PARTUUID=5678\s+none\s+swap\s+defaults`))
+			Expect(string(data)).To(MatchRegexp(`/var/swap/swapfile\s+none\s+swap\s+defaults`))
+		})
+		It("creates fstab with the growfs option for the partition set to grow", func() {
+			d.GetSystemPartition().Grow = true
+			upgradeH = initSnapperInstall(root)
+			trans = startInstallTransaction()
+
+			path := filepath.Join(root, btrfs.TopSubVol, ".snapshots/1/snapshot/etc")
+			Expect(vfs.MkdirAll(tfs, path, vfs.DirPerm)).To(Succeed())
+			Expect(upgradeH.UpdateFstab(trans)).To(Succeed())
+
+			data, err := tfs.ReadFile(filepath.Join(trans.Path, transaction.FstabFile))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(MatchRegexp(`\s+/\s+btrfs\s+ro=vfs,x-systemd.growfs\s`))
+			Expect(d.GetSystemPartition().MountOpts).To(Equal([]string{"ro=vfs"}))
+		})
 		It("it fails to create fstab file if the path does not exist", func() {
 			err := upgradeH.UpdateFstab(trans)
 			Expect(err).To(HaveOccurred())
@@ -143,7 +219,7 @@ var _ = Describe("SnapperUpgradeHelper", Label("transaction"), func() {
 			}
 			err := upgradeH.Lock(trans)
 			Expect(err).To(HaveOccurred())
-			Expect(err).To(MatchError("configuring new snapshot as read-only: snapper error"))
+			Expect(err).To(MatchError("configuring new snapshot as read-only: modifying snapshot 1: : snapper error"))
 			Expect(runner.CmdsMatch([][]string{
 				{"snapper", "--no-dbus", "--root", "/some/root/@/.snapshots/1/snapshot", "modify", "--read-only"},
 			})).To(Succeed())
@@ -191,6 +267,89 @@ var _ = Describe("SnapperUpgradeHelper", Label("transaction"), func() {
 				},
 				{"rsync"},
 			})).To(Succeed())
+
+			report, err := transaction.ReadMergeReport(s, filepath.Join(root, snapshotP))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Snapshot).To(Equal(5))
+			Expect(report.Conflicts).To(BeEmpty())
+			// the report is not part of the snapshotted /etc volume
+			Expect(vfs.Exists(tfs, filepath.Join(root, snapshotP, "/var/lib/elemental/merge-report.yaml"))).To(BeTrue())
+			Expect(vfs.Exists(tfs, filepath.Join(root, snapshotP, "/etc/elemental/merge-report.yaml"))).To(BeFalse())
+		})
+		Describe("merging conflicting changes", func() {
+			var etcStatus, oldEtc, newEtc string
+			BeforeEach(func() {
+				etcStatus = "/tmp/snapStatus/snap_status_etc"
+				oldEtc = "/.snapshots/4/snapshot/etc/.snapshots/1/snapshot"
+				newEtc = "/.snapshots/5/snapshot/etc"
+				template := filepath.Join(root, ".snapshots/5/snapshot/usr/share/snapper/config-templates/default")
+				snSysConf := filepath.Join(root, ".snapshots/5/snapshot/etc/sysconfig/snapper")
+
+				Expect(vfs.MkdirAll(tfs, filepath.Join(newEtc, "snapper/configs"), vfs.DirPerm)).To(Succeed())
+				Expect(vfs.MkdirAll(tfs, filepath.Dir(template), vfs.DirPerm)).To(Succeed())
+				Expect(tfs.WriteFile(template, []byte{}, vfs.FilePerm)).To(Succeed())
+				Expect(vfs.MkdirAll(tfs, filepath.Dir(snSysConf), vfs.DirPerm)).To(Succeed())
+				Expect(tfs.WriteFile(snSysConf, []byte{}, vfs.FilePerm)).To(Succeed())
+				Expect(vfs.MkdirAll(tfs, filepath.Dir(etcStatus), vfs.DirPerm)).To(Succeed())
+				Expect(tfs.WriteFile(etcStatus, []byte(snapperStatus), vfs.FilePerm)).To(Succeed())
+				Expect(tfs.WriteFile("/tmp/snapStatus/snap_status_home", []byte{}, vfs.FilePerm)).To(Succeed())
+
+				// modifiedFile and createdFile are also changed by the new image, deletedFile is not
+				Expect(vfs.MkdirAll(tfs, oldEtc, vfs.DirPerm)).To(Succeed())
+				Expect(tfs.WriteFile(filepath.Join(oldEtc, "modifiedFile"), []byte("old"), vfs.FilePerm)).To(Succeed())
+				Expect(tfs.WriteFile(filepath.Join(newEtc, "modifiedFile"), []byte("new"), vfs.FilePerm)).To(Succeed())
+				Expect(tfs.WriteFile(filepath.Join(newEtc, "createdFile"), []byte("new"), vfs.FilePerm)).To(Succeed())
+				Expect(tfs.WriteFile(filepath.Join(oldEtc, "deletedFile"), []byte("old"), vfs.FilePerm)).To(Succeed())
+				Expect(tfs.WriteFile(filepath.Join(newEtc, "deletedFile"), []byte("old"), vfs.FilePerm)).To(Succeed())
+			})
+			setEtcMergePolicies := func(policy deployment.MergePolicy, paths ...deployment.PathMergePolicy) {
+				for _, part := range d.Disks[0].Partitions {
+					for i := range part.RWVolumes {
+						if part.RWVolumes[i].Path == "/etc" {
+							part.RWVolumes[i].MergePolicy = policy
+							part.RWVolumes[i].PathMergePolicies = paths
+						}
+					}
+				}
+			}
+			It("applies the merge policies and reports conflicts", func() {
+				setEtcMergePolicies(0, deployment.PathMergePolicy{Path: "/etc/created*", Policy: deployment.PreferImage})
+
+				Expect(upgradeH.Merge(trans)).To(Succeed())
+				ok, _ := vfs.Exists(tfs, filepath.Join(newEtc, "deletedFile"))
+				Expect(ok).To(BeFalse())
+
+				report, err := transaction.ReadMergeReport(s, "/.snapshots/5/snapshot")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(report.Conflicts).To(Equal([]transaction.MergeConflict{
+					{Volume: "/etc", Path: "/etc/createdFile", Policy: "prefer-image", Kept: "image"},
+					{Volume: "/etc", Path: "/etc/modifiedFile", Policy: "prefer-local", Kept: "local"},
+				}))
+			})
+			It("carries over ACL changes and skips relabelled files", func() {
+				var synced []string
+				sideEffects["rsync"] = func(args ...string) ([]byte, error) {
+					if i := slices.Index(args, "--files-from"); i >= 0 && strings.HasSuffix(args[i+1], "sync_etc") {
+						data, err := tfs.ReadFile(args[i+1])
+						Expect(err).NotTo(HaveOccurred())
+						synced = strings.Fields(string(data))
+					}
+					return []byte{}, nil
+				}
+
+				Expect(upgradeH.Merge(trans)).To(Succeed())
+				Expect(synced).To(ConsistOf("/createdFile", "/modifiedFile", "/aclFile"))
+			})
+			It("fails on conflicts", func() {
+				setEtcMergePolicies(deployment.FailOnConflict)
+
+				err := upgradeH.Merge(trans)
+				Expect(err).To(MatchError(ContainSubstring(
+					"conflicting changes in '/etc': /etc/createdFile, /etc/modifiedFile",
+				)))
+				ok, _ := vfs.Exists(tfs, filepath.Join(newEtc, "deletedFile"))
+				Expect(ok).To(BeTrue())
+			})
 		})
 		It("updates fstab", func() {
 			fstab := filepath.Join(root, ".snapshots/5/snapshot/etc/fstab")
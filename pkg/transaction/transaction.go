@@ -20,10 +20,16 @@ package transaction
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"slices"
+
+	"go.yaml.in/yaml/v3"
 
 	"github.com/suse/elemental/v3/pkg/block/lsblk"
 	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/fstab"
 	"github.com/suse/elemental/v3/pkg/sys"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
 	"github.com/suse/elemental/v3/pkg/unpack"
 )
 
@@ -31,9 +37,17 @@ type transactionState int
 
 const FstabFile = "/etc/fstab"
 
+// GrowFsOption is the fstab mount option to expand the filesystem to the partition size
+const GrowFsOption = "x-systemd.growfs"
+
+// MergeReportFile is the file listing the conflicts of the last merge. It is kept out of the snapshotted
+// volumes, otherwise the next merge would carry it over as a local change.
+const MergeReportFile = "/var/lib/elemental/merge-report.yaml"
+
 const (
 	started transactionState = iota + 1
 	committed
+	staged
 	failed
 )
 
@@ -54,6 +68,41 @@ type Merge struct {
 	Modified string // modified tree on top of the old tree
 }
 
+// MergeReport lists the conflicts found while merging the snapshotted RW volumes of a transaction
+type MergeReport struct {
+	Snapshot  int             `yaml:"snapshot" json:"snapshot"`
+	Conflicts []MergeConflict `yaml:"conflicts,omitempty" json:"conflicts,omitempty"`
+}
+
+// MergeConflict is a path of a snapshotted RW volume changed both locally and by the new OS image
+type MergeConflict struct {
+	Volume string `yaml:"volume" json:"volume"`
+	Path   string `yaml:"path" json:"path"`
+	Policy string `yaml:"policy" json:"policy"`
+	// Kept is the side of the conflict kept in the new snapshot, either 'local' or 'image'
+	Kept string `yaml:"kept" json:"kept"`
+}
+
+// ReadMergeReport reads the merge report of the last upgrade of the system mounted at the given
+// root. Returns nil if there is no report.
+func ReadMergeReport(s *sys.System, root string) (*MergeReport, error) {
+	path := filepath.Join(root, MergeReportFile)
+	if ok, _ := vfs.Exists(s.FS(), path); !ok {
+		return nil, nil
+	}
+
+	data, err := s.FS().ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading merge report '%s': %w", path, err)
+	}
+
+	report := &MergeReport{}
+	if err = yaml.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("parsing merge report '%s': %w", path, err)
+	}
+	return report, nil
+}
+
 type Transaction struct {
 	ID     int
 	Path   string
@@ -66,9 +115,14 @@ type Interface interface {
 	Init(deployment.Deployment) (UpgradeHelper, error)
 	Start() (*Transaction, error)
 	Commit(trans *Transaction, cleanup func() error) error
+	Stage(trans *Transaction) error
+	CommitStaged(cleanup func() error) (*Transaction, error)
+	DiscardStaged() error
 	Rollback(*Transaction, error) error
+	RollbackTo(id int) (*Transaction, error)
 
 	GetActiveSnapshotIDs() ([]int, error)
+	GetDefaultSnapshotID() (int, error)
 }
 
 type UpgradeHelper interface {
@@ -78,3 +132,47 @@ type UpgradeHelper interface {
 	Lock(*Transaction) error
 	GenerateKernelCmdline(*Transaction) string
 }
+
+// fstabDevice returns the fstab device of the given partition. Encrypted partitions
+// are referenced by their mapped device.
+func fstabDevice(part *deployment.Partition) string {
+	if part.Encryption != nil {
+		return part.Encryption.MappedDevice()
+	}
+	return fmt.Sprintf("PARTUUID=%s", part.UUID)
+}
+
+// fstabOptions returns the fstab mount options of the given partition, partitions set to grow
+// get their filesystem expanded by systemd-growfs once mounted
+func fstabOptions(part *deployment.Partition) []string {
+	opts := slices.Clone(part.MountOpts)
+	if part.Grow {
+		opts = append(opts, GrowFsOption)
+	}
+	return opts
+}
+
+// swapFstabLines returns the fstab lines of the swap partitions and the swap file of the deployment
+func swapFstabLines(partitions deployment.Partitions, swap *deployment.SwapConfig) []fstab.Line {
+	var lines []fstab.Line
+	for _, part := range partitions {
+		if part.Role != deployment.Swap {
+			continue
+		}
+		lines = append(lines, fstab.Line{
+			Device:     fstabDevice(part),
+			MountPoint: "none",
+			Options:    []string{"defaults"},
+			FileSystem: deployment.SwapFS.String(),
+		})
+	}
+	if swap != nil && swap.File != nil {
+		lines = append(lines, fstab.Line{
+			Device:     swap.File.Path,
+			MountPoint: "none",
+			Options:    []string{"defaults"},
+			FileSystem: deployment.SwapFS.String(),
+		})
+	}
+	return lines
+}
@@ -161,6 +161,31 @@ const upgradeSnapList = `{
   }
 `
 
+const stagedSnapList = `{
+	"root": [
+	  {
+		"number": 3,
+		"default": false,
+		"active": false,
+		"userdata": null
+	  },{
+		"number": 4,
+		"default": true,
+		"active": true,
+		"userdata": null
+	  },{
+		"number": 5,
+		"default": false,
+		"active": false,
+		"userdata": {
+		    "update-in-progress": "yes",
+		    "update-staged": "%d"
+		}
+	  }
+	]
+  }
+`
+
 const installSnapList = `{
 	"root": [
 	  {
@@ -314,6 +339,9 @@ func startUpgradeTransaction() *transaction.Transaction {
 		if slices.Contains(args, "create") {
 			return []byte("5\n"), nil
 		}
+		if slices.Contains(args, "root") && slices.Contains(args, "list") {
+			return []byte(upgradeSnapList), nil
+		}
 		if slices.Contains(args, "etc") && slices.Contains(args, "list") {
 			return []byte(etcSnaps), nil
 		}
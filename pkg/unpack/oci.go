@@ -19,10 +19,12 @@ package unpack
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"path/filepath"
 	"time"
 
+	"github.com/suse/elemental/v3/pkg/cache"
 	"github.com/suse/elemental/v3/pkg/sys"
 	"github.com/suse/elemental/v3/pkg/sys/vfs"
 
@@ -45,6 +47,8 @@ type OCI struct {
 	verify      bool
 	imageRef    string
 	rsyncFlags  []string
+	cacheDir    string
+	digest      string
 }
 
 type OCIOpt func(*OCI)
@@ -73,6 +77,23 @@ func WithRsyncFlagsOCI(flags ...string) OCIOpt {
 	}
 }
 
+// WithCacheDirOCI sets the directory of a persistent cache for remote images. Images
+// already in the cache are not pulled again, and if the registry is not reachable the
+// most recently cached image of the reference is used.
+func WithCacheDirOCI(dir string) OCIOpt {
+	return func(o *OCI) {
+		o.cacheDir = dir
+	}
+}
+
+// WithDigestOCI pins the image to the given digest, so the unpacked image is the one the digest
+// was resolved for even if its tag is updated in the meantime
+func WithDigestOCI(digest string) OCIOpt {
+	return func(o *OCI) {
+		o.digest = digest
+	}
+}
+
 func NewOCIUnpacker(s *sys.System, imageRef string, opts ...OCIOpt) *OCI {
 	unpacker := &OCI{
 		s:           s,
@@ -117,27 +138,32 @@ func (o OCI) SynchedUnpack(ctx context.Context, destination string, excludes []s
 }
 
 func (o OCI) Unpack(ctx context.Context, destination string, excludes ...string) (string, error) {
-	platform, err := containerregistry.ParsePlatform(o.platformRef)
+	img, err := o.image(ctx)
 	if err != nil {
 		return "", err
 	}
 
-	opts := []name.Option{}
-	if !o.verify {
-		opts = append(opts, name.Insecure)
+	digest, err := img.Digest()
+	if err != nil {
+		return "", err
 	}
 
-	ref, err := name.ParseReference(o.imageRef, opts...)
+	reader := mutate.Extract(img)
+	defer reader.Close()
+
+	destination, err = o.s.FS().RawPath(destination)
 	if err != nil {
 		return "", err
 	}
 
-	var img containerregistry.Image
+	filter := excludesFilter(destination, excludes...)
+	_, err = archive.Apply(ctx, destination, reader, archive.WithFilter(filter))
+	return digest.String(), err
+}
 
-	err = backoff.Retry(func() error {
-		img, err = fetchImage(ctx, ref, *platform, o.local)
-		return err
-	}, backoff.WithMaxRetries(backoff.NewConstantBackOff(3*time.Second), 3))
+// Digest resolves the digest of the OCI image without extracting it
+func (o OCI) Digest(ctx context.Context) (string, error) {
+	img, err := o.image(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -146,18 +172,87 @@ func (o OCI) Unpack(ctx context.Context, destination string, excludes ...string)
 	if err != nil {
 		return "", err
 	}
+	return digest.String(), nil
+}
 
-	reader := mutate.Extract(img)
-	defer reader.Close()
+// Image fetches the image for the configured platform without extracting it
+func (o OCI) Image(ctx context.Context) (containerregistry.Image, error) {
+	return o.image(ctx)
+}
 
-	destination, err = o.s.FS().RawPath(destination)
+// image fetches the image reference for the configured platform
+func (o OCI) image(ctx context.Context) (containerregistry.Image, error) {
+	platform, err := containerregistry.ParsePlatform(o.platformRef)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	filter := excludesFilter(destination, excludes...)
-	_, err = archive.Apply(ctx, destination, reader, archive.WithFilter(filter))
-	return digest.String(), err
+	opts := []name.Option{}
+	if !o.verify {
+		opts = append(opts, name.Insecure)
+	}
+
+	ref, err := name.ParseReference(o.imageRef, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if o.digest != "" && !o.local {
+		ref = ref.Context().Digest(o.digest)
+	}
+
+	fetch := func() (img containerregistry.Image, err error) {
+		err = backoff.Retry(func() error {
+			img, err = fetchImage(ctx, ref, *platform, o.local)
+			return err
+		}, backoff.WithMaxRetries(backoff.NewConstantBackOff(3*time.Second), 3))
+		if err != nil || o.digest == "" {
+			return img, err
+		}
+
+		// local images can only be looked up by tag, ensure it was not updated
+		digest, err := img.Digest()
+		if err != nil {
+			return nil, err
+		}
+		if digest.String() != o.digest {
+			return nil, fmt.Errorf("image '%s' digest '%s' does not match the expected '%s'", o.imageRef, digest, o.digest)
+		}
+		return img, nil
+	}
+
+	if o.cacheDir == "" || o.local {
+		return fetch()
+	}
+
+	c := cache.New(o.s, o.cacheDir)
+	digest, err := c.Resolve(cache.OCIImage, o.imageRef, o.platformRef, func() (string, error) {
+		return resolveDigest(ctx, ref)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.Image(o.imageRef, digest, o.platformRef, fetch)
+}
+
+// resolveDigest returns the digest of the given reference. Only tags require querying the registry.
+func resolveDigest(ctx context.Context, ref name.Reference) (string, error) {
+	if digest, ok := ref.(name.Digest); ok {
+		return digest.DigestStr(), nil
+	}
+
+	var desc *containerregistry.Descriptor
+	err := backoff.Retry(func() (err error) {
+		desc, err = remote.Head(ref,
+			remote.WithTransport(http.DefaultTransport),
+			remote.WithAuthFromKeychain(authn.DefaultKeychain),
+			remote.WithContext(ctx),
+		)
+		return err
+	}, backoff.WithMaxRetries(backoff.NewConstantBackOff(3*time.Second), 3))
+	if err != nil {
+		return "", err
+	}
+	return desc.Digest.String(), nil
 }
 
 func fetchImage(ctx context.Context, ref name.Reference, platform containerregistry.Platform, local bool) (containerregistry.Image, error) {
@@ -19,10 +19,12 @@ package unpack_test
 
 import (
 	"context"
+	"path/filepath"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/suse/elemental/v3/pkg/cache"
 	"github.com/suse/elemental/v3/pkg/log"
 	"github.com/suse/elemental/v3/pkg/sys"
 	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
@@ -62,6 +64,23 @@ var _ = Describe("OCIUnpacker", Label("oci", "rootlesskit"), func() {
 		Expect(string(data)).To(ContainSubstring("VERSION_ID=3.21.3"))
 		Expect(digest).To(Equal("sha256:1c4eef651f65e2f7daee7ee785882ac164b02b78fb74503052a26dc061c90474"))
 	})
+	It("Unpacks a remote alpine image through the cache", func() {
+		Expect(vfs.MkdirAll(tfs, "/cache", vfs.DirPerm)).To(Succeed())
+		for _, target := range []string{"/target/first", "/target/second"} {
+			unpacker := unpack.NewOCIUnpacker(
+				s, alpineImageRef, unpack.WithPlatformRefOCI("linux/amd64"), unpack.WithCacheDirOCI("/cache"),
+			)
+			Expect(vfs.MkdirAll(tfs, target, vfs.DirPerm)).To(Succeed())
+			digest, err := unpacker.Unpack(context.Background(), target)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(digest).To(Equal("sha256:1c4eef651f65e2f7daee7ee785882ac164b02b78fb74503052a26dc061c90474"))
+			Expect(vfs.Exists(tfs, filepath.Join(target, "etc/os-release"))).To(BeTrue())
+		}
+		entries, err := cache.New(s, "/cache").List()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Source).To(Equal(alpineImageRef))
+	})
 	It("Fails to unpacks a remote bogus image", func() {
 		unpacker := unpack.NewOCIUnpacker(s, bogusImageRef, unpack.WithPlatformRefOCI("linux/amd64"), unpack.WithLocalOCI(false))
 		Expect(vfs.MkdirAll(tfs, "/target/root", vfs.DirPerm)).To(Succeed())
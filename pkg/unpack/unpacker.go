@@ -37,6 +37,12 @@ type Interface interface {
 	SynchedUnpack(ctx context.Context, destination string, excludes []string, deleteExcludes []string) (string, error)
 }
 
+// Digester is implemented by unpackers able to resolve the digest of the image
+// source without extracting its contents
+type Digester interface {
+	Digest(ctx context.Context) (string, error)
+}
+
 type options struct {
 	ociOpts []OCIOpt
 	dirOpts []DirectoryOpt
@@ -76,6 +82,28 @@ func WithPlatformRef(platform string) Opt {
 	}
 }
 
+// WithDigest pins OCI images to the given digest
+func WithDigest(digest string) Opt {
+	return func(srcType deployment.ImageSrcType, o *options) {
+		switch srcType {
+		case deployment.OCI:
+			o.ociOpts = append(o.ociOpts, WithDigestOCI(digest))
+		default:
+		}
+	}
+}
+
+// WithCacheDir sets the directory of a persistent cache for remote OCI images
+func WithCacheDir(dir string) Opt {
+	return func(srcType deployment.ImageSrcType, o *options) {
+		switch srcType {
+		case deployment.OCI:
+			o.ociOpts = append(o.ociOpts, WithCacheDirOCI(dir))
+		default:
+		}
+	}
+}
+
 func WithRsyncFlags(flags ...string) Opt {
 	return func(srcType deployment.ImageSrcType, o *options) {
 		switch srcType {
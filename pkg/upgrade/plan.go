@@ -0,0 +1,151 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upgrade
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/suse/elemental/v3/pkg/bootloader"
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/unpack"
+)
+
+// Plan describes the changes an upgrade transaction would apply to the system
+type Plan struct {
+	// Source is the OS image to upgrade to
+	Source *deployment.ImageSource
+	// Current is the OS image of the current deployment
+	Current *deployment.ImageSource
+	// UpToDate is true if Source and Current refer to the same image digest. Callers applying
+	// sources without a digest, such as an overlay tree, are expected to reset it.
+	UpToDate bool
+	// Release is the release manifest the upgrade applies, nil if upgrading to a bare OS image
+	Release *deployment.ReleaseInfo
+	// BaseSnapshot is the snapshot the new snapshot would be based on, 0 if there is none
+	BaseSnapshot int
+	// MergedVolumes lists the snapshotted RW volumes whose changes would be merged
+	MergedVolumes []string
+	// Bootloader is the bootloader that would get a new default entry
+	Bootloader string
+	// KernelCmdline is the kernel command line for the new entry, excluding the snapshot specific flags
+	KernelCmdline string
+	// RecoveryKernelCmdline is the kernel command line of the recovery entry, empty if there is no recovery
+	RecoveryKernelCmdline string
+	// EFIBootEntries lists the labels of the EFI boot entries that would be created
+	EFIBootEntries []string
+}
+
+// IsUpToDate returns true if both image sources have the same known digest
+func IsUpToDate(current, target *deployment.ImageSource) bool {
+	if current == nil || target == nil || current.GetDigest() == "" {
+		return false
+	}
+	return current.GetDigest() == target.GetDigest()
+}
+
+// IsReleaseUpToDate returns true if the target release is already deployed or if there is no target release
+func IsReleaseUpToDate(current, target *deployment.ReleaseInfo) bool {
+	if target == nil {
+		return true
+	}
+	return current != nil && current.Version == target.Version
+}
+
+// ResolveDigest resolves the digest of the deployment OS image without unpacking it and records
+// it in the image source. Image sources not able to resolve a digest, such as directories, are left
+// unchanged.
+func (u Upgrader) ResolveDigest(d *deployment.Deployment) error {
+	if d.SourceOS == nil || d.SourceOS.IsEmpty() {
+		return fmt.Errorf("no OS image defined in deployment")
+	}
+
+	unpacker, err := unpack.NewUnpacker(u.s, d.SourceOS, u.unpackOpts...)
+	if err != nil {
+		return fmt.Errorf("initializing unpacker: %w", err)
+	}
+
+	digester, ok := unpacker.(unpack.Digester)
+	if !ok {
+		u.s.Logger().Debug("Image source '%s' has no digest", d.SourceOS.String())
+		return nil
+	}
+
+	digest, err := digester.Digest(u.ctx)
+	if err != nil {
+		return fmt.Errorf("resolving digest of '%s': %w", d.SourceOS.String(), err)
+	}
+	d.SourceOS.SetDigest(digest)
+	return nil
+}
+
+// Plan computes the changes upgrading to the given deployment would apply without modifying the
+// system. The given deployment is expected to have the OS image digest already resolved, current
+// is the OS image of the running deployment.
+func (u Upgrader) Plan(d *deployment.Deployment, current *deployment.ImageSource) (*Plan, error) {
+	_, err := u.t.Init(*d)
+	if err != nil {
+		return nil, fmt.Errorf("initializing transaction: %w", err)
+	}
+
+	baseID, err := u.t.GetDefaultSnapshotID()
+	if err != nil {
+		return nil, fmt.Errorf("getting default snapshot: %w", err)
+	}
+
+	plan := &Plan{
+		Source:       d.SourceOS,
+		Current:      current,
+		UpToDate:     IsUpToDate(current, d.SourceOS),
+		Release:      d.Release,
+		BaseSnapshot: baseID,
+		Bootloader:   bootloaderName(d),
+	}
+
+	if baseID > 0 {
+		for _, disk := range d.Disks {
+			for _, rwVol := range disk.Partitions.GetSnapshottedVolumes() {
+				plan.MergedVolumes = append(plan.MergedVolumes, rwVol.Path)
+			}
+		}
+	}
+
+	cmdline := ""
+	if d.BootConfig != nil {
+		cmdline = d.BootConfig.KernelCmdline
+	}
+	plan.KernelCmdline = strings.TrimSpace(fmt.Sprintf("%s %s", d.BaseKernelCmdline(), cmdline))
+	if d.GetRecoveryPartition() != nil {
+		plan.RecoveryKernelCmdline = strings.TrimSpace(fmt.Sprintf("%s %s", d.RecoveryKernelCmdline(), d.Installer.KernelCmdline))
+	}
+
+	if d.Firmware != nil {
+		for _, entry := range d.Firmware.BootEntries {
+			plan.EFIBootEntries = append(plan.EFIBootEntries, entry.Label)
+		}
+	}
+
+	return plan, nil
+}
+
+func bootloaderName(d *deployment.Deployment) string {
+	if d.BootConfig == nil || d.BootConfig.Bootloader == "" {
+		return bootloader.BootNone
+	}
+	return d.BootConfig.Bootloader
+}
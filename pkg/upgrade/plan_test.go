@@ -0,0 +1,135 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upgrade_test
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/pkg/deployment"
+	"github.com/suse/elemental/v3/pkg/firmware"
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/sys/vfs"
+	transmock "github.com/suse/elemental/v3/pkg/transaction/mock"
+	"github.com/suse/elemental/v3/pkg/upgrade"
+)
+
+var _ = Describe("Upgrade plan", Label("upgrade", "plan"), func() {
+	var runner *sysmock.Runner
+	var fs vfs.FS
+	var cleanup func()
+	var s *sys.System
+	var d *deployment.Deployment
+	var u *upgrade.Upgrader
+	var t *transmock.Transactioner
+
+	BeforeEach(func() {
+		var err error
+		t = &transmock.Transactioner{DefaultID: 3}
+		runner = sysmock.NewRunner()
+		fs, cleanup, err = sysmock.TestFS(nil)
+		Expect(err).ToNot(HaveOccurred())
+		s, err = sys.NewSystem(
+			sys.WithRunner(runner), sys.WithFS(fs),
+			sys.WithLogger(log.New(log.WithDiscardAll())),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		d = deployment.DefaultDeployment()
+		d.SourceOS = deployment.NewOCISrc("registry.org/my/os:v2")
+		d.SourceOS.SetDigest("sha256:new")
+		d.BootConfig.Bootloader = "grub"
+		d.BootConfig.KernelCmdline = "console=ttyS0"
+		u = upgrade.New(context.Background(), s, upgrade.WithTransaction(t))
+	})
+	AfterEach(func() {
+		cleanup()
+	})
+	It("describes the upgrade transaction", func() {
+		current := deployment.NewOCISrc("registry.org/my/os:v1")
+		current.SetDigest("sha256:old")
+
+		plan, err := u.Plan(d, current)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.UpToDate).To(BeFalse())
+		Expect(plan.Source.GetDigest()).To(Equal("sha256:new"))
+		Expect(plan.BaseSnapshot).To(Equal(3))
+		Expect(plan.MergedVolumes).To(Equal([]string{"/etc"}))
+		Expect(plan.Bootloader).To(Equal("grub"))
+		Expect(plan.KernelCmdline).To(Equal("root=LABEL=SYSTEM console=ttyS0"))
+		Expect(plan.RecoveryKernelCmdline).To(BeEmpty())
+		Expect(plan.EFIBootEntries).To(BeEmpty())
+		Expect(runner.GetCmds()).To(BeEmpty())
+	})
+	It("reports recovery and EFI boot entries changes", func() {
+		deployment.WithRecoveryPartition(1024)(d)
+		d.Firmware.BootEntries = []*firmware.EfiBootEntry{{Label: "elemental"}}
+
+		plan, err := u.Plan(d, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.RecoveryKernelCmdline).To(Equal("root=live:LABEL=RECOVERY rd.live.overlay.overlayfs=1"))
+		Expect(plan.EFIBootEntries).To(Equal([]string{"elemental"}))
+	})
+	It("does not merge volumes if there is no base snapshot", func() {
+		t.DefaultID = 0
+		plan, err := u.Plan(d, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.MergedVolumes).To(BeEmpty())
+	})
+	It("reports the deployment is up to date", func() {
+		current := deployment.NewOCISrc("registry.org/my/os:latest")
+		current.SetDigest("sha256:new")
+
+		plan, err := u.Plan(d, current)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.UpToDate).To(BeTrue())
+	})
+	It("fails on transaction initialization", func() {
+		t.InitErr = fmt.Errorf("init failed")
+		_, err := u.Plan(d, nil)
+		Expect(err).To(MatchError("initializing transaction: init failed"))
+	})
+	It("does not resolve digests of non OCI sources", func() {
+		d.SourceOS = deployment.NewDirSrc("/some/dir")
+		Expect(u.ResolveDigest(d)).To(Succeed())
+		Expect(d.SourceOS.GetDigest()).To(BeEmpty())
+	})
+	It("fails to resolve the digest of an empty source", func() {
+		d.SourceOS = deployment.NewEmptySrc()
+		Expect(u.ResolveDigest(d)).To(MatchError("no OS image defined in deployment"))
+	})
+	It("compares release versions", func() {
+		current := &deployment.ReleaseInfo{Version: "1.0"}
+		Expect(upgrade.IsReleaseUpToDate(current, nil)).To(BeTrue())
+		Expect(upgrade.IsReleaseUpToDate(current, &deployment.ReleaseInfo{Version: "1.0"})).To(BeTrue())
+		Expect(upgrade.IsReleaseUpToDate(current, &deployment.ReleaseInfo{Version: "1.1"})).To(BeFalse())
+		Expect(upgrade.IsReleaseUpToDate(nil, &deployment.ReleaseInfo{Version: "1.0"})).To(BeFalse())
+	})
+	It("compares image digests", func() {
+		current := deployment.NewOCISrc("registry.org/my/os:v1")
+		Expect(upgrade.IsUpToDate(current, d.SourceOS)).To(BeFalse())
+		current.SetDigest("sha256:new")
+		Expect(upgrade.IsUpToDate(current, d.SourceOS)).To(BeTrue())
+		Expect(upgrade.IsUpToDate(nil, d.SourceOS)).To(BeFalse())
+	})
+})
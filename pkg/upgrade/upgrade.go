@@ -21,23 +21,32 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/suse/elemental/v3/pkg/block/lsblk"
 	"github.com/suse/elemental/v3/pkg/bootloader"
 	"github.com/suse/elemental/v3/pkg/chroot"
 	"github.com/suse/elemental/v3/pkg/cleanstack"
 	"github.com/suse/elemental/v3/pkg/deployment"
 	"github.com/suse/elemental/v3/pkg/fips"
 	"github.com/suse/elemental/v3/pkg/firmware"
+	"github.com/suse/elemental/v3/pkg/health"
+	"github.com/suse/elemental/v3/pkg/repart"
 	"github.com/suse/elemental/v3/pkg/rsync"
 	"github.com/suse/elemental/v3/pkg/selinux"
+	"github.com/suse/elemental/v3/pkg/swap"
 	"github.com/suse/elemental/v3/pkg/sys"
 	"github.com/suse/elemental/v3/pkg/transaction"
 	"github.com/suse/elemental/v3/pkg/unpack"
+	"github.com/suse/elemental/v3/pkg/verity"
 )
 
-const configFile = "/etc/elemental/config.sh"
+const (
+	configFile = "/etc/elemental/config.sh"
+	verityTree = "/usr"
+)
 
 type Interface interface {
 	Upgrade(*deployment.Deployment) error
@@ -53,6 +62,7 @@ type Upgrader struct {
 	bm         *firmware.EfiBootManager
 	b          bootloader.Bootloader
 	unpackOpts []unpack.Opt
+	noChroot   bool
 }
 
 func WithTransaction(t transaction.Interface) Option {
@@ -85,6 +95,14 @@ func WithUnpackOpts(opts ...unpack.Opt) Option {
 	}
 }
 
+// WithoutChroot prepares the transaction without chrooting into it, as required by unprivileged
+// installations. Deployments enabling FIPS or running a configuration hook are not supported.
+func WithoutChroot() Option {
+	return func(u *Upgrader) {
+		u.noChroot = true
+	}
+}
+
 func New(ctx context.Context, s *sys.System, opts ...Option) *Upgrader {
 	up := &Upgrader{
 		s:   s,
@@ -108,64 +126,240 @@ func (u *Upgrader) SetUnpackOpts(opts ...unpack.Opt) {
 	u.unpackOpts = opts
 }
 
-//nolint:gocyclo
+// Upgrade upgrades the system to the given deployment and sets the new snapshot as the default one
 func (u Upgrader) Upgrade(d *deployment.Deployment) (err error) {
 	cleanup := cleanstack.NewCleanStack()
 	defer func() { err = cleanup.Cleanup(err) }()
 
-	var uh transaction.UpgradeHelper
+	esp := d.GetEfiPartition()
+	if esp == nil {
+		return fmt.Errorf("no EFI partition defined in deployment")
+	}
+
+	trans, err := u.prepare(d, esp)
+	if trans != nil {
+		cleanup.PushErrorOnly(func() error { return u.t.Rollback(trans, err) })
+	}
+	if err != nil {
+		return err
+	}
+
+	commitCleanup := func() error {
+		snapshots, err := u.t.GetActiveSnapshotIDs()
+		if err != nil {
+			return fmt.Errorf("get active snapshots: %w", err)
+		}
+
+		return u.b.Prune(trans.Path, filepath.Join(trans.Path, esp.MountPoint), snapshots)
+	}
+
+	err = u.t.Commit(trans, commitCleanup)
+	if err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Stage prepares the snapshot of the given deployment without setting it as the default one. The
+// default boot entry keeps pointing to the current snapshot until the staged one is applied with
+// ApplyStaged.
+func (u Upgrader) Stage(d *deployment.Deployment) (err error) {
+	cleanup := cleanstack.NewCleanStack()
+	defer func() { err = cleanup.Cleanup(err) }()
 
 	esp := d.GetEfiPartition()
 	if esp == nil {
 		return fmt.Errorf("no EFI partition defined in deployment")
 	}
 
-	uh, err = u.t.Init(*d)
+	trans, err := u.prepare(d, esp)
+	if trans != nil {
+		cleanup.PushErrorOnly(func() error { return u.t.Rollback(trans, err) })
+	}
+	if err != nil {
+		return err
+	}
+
+	baseID, err := u.t.GetDefaultSnapshotID()
+	if err != nil {
+		return fmt.Errorf("getting default snapshot: %w", err)
+	}
+	if baseID == 0 {
+		return fmt.Errorf("no default snapshot to stage an upgrade on")
+	}
+
+	err = u.b.SetDefaultEntry(filepath.Join(trans.Path, esp.MountPoint), strconv.Itoa(baseID))
+	if err != nil {
+		return fmt.Errorf("restoring default boot entry: %w", err)
+	}
+
+	err = u.t.Stage(trans)
+	if err != nil {
+		return fmt.Errorf("staging transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ApplyStaged sets the staged snapshot as the default one and points the default boot entry to
+// it. If the bootloader supports boot counting it falls back to the current default entry. The
+// given deployment is the one of the running system.
+func (u Upgrader) ApplyStaged(d *deployment.Deployment) error {
+	esp := d.GetEfiPartition()
+	if esp == nil {
+		return fmt.Errorf("no EFI partition defined in deployment")
+	}
+
+	_, err := u.t.Init(*d)
 	if err != nil {
 		return fmt.Errorf("initializing transaction: %w", err)
 	}
 
-	trans, err := u.t.Start()
+	espDir := filepath.Join("/", esp.MountPoint)
+	commitCleanup := func() error {
+		snapshots, err := u.t.GetActiveSnapshotIDs()
+		if err != nil {
+			return fmt.Errorf("get active snapshots: %w", err)
+		}
+
+		return u.b.Prune("/", espDir, snapshots)
+	}
+
+	trans, err := u.t.CommitStaged(commitCleanup)
 	if err != nil {
-		return fmt.Errorf("starting transaction: %w", err)
+		return fmt.Errorf("committing staged transaction: %w", err)
 	}
-	cleanup.PushErrorOnly(func() error { return u.t.Rollback(trans, err) })
 
-	err = uh.SyncImageContent(d.SourceOS, trans, u.unpackOpts...)
+	// fall back to the previous default entry as a regular upgrade does
+	if counter, ok := u.b.(bootloader.BootCounter); ok {
+		err = counter.SetDefaultEntryWithFallback(espDir, strconv.Itoa(trans.ID))
+	} else {
+		err = u.b.SetDefaultEntry(espDir, strconv.Itoa(trans.ID))
+	}
 	if err != nil {
-		return fmt.Errorf("syncing OS image content: %w", err)
+		return fmt.Errorf("setting default boot entry: %w", err)
+	}
+
+	return nil
+}
+
+// DiscardStaged deletes the staged snapshot and its boot entry. The given deployment is the one
+// of the running system.
+func (u Upgrader) DiscardStaged(d *deployment.Deployment) error {
+	esp := d.GetEfiPartition()
+	if esp == nil {
+		return fmt.Errorf("no EFI partition defined in deployment")
+	}
+
+	_, err := u.t.Init(*d)
+	if err != nil {
+		return fmt.Errorf("initializing transaction: %w", err)
+	}
+
+	err = u.t.DiscardStaged()
+	if err != nil {
+		return fmt.Errorf("discarding staged transaction: %w", err)
+	}
+
+	snapshots, err := u.t.GetActiveSnapshotIDs()
+	if err != nil {
+		return fmt.Errorf("get active snapshots: %w", err)
+	}
+
+	err = u.b.Prune("/", filepath.Join("/", esp.MountPoint), snapshots)
+	if err != nil {
+		return fmt.Errorf("pruning boot entries: %w", err)
+	}
+
+	return nil
+}
+
+// prepare starts a new transaction and applies the given deployment to it up to the bootloader
+// installation. Once the transaction is started it is returned even on error, so the caller can
+// roll it back.
+//
+//nolint:gocyclo
+func (u Upgrader) prepare(d *deployment.Deployment, esp *deployment.Partition) (trans *transaction.Transaction, err error) {
+	var uh transaction.UpgradeHelper
+
+	if u.noChroot && (d.IsFipsEnabled() || d.CfgScript != "") {
+		return nil, fmt.Errorf("enabling FIPS and configuration hooks require a chroot")
+	}
+
+	uh, err = u.t.Init(*d)
+	if err != nil {
+		return nil, fmt.Errorf("initializing transaction: %w", err)
+	}
+
+	trans, err = u.t.Start()
+	if err != nil {
+		return nil, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	opts := u.unpackOpts
+	if digest := d.SourceOS.GetDigest(); digest != "" {
+		// unpack the very same image the digest was resolved for
+		opts = append(slices.Clone(opts), unpack.WithDigest(digest))
+	}
+
+	err = uh.SyncImageContent(d.SourceOS, trans, opts...)
+	if err != nil {
+		return trans, fmt.Errorf("syncing OS image content: %w", err)
 	}
 
 	err = uh.Merge(trans)
 	if err != nil {
-		return fmt.Errorf("merging RW volumes: %w", err)
+		return trans, fmt.Errorf("merging RW volumes: %w", err)
 	}
 
 	err = uh.UpdateFstab(trans)
 	if err != nil {
-		return fmt.Errorf("updating fstab: %w", err)
+		return trans, fmt.Errorf("updating fstab: %w", err)
 	}
 
 	if d.IsFipsEnabled() {
 		err = fips.ChrootedEnable(u.ctx, u.s, trans.Path)
 		if err != nil {
-			return fmt.Errorf("enabling FIPS: %w", err)
+			return trans, fmt.Errorf("enabling FIPS: %w", err)
+		}
+	}
+
+	if d.Swap != nil && d.Swap.Zram != nil {
+		err = swap.WriteZramConfig(u.s, trans.Path, d.Swap.Zram)
+		if err != nil {
+			return trans, fmt.Errorf("writing zram configuration: %w", err)
 		}
 	}
 
-	err = selinux.ChrootedRelabel(u.ctx, u.s, trans.Path, nil)
+	if disk := d.GetSystemDisk(); disk != nil {
+		err = repart.WriteGrowDropIns(u.s, trans.Path, disk)
+		if err != nil {
+			return trans, fmt.Errorf("writing systemd-repart configuration: %w", err)
+		}
+	}
+
+	if u.noChroot {
+		err = selinux.Relabel(u.ctx, u.s, trans.Path)
+	} else {
+		err = selinux.ChrootedRelabel(u.ctx, u.s, trans.Path, nil)
+	}
 	if err != nil {
-		return fmt.Errorf("relabelling snapshot path '%s': %w", trans.Path, err)
+		return trans, fmt.Errorf("relabelling snapshot path '%s': %w", trans.Path, err)
+	}
+
+	if d.Verity != nil {
+		d.Verity.Slot = d.Verity.NextSlot()
 	}
 
 	err = d.WriteDeploymentFile(u.s, trans.Path)
 	if err != nil {
-		return fmt.Errorf("writing deployment file: %w", err)
+		return trans, fmt.Errorf("writing deployment file: %w", err)
 	}
 
 	err = uh.Lock(trans)
 	if err != nil {
-		return fmt.Errorf("locking transaction '%d': %w", trans.ID, err)
+		return trans, fmt.Errorf("locking transaction '%d': %w", trans.ID, err)
 	}
 
 	if d.OverlayTree != nil && !d.OverlayTree.IsEmpty() {
@@ -173,18 +367,25 @@ func (u Upgrader) Upgrade(d *deployment.Deployment) (err error) {
 			u.s, d.OverlayTree, unpack.WithRsyncFlags(rsync.OverlayTreeSyncFlags()...),
 		)
 		if err != nil {
-			return fmt.Errorf("initializing unpacker: %w", err)
+			return trans, fmt.Errorf("initializing unpacker: %w", err)
 		}
 		_, err = unpacker.Unpack(u.ctx, trans.Path)
 		if err != nil {
-			return fmt.Errorf("unpacking overlay tree: %w", err)
+			return trans, fmt.Errorf("unpacking overlay tree: %w", err)
 		}
 	}
 
 	if d.CfgScript != "" {
 		err = u.configHook(d.CfgScript, trans.Path)
 		if err != nil {
-			return fmt.Errorf("executing configuration hook: %w", err)
+			return trans, fmt.Errorf("executing configuration hook: %w", err)
+		}
+	}
+
+	if len(d.HealthChecks) > 0 {
+		err = u.enableHealthChecks(trans.Path)
+		if err != nil {
+			return trans, fmt.Errorf("enabling health checks: %w", err)
 		}
 	}
 
@@ -193,7 +394,16 @@ func (u Upgrader) Upgrade(d *deployment.Deployment) (err error) {
 		cmdline = d.BootConfig.KernelCmdline
 	}
 
-	kernelCmdline := strings.TrimSpace(fmt.Sprintf("%s %s %s", d.BaseKernelCmdline(), uh.GenerateKernelCmdline(trans), cmdline))
+	baseCmdline := fmt.Sprintf("%s %s", d.BaseKernelCmdline(), uh.GenerateKernelCmdline(trans))
+	if d.Verity != nil {
+		rootHash, err := u.writeVerityImage(d, trans)
+		if err != nil {
+			return trans, fmt.Errorf("writing verity image: %w", err)
+		}
+		baseCmdline = fmt.Sprintf("%s %s", baseCmdline, d.VerityKernelCmdline(rootHash))
+	}
+
+	kernelCmdline := strings.TrimSpace(fmt.Sprintf("%s %s", baseCmdline, cmdline))
 	recKernelCmdline := ""
 	if d.GetRecoveryPartition() != nil {
 		recKernelCmdline = strings.TrimSpace(fmt.Sprintf("%s %s", d.RecoveryKernelCmdline(), d.Installer.KernelCmdline))
@@ -202,31 +412,73 @@ func (u Upgrader) Upgrade(d *deployment.Deployment) (err error) {
 	espDir := filepath.Join(trans.Path, esp.MountPoint)
 	err = u.b.Install(trans.Path, espDir, esp.Label, strconv.Itoa(trans.ID), kernelCmdline, recKernelCmdline)
 	if err != nil {
-		return fmt.Errorf("installing bootloader: %w", err)
+		return trans, fmt.Errorf("installing bootloader: %w", err)
 	}
 
 	if d.Firmware != nil {
 		err = u.bm.CreateBootEntries(d.Firmware.BootEntries)
 		if err != nil {
-			return fmt.Errorf("creating EFI boot entries: %w", err)
+			return trans, fmt.Errorf("creating EFI boot entries: %w", err)
 		}
 	}
 
-	commitCleanup := func() error {
-		snapshots, err := u.t.GetActiveSnapshotIDs()
-		if err != nil {
-			return fmt.Errorf("get active snapshots: %w", err)
+	return trans, nil
+}
+
+// writeVerityImage writes the /usr tree of the transaction to the verity partitions of the deployment
+// slot and returns the root hash of the image. RW volumes within /usr are excluded.
+func (u Upgrader) writeVerityImage(d *deployment.Deployment, trans *transaction.Transaction) (string, error) {
+	data, hash := d.GetVerityPartitions(d.Verity.Slot)
+	if data == nil || hash == nil {
+		return "", fmt.Errorf("no verity partitions found for slot '%s'", d.Verity.Slot)
+	}
+
+	parts, err := lsblk.NewLsDevice(u.s).GetAllPartitions()
+	if err != nil {
+		return "", fmt.Errorf("probing host partitions: %w", err)
+	}
+	dataDev := parts.GetByUUID(data.UUID)
+	hashDev := parts.GetByUUID(hash.UUID)
+	if dataDev == nil || hashDev == nil {
+		return "", fmt.Errorf("verity partitions of slot '%s' not found", d.Verity.Slot)
+	}
+
+	var excludes []string
+	for _, disk := range d.Disks {
+		for _, part := range disk.Partitions {
+			for _, rwVol := range part.RWVolumes {
+				if rel, ok := strings.CutPrefix(rwVol.Path, verityTree+"/"); ok {
+					excludes = append(excludes, rel)
+				}
+			}
 		}
+	}
 
-		return u.b.Prune(trans.Path, filepath.Join(trans.Path, esp.MountPoint), snapshots)
+	tree := filepath.Join(trans.Path, verityTree)
+	rootHash, err := verity.WriteImage(u.ctx, u.s, tree, dataDev.Path, hashDev.Path, excludes...)
+	if err != nil {
+		return "", err
 	}
 
-	err = u.t.Commit(trans, commitCleanup)
+	err = verity.Verify(u.s, dataDev.Path, hashDev.Path, rootHash)
 	if err != nil {
-		return fmt.Errorf("committing transaction: %w", err)
+		return "", err
 	}
+	return rootHash, nil
+}
 
-	return nil
+// enableHealthChecks enables the health check unit in the given root if there is a previous
+// snapshot to roll back to
+func (u Upgrader) enableHealthChecks(root string) error {
+	baseID, err := u.t.GetDefaultSnapshotID()
+	if err != nil {
+		return fmt.Errorf("getting default snapshot: %w", err)
+	}
+	if baseID == 0 {
+		u.s.Logger().Debug("No previous snapshot to roll back to, skipping health checks")
+		return nil
+	}
+	return health.EnableUnit(u.s, root)
 }
 
 func (u Upgrader) configHook(config string, root string) error {
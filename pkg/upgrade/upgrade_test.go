@@ -20,12 +20,14 @@ package upgrade_test
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/suse/elemental/v3/pkg/bootloader"
 	"github.com/suse/elemental/v3/pkg/deployment"
 	"github.com/suse/elemental/v3/pkg/firmware"
 	"github.com/suse/elemental/v3/pkg/log"
@@ -42,6 +44,48 @@ func TestUpgradeSuite(t *testing.T) {
 	RunSpecs(t, "Upgrade test suite")
 }
 
+const lsblkVerityJson = `{
+	"blockdevices": [
+	   {
+		  "label": "USR_A",
+		  "partlabel": "USR_A",
+		  "partuuid": "usr-a-uuid",
+		  "path": "/dev/device2",
+		  "pkname": "/dev/device",
+		  "type": "part"
+	   },{
+		  "label": "USR_A_VERITY",
+		  "partlabel": "USR_A_VERITY",
+		  "partuuid": "usr-a-verity-uuid",
+		  "path": "/dev/device3",
+		  "pkname": "/dev/device",
+		  "type": "part"
+	   }
+	]
+ }`
+
+// cmdlineBootloader records the kernel command line of the installed entry
+type cmdlineBootloader struct {
+	*bootloader.None
+	cmdline string
+}
+
+func (b *cmdlineBootloader) Install(_, _, _, _, kernelCmdline, _ string) error {
+	b.cmdline = kernelCmdline
+	return nil
+}
+
+// fallbackBootloader records the entries set as default with a boot counter fallback
+type fallbackBootloader struct {
+	*bootloader.None
+	fallbackEntry string
+}
+
+func (b *fallbackBootloader) SetDefaultEntryWithFallback(_, entryID string) error {
+	b.fallbackEntry = entryID
+	return nil
+}
+
 var _ = Describe("Upgrade", Label("upgrade"), func() {
 	var runner *sysmock.Runner
 	var mounter *sysmock.Mounter
@@ -101,6 +145,58 @@ var _ = Describe("Upgrade", Label("upgrade"), func() {
 			{"/etc/elemental/config.sh"},
 		}))
 	})
+	It("enables health checks if there is a snapshot to roll back to", func() {
+		d.HealthChecks = []deployment.HealthCheck{{Name: "true", Command: "true"}}
+		t.DefaultID = 1
+		Expect(u.Upgrade(d)).To(Succeed())
+		Expect(vfs.Exists(fs, "/snapshot/path/etc/systemd/system/elemental-health-check.service")).To(BeTrue())
+		Expect(vfs.Exists(fs, "/snapshot/path/etc/systemd/system/multi-user.target.wants/elemental-health-check.service")).To(BeTrue())
+	})
+	It("does not enable health checks without a snapshot to roll back to", func() {
+		d.HealthChecks = []deployment.HealthCheck{{Name: "true", Command: "true"}}
+		Expect(u.Upgrade(d)).To(Succeed())
+		Expect(vfs.Exists(fs, "/snapshot/path/etc/systemd/system/elemental-health-check.service")).To(BeFalse())
+	})
+	It("writes the zram generator configuration", func() {
+		d.Swap = &deployment.SwapConfig{Zram: &deployment.ZramConfig{Size: "min(ram / 2, 4096)"}}
+		Expect(u.Upgrade(d)).To(Succeed())
+		data, err := fs.ReadFile("/snapshot/path/etc/systemd/zram-generator.conf")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("zram-size = min(ram / 2, 4096)\n"))
+	})
+	It("writes the systemd-repart drop-ins to grow the system partition", func() {
+		Expect(u.Upgrade(d)).To(Succeed())
+		Expect(vfs.Exists(fs, "/snapshot/path/etc/repart.d")).To(BeFalse())
+
+		d.GetSystemPartition().Grow = true
+		Expect(u.Upgrade(d)).To(Succeed())
+		data, err := fs.ReadFile("/snapshot/path/etc/repart.d/01-system.conf")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("GrowFileSystem=on"))
+	})
+	It("upgrades without chrooting into the new snapshot", func() {
+		d.CfgScript = ""
+		contexts := "/snapshot/path/etc/selinux/targeted/contexts/files/file_contexts"
+		Expect(vfs.MkdirAll(fs, filepath.Dir(contexts), vfs.DirPerm)).To(Succeed())
+		Expect(fs.WriteFile(contexts, []byte{}, vfs.FilePerm)).To(Succeed())
+
+		u = upgrade.New(
+			context.Background(), s, upgrade.WithTransaction(t),
+			upgrade.WithBootManager(firmware.NewEfiBootManager(s)), upgrade.WithoutChroot(),
+		)
+		Expect(u.Upgrade(d)).To(Succeed())
+		Expect(runner.IncludesCmds([][]string{
+			{"setfiles", "-i", "-F", "-r", "/snapshot/path", contexts, "/snapshot/path"},
+		})).To(Succeed())
+		Expect(syscall.WasChrootCalledWith("/snapshot/path")).To(BeFalse())
+	})
+	It("fails to upgrade without chroot if a configuration hook is set", func() {
+		u = upgrade.New(
+			context.Background(), s, upgrade.WithTransaction(t),
+			upgrade.WithBootManager(firmware.NewEfiBootManager(s)), upgrade.WithoutChroot(),
+		)
+		Expect(u.Upgrade(d)).To(MatchError("enabling FIPS and configuration hooks require a chroot"))
+	})
 	It("fails on transaction initialization", func() {
 		t.InitErr = fmt.Errorf("init failed")
 		err := u.Upgrade(d)
@@ -177,6 +273,93 @@ var _ = Describe("Upgrade", Label("upgrade"), func() {
 		Expect(err).To(MatchError("committing transaction: commit failed"))
 		Expect(t.RollbackCalled()).To(BeTrue())
 	})
+	It("stages the upgrade without committing it", func() {
+		t.DefaultID = 1
+		t.CommitErr = fmt.Errorf("commit should not be called")
+		Expect(u.Stage(d)).To(Succeed())
+		Expect(t.Staged()).To(BeTrue())
+		Expect(t.RollbackCalled()).To(BeFalse())
+	})
+	It("fails to stage an upgrade without a default snapshot", func() {
+		err := u.Stage(d)
+		Expect(err).To(MatchError("no default snapshot to stage an upgrade on"))
+		Expect(t.Staged()).To(BeFalse())
+		Expect(t.RollbackCalled()).To(BeTrue())
+	})
+	It("fails on transaction stage", func() {
+		t.DefaultID = 1
+		t.StageErr = fmt.Errorf("stage failed")
+		err := u.Stage(d)
+		Expect(err).To(MatchError("staging transaction: stage failed"))
+		Expect(t.RollbackCalled()).To(BeTrue())
+	})
+	It("applies the staged upgrade", func() {
+		Expect(u.ApplyStaged(d)).To(Succeed())
+
+		t.CommitErr = fmt.Errorf("no staged snapshot found")
+		Expect(u.ApplyStaged(d)).To(MatchError("committing staged transaction: no staged snapshot found"))
+	})
+	It("arms the boot counter when applying the staged upgrade", func() {
+		b := &fallbackBootloader{None: bootloader.NewNone(s)}
+		u = upgrade.New(context.Background(), s, upgrade.WithTransaction(t), upgrade.WithBootloader(b))
+		Expect(u.ApplyStaged(d)).To(Succeed())
+		Expect(b.fallbackEntry).To(Equal("2"))
+	})
+	It("discards the staged upgrade", func() {
+		Expect(u.DiscardStaged(d)).To(Succeed())
+
+		t.DiscardErr = fmt.Errorf("no staged snapshot found")
+		Expect(u.DiscardStaged(d)).To(MatchError("discarding staged transaction: no staged snapshot found"))
+	})
+	It("writes the verity image of the new deployment", func() {
+		d.Verity = &deployment.VerityConfig{Size: 2048}
+		Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+		data, hash := d.GetVerityPartitions("a")
+		data.UUID = "usr-a-uuid"
+		hash.UUID = "usr-a-verity-uuid"
+
+		runner.SideEffect = func(cmd string, args ...string) ([]byte, error) {
+			switch cmd {
+			case "lsblk":
+				return []byte(lsblkVerityJson), nil
+			case "veritysetup":
+				if args[0] == "format" {
+					return []byte("UUID:\t\t0000\nRoot hash:\t\tabcdef\n"), nil
+				}
+			}
+			return []byte{}, nil
+		}
+		b := &cmdlineBootloader{None: bootloader.NewNone(s)}
+		u = upgrade.New(
+			context.Background(), s, upgrade.WithTransaction(t), upgrade.WithBootloader(b),
+			upgrade.WithBootManager(firmware.NewEfiBootManager(s)),
+		)
+
+		Expect(u.Upgrade(d)).To(Succeed())
+		Expect(d.Verity.Slot).To(Equal("a"))
+		Expect(b.cmdline).To(ContainSubstring(
+			"usrhash=abcdef systemd.verity_usr_data=PARTUUID=usr-a-uuid systemd.verity_usr_hash=PARTUUID=usr-a-verity-uuid",
+		))
+		Expect(runner.MatchMilestones([][]string{
+			{"mksquashfs", "/snapshot/path/usr", "/dev/device2"},
+			{"veritysetup", "format", "/dev/device2", "/dev/device3"},
+			{"veritysetup", "verify", "/dev/device2", "/dev/device3", "abcdef"},
+		})).To(Succeed())
+	})
+	It("fails if the verity partitions of the next slot are not found", func() {
+		d.Verity = &deployment.VerityConfig{Size: 2048, Slot: "a"}
+		Expect(d.Sanitize(s, deployment.CheckDiskDevice)).To(Succeed())
+		runner.SideEffect = func(cmd string, args ...string) ([]byte, error) {
+			if cmd == "lsblk" {
+				return []byte(lsblkVerityJson), nil
+			}
+			return []byte{}, nil
+		}
+
+		err := u.Upgrade(d)
+		Expect(err).To(MatchError("writing verity image: verity partitions of slot 'b' not found"))
+		Expect(t.RollbackCalled()).To(BeTrue())
+	})
 	It("creates an efi boot entry", func() {
 		efiBootMgrCalled := false
 		disk := "/dev/sdz"
@@ -0,0 +1,72 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package verity
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/suse/elemental/v3/pkg/filesystem"
+	"github.com/suse/elemental/v3/pkg/sys"
+)
+
+const rootHashPrefix = "Root hash:"
+
+// WriteImage writes a read-only squashfs image of the given tree to the data device, excluding
+// the given paths relative to the tree, and its dm-verity hash tree to the hash device. Returns
+// the root hash of the hash tree.
+func WriteImage(ctx context.Context, s *sys.System, tree, dataDev, hashDev string, excludes ...string) (string, error) {
+	s.Logger().Info("Writing verity image of '%s' to '%s'", tree, dataDev)
+	opts := append(filesystem.DefaultSquashfsCompressionOptions(), "-noappend")
+	opts = append(opts, filesystem.SquashfsExcludeOptions(excludes...)...)
+	err := filesystem.CreateSquashFS(ctx, s, tree, dataDev, opts)
+	if err != nil {
+		return "", fmt.Errorf("creating image: %w", err)
+	}
+	return Format(s, dataDev, hashDev)
+}
+
+// Format computes the dm-verity hash tree of the data device, writes it to the hash device
+// and returns its root hash
+func Format(s *sys.System, dataDev, hashDev string) (string, error) {
+	out, err := s.Runner().Run("veritysetup", "format", dataDev, hashDev)
+	if err != nil {
+		return "", fmt.Errorf("formatting verity hash device '%s': %w", hashDev, err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if hash, ok := strings.CutPrefix(line, rootHashPrefix); ok {
+			return strings.TrimSpace(hash), nil
+		}
+	}
+	return "", fmt.Errorf("no root hash found in veritysetup output")
+}
+
+// Verify checks the data device matches the given root hash of the hash device
+func Verify(s *sys.System, dataDev, hashDev, rootHash string) error {
+	_, err := s.Runner().Run("veritysetup", "verify", dataDev, hashDev, rootHash)
+	if err != nil {
+		return fmt.Errorf("verifying '%s': %w", dataDev, err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright © 2025 SUSE LLC
+SPDX-License-Identifier: Apache-2.0
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package verity_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/suse/elemental/v3/pkg/log"
+	"github.com/suse/elemental/v3/pkg/sys"
+	sysmock "github.com/suse/elemental/v3/pkg/sys/mock"
+	"github.com/suse/elemental/v3/pkg/verity"
+)
+
+func TestVeritySuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Verity test suite")
+}
+
+const veritysetupFormat = `VERITY header information for /dev/sda4
+UUID:            	6d3b4a8e-5a51-4f4e-8d9a-0b4bc4fbd0ac
+Hash type:       	1
+Data blocks:     	262144
+Data block size: 	4096
+Hash block size: 	4096
+Hash algorithm:  	sha256
+Salt:            	fa2b0f3c6d9a
+Root hash:      	4392712ba01368efdf14b05c76f9e4df0d53664630b5d48632ed17a137f39076
+`
+
+var _ = Describe("Verity", Label("verity"), func() {
+	var runner *sysmock.Runner
+	var s *sys.System
+
+	BeforeEach(func() {
+		var err error
+		runner = sysmock.NewRunner()
+		s, err = sys.NewSystem(sys.WithRunner(runner), sys.WithLogger(log.New(log.WithDiscardAll())))
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("writes a verity protected image of the given tree", func() {
+		runner.SideEffect = func(cmd string, args ...string) ([]byte, error) {
+			if cmd == "veritysetup" {
+				return []byte(veritysetupFormat), nil
+			}
+			return nil, nil
+		}
+		rootHash, err := verity.WriteImage(context.Background(), s, "/snapshot/usr", "/dev/sda3", "/dev/sda4", "local")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rootHash).To(Equal("4392712ba01368efdf14b05c76f9e4df0d53664630b5d48632ed17a137f39076"))
+		Expect(runner.CmdsMatch([][]string{
+			{"mksquashfs", "/snapshot/usr", "/dev/sda3", "-b", "1024k", "-noappend", "-wildcards", "-e", "local"},
+			{"veritysetup", "format", "/dev/sda3", "/dev/sda4"},
+		})).To(Succeed())
+	})
+	It("fails if there is no root hash in veritysetup output", func() {
+		_, err := verity.Format(s, "/dev/sda3", "/dev/sda4")
+		Expect(err).To(MatchError("no root hash found in veritysetup output"))
+	})
+	It("detects a tampered image", func() {
+		runner.SideEffect = func(cmd string, args ...string) ([]byte, error) {
+			return nil, fmt.Errorf("verification failed")
+		}
+		err := verity.Verify(s, "/dev/sda3", "/dev/sda4", "1234")
+		Expect(err).To(MatchError("verifying '/dev/sda3': verification failed"))
+	})
+})